@@ -0,0 +1,160 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/WarisLi/Golang-mini-project/internal/config"
+	"github.com/WarisLi/Golang-mini-project/internal/core/models"
+	"github.com/WarisLi/Golang-mini-project/internal/core/ports"
+)
+
+func apiKeyCommand(args []string) error {
+	command, args, err := subcommand("api-key", args)
+	if err != nil {
+		return err
+	}
+
+	switch command {
+	case "create":
+		return createAPIKey(args)
+	case "list":
+		return listAPIKeys(args)
+	case "rotate":
+		return rotateAPIKey(args)
+	case "revoke":
+		return revokeAPIKey(args)
+	}
+
+	return fmt.Errorf("unknown api-key command %q", command)
+}
+
+// withAPIKeyService calls fn with the API key service, the changes are audited as
+// made by models.ActorCommandLine.
+func withAPIKeyService(fn func(apiKeyService ports.APIKeyService) error) error {
+	repos, err := config.SetupRepositories()
+	if err != nil {
+		return err
+	}
+	apiKeyConfig, err := config.LoadAPIKeyConfig()
+	if err != nil {
+		return err
+	}
+	eventProducer, closeProducer, err := config.SetupEventProducer(outboxErrorHandler(repos.Outbox))
+	if err != nil {
+		return err
+	}
+	defer closeProducer()
+
+	return fn(ports.NewAPIKeyService(repos.APIKey, repos.User, eventProducer, repos.Outbox, *apiKeyConfig))
+}
+
+func createAPIKey(args []string) error {
+	flags := flag.NewFlagSet("api-key create", flag.ExitOnError)
+	username := flags.String("username", "", "user or service account of the key")
+	name := flags.String("name", "", "name of the key, e.g. the client using it")
+	scopes := flags.String("scopes", "", "comma separated scopes: "+strings.Join(models.APIKeyScopes, ", "))
+	expiresIn := flags.Duration("expires-in", 0, "lifetime of the key, API_KEY_MAX_TTL when not set")
+	flags.Parse(args)
+
+	if *username == "" || *name == "" || *scopes == "" {
+		return errors.New("username, name and scopes are required")
+	}
+	input := models.APIKeyInput{Name: *name, Scopes: strings.Split(*scopes, ",")}
+	if *expiresIn > 0 {
+		expiresAt := time.Now().Add(*expiresIn)
+		input.ExpiresAt = &expiresAt
+	}
+
+	return withAPIKeyService(func(apiKeyService ports.APIKeyService) error {
+		key, err := apiKeyService.CreateAPIKey(models.ActorCommandLine, *username, input)
+		if err != nil {
+			return err
+		}
+		printAPIKeyCreated(key)
+		return nil
+	})
+}
+
+func listAPIKeys(args []string) error {
+	flags := flag.NewFlagSet("api-key list", flag.ExitOnError)
+	username := flags.String("username", "", "user or service account of the keys")
+	flags.Parse(args)
+
+	if *username == "" {
+		return errors.New("username is required")
+	}
+
+	return withAPIKeyService(func(apiKeyService ports.APIKeyService) error {
+		keys, err := apiKeyService.ListAPIKeys(*username)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			status := "active"
+			switch {
+			case key.RevokedAt != nil:
+				status = "revoked"
+			case !time.Now().Before(key.ExpiresAt):
+				status = "expired"
+			}
+			lastUsed := "never"
+			if key.LastUsedAt != nil {
+				lastUsed = key.LastUsedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%d\t%s\t%s\t%s\t%s\texpires %s\tlast used %s\n", key.ID, key.KeyID, key.Name,
+				strings.Join(key.Scopes, ","), status, key.ExpiresAt.Format(time.RFC3339), lastUsed)
+		}
+		return nil
+	})
+}
+
+func rotateAPIKey(args []string) error {
+	flags := flag.NewFlagSet("api-key rotate", flag.ExitOnError)
+	username := flags.String("username", "", "user or service account of the key")
+	id := flags.Uint("id", 0, "ID of the key")
+	flags.Parse(args)
+
+	if *username == "" || *id == 0 {
+		return errors.New("username and id are required")
+	}
+
+	return withAPIKeyService(func(apiKeyService ports.APIKeyService) error {
+		key, err := apiKeyService.RotateAPIKey(models.ActorCommandLine, *username, *id)
+		if err != nil {
+			return err
+		}
+		printAPIKeyCreated(key)
+		return nil
+	})
+}
+
+func revokeAPIKey(args []string) error {
+	flags := flag.NewFlagSet("api-key revoke", flag.ExitOnError)
+	username := flags.String("username", "", "user or service account of the key")
+	id := flags.Uint("id", 0, "ID of the key")
+	flags.Parse(args)
+
+	if *username == "" || *id == 0 {
+		return errors.New("username and id are required")
+	}
+
+	err := withAPIKeyService(func(apiKeyService ports.APIKeyService) error {
+		return apiKeyService.RevokeAPIKey(models.ActorCommandLine, *username, *id)
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("API key %d revoked\n", *id)
+	return nil
+}
+
+func printAPIKeyCreated(key *models.APIKeyCreated) {
+	fmt.Printf("API key %d created, expires %s\n", key.ID, key.ExpiresAt.Format(time.RFC3339))
+	fmt.Printf("%s\n", key.Key)
+	fmt.Printf("The key is not shown again, store it now\n")
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"flag"
+
+	"github.com/WarisLi/Golang-mini-project/internal/config"
+	"github.com/WarisLi/Golang-mini-project/internal/core/ports"
+)
+
+func migrate(args []string) error {
+	flags := flag.NewFlagSet("migrate", flag.ExitOnError)
+	flags.Parse(args)
+
+	repos, err := config.SetupRepositories()
+	if err != nil {
+		return err
+	}
+	return repos.Migrate()
+}
+
+func seed(args []string) error {
+	flags := flag.NewFlagSet("seed", flag.ExitOnError)
+	reset := flags.Bool("reset", false, "delete all existing data before seeding")
+	flags.Parse(args)
+
+	repos, err := config.SetupRepositories()
+	if err != nil {
+		return err
+	}
+	if err := repos.Migrate(); err != nil {
+		return err
+	}
+	userConfig, err := config.LoadUserConfig()
+	if err != nil {
+		return err
+	}
+	notifier, err := config.SetupNotifier()
+	if err != nil {
+		return err
+	}
+	tokenConfig, err := config.LoadTokenConfig()
+	if err != nil {
+		return err
+	}
+	if *reset {
+		repos.Reset()
+	}
+	tokenService := ports.NewTokenService(repos.SigningKey, tokenConfig.Options)
+	repos.Seed(ports.NewUserService(repos.User, repos.PasswordReset, notifier, tokenService, *userConfig))
+
+	return nil
+}
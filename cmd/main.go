@@ -1,21 +1,38 @@
 package main
 
 import (
+	"fmt"
 	"os"
 
 	_ "github.com/WarisLi/Golang-mini-project/docs"
-	"github.com/WarisLi/Golang-mini-project/internal/adapters/database"
-	"github.com/WarisLi/Golang-mini-project/internal/adapters/http"
-	"github.com/WarisLi/Golang-mini-project/internal/adapters/producer"
-	"github.com/WarisLi/Golang-mini-project/internal/config"
-	"github.com/WarisLi/Golang-mini-project/internal/core/ports"
-	"github.com/gofiber/fiber/v2"
 	"github.com/joho/godotenv"
 
 	_ "github.com/lib/pq"
-	"gopkg.in/Shopify/sarama.v1"
 )
 
+const usage = `Usage: main <command> [arguments]
+
+Commands:
+  serve                 start the HTTP server (default)
+  migrate               migrate the database schema
+  seed                  insert initial data
+  user create           create a user
+  user disable          disable a user
+  user enable           enable a user
+  user set-role         change the role of a user
+  user delete           delete a user
+  user reset-2fa        remove the authenticator of a user
+  api-key create        create an API key of a user or service account
+  api-key list          list the API keys of a user
+  api-key rotate        replace an API key by a new one
+  api-key revoke        revoke an API key
+  product import        import products from a CSV or JSON file
+  product export        export products to a CSV or JSON file
+  outbox replay         publish events kept in the outbox
+
+Run "main <command> -h" for the arguments of a command.
+`
+
 // @title           Swagger API
 // @version         1.0
 // @description     This is a sample server for a Product API.
@@ -33,28 +50,47 @@ func main() {
 		panic(err)
 	}
 
-	db := config.SetupDB()
-
-	servers := []string{os.Getenv("KAFKA_SERVERS")}
-	saramaProducer, err := sarama.NewSyncProducer(servers, nil)
-	if err != nil {
-		panic(err)
+	if err := run(os.Args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
-	defer saramaProducer.Close()
-
-	productRepo := database.NewGormProductRepository(db)
-	userRepo := database.NewGormUserRepository(db)
-
-	eventProducer := producer.NewEventProducer(saramaProducer)
+}
 
-	productService := ports.NewProductService(productRepo, eventProducer)
-	productHandler := http.NewHttpProductHandler(productService)
+func run(args []string) error {
+	if len(args) == 0 {
+		return serve(args)
+	}
 
-	userService := ports.NewUserService(userRepo)
-	userHandler := http.NewHttpUserHandler(userService)
+	command, args := args[0], args[1:]
+	switch command {
+	case "serve":
+		return serve(args)
+	case "migrate":
+		return migrate(args)
+	case "seed":
+		return seed(args)
+	case "user":
+		return userCommand(args)
+	case "product":
+		return productCommand(args)
+	case "outbox":
+		return outboxCommand(args)
+	case "api-key":
+		return apiKeyCommand(args)
+	case "help", "-h", "--help":
+		fmt.Print(usage)
+		return nil
+	}
 
-	app := fiber.New()
-	http.SetupRoutes(app, productHandler, userHandler)
+	fmt.Fprint(os.Stderr, usage)
+	return fmt.Errorf("unknown command %q", command)
+}
 
-	app.Listen(":8080")
+// subcommand splits the sub command of a command group from its arguments.
+func subcommand(group string, args []string) (string, []string, error) {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		return "", nil, fmt.Errorf("missing %s command", group)
+	}
+	return args[0], args[1:], nil
 }
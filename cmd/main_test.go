@@ -0,0 +1,129 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupCommandEnv runs the commands with the memory repositories and the channel producer.
+func setupCommandEnv(t *testing.T) {
+	t.Setenv("DB_DRIVER", "memory")
+	t.Setenv("PRODUCT_CACHE", "none")
+	t.Setenv("EVENT_PRODUCER", "channel")
+}
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		description string
+		args        []string
+		expectError string
+	}{
+		{description: "Help", args: []string{"help"}},
+		{description: "Unknown command", args: []string{"deploy"}, expectError: `unknown command "deploy"`},
+		{description: "Missing user command", args: []string{"user"}, expectError: "missing user command"},
+		{description: "Unknown user command", args: []string{"user", "rename"}, expectError: `unknown user command "rename"`},
+		{description: "Missing product command", args: []string{"product"}, expectError: "missing product command"},
+		{description: "Unknown product command", args: []string{"product", "sync"}, expectError: `unknown product command "sync"`},
+		{description: "Missing outbox command", args: []string{"outbox"}, expectError: "missing outbox command"},
+		{description: "Unknown outbox command", args: []string{"outbox", "purge"}, expectError: `unknown outbox command "purge"`},
+		{description: "Missing api-key command", args: []string{"api-key"}, expectError: "missing api-key command"},
+		{description: "Unknown api-key command", args: []string{"api-key", "show"}, expectError: `unknown api-key command "show"`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			err := run(test.args)
+			if test.expectError == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), test.expectError)
+		})
+	}
+}
+
+func TestImportProductsCommand(t *testing.T) {
+	setupCommandEnv(t)
+	dir := t.TempDir()
+	writeFile := func(name string, content string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+		return path
+	}
+
+	tests := []struct {
+		description string
+		args        []string
+		expectError string
+	}{
+		{
+			description: "CSV",
+			args:        []string{"-file", writeFile("products.csv", "name,quantity,category,sku,description\nBook A,10,Books,BK-0001,Hardcover\nBook B,0,,,\n")},
+		},
+		{
+			description: "JSON",
+			args:        []string{"-file", writeFile("products.json", `[{"name":"Book A","quantity":10,"sku":"BK-0001"}]`)},
+		},
+		{
+			description: "Format flag",
+			args:        []string{"-file", writeFile("products.txt", "Book A,10,Books,BK-0001,Hardcover\n"), "-format", "CSV"},
+		},
+		{
+			description: "Missing file flag",
+			expectError: "file is required",
+		},
+		{
+			description: "Unsupported format",
+			args:        []string{"-file", writeFile("products.xml", "<products/>")},
+			expectError: `unsupported format "xml"`,
+		},
+		{
+			description: "Invalid product",
+			args:        []string{"-file", writeFile("invalid.json", `[{"name":"Book A","quantity":1},{"name":"","quantity":1}]`)},
+			expectError: "product 2:",
+		},
+		{
+			description: "Negative quantity",
+			args:        []string{"-file", writeFile("negative.csv", "name,quantity\nBook A,-1\n")},
+			expectError: "product 1:",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			err := run(append([]string{"product", "import"}, test.args...))
+			if test.expectError == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), test.expectError)
+		})
+	}
+}
+
+func TestExportProductsCommand(t *testing.T) {
+	setupCommandEnv(t)
+	dir := t.TempDir()
+
+	// The memory repositories of the command start empty
+	csvFile := filepath.Join(dir, "products.csv")
+	require.NoError(t, run([]string{"product", "export", "-file", csvFile}))
+	content, err := os.ReadFile(csvFile)
+	require.NoError(t, err)
+	assert.Equal(t, "name,quantity,category,sku,description\n", string(content))
+
+	jsonFile := filepath.Join(dir, "products.json")
+	require.NoError(t, run([]string{"product", "export", "-file", jsonFile}))
+	content, err = os.ReadFile(jsonFile)
+	require.NoError(t, err)
+	assert.JSONEq(t, `[]`, string(content))
+
+	err = run([]string{"product", "export", "-file", filepath.Join(dir, "products.xml")})
+	assert.ErrorContains(t, err, `unsupported format "xml"`)
+}
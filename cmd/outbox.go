@@ -0,0 +1,53 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/WarisLi/Golang-mini-project/internal/config"
+	"github.com/WarisLi/Golang-mini-project/internal/core/ports"
+)
+
+func outboxCommand(args []string) error {
+	command, args, err := subcommand("outbox", args)
+	if err != nil {
+		return err
+	}
+
+	switch command {
+	case "replay":
+		return replayOutbox(args)
+	}
+
+	return fmt.Errorf("unknown outbox command %q", command)
+}
+
+func replayOutbox(args []string) error {
+	flags := flag.NewFlagSet("outbox replay", flag.ExitOnError)
+	flags.Parse(args)
+
+	repos, err := config.SetupRepositories()
+	if err != nil {
+		return err
+	}
+	outboxRepo := repos.Outbox
+
+	eventProducer, closeProducer, err := config.SetupEventProducer(outboxErrorHandler(outboxRepo))
+	if err != nil {
+		return err
+	}
+	defer closeProducer()
+
+	outboxService := ports.NewOutboxService(
+		outboxRepo,
+		eventProducer,
+	)
+
+	published, err := outboxService.Replay()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%d outbox events published\n", published)
+	return nil
+}
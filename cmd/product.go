@@ -0,0 +1,257 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/WarisLi/Golang-mini-project/internal/adapters/producer"
+	"github.com/WarisLi/Golang-mini-project/internal/adapters/webhook"
+	"github.com/WarisLi/Golang-mini-project/internal/config"
+	"github.com/WarisLi/Golang-mini-project/internal/core/models"
+	"github.com/WarisLi/Golang-mini-project/internal/core/ports"
+)
+
+func productCommand(args []string) error {
+	command, args, err := subcommand("product", args)
+	if err != nil {
+		return err
+	}
+
+	switch command {
+	case "import":
+		return importProducts(args)
+	case "export":
+		return exportProducts(args)
+	}
+
+	return fmt.Errorf("unknown product command %q", command)
+}
+
+func withProductService(fn func(productService ports.ProductService) error) error {
+	repos, err := config.SetupRepositories()
+	if err != nil {
+		return err
+	}
+	closeCache, err := config.SetupProductCache(repos)
+	if err != nil {
+		return err
+	}
+	defer closeCache()
+	outboxRepo := repos.Outbox
+
+	webhookConfig, err := config.LoadWebhookConfig()
+	if err != nil {
+		return err
+	}
+	productConfig, err := config.LoadProductConfig()
+	if err != nil {
+		return err
+	}
+
+	eventProducer, closeProducer, err := config.SetupEventProducer(outboxErrorHandler(outboxRepo))
+	if err != nil {
+		return err
+	}
+	defer closeProducer()
+
+	webhookService := ports.NewWebhookService(repos.Webhook,
+		webhook.NewHttpWebhookSender(webhookConfig.Timeout), webhookConfig.Options)
+	defer webhookService.Wait()
+
+	productService := ports.NewProductService(
+		repos.Product,
+		repos.UnitOfWork,
+		producer.NewMultiProducer(eventProducer, webhookService),
+		outboxRepo,
+		*productConfig,
+	)
+	return fn(productService)
+}
+
+// fileFormat returns the format flag, or guesses it from the file extension.
+func fileFormat(format string, file string) (string, error) {
+	if format == "" {
+		format = strings.TrimPrefix(filepath.Ext(file), ".")
+	}
+	format = strings.ToLower(format)
+	if format != "csv" && format != "json" {
+		return "", fmt.Errorf("unsupported format %q, use csv or json", format)
+	}
+	return format, nil
+}
+
+func importProducts(args []string) error {
+	flags := flag.NewFlagSet("product import", flag.ExitOnError)
+	file := flags.String("file", "", "file to import")
+	format := flags.String("format", "", "csv or json (default from file extension)")
+	flags.Parse(args)
+
+	if *file == "" {
+		return errors.New("file is required")
+	}
+	fileFormat, err := fileFormat(*format, *file)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(*file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var productFields []models.ProductFields
+	if fileFormat == "json" {
+		err = json.NewDecoder(f).Decode(&productFields)
+	} else {
+		productFields, err = readProductsCSV(f)
+	}
+	if err != nil {
+		return err
+	}
+
+	return withProductService(func(productService ports.ProductService) error {
+		err := productService.ImportProducts(productFields)
+		var operationErr *ports.BatchOperationError
+		if errors.As(err, &operationErr) {
+			return fmt.Errorf("product %d: %w", operationErr.Index+1, operationErr.Err)
+		}
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("%d products imported\n", len(productFields))
+		return nil
+	})
+}
+
+func exportProducts(args []string) error {
+	flags := flag.NewFlagSet("product export", flag.ExitOnError)
+	file := flags.String("file", "", "file to export to (default stdout)")
+	format := flags.String("format", "", "csv or json (default from file extension)")
+	flags.Parse(args)
+
+	if *file == "" && *format == "" {
+		*format = "json"
+	}
+	fileFormat, err := fileFormat(*format, *file)
+	if err != nil {
+		return err
+	}
+
+	return withProductService(func(productService ports.ProductService) error {
+		products, err := productService.GetProducts()
+		if err != nil {
+			return err
+		}
+
+		var w io.Writer = os.Stdout
+		if *file != "" {
+			f, err := os.Create(*file)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			w = f
+		}
+
+		if fileFormat == "json" {
+			return writeProductsJSON(w, products)
+		}
+		return writeProductsCSV(w, products)
+	})
+}
+
+var productCSVHeader = []string{"name", "quantity", "category", "sku", "description"}
+
+// readProductsCSV reads the products of a CSV file. The columns are named by the
+// header when the file starts with one, otherwise they are productCSVHeader.
+func readProductsCSV(r io.Reader) ([]models.ProductFields, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	columns := productCSVHeader
+	line := 1
+	if slices.ContainsFunc(productCSVHeader, func(column string) bool {
+		return strings.EqualFold(strings.TrimSpace(records[0][0]), column)
+	}) {
+		columns = records[0]
+		records = records[1:]
+		line++
+	}
+
+	productFields := make([]models.ProductFields, 0, len(records))
+	for i, record := range records {
+		if len(record) != len(columns) {
+			return nil, fmt.Errorf("line %d: expected %d columns", line+i, len(columns))
+		}
+
+		var fields models.ProductFields
+		for j, column := range columns {
+			value := strings.TrimSpace(record[j])
+			switch strings.ToLower(strings.TrimSpace(column)) {
+			case "name":
+				fields.Name = value
+			case "quantity":
+				if fields.Quantity, err = strconv.Atoi(value); err != nil {
+					return nil, fmt.Errorf("line %d: %w", line+i, err)
+				}
+			case "category":
+				fields.Category = value
+			case "sku":
+				fields.SKU = value
+			case "description":
+				fields.Description = value
+			default:
+				return nil, fmt.Errorf("line %d: unknown column %q", line+i, column)
+			}
+		}
+		productFields = append(productFields, fields)
+	}
+	return productFields, nil
+}
+
+func writeProductsCSV(w io.Writer, products []models.Product) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(productCSVHeader); err != nil {
+		return err
+	}
+	for _, product := range products {
+		record := []string{product.Name, strconv.Itoa(product.Quantity), product.Category, product.SKU, product.Description}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func writeProductsJSON(w io.Writer, products []models.Product) error {
+	exported := make([]models.ProductFields, 0, len(products))
+	for _, product := range products {
+		exported = append(exported, models.ProductFields{
+			Name:        product.Name,
+			Quantity:    product.Quantity,
+			Category:    product.Category,
+			SKU:         product.SKU,
+			Description: product.Description,
+		})
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(exported)
+}
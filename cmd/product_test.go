@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/WarisLi/Golang-mini-project/internal/core/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var exportedProducts = []models.Product{
+	{Name: "Book A", Quantity: 10, Category: "Books", SKU: "BK-0001", Description: "Hardcover, 320 pages"},
+	{Name: "Pen, blue", Quantity: 0, Category: "Stationery", SKU: "PN-0001", Description: `Says "hello"`},
+}
+
+var importedFields = []models.ProductFields{
+	{Name: "Book A", Quantity: 10, Category: "Books", SKU: "BK-0001", Description: "Hardcover, 320 pages"},
+	{Name: "Pen, blue", Quantity: 0, Category: "Stationery", SKU: "PN-0001", Description: `Says "hello"`},
+}
+
+func TestProductsCSVRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, writeProductsCSV(&buf, exportedProducts))
+	assert.True(t, strings.HasPrefix(buf.String(), "name,quantity,category,sku,description\n"))
+
+	productFields, err := readProductsCSV(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, importedFields, productFields)
+}
+
+func TestProductsJSONRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, writeProductsJSON(&buf, exportedProducts))
+
+	var productFields []models.ProductFields
+	require.NoError(t, json.NewDecoder(&buf).Decode(&productFields))
+	assert.Equal(t, importedFields, productFields)
+}
+
+func TestReadProductsCSV(t *testing.T) {
+	tests := []struct {
+		description string
+		csv         string
+		expect      []models.ProductFields
+		expectError string
+	}{
+		{
+			description: "Without header",
+			csv:         "Book A,10,Books,BK-0001,Hardcover\n",
+			expect:      []models.ProductFields{{Name: "Book A", Quantity: 10, Category: "Books", SKU: "BK-0001", Description: "Hardcover"}},
+		},
+		{
+			description: "Columns named by the header",
+			csv:         "SKU,Name,Quantity\nBK-0001, Book A ,0\n",
+			expect:      []models.ProductFields{{Name: "Book A", Quantity: 0, SKU: "BK-0001"}},
+		},
+		{
+			description: "Empty file",
+			csv:         "",
+		},
+		{
+			description: "Unknown column",
+			csv:         "name,quantity,price\nBook A,10,5\n",
+			expectError: `line 2: unknown column "price"`,
+		},
+		{
+			description: "Invalid quantity",
+			csv:         "name,quantity\nBook A,ten\n",
+			expectError: "line 2:",
+		},
+		{
+			description: "Missing columns",
+			csv:         "Book A,10\n",
+			expectError: "line 1: expected 5 columns",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			productFields, err := readProductsCSV(strings.NewReader(test.csv))
+			if test.expectError != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), test.expectError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expect, productFields)
+		})
+	}
+}
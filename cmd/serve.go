@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"time"
+
+	"github.com/WarisLi/Golang-mini-project/internal/adapters/consumer"
+	"github.com/WarisLi/Golang-mini-project/internal/adapters/http"
+	"github.com/WarisLi/Golang-mini-project/internal/adapters/http/middleware"
+	"github.com/WarisLi/Golang-mini-project/internal/adapters/producer"
+	"github.com/WarisLi/Golang-mini-project/internal/adapters/webhook"
+	"github.com/WarisLi/Golang-mini-project/internal/config"
+	"github.com/WarisLi/Golang-mini-project/internal/core/models"
+	"github.com/WarisLi/Golang-mini-project/internal/core/ports"
+	"github.com/gofiber/fiber/v2"
+	"gopkg.in/Shopify/sarama.v1"
+)
+
+func serve(args []string) error {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := flags.String("addr", ":8080", "address to listen on")
+	reset := flags.Bool("reset", false, "reset and seed the database before starting")
+	flags.Parse(args)
+
+	repos, err := config.SetupRepositories()
+	if err != nil {
+		return err
+	}
+	if err := repos.Migrate(); err != nil {
+		return err
+	}
+	userConfig, err := config.LoadUserConfig()
+	if err != nil {
+		return err
+	}
+	notifier, err := config.SetupNotifier()
+	if err != nil {
+		return err
+	}
+	tokenConfig, err := config.LoadTokenConfig()
+	if err != nil {
+		return err
+	}
+	cookieConfig, err := config.LoadCookieConfig(tokenConfig.Options.TTL)
+	if err != nil {
+		return err
+	}
+	tokenService := ports.NewTokenService(repos.SigningKey, tokenConfig.Options)
+	userService := ports.NewUserService(repos.User, repos.PasswordReset, notifier, tokenService, *userConfig)
+	defer userService.Wait()
+	// The memory driver starts empty, so it is always seeded
+	if *reset || !repos.Persistent {
+		repos.Reset()
+		repos.Seed(userService)
+	}
+	closeCache, err := config.SetupProductCache(repos)
+	if err != nil {
+		return err
+	}
+	defer closeCache()
+
+	deadLetterConfig, err := config.LoadDeadLetterConfig()
+	if err != nil {
+		return err
+	}
+	consumerConfig, err := config.LoadKafkaConsumerConfig()
+	if err != nil {
+		return err
+	}
+	webhookConfig, err := config.LoadWebhookConfig()
+	if err != nil {
+		return err
+	}
+	streamConfig, err := config.LoadProductStreamConfig()
+	if err != nil {
+		return err
+	}
+	idempotencyConfig, err := config.LoadIdempotencyConfig()
+	if err != nil {
+		return err
+	}
+	productConfig, err := config.LoadProductConfig()
+	if err != nil {
+		return err
+	}
+	apiKeyConfig, err := config.LoadAPIKeyConfig()
+	if err != nil {
+		return err
+	}
+	oidcConfig, err := config.SetupOIDC()
+	if err != nil {
+		return err
+	}
+	rateLimits, closeRateLimits, err := config.SetupRateLimits()
+	if err != nil {
+		return err
+	}
+	defer closeRateLimits()
+
+	productRepo := repos.Product
+	outboxRepo := repos.Outbox
+
+	eventProducer, closeProducer, err := config.SetupEventProducer(outboxErrorHandler(outboxRepo))
+	if err != nil {
+		return err
+	}
+	defer closeProducer()
+
+	webhookService := ports.NewWebhookService(repos.Webhook,
+		webhook.NewHttpWebhookSender(webhookConfig.Timeout), webhookConfig.Options)
+	defer webhookService.Wait()
+	webhookHandler := http.NewHttpWebhookHandler(webhookService)
+
+	productStreamService := ports.NewProductStreamService(*streamConfig)
+
+	// Product changes are published to the event producer, delivered to webhooks and streamed to clients
+	productEventProducer := producer.NewMultiProducer(eventProducer, webhookService, productStreamService)
+
+	productService := ports.NewProductService(productRepo, repos.UnitOfWork, productEventProducer, outboxRepo, *productConfig)
+	productHandler := http.NewHttpProductHandler(productService)
+
+	productSearchService := ports.NewProductSearchService(repos.ProductSearcher)
+	productSearchHandler := http.NewHttpProductSearchHandler(productSearchService)
+
+	userHandler := http.NewHttpUserHandler(userService, *cookieConfig)
+	tokenHandler := http.NewHttpTokenHandler(tokenService)
+	// Logins with the OpenID Connect providers, the provisioned users are audited
+	oidcService := ports.NewOIDCService(repos.User, repos.OIDCLogin, tokenService, eventProducer, outboxRepo,
+		oidcConfig.Providers, oidcConfig.Options)
+	oidcHandler := http.NewHttpOIDCHandler(oidcService, *cookieConfig, oidcConfig.AfterLoginURL)
+	// User changes of the administrators are published as audit events
+	userAdminService := ports.NewUserAdminService(repos.User, repos.UnitOfWork, eventProducer, outboxRepo)
+	userAdminHandler := http.NewHttpUserAdminHandler(userAdminService)
+
+	apiKeyService := ports.NewAPIKeyService(repos.APIKey, repos.User, eventProducer, outboxRepo, *apiKeyConfig)
+	apiKeyHandler := http.NewHttpAPIKeyHandler(apiKeyService)
+	// The streams are closed once the session of their client is invalidated
+	productStreamHandler := http.NewHttpProductStreamHandler(productStreamService, userService, apiKeyService, streamConfig.SessionCheckInterval)
+
+	outboxService := ports.NewOutboxService(outboxRepo, eventProducer)
+	deadLetterHandler := http.NewHttpDeadLetterHandler(outboxService)
+
+	idempotencyService := ports.NewIdempotencyService(repos.Idempotency, *idempotencyConfig)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	monitor := ports.NewDeadLetterMonitor(outboxService, deadLetterConfig.AlertThreshold, deadLetterAlert(deadLetterConfig))
+	go monitor.Run(ctx, deadLetterConfig.CheckInterval)
+	// The first key is created before the JWKS is served
+	if err := tokenService.RotateKeys(); err != nil {
+		return err
+	}
+	go tokenService.RunKeyRotation(ctx, tokenConfig.RotationCheckInterval)
+	go webhookService.RunRetries(ctx, webhookConfig.RetryInterval)
+	go idempotencyService.RunSweep(ctx, idempotencyConfig.SweepInterval)
+
+	if consumerConfig.Enabled {
+		group, err := sarama.NewConsumerGroup(consumerConfig.Servers, consumerConfig.Group, consumerConfig.Sarama)
+		if err != nil {
+			return err
+		}
+
+		stockService := ports.NewStockService(repos.UnitOfWork, productEventProducer, outboxRepo)
+		orderConsumer := consumer.NewOrderConsumer(group, stockService, outboxRepo, consumer.OrderConsumerOptions{
+			TopicPrefix:  consumerConfig.TopicPrefix,
+			RetryBackoff: consumerConfig.RetryBackoff,
+		})
+		go orderConsumer.Run(ctx)
+	}
+
+	app := fiber.New()
+	http.SetupRoutes(app, productHandler, productSearchHandler, userHandler, userAdminHandler, tokenHandler, oidcHandler, apiKeyHandler, deadLetterHandler, webhookHandler,
+		productStreamHandler, middleware.Idempotency(idempotencyService), rateLimits.Login, rateLimits.API, middleware.APIKeyAuth(apiKeyService))
+
+	return app.Listen(*addr)
+}
+
+// outboxErrorHandler keeps the events an asynchronous producer failed to deliver in the outbox.
+func outboxErrorHandler(outboxRepo ports.OutboxRepository) producer.ErrorHandler {
+	return func(topic string, value []byte, err error) {
+		log.Printf("Produce to %s failed %s\n", topic, err)
+
+		outboxEvent := models.OutboxEvent{
+			Topic:     topic,
+			Payload:   value,
+			Attempts:  1,
+			LastError: err.Error(),
+		}
+		if _, err := outboxRepo.SaveEvent(outboxEvent); err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+// deadLetterAlert logs dead-letter alerts and posts them to the alert webhook when configured.
+func deadLetterAlert(deadLetterConfig *config.DeadLetterConfig) func(alert ports.DeadLetterAlert) {
+	var alertProducer producer.EventProducer
+	if deadLetterConfig.AlertWebhookURL != "" {
+		alertProducer = producer.NewHttpProducer(deadLetterConfig.AlertWebhookURL, 5*time.Second)
+	}
+
+	return func(alert ports.DeadLetterAlert) {
+		log.Printf("ALERT: %d dead letters pending (threshold %d)\n", alert.Pending, alert.Threshold)
+
+		if alertProducer != nil {
+			if err := alertProducer.Produce(alert); err != nil {
+				log.Printf("Dead letter alert failed %s\n", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/WarisLi/Golang-mini-project/internal/config"
+	"github.com/WarisLi/Golang-mini-project/internal/core/models"
+	"github.com/WarisLi/Golang-mini-project/internal/core/ports"
+)
+
+func userCommand(args []string) error {
+	command, args, err := subcommand("user", args)
+	if err != nil {
+		return err
+	}
+
+	switch command {
+	case "create":
+		return createUser(args)
+	case "disable":
+		return setUserDisabled("user disable", args, true)
+	case "enable":
+		return setUserDisabled("user enable", args, false)
+	case "set-role":
+		return setUserRole(args)
+	case "delete":
+		return deleteUser(args)
+	case "reset-2fa":
+		return resetTwoFactor(args)
+	}
+
+	return fmt.Errorf("unknown user command %q", command)
+}
+
+// withUserServices calls fn with the user services, the changes of userAdminService
+// are audited as made by models.ActorCommandLine.
+func withUserServices(fn func(userService ports.UserService, userAdminService ports.UserAdminService) error) error {
+	repos, err := config.SetupRepositories()
+	if err != nil {
+		return err
+	}
+	userConfig, err := config.LoadUserConfig()
+	if err != nil {
+		return err
+	}
+	notifier, err := config.SetupNotifier()
+	if err != nil {
+		return err
+	}
+	tokenConfig, err := config.LoadTokenConfig()
+	if err != nil {
+		return err
+	}
+	eventProducer, closeProducer, err := config.SetupEventProducer(outboxErrorHandler(repos.Outbox))
+	if err != nil {
+		return err
+	}
+	defer closeProducer()
+
+	tokenService := ports.NewTokenService(repos.SigningKey, tokenConfig.Options)
+	userService := ports.NewUserService(repos.User, repos.PasswordReset, notifier, tokenService, *userConfig)
+	userAdminService := ports.NewUserAdminService(repos.User, repos.UnitOfWork, eventProducer, repos.Outbox)
+	return fn(userService, userAdminService)
+}
+
+func createUser(args []string) error {
+	flags := flag.NewFlagSet("user create", flag.ExitOnError)
+	username := flags.String("username", "", "username of the new user")
+	password := flags.String("password", "", "password of the new user")
+	email := flags.String("email", "", "email of the new user, receives the password reset messages")
+	role := flags.String("role", models.RoleAdmin, "role of the new user (admin or user)")
+	serviceAccount := flags.Bool("service-account", false, "create a service account, without password, for API keys")
+	flags.Parse(args)
+
+	if *username == "" || (*password == "" && !*serviceAccount) {
+		return errors.New("username and password are required")
+	}
+
+	err := withUserServices(func(userService ports.UserService, userAdminService ports.UserAdminService) error {
+		if *serviceAccount {
+			return userAdminService.CreateServiceAccount(models.ActorCommandLine, models.ServiceAccount{Username: *username, Role: *role})
+		}
+		// The role is checked before the user is created, an unknown role creates no user
+		return userService.CreateUser(models.UsernamePassword{Username: *username, Password: *password, Email: *email}, *role)
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("User %s created\n", *username)
+	return nil
+}
+
+func setUserDisabled(name string, args []string, disabled bool) error {
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	username := flags.String("username", "", "username of the user")
+	flags.Parse(args)
+
+	if *username == "" {
+		return errors.New("username is required")
+	}
+
+	err := withUserServices(func(_ ports.UserService, userAdminService ports.UserAdminService) error {
+		return userAdminService.SetUserDisabled(models.ActorCommandLine, *username, disabled)
+	})
+	if err != nil {
+		return err
+	}
+
+	if disabled {
+		fmt.Printf("User %s disabled\n", *username)
+	} else {
+		fmt.Printf("User %s enabled\n", *username)
+	}
+	return nil
+}
+
+func setUserRole(args []string) error {
+	flags := flag.NewFlagSet("user set-role", flag.ExitOnError)
+	username := flags.String("username", "", "username of the user")
+	role := flags.String("role", "", "new role (admin or user)")
+	flags.Parse(args)
+
+	if *username == "" || *role == "" {
+		return errors.New("username and role are required")
+	}
+
+	err := withUserServices(func(_ ports.UserService, userAdminService ports.UserAdminService) error {
+		return userAdminService.SetUserRole(models.ActorCommandLine, *username, *role)
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("User %s role set to %s\n", *username, *role)
+	return nil
+}
+
+func deleteUser(args []string) error {
+	flags := flag.NewFlagSet("user delete", flag.ExitOnError)
+	username := flags.String("username", "", "username of the user")
+	flags.Parse(args)
+
+	if *username == "" {
+		return errors.New("username is required")
+	}
+
+	err := withUserServices(func(_ ports.UserService, userAdminService ports.UserAdminService) error {
+		return userAdminService.DeleteUser(models.ActorCommandLine, *username)
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("User %s deleted\n", *username)
+	return nil
+}
+
+func resetTwoFactor(args []string) error {
+	flags := flag.NewFlagSet("user reset-2fa", flag.ExitOnError)
+	username := flags.String("username", "", "username of the user")
+	flags.Parse(args)
+
+	if *username == "" {
+		return errors.New("username is required")
+	}
+
+	err := withUserServices(func(_ ports.UserService, userAdminService ports.UserAdminService) error {
+		return userAdminService.ResetTwoFactor(models.ActorCommandLine, *username)
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("User %s two-factor authentication reset\n", *username)
+	return nil
+}
@@ -0,0 +1,255 @@
+package cache
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/WarisLi/Golang-mini-project/internal/core/models"
+	"github.com/WarisLi/Golang-mini-project/internal/core/ports"
+)
+
+const (
+	productKeyPrefix  = "product:"
+	productListPrefix = "products:"
+	// productListVersionKey is part of the product list keys, changing it
+	// invalidates every cached list and page at once.
+	productListVersionKey = "products:version"
+)
+
+type ProductCacheOptions struct {
+	// TTL bounds how long a product or list change made outside of the
+	// decorated repositories, e.g. by another instance with an in-process cache, goes unnoticed.
+	TTL time.Duration
+}
+
+// ProductCache reads through and invalidates the cached products. Concurrent
+// misses of a key share one read of the repository so that an expired popular
+// key does not send a burst of queries to the database.
+type ProductCache struct {
+	cache   ports.Cache
+	options ProductCacheOptions
+
+	mu    sync.Mutex
+	calls map[string]*loadCall
+	// invalidations counts the invalidations, a value read while one happened
+	// may be stale and is not cached.
+	invalidations atomic.Uint64
+}
+
+type loadCall struct {
+	done  chan struct{}
+	value []byte
+	err   error
+}
+
+func NewProductCache(cache ports.Cache, options ProductCacheOptions) *ProductCache {
+	return &ProductCache{cache: cache, options: options, calls: map[string]*loadCall{}}
+}
+
+// load returns the cached value of key, or caches the JSON of what read returns.
+func (c *ProductCache) load(key string, read func() (interface{}, error), result interface{}) error {
+	value, err := c.cache.Get(key)
+	if err == nil {
+		if err := json.Unmarshal(value, result); err == nil {
+			return nil
+		}
+	} else if !errors.Is(err, ports.ErrCacheMiss) {
+		log.Printf("Product cache get failed %s\n", err)
+	}
+
+	c.mu.Lock()
+	call, loading := c.calls[key]
+	if !loading {
+		call = &loadCall{done: make(chan struct{})}
+		c.calls[key] = call
+	}
+	c.mu.Unlock()
+
+	if !loading {
+		call.value, call.err = c.read(key, read)
+
+		c.mu.Lock()
+		delete(c.calls, key)
+		c.mu.Unlock()
+		close(call.done)
+	}
+	<-call.done
+
+	if call.err != nil {
+		return call.err
+	}
+	return json.Unmarshal(call.value, result)
+}
+
+func (c *ProductCache) read(key string, read func() (interface{}, error)) ([]byte, error) {
+	invalidations := c.invalidations.Load()
+	result, err := read()
+	if err != nil {
+		return nil, err
+	}
+	value, err := json.Marshal(result)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.invalidations.Load() == invalidations {
+		if err := c.cache.Set(key, value, c.options.TTL); err != nil {
+			log.Printf("Product cache set failed %s\n", err)
+		}
+	}
+	return value, nil
+}
+
+// listKey returns the key of a product list for the current list version.
+func (c *ProductCache) listKey(name string) string {
+	version, err := c.cache.Get(productListVersionKey)
+	if err != nil {
+		version = []byte("0")
+	}
+	return productListPrefix + string(version) + ":" + name
+}
+
+// invalidate removes the cached products of ids and every cached list.
+func (c *ProductCache) invalidate(ids ...uint) {
+	c.invalidations.Add(1)
+
+	if len(ids) == 0 {
+		return
+	}
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = productKey(id)
+	}
+	if err := c.cache.Delete(keys...); err != nil {
+		log.Printf("Product cache delete failed %s\n", err)
+	}
+
+	version := strconv.FormatInt(time.Now().UnixNano(), 36)
+	if err := c.cache.Set(productListVersionKey, []byte(version), 0); err != nil {
+		log.Printf("Product cache set failed %s\n", err)
+	}
+}
+
+func productKey(id uint) string {
+	return productKeyPrefix + strconv.FormatUint(uint64(id), 10)
+}
+
+// CachedProductRepository caches the products read from a ProductRepository and
+// invalidates them when they are written through it.
+type CachedProductRepository struct {
+	repo  ports.ProductRepository
+	cache *ProductCache
+}
+
+// CachedStockRepository invalidates the cached products whose stock moved.
+type CachedStockRepository struct {
+	repo  ports.StockRepository
+	cache *ProductCache
+}
+
+// ProductRepository decorates a product repository with the cache.
+func (c *ProductCache) ProductRepository(repo ports.ProductRepository) ports.ProductRepository {
+	return &CachedProductRepository{repo: repo, cache: c}
+}
+
+// StockRepository decorates a stock repository with the cache.
+func (c *ProductCache) StockRepository(repo ports.StockRepository) ports.StockRepository {
+	return &CachedStockRepository{repo: repo, cache: c}
+}
+
+func (r *CachedProductRepository) GetAll() ([]models.Product, error) {
+	var products []models.Product
+	err := r.cache.load(r.cache.listKey("all"), func() (interface{}, error) {
+		return r.repo.GetAll()
+	}, &products)
+	if err != nil {
+		return nil, err
+	}
+	return products, nil
+}
+
+// productPage is the cached value of a page.
+type productPage struct {
+	Products []models.Product
+	Total    int64
+}
+
+func (r *CachedProductRepository) GetPage(request models.PageRequest) ([]models.Product, int64, error) {
+	var page productPage
+	key := r.cache.listKey(fmt.Sprintf("page:%d:%d", request.Page, request.PageSize))
+	err := r.cache.load(key, func() (interface{}, error) {
+		products, total, err := r.repo.GetPage(request)
+		return productPage{Products: products, Total: total}, err
+	}, &page)
+	if err != nil {
+		return nil, 0, err
+	}
+	return page.Products, page.Total, nil
+}
+
+func (r *CachedProductRepository) GetOne(id uint) (*models.Product, error) {
+	var product models.Product
+	err := r.cache.load(productKey(id), func() (interface{}, error) {
+		return r.repo.GetOne(id)
+	}, &product)
+	if err != nil {
+		return nil, err
+	}
+	return &product, nil
+}
+
+func (r *CachedProductRepository) Save(product models.Product) (uint, error) {
+	id, err := r.repo.Save(product)
+	if err != nil {
+		return 0, err
+	}
+
+	r.cache.invalidate(id)
+	return id, nil
+}
+
+func (r *CachedProductRepository) Update(product models.Product) error {
+	err := r.repo.Update(product)
+	r.cache.invalidate(product.ID)
+	return err
+}
+
+func (r *CachedProductRepository) Delete(id uint) error {
+	err := r.repo.Delete(id)
+	r.cache.invalidate(id)
+	return err
+}
+
+func (r *CachedProductRepository) ApplyProductOperations(operations []models.ProductOperation) ([]models.Product, error) {
+	products, err := r.repo.ApplyProductOperations(operations)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]uint, len(products))
+	for i, product := range products {
+		ids[i] = product.ID
+	}
+	r.cache.invalidate(ids...)
+	return products, nil
+}
+
+func (r *CachedStockRepository) ApplyStockMovements(eventID string, movements []models.StockMovement) ([]models.Product, error) {
+	products, err := r.repo.ApplyStockMovements(eventID, movements)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]uint, len(products))
+	for i, product := range products {
+		ids[i] = product.ID
+	}
+	r.cache.invalidate(ids...)
+	return products, nil
+}
@@ -0,0 +1,109 @@
+package cache
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/WarisLi/Golang-mini-project/internal/core/ports"
+)
+
+const (
+	rateLimitKeyPrefix = "ratelimit:"
+	// rateLimitSweepInterval is how often the expired windows of the memory rate limiter are removed.
+	rateLimitSweepInterval = time.Minute
+)
+
+// MemoryRateLimiter counts the hits of each key in the process, the limits are
+// per instance.
+type MemoryRateLimiter struct {
+	mu        sync.Mutex
+	windows   map[string]*rateWindow
+	nextSweep time.Time
+}
+
+type rateWindow struct {
+	hits    int
+	resetAt time.Time
+}
+
+func NewMemoryRateLimiter() *MemoryRateLimiter {
+	return &MemoryRateLimiter{windows: map[string]*rateWindow{}}
+}
+
+func (l *MemoryRateLimiter) Allow(key string, limit int, window time.Duration) (ports.RateLimit, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if now.After(l.nextSweep) {
+		for key, w := range l.windows {
+			if !now.Before(w.resetAt) {
+				delete(l.windows, key)
+			}
+		}
+		l.nextSweep = now.Add(rateLimitSweepInterval)
+	}
+
+	w, ok := l.windows[key]
+	if !ok || !now.Before(w.resetAt) {
+		w = &rateWindow{resetAt: now.Add(window)}
+		l.windows[key] = w
+	}
+	w.hits++
+
+	return rateLimit(w.hits, limit, w.resetAt.Sub(now)), nil
+}
+
+// RedisRateLimiter counts the hits of each key in a Redis-compatible server, the
+// limits are shared by the instances.
+type RedisRateLimiter struct {
+	redis *RedisCache
+}
+
+func NewRedisRateLimiter(redis *RedisCache) *RedisRateLimiter {
+	return &RedisRateLimiter{redis: redis}
+}
+
+func (l *RedisRateLimiter) Allow(key string, limit int, window time.Duration) (ports.RateLimit, error) {
+	key = rateLimitKeyPrefix + key
+	windowMs := strconv.FormatInt(max(window.Milliseconds(), 1), 10)
+
+	// Starts the window unless it is running
+	if _, err := l.redis.command("SET", key, "0", "PX", windowMs, "NX"); err != nil {
+		return ports.RateLimit{}, err
+	}
+	reply, err := l.redis.command("INCR", key)
+	if err != nil {
+		return ports.RateLimit{}, err
+	}
+	hits, err := strconv.Atoi(string(reply))
+	if err != nil {
+		return ports.RateLimit{}, err
+	}
+	reply, err = l.redis.command("PTTL", key)
+	if err != nil {
+		return ports.RateLimit{}, err
+	}
+	ttl, err := strconv.ParseInt(string(reply), 10, 64)
+	if err != nil {
+		return ports.RateLimit{}, err
+	}
+	if ttl < 0 {
+		// The window expired between SET and INCR, INCR created a key without expiry
+		if _, err := l.redis.command("PEXPIRE", key, windowMs); err != nil {
+			return ports.RateLimit{}, err
+		}
+		ttl = window.Milliseconds()
+	}
+
+	return rateLimit(hits, limit, time.Duration(ttl)*time.Millisecond), nil
+}
+
+func rateLimit(hits int, limit int, resetIn time.Duration) ports.RateLimit {
+	return ports.RateLimit{
+		Allowed:    hits <= limit,
+		Remaining:  max(limit-hits, 0),
+		RetryAfter: resetIn,
+	}
+}
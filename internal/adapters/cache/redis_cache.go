@@ -0,0 +1,204 @@
+package cache
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/WarisLi/Golang-mini-project/internal/core/ports"
+)
+
+const redisDefaultPort = "6379"
+
+// RedisCache caches values in a Redis-compatible server, e.g. Redis, Valkey or
+// KeyDB, using the RESP protocol. Commands are sent one at a time on a single
+// connection, which is opened again on the next command after an error.
+type RedisCache struct {
+	url     *url.URL
+	timeout time.Duration
+
+	mu   sync.Mutex
+	conn net.Conn
+	r    *bufio.Reader
+	w    *bufio.Writer
+}
+
+// NewRedisCache connects to rawURL, e.g. "redis://:password@localhost:6379/0".
+func NewRedisCache(rawURL string, timeout time.Duration) (*RedisCache, error) {
+	redisURL, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if redisURL.Scheme != "redis" {
+		return nil, fmt.Errorf("redis: unsupported scheme %q", redisURL.Scheme)
+	}
+
+	c := &RedisCache{url: redisURL, timeout: timeout}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.connect(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// redisError is an error reply of the server.
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+// connect must be called with c.mu held.
+func (c *RedisCache) connect() error {
+	host := c.url.Host
+	if c.url.Port() == "" {
+		host = net.JoinHostPort(c.url.Hostname(), redisDefaultPort)
+	}
+
+	conn, err := net.DialTimeout("tcp", host, c.timeout)
+	if err != nil {
+		return err
+	}
+	c.conn = conn
+	c.r = bufio.NewReader(conn)
+	c.w = bufio.NewWriter(conn)
+
+	if c.url.User != nil {
+		args := []string{"AUTH"}
+		if username := c.url.User.Username(); username != "" {
+			args = append(args, username)
+		}
+		password, _ := c.url.User.Password()
+		if _, err := c.do(append(args, password)...); err != nil {
+			c.close()
+			return err
+		}
+	}
+	if db := strings.TrimPrefix(c.url.Path, "/"); db != "" && db != "0" {
+		if _, err := c.do("SELECT", db); err != nil {
+			c.close()
+			return err
+		}
+	}
+	return nil
+}
+
+// close must be called with c.mu held.
+func (c *RedisCache) close() error {
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
+
+// command sends a command and returns its reply, a nil reply is returned as a nil slice.
+func (c *RedisCache) command(args ...string) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn == nil {
+		if err := c.connect(); err != nil {
+			return nil, err
+		}
+	}
+
+	reply, err := c.do(args...)
+	var replyErr redisError
+	if err != nil && !errors.As(err, &replyErr) {
+		// The connection is in an unknown state
+		c.close()
+	}
+	return reply, err
+}
+
+// do must be called with c.mu held and c.conn open.
+func (c *RedisCache) do(args ...string) ([]byte, error) {
+	c.conn.SetDeadline(time.Now().Add(c.timeout))
+
+	fmt.Fprintf(c.w, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(c.w, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if err := c.w.Flush(); err != nil {
+		return nil, err
+	}
+
+	return c.readReply()
+}
+
+func (c *RedisCache) readReply() ([]byte, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("redis: empty reply")
+	}
+
+	switch line[0] {
+	case '+', ':':
+		return []byte(line[1:]), nil
+	case '-':
+		return nil, redisError(line[1:])
+	case '$':
+		size, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("redis: invalid reply %q", line)
+		}
+		if size < 0 {
+			return nil, nil
+		}
+		value := make([]byte, size+2)
+		if _, err := io.ReadFull(c.r, value); err != nil {
+			return nil, err
+		}
+		return value[:size], nil
+	}
+	return nil, fmt.Errorf("redis: unexpected reply %q", line)
+}
+
+func (c *RedisCache) Get(key string) ([]byte, error) {
+	value, err := c.command("GET", key)
+	if err != nil {
+		return nil, err
+	}
+	if value == nil {
+		return nil, ports.ErrCacheMiss
+	}
+	return value, nil
+}
+
+func (c *RedisCache) Set(key string, value []byte, ttl time.Duration) error {
+	args := []string{"SET", key, string(value)}
+	if ttl > 0 {
+		args = append(args, "PX", strconv.FormatInt(max(ttl.Milliseconds(), 1), 10))
+	}
+	_, err := c.command(args...)
+	return err
+}
+
+func (c *RedisCache) Delete(keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	_, err := c.command(append([]string{"DEL"}, keys...)...)
+	return err
+}
+
+func (c *RedisCache) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.close()
+}
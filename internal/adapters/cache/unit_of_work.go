@@ -0,0 +1,91 @@
+package cache
+
+import (
+	"sync"
+
+	"github.com/WarisLi/Golang-mini-project/internal/core/models"
+	"github.com/WarisLi/Golang-mini-project/internal/core/ports"
+)
+
+// CachedUnitOfWork invalidates the cached products written by a unit of work
+// once it is committed. The products are not read from the cache within the
+// unit of work, they could be out of date there.
+type CachedUnitOfWork struct {
+	unitOfWork ports.UnitOfWork
+	cache      *ProductCache
+}
+
+// UnitOfWork decorates a unit of work with the cache.
+func (c *ProductCache) UnitOfWork(unitOfWork ports.UnitOfWork) ports.UnitOfWork {
+	return &CachedUnitOfWork{unitOfWork: unitOfWork, cache: c}
+}
+
+func (u *CachedUnitOfWork) Do(fn func(repos ports.TransactionRepositories) error) error {
+	written := &writtenProducts{}
+	err := u.unitOfWork.Do(func(repos ports.TransactionRepositories) error {
+		repos.Product = &writtenProductRepository{ProductRepository: repos.Product, written: written}
+		repos.Stock = &writtenStockRepository{StockRepository: repos.Stock, written: written}
+		return fn(repos)
+	})
+	if err == nil {
+		u.cache.invalidate(written.ids...)
+	}
+	return err
+}
+
+// writtenProducts are the IDs of the products written by a unit of work.
+type writtenProducts struct {
+	mu  sync.Mutex
+	ids []uint
+}
+
+func (w *writtenProducts) add(products ...models.Product) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, product := range products {
+		w.ids = append(w.ids, product.ID)
+	}
+}
+
+// writtenProductRepository records the products written through it.
+type writtenProductRepository struct {
+	ports.ProductRepository
+	written *writtenProducts
+}
+
+func (r *writtenProductRepository) Save(product models.Product) (uint, error) {
+	id, err := r.ProductRepository.Save(product)
+	if err == nil {
+		r.written.add(models.Product{ID: id})
+	}
+	return id, err
+}
+
+func (r *writtenProductRepository) Update(product models.Product) error {
+	r.written.add(product)
+	return r.ProductRepository.Update(product)
+}
+
+func (r *writtenProductRepository) Delete(id uint) error {
+	r.written.add(models.Product{ID: id})
+	return r.ProductRepository.Delete(id)
+}
+
+func (r *writtenProductRepository) ApplyProductOperations(operations []models.ProductOperation) ([]models.Product, error) {
+	products, err := r.ProductRepository.ApplyProductOperations(operations)
+	r.written.add(products...)
+	return products, err
+}
+
+// writtenStockRepository records the products whose stock moved through it.
+type writtenStockRepository struct {
+	ports.StockRepository
+	written *writtenProducts
+}
+
+func (r *writtenStockRepository) ApplyStockMovements(eventID string, movements []models.StockMovement) ([]models.Product, error) {
+	products, err := r.StockRepository.ApplyStockMovements(eventID, movements)
+	r.written.add(products...)
+	return products, err
+}
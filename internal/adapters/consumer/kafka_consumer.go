@@ -0,0 +1,213 @@
+package consumer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/WarisLi/Golang-mini-project/internal/adapters/producer"
+	"github.com/WarisLi/Golang-mini-project/internal/core/models"
+	"github.com/WarisLi/Golang-mini-project/internal/core/ports"
+	"gopkg.in/Shopify/sarama.v1"
+	"gorm.io/gorm"
+)
+
+const maxRetryBackoff = 30 * time.Second
+
+type OrderConsumerOptions struct {
+	TopicPrefix  string
+	RetryBackoff time.Duration
+}
+
+// OrderConsumer applies the stock movements of order events. Offsets are marked
+// only after the movement is committed to the database, so a message is either
+// applied or delivered again; the stock service ignores redelivered events.
+// Messages that can never be applied are moved to the dead-letter store.
+type OrderConsumer struct {
+	group      sarama.ConsumerGroup
+	service    ports.StockService
+	outboxRepo ports.OutboxRepository
+	options    OrderConsumerOptions
+}
+
+func NewOrderConsumer(group sarama.ConsumerGroup, service ports.StockService, outboxRepo ports.OutboxRepository, options OrderConsumerOptions) *OrderConsumer {
+	if options.RetryBackoff <= 0 {
+		options.RetryBackoff = time.Second
+	}
+
+	return &OrderConsumer{
+		group:      group,
+		service:    service,
+		outboxRepo: outboxRepo,
+		options:    options,
+	}
+}
+
+// Topics returns the topics the consumer subscribes to.
+func (c *OrderConsumer) Topics() []string {
+	return []string{
+		c.options.TopicPrefix + producer.TopicOf(models.OrderPlacedEvent{}),
+		c.options.TopicPrefix + producer.TopicOf(models.OrderCancelledEvent{}),
+	}
+}
+
+// Run consumes until ctx is done, joining the group again after every rebalance.
+func (c *OrderConsumer) Run(ctx context.Context) error {
+	go func() {
+		for err := range c.group.Errors() {
+			log.Printf("Order consumer error %s\n", err)
+		}
+	}()
+
+	for {
+		if err := c.group.Consume(ctx, c.Topics(), c); err != nil {
+			log.Printf("Order consumer session failed %s\n", err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(c.options.RetryBackoff):
+			}
+		}
+		if ctx.Err() != nil {
+			return c.group.Close()
+		}
+	}
+}
+
+// Setup is called at the beginning of a session, after a rebalance.
+func (c *OrderConsumer) Setup(session sarama.ConsumerGroupSession) error {
+	log.Printf("Order consumer %s assigned %v\n", session.MemberID(), session.Claims())
+	return nil
+}
+
+// Cleanup is called at the end of a session, before a rebalance.
+func (c *OrderConsumer) Cleanup(session sarama.ConsumerGroupSession) error {
+	log.Printf("Order consumer %s released %v\n", session.MemberID(), session.Claims())
+	return nil
+}
+
+func (c *OrderConsumer) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	for msg := range claim.Messages() {
+		if !c.handleWithRetry(session.Context(), msg) {
+			// The session ended while retrying, the message is delivered again
+			// to the partition owner after the rebalance.
+			return nil
+		}
+		session.MarkMessage(msg, "")
+	}
+	return nil
+}
+
+// handleWithRetry handles msg until it is applied or dead-lettered, retrying
+// temporary failures with exponential backoff. It returns false when ctx is done first.
+func (c *OrderConsumer) handleWithRetry(ctx context.Context, msg *sarama.ConsumerMessage) bool {
+	backoff := c.options.RetryBackoff
+	for {
+		err := c.handle(msg)
+		if err == nil {
+			return true
+		}
+
+		if isPoison(err) {
+			if err = c.deadLetter(msg, err); err == nil {
+				return true
+			}
+		}
+
+		log.Printf("Order message %s/%d/%d failed, retrying in %s: %s\n", msg.Topic, msg.Partition, msg.Offset, backoff, err)
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, maxRetryBackoff)
+	}
+}
+
+// poisonError is returned for messages that cannot be decoded.
+type poisonError struct {
+	err error
+}
+
+func (e poisonError) Error() string { return e.err.Error() }
+func (e poisonError) Unwrap() error { return e.err }
+
+// isPoison reports whether retrying the message can never succeed.
+func isPoison(err error) bool {
+	var poison poisonError
+	return errors.As(err, &poison) ||
+		errors.Is(err, ports.ErrInvalidEvent) ||
+		errors.Is(err, ports.ErrInsufficientStock) ||
+		errors.Is(err, gorm.ErrRecordNotFound)
+}
+
+func (c *OrderConsumer) handle(msg *sarama.ConsumerMessage) error {
+	envelopeID, data := decodeMessage(msg)
+	fallbackID := fmt.Sprintf("%s/%d/%d", msg.Topic, msg.Partition, msg.Offset)
+	if envelopeID != "" {
+		fallbackID = envelopeID
+	}
+
+	switch c.eventName(msg.Topic) {
+	case producer.TopicOf(models.OrderPlacedEvent{}):
+		var event models.OrderPlacedEvent
+		if err := json.Unmarshal(data, &event); err != nil {
+			return poisonError{err}
+		}
+		if event.EventID == "" {
+			event.EventID = fallbackID
+		}
+		return c.service.HandleOrderPlaced(event)
+
+	case producer.TopicOf(models.OrderCancelledEvent{}):
+		var event models.OrderCancelledEvent
+		if err := json.Unmarshal(data, &event); err != nil {
+			return poisonError{err}
+		}
+		if event.EventID == "" {
+			event.EventID = fallbackID
+		}
+		return c.service.HandleOrderCancelled(event)
+	}
+
+	return poisonError{fmt.Errorf("unexpected topic %s", msg.Topic)}
+}
+
+func (c *OrderConsumer) eventName(topic string) string {
+	return strings.TrimPrefix(topic, c.options.TopicPrefix)
+}
+
+// decodeMessage returns the CloudEvents id and the event JSON of a raw,
+// structured or binary CloudEvents message.
+func decodeMessage(msg *sarama.ConsumerMessage) (string, []byte) {
+	for _, header := range msg.Headers {
+		if header != nil && string(header.Key) == "ce_id" {
+			return string(header.Value), msg.Value
+		}
+	}
+
+	var cloudEvent producer.CloudEvent
+	if err := json.Unmarshal(msg.Value, &cloudEvent); err == nil && cloudEvent.SpecVersion != "" && cloudEvent.Data != nil {
+		return cloudEvent.ID, cloudEvent.Data
+	}
+
+	return "", msg.Value
+}
+
+func (c *OrderConsumer) deadLetter(msg *sarama.ConsumerMessage, err error) error {
+	log.Printf("Order message %s/%d/%d moved to dead letters: %s\n", msg.Topic, msg.Partition, msg.Offset, err)
+
+	_, data := decodeMessage(msg)
+	outboxEvent := models.OutboxEvent{
+		Topic:     c.eventName(msg.Topic),
+		Payload:   data,
+		Attempts:  1,
+		LastError: err.Error(),
+		Consumed:  true,
+	}
+	_, err = c.outboxRepo.SaveEvent(outboxEvent)
+	return err
+}
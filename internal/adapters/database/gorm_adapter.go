@@ -1,15 +1,24 @@
 package database
 
 import (
-	"errors"
+	"fmt"
+	"strings"
+	"time"
 
 	"github.com/WarisLi/Golang-mini-project/internal/core/models"
 	"github.com/WarisLi/Golang-mini-project/internal/core/ports"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// productColumns are the product columns written by an update.
+var productColumns = []interface{}{"Name", "Quantity", "Category", "SKU", "Description"}
+
 type GormRepository struct {
 	db *gorm.DB
+	// lockRows locks the products read by GetOne until the transaction ends,
+	// they are read to be written in a unit of work.
+	lockRows bool
 }
 
 func NewGormProductRepository(db *gorm.DB) ports.ProductRepository {
@@ -20,6 +29,38 @@ func NewGormUserRepository(db *gorm.DB) ports.UserRepository {
 	return &GormRepository{db: db}
 }
 
+func NewGormOutboxRepository(db *gorm.DB) ports.OutboxRepository {
+	return &GormRepository{db: db}
+}
+
+func NewGormStockRepository(db *gorm.DB) ports.StockRepository {
+	return &GormRepository{db: db}
+}
+
+func NewGormWebhookRepository(db *gorm.DB) ports.WebhookRepository {
+	return &GormRepository{db: db}
+}
+
+func NewGormIdempotencyRepository(db *gorm.DB) ports.IdempotencyRepository {
+	return &GormRepository{db: db}
+}
+
+func NewGormPasswordResetRepository(db *gorm.DB) ports.PasswordResetRepository {
+	return &GormRepository{db: db}
+}
+
+func NewGormAPIKeyRepository(db *gorm.DB) ports.APIKeyRepository {
+	return &GormRepository{db: db}
+}
+
+func NewGormSigningKeyRepository(db *gorm.DB) ports.SigningKeyRepository {
+	return &GormRepository{db: db}
+}
+
+func NewGormOIDCLoginRepository(db *gorm.DB) ports.OIDCLoginRepository {
+	return &GormRepository{db: db}
+}
+
 func (r *GormRepository) GetAll() ([]models.Product, error) {
 	var products []models.Product
 
@@ -29,27 +70,49 @@ func (r *GormRepository) GetAll() ([]models.Product, error) {
 	return products, nil
 }
 
+func (r *GormRepository) GetPage(request models.PageRequest) ([]models.Product, int64, error) {
+	var products []models.Product
+	var total int64
+
+	if result := r.db.Model(&models.Product{}).Count(&total); result.Error != nil {
+		return nil, 0, result.Error
+	}
+	if result := r.db.Order("id").Limit(request.PageSize).Offset(request.Offset()).Find(&products); result.Error != nil {
+		return nil, 0, result.Error
+	}
+	return products, total, nil
+}
+
 func (r *GormRepository) GetOne(id uint) (*models.Product, error) {
 	var product models.Product
 
-	if result := r.db.First(&product, id); result.Error != nil {
+	db := r.db
+	if r.lockRows {
+		db = db.Clauses(clause.Locking{Strength: "UPDATE"})
+	}
+	if result := db.First(&product, id); result.Error != nil {
 		return nil, result.Error
 	}
 	return &product, nil
 }
 
-func (r *GormRepository) Save(product models.Product) error {
+func (r *GormRepository) Save(product models.Product) (uint, error) {
 	if result := r.db.Create(&product); result.Error != nil {
-		return result.Error
+		return 0, result.Error
 	}
 
-	return nil
+	return product.ID, nil
 }
 
 func (r *GormRepository) Update(product models.Product) error {
-	if result := r.db.Model(&product).Updates(product); result.Error != nil {
+	// Select the columns so that zero values are saved too
+	result := r.db.Model(&product).Select(productColumns[0], productColumns[1:]...).Updates(product)
+	if result.Error != nil {
 		return result.Error
 	}
+	if result.RowsAffected <= 0 {
+		return gorm.ErrRecordNotFound
+	}
 	return nil
 }
 
@@ -60,11 +123,49 @@ func (r *GormRepository) Delete(id uint) error {
 		return result.Error
 	}
 	if result.RowsAffected <= 0 {
-		return errors.New("Delete failed")
+		return gorm.ErrRecordNotFound
 	}
 	return nil
 }
 
+func (r *GormRepository) ApplyProductOperations(operations []models.ProductOperation) ([]models.Product, error) {
+	products := make([]models.Product, len(operations))
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		for i, operation := range operations {
+			product := operation.Product
+
+			var err error
+			switch operation.Op {
+			case models.ProductOperationCreate:
+				err = tx.Create(&product).Error
+			case models.ProductOperationUpdate:
+				result := tx.Model(&product).Select(productColumns[0], productColumns[1:]...).Updates(product)
+				if err = result.Error; err == nil && result.RowsAffected == 0 {
+					err = gorm.ErrRecordNotFound
+				}
+			case models.ProductOperationDelete:
+				if err = tx.First(&product, product.ID).Error; err == nil {
+					err = tx.Delete(&product).Error
+				}
+			default:
+				err = fmt.Errorf("unknown operation %q", operation.Op)
+			}
+			if err != nil {
+				return &ports.BatchOperationError{Index: i, Err: err}
+			}
+
+			products[i] = product
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return products, nil
+}
+
 func (r *GormRepository) GetUser(username string) (*models.User, error) {
 	var user models.User
 	result := r.db.Where("username = ?", username).First(&user)
@@ -75,6 +176,16 @@ func (r *GormRepository) GetUser(username string) (*models.User, error) {
 	return &user, nil
 }
 
+func (r *GormRepository) GetUserByIdentity(provider string, subject string) (*models.User, error) {
+	var user models.User
+	result := r.db.Where("identity_provider = ? AND external_subject = ?", provider, subject).First(&user)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return &user, nil
+}
+
 func (r *GormRepository) Create(user models.User) error {
 	if result := r.db.Create(&user); result.Error != nil {
 		return result.Error
@@ -82,3 +193,518 @@ func (r *GormRepository) Create(user models.User) error {
 
 	return nil
 }
+
+func (r *GormRepository) UpdateUser(user models.User) error {
+	result := r.db.Model(&user).Select("Password", "Role", "Disabled", "FailedLogins", "LockedUntil", "SessionVersion",
+		"TOTPSecret", "TOTPEnabled", "TOTPLastStep", "RecoveryCodes", "IdentityProvider", "ExternalSubject").Updates(user)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	return nil
+}
+
+func (r *GormRepository) AddFailedLogin(username string) (int, error) {
+	var user models.User
+	result := r.db.Model(&user).Clauses(clause.Returning{Columns: []clause.Column{{Name: "failed_logins"}}}).
+		Where("username = ?", username).Update("failed_logins", gorm.Expr("failed_logins + 1"))
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	if result.RowsAffected <= 0 {
+		return 0, gorm.ErrRecordNotFound
+	}
+	return user.FailedLogins, nil
+}
+
+func (r *GormRepository) LockUser(username string, lockedUntil time.Time) error {
+	result := r.db.Model(&models.User{}).Where("username = ? AND (locked_until IS NULL OR locked_until < ?)", username, lockedUntil).
+		Update("locked_until", lockedUntil)
+	return result.Error
+}
+
+func (r *GormRepository) ResetFailedLogins(username string) error {
+	result := r.db.Model(&models.User{}).Where("username = ?", username).
+		Updates(map[string]interface{}{"failed_logins": 0, "locked_until": nil})
+	return result.Error
+}
+
+func (r *GormRepository) UpdatePasswordHash(username string, oldHash string, newHash string) error {
+	result := r.db.Model(&models.User{}).Where("username = ? AND password = ?", username, oldHash).Update("password", newHash)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected <= 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *GormRepository) UpdateTwoFactor(username string, from models.TwoFactorState, state models.TwoFactorState) error {
+	// The secret and recovery codes of the users created before two-factor authentication are NULL
+	result := r.db.Model(&models.User{}).
+		Where("username = ? AND COALESCE(totp_secret, '') = ? AND totp_enabled = ? AND totp_last_step = ? AND COALESCE(recovery_codes, '') = ?",
+			username, from.TOTPSecret, from.TOTPEnabled, from.TOTPLastStep, from.RecoveryCodes).
+		Updates(map[string]interface{}{
+			"totp_secret":    state.TOTPSecret,
+			"totp_enabled":   state.TOTPEnabled,
+			"totp_last_step": state.TOTPLastStep,
+			"recovery_codes": state.RecoveryCodes,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected <= 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *GormRepository) GetUsers(query models.UserQuery) ([]models.User, int64, error) {
+	db := r.db.Model(&models.User{})
+	if query.Query != "" {
+		pattern := "%" + likeEscaper.Replace(strings.ToLower(query.Query)) + "%"
+		db = db.Where(`LOWER(username) LIKE ? ESCAPE '\' OR LOWER(email) LIKE ? ESCAPE '\'`, pattern, pattern)
+	}
+	if query.Role != "" {
+		db = db.Where("role = ?", query.Role)
+	}
+	if query.Disabled != nil {
+		db = db.Where("disabled = ?", *query.Disabled)
+	}
+
+	var total int64
+	if result := db.Count(&total); result.Error != nil {
+		return nil, 0, result.Error
+	}
+
+	var users []models.User
+	if result := db.Order("id").Limit(query.PageSize).Offset(query.Offset()).Find(&users); result.Error != nil {
+		return nil, 0, result.Error
+	}
+	return users, total, nil
+}
+
+// likeEscaper escapes the wildcards of a LIKE pattern, with backslash as escape character.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// DeleteUser deletes the user permanently, so that its username can be registered again.
+func (r *GormRepository) DeleteUser(username string) error {
+	result := r.db.Unscoped().Where("username = ?", username).Delete(&models.User{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected <= 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *GormRepository) SaveEvent(event models.OutboxEvent) (uint, error) {
+	if result := r.db.Create(&event); result.Error != nil {
+		return 0, result.Error
+	}
+
+	return event.ID, nil
+}
+
+func (r *GormRepository) GetPendingEvents() ([]models.OutboxEvent, error) {
+	var outboxEvents []models.OutboxEvent
+
+	if result := r.db.Where("published_at IS NULL AND consumed = ?", false).Order("id").Find(&outboxEvents); result.Error != nil {
+		return nil, result.Error
+	}
+	return outboxEvents, nil
+}
+
+// failedEvents are the pending events whose publishing failed at least once, the
+// events of a unit of work being published are not attempted yet.
+const failedEvents = "published_at IS NULL AND attempts > 0"
+
+func (r *GormRepository) GetFailedEvents() ([]models.OutboxEvent, error) {
+	var outboxEvents []models.OutboxEvent
+
+	if result := r.db.Where(failedEvents).Order("id").Find(&outboxEvents); result.Error != nil {
+		return nil, result.Error
+	}
+	return outboxEvents, nil
+}
+
+func (r *GormRepository) GetFailedEvent(id uint) (*models.OutboxEvent, error) {
+	var outboxEvent models.OutboxEvent
+
+	if result := r.db.Where(failedEvents).First(&outboxEvent, id); result.Error != nil {
+		return nil, result.Error
+	}
+	return &outboxEvent, nil
+}
+
+func (r *GormRepository) CountFailedEvents() (int64, error) {
+	var count int64
+
+	if result := r.db.Model(&models.OutboxEvent{}).Where(failedEvents).Count(&count); result.Error != nil {
+		return 0, result.Error
+	}
+	return count, nil
+}
+
+func (r *GormRepository) MarkEventPublished(id uint) error {
+	result := r.db.Model(&models.OutboxEvent{}).Where("id = ?", id).Update("published_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	return nil
+}
+
+func (r *GormRepository) RecordEventFailure(id uint, lastError string) error {
+	result := r.db.Model(&models.OutboxEvent{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"attempts":   gorm.Expr("attempts + 1"),
+		"last_error": lastError,
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	return nil
+}
+
+func (r *GormRepository) DeleteFailedEvent(id uint) error {
+	result := r.db.Where(failedEvents).Delete(&models.OutboxEvent{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected <= 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *GormRepository) ApplyStockMovements(eventID string, movements []models.StockMovement) ([]models.Product, error) {
+	var products []models.Product
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		processedEvent := models.ProcessedEvent{EventID: eventID, ProcessedAt: time.Now()}
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&processedEvent)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ports.ErrEventAlreadyProcessed
+		}
+
+		for _, movement := range movements {
+			var product models.Product
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&product, movement.ProductID).Error; err != nil {
+				return err
+			}
+
+			product.Quantity += movement.Delta
+			if product.Quantity < 0 {
+				return fmt.Errorf("%w: product %d", ports.ErrInsufficientStock, product.ID)
+			}
+			if err := tx.Model(&product).Update("quantity", product.Quantity).Error; err != nil {
+				return err
+			}
+			products = append(products, product)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return products, nil
+}
+
+func (r *GormRepository) GetWebhooks() ([]models.Webhook, error) {
+	var webhooks []models.Webhook
+
+	if result := r.db.Order("id").Find(&webhooks); result.Error != nil {
+		return nil, result.Error
+	}
+	return webhooks, nil
+}
+
+func (r *GormRepository) GetActiveWebhooks() ([]models.Webhook, error) {
+	var webhooks []models.Webhook
+
+	if result := r.db.Where("active = ?", true).Find(&webhooks); result.Error != nil {
+		return nil, result.Error
+	}
+	return webhooks, nil
+}
+
+func (r *GormRepository) GetWebhook(id uint) (*models.Webhook, error) {
+	var webhook models.Webhook
+
+	if result := r.db.First(&webhook, id); result.Error != nil {
+		return nil, result.Error
+	}
+	return &webhook, nil
+}
+
+func (r *GormRepository) CreateWebhook(webhook models.Webhook) (uint, error) {
+	if result := r.db.Create(&webhook); result.Error != nil {
+		return 0, result.Error
+	}
+
+	return webhook.ID, nil
+}
+
+func (r *GormRepository) UpdateWebhook(webhook models.Webhook) error {
+	result := r.db.Model(&webhook).Select("URL", "EventTypes", "Secret", "Active", "FailureCount", "DisabledAt").Updates(webhook)
+	if result.Error != nil {
+		return result.Error
+	}
+	return nil
+}
+
+func (r *GormRepository) DeleteWebhook(id uint) error {
+	result := r.db.Delete(&models.Webhook{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected <= 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *GormRepository) SaveWebhookDelivery(delivery models.WebhookDelivery) error {
+	if result := r.db.Create(&delivery); result.Error != nil {
+		return result.Error
+	}
+
+	return nil
+}
+
+func (r *GormRepository) GetWebhookDeliveries(webhookID uint) ([]models.WebhookDelivery, error) {
+	var deliveries []models.WebhookDelivery
+
+	if result := r.db.Where("webhook_id = ?", webhookID).Order("id DESC").Limit(100).Find(&deliveries); result.Error != nil {
+		return nil, result.Error
+	}
+	return deliveries, nil
+}
+
+func (r *GormRepository) GetDueWebhookDeliveries(now time.Time) ([]models.WebhookDelivery, error) {
+	var deliveries []models.WebhookDelivery
+
+	if result := r.db.Where("retry_at <= ?", now).Order("retry_at").Limit(100).Find(&deliveries); result.Error != nil {
+		return nil, result.Error
+	}
+	return deliveries, nil
+}
+
+func (r *GormRepository) ClaimWebhookDelivery(id uint) error {
+	result := r.db.Model(&models.WebhookDelivery{}).Where("id = ? AND retry_at IS NOT NULL", id).Update("retry_at", nil)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected <= 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *GormRepository) CreateIdempotencyKey(key models.IdempotencyKey) error {
+	result := r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&key)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ports.ErrIdempotencyKeyExists
+	}
+	return nil
+}
+
+func (r *GormRepository) GetIdempotencyKey(scope string, key string) (*models.IdempotencyKey, error) {
+	var idempotencyKey models.IdempotencyKey
+
+	if result := r.db.Where("scope = ? AND key = ?", scope, key).First(&idempotencyKey); result.Error != nil {
+		return nil, result.Error
+	}
+	return &idempotencyKey, nil
+}
+
+func (r *GormRepository) UpdateIdempotencyKey(key models.IdempotencyKey) error {
+	result := r.db.Model(&models.IdempotencyKey{}).Where("scope = ? AND key = ?", key.Scope, key.Key).
+		Updates(map[string]interface{}{
+			"status_code":  key.StatusCode,
+			"content_type": key.ContentType,
+			"body":         key.Body,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	return nil
+}
+
+func (r *GormRepository) DeleteIdempotencyKey(scope string, key string) error {
+	if result := r.db.Where("scope = ? AND key = ?", scope, key).Delete(&models.IdempotencyKey{}); result.Error != nil {
+		return result.Error
+	}
+	return nil
+}
+
+func (r *GormRepository) DeleteExpiredIdempotencyKeys(now time.Time) error {
+	if result := r.db.Where("expires_at <= ?", now).Delete(&models.IdempotencyKey{}); result.Error != nil {
+		return result.Error
+	}
+	return nil
+}
+
+func (r *GormRepository) CreatePasswordResetToken(token models.PasswordResetToken) error {
+	if result := r.db.Create(&token); result.Error != nil {
+		return result.Error
+	}
+	return nil
+}
+
+func (r *GormRepository) GetPasswordResetToken(tokenHash string) (*models.PasswordResetToken, error) {
+	var token models.PasswordResetToken
+
+	if result := r.db.Where("token_hash = ?", tokenHash).First(&token); result.Error != nil {
+		return nil, result.Error
+	}
+	return &token, nil
+}
+
+func (r *GormRepository) UsePasswordResetToken(tokenHash string, usedAt time.Time) error {
+	result := r.db.Model(&models.PasswordResetToken{}).Where("token_hash = ? AND used_at IS NULL", tokenHash).
+		Update("used_at", usedAt)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ports.ErrInvalidResetToken
+	}
+	return nil
+}
+
+func (r *GormRepository) DeleteExpiredPasswordResetTokens(now time.Time) error {
+	if result := r.db.Where("expires_at <= ?", now).Delete(&models.PasswordResetToken{}); result.Error != nil {
+		return result.Error
+	}
+	return nil
+}
+
+func (r *GormRepository) DeleteUserPasswordResetTokens(username string) error {
+	if result := r.db.Where("username = ?", username).Delete(&models.PasswordResetToken{}); result.Error != nil {
+		return result.Error
+	}
+	return nil
+}
+
+func (r *GormRepository) CreateAPIKey(key models.APIKey) (uint, error) {
+	if result := r.db.Create(&key); result.Error != nil {
+		return 0, result.Error
+	}
+
+	return key.ID, nil
+}
+
+func (r *GormRepository) GetAPIKey(id uint) (*models.APIKey, error) {
+	var key models.APIKey
+
+	if result := r.db.First(&key, id); result.Error != nil {
+		return nil, result.Error
+	}
+	return &key, nil
+}
+
+func (r *GormRepository) GetAPIKeyByKeyID(keyID string) (*models.APIKey, error) {
+	var key models.APIKey
+
+	if result := r.db.Where("key_id = ?", keyID).First(&key); result.Error != nil {
+		return nil, result.Error
+	}
+	return &key, nil
+}
+
+func (r *GormRepository) GetUserAPIKeys(username string) ([]models.APIKey, error) {
+	var keys []models.APIKey
+
+	if result := r.db.Where("username = ?", username).Order("id").Find(&keys); result.Error != nil {
+		return nil, result.Error
+	}
+	return keys, nil
+}
+
+func (r *GormRepository) UpdateAPIKey(key models.APIKey) error {
+	result := r.db.Model(&key).Select("Name", "Scopes", "ExpiresAt", "RevokedAt").Updates(key)
+	if result.Error != nil {
+		return result.Error
+	}
+	return nil
+}
+
+func (r *GormRepository) TouchAPIKey(id uint, usedAt time.Time) error {
+	// The last use is not a change of the key, UpdatedAt is left alone
+	result := r.db.Model(&models.APIKey{}).Where("id = ?", id).UpdateColumn("last_used_at", usedAt)
+	if result.Error != nil {
+		return result.Error
+	}
+	return nil
+}
+
+func (r *GormRepository) DeleteUserAPIKeys(username string) error {
+	if result := r.db.Unscoped().Where("username = ?", username).Delete(&models.APIKey{}); result.Error != nil {
+		return result.Error
+	}
+	return nil
+}
+
+func (r *GormRepository) CreateSigningKey(key models.SigningKey) error {
+	if result := r.db.Create(&key); result.Error != nil {
+		return result.Error
+	}
+	return nil
+}
+
+func (r *GormRepository) GetSigningKeys() ([]models.SigningKey, error) {
+	var keys []models.SigningKey
+	if result := r.db.Order("activates_at, id").Find(&keys); result.Error != nil {
+		return nil, result.Error
+	}
+	return keys, nil
+}
+
+// DeleteSigningKey deletes the private key for good, not softly.
+func (r *GormRepository) DeleteSigningKey(id uint) error {
+	if result := r.db.Unscoped().Delete(&models.SigningKey{}, id); result.Error != nil {
+		return result.Error
+	}
+	return nil
+}
+
+func (r *GormRepository) CreateOIDCLogin(login models.OIDCLogin) error {
+	if result := r.db.Create(&login); result.Error != nil {
+		return result.Error
+	}
+	return nil
+}
+
+func (r *GormRepository) TakeOIDCLogin(stateHash string) (*models.OIDCLogin, error) {
+	var login models.OIDCLogin
+	if result := r.db.Where("state_hash = ?", stateHash).First(&login); result.Error != nil {
+		return nil, result.Error
+	}
+
+	// Only the request deleting the login completes it
+	result := r.db.Where("state_hash = ?", stateHash).Delete(&models.OIDCLogin{})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &login, nil
+}
+
+func (r *GormRepository) DeleteExpiredOIDCLogins(now time.Time) error {
+	if result := r.db.Where("expires_at <= ?", now).Delete(&models.OIDCLogin{}); result.Error != nil {
+		return result.Error
+	}
+	return nil
+}
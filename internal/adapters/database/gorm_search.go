@@ -0,0 +1,52 @@
+package database
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/WarisLi/Golang-mini-project/internal/core/models"
+	"github.com/WarisLi/Golang-mini-project/internal/core/ports"
+	"gorm.io/gorm"
+)
+
+// GormProductSearcher searches the products with LIKE patterns. It works on
+// any database, e.g. SQLite, but does not rank nor highlight the matches.
+type GormProductSearcher struct {
+	db *gorm.DB
+}
+
+func NewGormProductSearcher(db *gorm.DB) ports.ProductSearcher {
+	return &GormProductSearcher{db: db}
+}
+
+func (s *GormProductSearcher) SearchProducts(query models.ProductSearchQuery) ([]models.ProductSearchResult, int64, error) {
+	terms := strings.FieldsFunc(strings.ToLower(query.Query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	if len(terms) == 0 {
+		return nil, 0, nil
+	}
+
+	// Every term has to be found in the name, SKU or description
+	db := s.db.Model(&models.Product{})
+	for _, term := range terms {
+		pattern := "%" + term + "%"
+		db = db.Where("LOWER(name) LIKE ? OR LOWER(sku) LIKE ? OR LOWER(description) LIKE ?", pattern, pattern, pattern)
+	}
+
+	var total int64
+	if result := db.Count(&total); result.Error != nil {
+		return nil, 0, result.Error
+	}
+
+	var products []models.Product
+	if result := db.Order("id").Limit(query.PageSize).Offset(query.Offset()).Find(&products); result.Error != nil {
+		return nil, 0, result.Error
+	}
+
+	results := make([]models.ProductSearchResult, len(products))
+	for i, product := range products {
+		results[i] = models.ProductSearchResult{Product: product, Rank: 1}
+	}
+	return results, total, nil
+}
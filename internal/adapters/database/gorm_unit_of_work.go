@@ -0,0 +1,32 @@
+package database
+
+import (
+	"github.com/WarisLi/Golang-mini-project/internal/core/ports"
+	"gorm.io/gorm"
+)
+
+type GormUnitOfWork struct {
+	db *gorm.DB
+}
+
+func NewGormUnitOfWork(db *gorm.DB) ports.UnitOfWork {
+	return &GormUnitOfWork{db: db}
+}
+
+// Do runs fn in a database transaction. The transactions of the repository
+// methods, e.g. ApplyProductOperations, become savepoints of it. The products
+// read in it are locked, a concurrent unit of work waits to read them.
+func (u *GormUnitOfWork) Do(fn func(repos ports.TransactionRepositories) error) error {
+	return u.db.Transaction(func(tx *gorm.DB) error {
+		repo := &GormRepository{db: tx, lockRows: true}
+		return fn(ports.TransactionRepositories{
+			Product:       repo,
+			Stock:         repo,
+			Outbox:        repo,
+			User:          repo,
+			PasswordReset: repo,
+			APIKey:        repo,
+			Webhook:       repo,
+		})
+	})
+}
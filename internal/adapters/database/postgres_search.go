@@ -0,0 +1,166 @@
+package database
+
+import (
+	"html"
+	"strings"
+	"unicode"
+
+	"github.com/WarisLi/Golang-mini-project/internal/core/models"
+	"github.com/WarisLi/Golang-mini-project/internal/core/ports"
+	"gorm.io/gorm"
+)
+
+// productSearchDocument is the text search document of a product.
+const productSearchDocument = `to_tsvector('simple', coalesce(products.name, '') || ' ' || coalesce(products.sku, '') || ' ' || coalesce(products.description, ''))`
+
+// The highlighted text is HTML escaped before the selection markers become <mark> tags.
+const (
+	highlightStart   = "{{mark}}"
+	highlightStop    = "{{/mark}}"
+	highlightOptions = "StartSel=" + highlightStart + ", StopSel=" + highlightStop
+)
+
+// PostgresProductSearcher searches the products with the Postgres full-text
+// search and falls back to trigram similarity when nothing matches, e.g. on typos.
+type PostgresProductSearcher struct {
+	db *gorm.DB
+}
+
+func NewPostgresProductSearcher(db *gorm.DB) ports.ProductSearcher {
+	return &PostgresProductSearcher{db: db}
+}
+
+// SetupPostgresSearch creates the pg_trgm extension and the search indexes.
+func SetupPostgresSearch(db *gorm.DB) error {
+	statements := []string{
+		"CREATE EXTENSION IF NOT EXISTS pg_trgm",
+		"CREATE INDEX IF NOT EXISTS idx_products_search ON products USING GIN ((" + productSearchDocument + "))",
+		"CREATE INDEX IF NOT EXISTS idx_products_name_trgm ON products USING GIN (name gin_trgm_ops)",
+		"CREATE INDEX IF NOT EXISTS idx_products_sku_trgm ON products USING GIN (sku gin_trgm_ops)",
+		"CREATE INDEX IF NOT EXISTS idx_products_description_trgm ON products USING GIN (description gin_trgm_ops)",
+	}
+	for _, statement := range statements {
+		if err := db.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type productSearchRow struct {
+	models.Product
+	Rank                 float64 `gorm:"column:rank"`
+	NameHighlight        string  `gorm:"column:name_highlight"`
+	SKUHighlight         string  `gorm:"column:sku_highlight"`
+	DescriptionHighlight string  `gorm:"column:description_highlight"`
+}
+
+func (s *PostgresProductSearcher) SearchProducts(query models.ProductSearchQuery) ([]models.ProductSearchResult, int64, error) {
+	terms := strings.FieldsFunc(query.Query, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	if len(terms) == 0 {
+		return nil, 0, nil
+	}
+
+	results, total, err := s.searchText(terms, query.PageRequest)
+	if err != nil || total > 0 {
+		return results, total, err
+	}
+	return s.searchSimilar(strings.Join(terms, " "), query.PageRequest)
+}
+
+// searchText matches every term as a word prefix.
+func (s *PostgresProductSearcher) searchText(terms []string, page models.PageRequest) ([]models.ProductSearchResult, int64, error) {
+	prefixes := make([]string, len(terms))
+	for i, term := range terms {
+		prefixes[i] = strings.ToLower(term) + ":*"
+	}
+	tsQuery := strings.Join(prefixes, " & ")
+	match := productSearchDocument + " @@ to_tsquery('simple', ?)"
+
+	var total int64
+	if result := s.db.Model(&models.Product{}).Where(match, tsQuery).Count(&total); result.Error != nil {
+		return nil, 0, result.Error
+	}
+	if total == 0 {
+		return nil, 0, nil
+	}
+
+	var rows []productSearchRow
+	result := s.db.Model(&models.Product{}).
+		Select("products.*, "+
+			"ts_rank("+productSearchDocument+", to_tsquery('simple', ?)) AS rank, "+
+			"ts_headline('simple', products.name, to_tsquery('simple', ?), ?) AS name_highlight, "+
+			"ts_headline('simple', products.sku, to_tsquery('simple', ?), ?) AS sku_highlight, "+
+			"ts_headline('simple', products.description, to_tsquery('simple', ?), ?) AS description_highlight",
+			tsQuery,
+			tsQuery, highlightOptions+", HighlightAll=true",
+			tsQuery, highlightOptions+", HighlightAll=true",
+			tsQuery, highlightOptions+", MaxFragments=2, MaxWords=20, MinWords=5").
+		Where(match, tsQuery).
+		Order("rank DESC, products.id").
+		Limit(page.PageSize).Offset(page.Offset()).
+		Scan(&rows)
+	if result.Error != nil {
+		return nil, 0, result.Error
+	}
+
+	results := make([]models.ProductSearchResult, len(rows))
+	for i, row := range rows {
+		results[i] = models.ProductSearchResult{
+			Product:    row.Product,
+			Rank:       row.Rank,
+			Highlights: map[string]string{},
+		}
+		for field, highlight := range map[string]string{
+			"name":        row.NameHighlight,
+			"sku":         row.SKUHighlight,
+			"description": row.DescriptionHighlight,
+		} {
+			if strings.Contains(highlight, highlightStart) {
+				results[i].Highlights[field] = MarkHighlight(highlight)
+			}
+		}
+	}
+	return results, total, nil
+}
+
+// searchSimilar matches the products whose name, SKU or description words are similar to text.
+func (s *PostgresProductSearcher) searchSimilar(text string, page models.PageRequest) ([]models.ProductSearchResult, int64, error) {
+	match := "products.name % ? OR products.sku % ? OR ? <% products.description"
+
+	var total int64
+	if result := s.db.Model(&models.Product{}).Where(match, text, text, text).Count(&total); result.Error != nil {
+		return nil, 0, result.Error
+	}
+	if total == 0 {
+		return nil, 0, nil
+	}
+
+	var rows []productSearchRow
+	result := s.db.Model(&models.Product{}).
+		Select("products.*, GREATEST(similarity(products.name, ?), similarity(products.sku, ?), word_similarity(?, products.description)) AS rank",
+			text, text, text).
+		Where(match, text, text, text).
+		Order("rank DESC, products.id").
+		Limit(page.PageSize).Offset(page.Offset()).
+		Scan(&rows)
+	if result.Error != nil {
+		return nil, 0, result.Error
+	}
+
+	results := make([]models.ProductSearchResult, len(rows))
+	for i, row := range rows {
+		results[i] = models.ProductSearchResult{Product: row.Product, Rank: row.Rank, Fuzzy: true}
+	}
+	return results, total, nil
+}
+
+// MarkHighlight escapes a highlighted text of ts_headline and turns its selection markers
+// into <mark> tags, the text of the products cannot inject HTML.
+func MarkHighlight(highlight string) string {
+	escaped := html.EscapeString(highlight)
+	escaped = strings.ReplaceAll(escaped, highlightStart, "<mark>")
+	return strings.ReplaceAll(escaped, highlightStop, "</mark>")
+}
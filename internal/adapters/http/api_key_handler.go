@@ -0,0 +1,154 @@
+package http
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/WarisLi/Golang-mini-project/internal/adapters/http/middleware"
+	"github.com/WarisLi/Golang-mini-project/internal/core/models"
+	"github.com/WarisLi/Golang-mini-project/internal/core/ports"
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"gorm.io/gorm"
+)
+
+// HttpAPIKeyHandler serves the API keys of the current user at /user/api-keys and,
+// for the administrators, the API keys of any user at /users/{username}/api-keys.
+type HttpAPIKeyHandler struct {
+	service ports.APIKeyService
+}
+
+func NewHttpAPIKeyHandler(service ports.APIKeyService) *HttpAPIKeyHandler {
+	return &HttpAPIKeyHandler{service: service}
+}
+
+// Handler functions
+// GetAPIKeys godoc
+// @Summary Get API keys
+// @Description Get the API keys of a user, revoked and expired ones included, the keys themselves are never returned
+// @Tags api-key
+// @Accept  json
+// @Produce  json
+// @Security ApiKeyAuth
+// @Param username path string false "Username, for the administrators"
+// @Success 200 {array} models.APIKeyResponse
+// @Router /user/api-keys [get]
+// @Router /users/{username}/api-keys [get]
+func (h *HttpAPIKeyHandler) GetAPIKeys(c *fiber.Ctx) error {
+	keys, err := h.service.ListAPIKeys(apiKeyOwner(c))
+	if err != nil {
+		return apiKeyError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(keys)
+}
+
+// Handler functions
+// CreateAPIKey godoc
+// @Summary Create API key
+// @Description Create an API key, the key is returned once. Send it in the X-API-Key header or as the bearer token
+// @Tags api-key
+// @Accept  json
+// @Produce  json
+// @Security ApiKeyAuth
+// @Param username path string false "Username, for the administrators"
+// @Param key body models.APIKeyInput true "Name, scopes and expiry"
+// @Success 201 {object} models.APIKeyCreated
+// @Failure 400 {object} models.MessageResponse "Scope not allowed for the role or expiry too far"
+// @Router /user/api-keys [post]
+// @Router /users/{username}/api-keys [post]
+func (h *HttpAPIKeyHandler) CreateAPIKey(c *fiber.Ctx) error {
+	var input models.APIKeyInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.MessageResponse{Message: err.Error()})
+	}
+
+	var validate = validator.New()
+	if err := validate.Struct(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.MessageResponse{Message: err.Error()})
+	}
+
+	key, err := h.service.CreateAPIKey(middleware.CurrentUser(c).Username, apiKeyOwner(c), input)
+	if err != nil {
+		return apiKeyError(c, err)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(key)
+}
+
+// Handler functions
+// RotateAPIKey godoc
+// @Summary Rotate API key
+// @Description Replace an API key by a new one of the same name and scopes, the old key keeps working for the rotation grace period
+// @Tags api-key
+// @Accept  json
+// @Produce  json
+// @Security ApiKeyAuth
+// @Param username path string false "Username, for the administrators"
+// @Param id path int true "API key ID"
+// @Success 201 {object} models.APIKeyCreated
+// @Failure 409 {object} models.MessageResponse "Revoked or expired key"
+// @Router /user/api-keys/{id}/rotate [post]
+// @Router /users/{username}/api-keys/{id}/rotate [post]
+func (h *HttpAPIKeyHandler) RotateAPIKey(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.MessageResponse{Message: err.Error()})
+	}
+
+	key, err := h.service.RotateAPIKey(middleware.CurrentUser(c).Username, apiKeyOwner(c), uint(id))
+	if err != nil {
+		return apiKeyError(c, err)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(key)
+}
+
+// Handler functions
+// RevokeAPIKey godoc
+// @Summary Revoke API key
+// @Description Revoke an API key at once, it stays listed
+// @Tags api-key
+// @Accept  json
+// @Produce  json
+// @Security ApiKeyAuth
+// @Param username path string false "Username, for the administrators"
+// @Param id path int true "API key ID"
+// @Success 200 {object} models.MessageResponse
+// @Router /user/api-keys/{id} [DELETE]
+// @Router /users/{username}/api-keys/{id} [DELETE]
+func (h *HttpAPIKeyHandler) RevokeAPIKey(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.MessageResponse{Message: err.Error()})
+	}
+
+	if err := h.service.RevokeAPIKey(middleware.CurrentUser(c).Username, apiKeyOwner(c), uint(id)); err != nil {
+		return apiKeyError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(models.MessageResponse{Message: "success"})
+}
+
+// apiKeyOwner returns the user of the keys of a request, the user of the path on
+// the administration routes and the current user otherwise. The path parameter is
+// copied as Fiber reuses its buffer once the request is served.
+func apiKeyOwner(c *fiber.Ctx) string {
+	if username := c.Params("username"); username != "" {
+		return utils.CopyString(username)
+	}
+	return middleware.CurrentUser(c).Username
+}
+
+func apiKeyError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(models.MessageResponse{Message: "API key or user not found"})
+	case errors.Is(err, ports.ErrInvalidAPIKeyScope), errors.Is(err, ports.ErrInvalidAPIKeyExpiry):
+		return c.Status(fiber.StatusBadRequest).JSON(models.MessageResponse{Message: err.Error()})
+	case errors.Is(err, ports.ErrAPIKeyInactive):
+		return c.Status(fiber.StatusConflict).JSON(models.MessageResponse{Message: err.Error()})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(models.MessageResponse{Message: err.Error()})
+}
@@ -0,0 +1,125 @@
+package http
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/WarisLi/Golang-mini-project/internal/core/models"
+	"github.com/WarisLi/Golang-mini-project/internal/core/ports"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+type HttpDeadLetterHandler struct {
+	service ports.OutboxService
+}
+
+func NewHttpDeadLetterHandler(service ports.OutboxService) *HttpDeadLetterHandler {
+	return &HttpDeadLetterHandler{service: service}
+}
+
+// Handler functions
+// GetDeadLetters godoc
+// @Summary Get dead letters
+// @Description Get events that could not be published
+// @Tags dead-letter
+// @Accept  json
+// @Produce  json
+// @Security ApiKeyAuth
+// @Success 200 {array} models.DeadLetter
+// @Router /dead-letter [get]
+func (h *HttpDeadLetterHandler) GetDeadLetters(c *fiber.Ctx) error {
+	deadLetters, err := h.service.GetDeadLetters()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.MessageResponse{Message: err.Error()})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(deadLetters)
+}
+
+// Handler functions
+// GetDeadLetter godoc
+// @Summary Get dead letter
+// @Description Get an event that could not be published
+// @Tags dead-letter
+// @Accept  json
+// @Produce  json
+// @Security ApiKeyAuth
+// @Success 200 {object} models.DeadLetter
+// @Param id path uint true "ID"
+// @Router /dead-letter/{id} [get]
+func (h *HttpDeadLetterHandler) GetDeadLetter(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.MessageResponse{Message: err.Error()})
+	}
+
+	deadLetter, err := h.service.GetDeadLetter(uint(id))
+	if err != nil {
+		return deadLetterError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(deadLetter)
+}
+
+// Handler functions
+// RetryDeadLetter godoc
+// @Summary Retry dead letter
+// @Description Publish an event that could not be published again
+// @Tags dead-letter
+// @Accept  json
+// @Produce  json
+// @Security ApiKeyAuth
+// @Success 200 {object} models.MessageResponse
+// @Failure 409 {object} models.MessageResponse "Consumed message, it is not published again"
+// @Param id path uint true "ID"
+// @Router /dead-letter/{id}/retry [POST]
+func (h *HttpDeadLetterHandler) RetryDeadLetter(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.MessageResponse{Message: err.Error()})
+	}
+
+	if err := h.service.RetryDeadLetter(uint(id)); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return deadLetterError(c, err)
+		}
+		if errors.Is(err, ports.ErrConsumedDeadLetter) {
+			return c.Status(fiber.StatusConflict).JSON(models.MessageResponse{Message: err.Error()})
+		}
+		return c.Status(fiber.StatusBadGateway).JSON(models.MessageResponse{Message: err.Error()})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(models.MessageResponse{Message: "success"})
+}
+
+// Handler functions
+// DiscardDeadLetter godoc
+// @Summary Discard dead letter
+// @Description Discard an event that could not be published
+// @Tags dead-letter
+// @Accept  json
+// @Produce  json
+// @Security ApiKeyAuth
+// @Success 200 {object} models.MessageResponse
+// @Param id path uint true "ID"
+// @Router /dead-letter/{id} [DELETE]
+func (h *HttpDeadLetterHandler) DiscardDeadLetter(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.MessageResponse{Message: err.Error()})
+	}
+
+	if err := h.service.DiscardDeadLetter(uint(id)); err != nil {
+		return deadLetterError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(models.MessageResponse{Message: "success"})
+}
+
+func deadLetterError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(models.MessageResponse{Message: "dead letter not found"})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(models.MessageResponse{Message: err.Error()})
+}
@@ -0,0 +1,95 @@
+package middleware
+
+import (
+	"errors"
+	"slices"
+	"strings"
+
+	"github.com/WarisLi/Golang-mini-project/internal/core/models"
+	"github.com/WarisLi/Golang-mini-project/internal/core/ports"
+	"github.com/gofiber/fiber/v2"
+)
+
+// APIKeyHeader carries the API key, which can also be sent as the bearer token.
+const APIKeyHeader = "X-API-Key"
+
+// APIKeyAuth authenticates the requests sent with an API key as the user of the key.
+// The other requests go on to the JWT middleware, which skips the authenticated
+// ones with APIKeyAuthenticated as its Filter.
+func APIKeyAuth(service ports.APIKeyService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		key := apiKeyOf(c)
+		if key == "" {
+			return c.Next()
+		}
+
+		user, apiKey, err := service.AuthenticateAPIKey(key)
+		if errors.Is(err, ports.ErrInvalidAPIKey) {
+			return c.Status(fiber.StatusUnauthorized).JSON(models.MessageResponse{Message: err.Error()})
+		}
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(models.MessageResponse{Message: err.Error()})
+		}
+
+		c.Locals(userContextKey, &UserData{
+			Username:       user.Username,
+			Role:           user.Role,
+			SessionVersion: user.SessionVersion,
+			APIKey:         apiKey.KeyID,
+			Scopes:         apiKey.ScopeList(),
+		})
+		return c.Next()
+	}
+}
+
+// apiKeyOf returns the API key of the X-API-Key header or of the bearer token.
+func apiKeyOf(c *fiber.Ctx) string {
+	if key := c.Get(APIKeyHeader); key != "" {
+		return key
+	}
+	token := strings.TrimPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+	if strings.HasPrefix(token, models.APIKeyPrefix) {
+		return token
+	}
+	return ""
+}
+
+// APIKeyAuthenticated reports whether APIKeyAuth authenticated the request.
+func APIKeyAuthenticated(c *fiber.Ctx) bool {
+	_, ok := c.Locals(userContextKey).(*UserData)
+	return ok
+}
+
+// RequireScope refuses the API keys without scope.
+func RequireScope(scope string) fiber.Handler {
+	return RequireScopes(scope, scope)
+}
+
+// RequireScopes requires readScope from the GET and HEAD requests of an API key
+// and writeScope from the others. The requests of the tokens have every scope.
+func RequireScopes(readScope string, writeScope string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		user := CurrentUser(c)
+		if user.APIKey == "" {
+			return c.Next()
+		}
+
+		scope := writeScope
+		if c.Method() == fiber.MethodGet || c.Method() == fiber.MethodHead {
+			scope = readScope
+		}
+		if !slices.Contains(user.Scopes, scope) {
+			return c.Status(fiber.StatusForbidden).JSON(models.MessageResponse{Message: ports.ErrMissingScope.Error() + " " + scope})
+		}
+		return c.Next()
+	}
+}
+
+// DenyAPIKey refuses the API keys on the routes managing the account of a user,
+// its password, second factor and API keys need the user itself.
+func DenyAPIKey(c *fiber.Ctx) error {
+	if CurrentUser(c).APIKey != "" {
+		return c.Status(fiber.StatusForbidden).JSON(models.MessageResponse{Message: "not allowed with an API key"})
+	}
+	return c.Next()
+}
@@ -0,0 +1,22 @@
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/etag"
+)
+
+// productCacheControl lets clients keep product responses but makes them
+// revalidate with If-None-Match, products change at any time.
+const productCacheControl = "private, no-cache"
+
+// Revalidate tags successful responses with an ETag, answers 304 Not Modified
+// when the If-None-Match header has the same tag and sets Cache-Control.
+func Revalidate() fiber.Handler {
+	tag := etag.New()
+
+	return func(c *fiber.Ctx) error {
+		c.Set(fiber.HeaderCacheControl, productCacheControl)
+		c.Vary(fiber.HeaderAuthorization)
+		return tag(c)
+	}
+}
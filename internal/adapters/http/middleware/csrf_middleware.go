@@ -0,0 +1,97 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"time"
+
+	"github.com/WarisLi/Golang-mini-project/internal/core/models"
+	"github.com/gofiber/contrib/websocket"
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	// TokenCookie carries the access token of the browsers, out of reach of the scripts.
+	TokenCookie = "jwt"
+	// CSRFCookie carries the CSRF token, which the scripts of the site send back in CSRFHeader.
+	CSRFCookie = "csrf_token"
+	CSRFHeader = "X-CSRF-Token"
+	// csrfQuery carries the CSRF token of the WebSocket upgrades, which cannot set headers.
+	csrfQuery = "csrf_token"
+)
+
+// CookieOptions are the attributes of the token and CSRF cookies.
+type CookieOptions struct {
+	Secure bool
+	// SameSite is Strict, Lax or None.
+	SameSite string
+	// Domain is empty for the host of the request.
+	Domain string
+	// TTL is the lifetime of the cookies, the one of the access tokens.
+	TTL time.Duration
+}
+
+// SetTokenCookies stores the access token in an HttpOnly cookie and a new CSRF token in a
+// cookie the scripts of the site can read.
+func SetTokenCookies(c *fiber.Ctx, token string, options CookieOptions) error {
+	csrf := make([]byte, 32)
+	if _, err := rand.Read(csrf); err != nil {
+		return err
+	}
+
+	c.Cookie(newCookie(TokenCookie, token, true, options))
+	c.Cookie(newCookie(CSRFCookie, hex.EncodeToString(csrf), false, options))
+	return nil
+}
+
+// ClearTokenCookies expires the token and CSRF cookies.
+func ClearTokenCookies(c *fiber.Ctx, options CookieOptions) {
+	options.TTL = 0
+	for _, name := range []string{TokenCookie, CSRFCookie} {
+		cookie := newCookie(name, "", name == TokenCookie, options)
+		cookie.Expires = time.Unix(0, 0)
+		cookie.MaxAge = -1
+		c.Cookie(cookie)
+	}
+}
+
+func newCookie(name string, value string, httpOnly bool, options CookieOptions) *fiber.Cookie {
+	return &fiber.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		Domain:   options.Domain,
+		Expires:  time.Now().Add(options.TTL),
+		MaxAge:   int(options.TTL.Seconds()),
+		Secure:   options.Secure,
+		HTTPOnly: httpOnly,
+		SameSite: options.SameSite,
+	}
+}
+
+// CSRF refuses the mutating requests authenticated with the token cookie which do not send
+// the CSRF token of the cookie back, the pages of other sites cannot read it (double submit).
+// It runs after JWTAuthMiddleware, the requests of the Authorization header and of the API
+// keys are not sent by the browsers on their own and are not checked.
+func CSRF(c *fiber.Ctx) error {
+	if !CurrentUser(c).TokenCookie {
+		return c.Next()
+	}
+
+	var submitted string
+	switch {
+	case websocket.IsWebSocketUpgrade(c):
+		submitted = c.Query(csrfQuery)
+	case c.Method() == fiber.MethodGet || c.Method() == fiber.MethodHead || c.Method() == fiber.MethodOptions:
+		return c.Next()
+	default:
+		submitted = c.Get(CSRFHeader)
+	}
+
+	expected := c.Cookies(CSRFCookie)
+	if expected == "" || subtle.ConstantTimeCompare([]byte(submitted), []byte(expected)) != 1 {
+		return c.Status(fiber.StatusForbidden).JSON(models.MessageResponse{Message: "missing or invalid CSRF token"})
+	}
+	return c.Next()
+}
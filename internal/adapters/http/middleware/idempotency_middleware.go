@@ -0,0 +1,99 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+
+	"github.com/WarisLi/Golang-mini-project/internal/core/models"
+	"github.com/WarisLi/Golang-mini-project/internal/core/ports"
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	IdempotencyKeyHeader     = "Idempotency-Key"
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+	maxIdempotencyKeyLength  = 255
+)
+
+// Idempotency stores the response of mutating requests sent with an
+// Idempotency-Key header and replays it when the request is retried with the
+// same key. Keys are scoped to the authenticated user, or to the client IP for
+// the anonymous requests such as the sign-up. Server errors are not stored so
+// the request can be retried.
+func Idempotency(service ports.IdempotencyService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		key := c.Get(IdempotencyKeyHeader)
+		if key == "" {
+			return c.Next()
+		}
+		switch c.Method() {
+		case fiber.MethodPost, fiber.MethodPut, fiber.MethodPatch, fiber.MethodDelete:
+		default:
+			return c.Next()
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			return c.Status(fiber.StatusBadRequest).JSON(models.MessageResponse{Message: "idempotency key is too long"})
+		}
+
+		scope := idempotencyScope(c)
+
+		stored, err := service.Begin(scope, key, requestHash(c))
+		switch {
+		case errors.Is(err, ports.ErrIdempotencyKeyInProgress):
+			return c.Status(fiber.StatusConflict).JSON(models.MessageResponse{Message: err.Error()})
+		case errors.Is(err, ports.ErrIdempotencyKeyMismatch):
+			return c.Status(fiber.StatusUnprocessableEntity).JSON(models.MessageResponse{Message: err.Error()})
+		case err != nil:
+			return c.Status(fiber.StatusInternalServerError).JSON(models.MessageResponse{Message: err.Error()})
+		}
+
+		if stored != nil {
+			c.Set(IdempotentReplayedHeader, "true")
+			if stored.ContentType != "" {
+				c.Set(fiber.HeaderContentType, stored.ContentType)
+			}
+			return c.Status(stored.StatusCode).Send(stored.Body)
+		}
+
+		if err := c.Next(); err != nil {
+			if releaseErr := service.Release(scope, key); releaseErr != nil {
+				log.Printf("Idempotency key release failed %s\n", releaseErr)
+			}
+			return err
+		}
+
+		response := c.Response()
+		if response.StatusCode() >= fiber.StatusInternalServerError {
+			err = service.Release(scope, key)
+		} else {
+			err = service.Complete(scope, key, response.StatusCode(), string(response.Header.ContentType()), response.Body())
+		}
+		if err != nil {
+			log.Printf("Idempotency key update failed %s\n", err)
+		}
+
+		return nil
+	}
+}
+
+// idempotencyScope returns the namespace of the keys of a request, the prefixes keep
+// a username from colliding with a client IP.
+func idempotencyScope(c *fiber.Ctx) string {
+	if user, ok := c.Locals(userContextKey).(*UserData); ok {
+		return "user:" + user.Username
+	}
+	return "ip:" + ClientIP(c)
+}
+
+// requestHash identifies a request by its method, URL and body.
+func requestHash(c *fiber.Ctx) string {
+	hash := sha256.New()
+	hash.Write([]byte(c.Method()))
+	hash.Write([]byte{0})
+	hash.Write([]byte(c.OriginalURL()))
+	hash.Write([]byte{0})
+	hash.Write(c.Body())
+	return hex.EncodeToString(hash.Sum(nil))
+}
@@ -9,20 +9,40 @@ import (
 type UserData struct {
 	Username string
 	Role     string
+	// SessionID is empty in the tokens issued before session IDs.
+	SessionID string
+	// SessionVersion is zero in the tokens issued before session versions.
+	SessionVersion int
+	// APIKey is the key ID of the API key of the request, empty for the tokens.
+	APIKey string
+	// Scopes are the scopes of the API key, the tokens have every scope.
+	Scopes []string
+	// TokenCookie is true when the token was read from the cookie, the request is checked by CSRF.
+	TokenCookie bool
 }
 
 // userContextKey is the key used to store user data in the Fiber context
 const userContextKey = "user"
 
 func JWTAuthMiddleware(c *fiber.Ctx) error {
+	// The request was authenticated with an API key
+	if APIKeyAuthenticated(c) {
+		return c.Next()
+	}
+
 	user := &UserData{}
 
 	// Extract the token from the Fiber context (inserted by the JWT middleware)
 	token := c.Locals("user").(*jwt.Token)
 	claims := token.Claims.(jwt.MapClaims)
 
-	user.Username = claims["username"].(string)
+	user.Username, _ = claims.GetSubject()
 	user.Role = claims["role"].(string)
+	user.SessionID, _ = claims["sid"].(string)
+	if version, ok := claims["ver"].(float64); ok {
+		user.SessionVersion = int(version)
+	}
+	user.TokenCookie = c.Get(fiber.HeaderAuthorization) == "" && token.Raw == c.Cookies(TokenCookie)
 
 	// Store the user data in the Fiber context
 	c.Locals(userContextKey, user)
@@ -30,6 +50,11 @@ func JWTAuthMiddleware(c *fiber.Ctx) error {
 	return c.Next()
 }
 
+// CurrentUser returns the user data stored by JWTAuthMiddleware.
+func CurrentUser(c *fiber.Ctx) *UserData {
+	return c.Locals(userContextKey).(*UserData)
+}
+
 func CheckRole(c *fiber.Ctx) error {
 	user := c.Locals(userContextKey).(*UserData)
 
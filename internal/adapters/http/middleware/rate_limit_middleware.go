@@ -0,0 +1,108 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/WarisLi/Golang-mini-project/internal/core/models"
+	"github.com/WarisLi/Golang-mini-project/internal/core/ports"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// RateLimitRule allows Limit requests per Window for each key of a client.
+type RateLimitRule struct {
+	// Name scopes the counters of the rule, e.g. "login-ip".
+	Name   string
+	Limit  int
+	Window time.Duration
+	// Key identifies the client of a request, requests without a key are not counted.
+	Key func(c *fiber.Ctx) string
+}
+
+// RateLimit answers 429 Too Many Requests with a Retry-After header once a client
+// exceeds one of the rules, rules with a zero Limit are skipped. Requests are let
+// through when the limiter fails so that its storage being down does not take the API down.
+func RateLimit(limiter ports.RateLimiter, rules ...RateLimitRule) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		for _, rule := range rules {
+			if rule.Limit <= 0 {
+				continue
+			}
+			key := rule.Key(c)
+			if key == "" {
+				continue
+			}
+
+			limit, err := limiter.Allow(rule.Name+":"+key, rule.Limit, rule.Window)
+			if err != nil {
+				log.Printf("Rate limit %s failed %s\n", rule.Name, err)
+				continue
+			}
+			if !limit.Allowed {
+				SetRetryAfter(c, limit.RetryAfter)
+				return c.Status(fiber.StatusTooManyRequests).JSON(models.MessageResponse{Message: "too many requests"})
+			}
+		}
+
+		return c.Next()
+	}
+}
+
+// SetRetryAfter sets the Retry-After header in whole seconds, rounded up.
+func SetRetryAfter(c *fiber.Ctx, retryAfter time.Duration) {
+	seconds := int64((retryAfter + time.Second - 1) / time.Second)
+	c.Set(fiber.HeaderRetryAfter, strconv.FormatInt(max(seconds, 1), 10))
+}
+
+// ClientIP keys the requests by the IP address of the client.
+func ClientIP(c *fiber.Ctx) string {
+	return c.IP()
+}
+
+// LoginUsername keys the login requests by the username of their body, or by the
+// subject of their two-factor challenge token. The token is not verified here, a
+// forged one is refused by the login and only counts against the user it names.
+func LoginUsername(c *fiber.Ctx) string {
+	var login struct {
+		models.UsernamePassword
+		ChallengeToken string `json:"challenge_token"`
+	}
+	if err := c.BodyParser(&login); err != nil {
+		return ""
+	}
+	if login.Username != "" || login.ChallengeToken == "" {
+		return login.Username
+	}
+
+	claims := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(login.ChallengeToken, claims); err != nil {
+		return ""
+	}
+	subject, _ := claims.GetSubject()
+	return subject
+}
+
+// AccessToken keys the requests by a hash of their bearer token, from the
+// Authorization header, the access_token query or the token cookie, or of their API key.
+func AccessToken(c *fiber.Ctx) string {
+	token := c.Cookies(TokenCookie)
+	if query := c.Query("access_token"); query != "" {
+		token = query
+	}
+	if authorization := c.Get(fiber.HeaderAuthorization); authorization != "" {
+		token = strings.TrimPrefix(authorization, "Bearer ")
+	}
+	if key := c.Get(APIKeyHeader); key != "" {
+		token = key
+	}
+	if token == "" {
+		return ""
+	}
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
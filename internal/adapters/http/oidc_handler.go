@@ -0,0 +1,140 @@
+package http
+
+import (
+	"crypto/subtle"
+	"errors"
+	"time"
+
+	"github.com/WarisLi/Golang-mini-project/internal/adapters/http/middleware"
+	"github.com/WarisLi/Golang-mini-project/internal/core/models"
+	"github.com/WarisLi/Golang-mini-project/internal/core/ports"
+	"github.com/gofiber/fiber/v2"
+)
+
+// oidcStateCookie holds the state of the login started by the browser, the callback of
+// a login started in another browser is refused.
+const oidcStateCookie = "oidc_state"
+
+type HttpOIDCHandler struct {
+	service ports.OIDCService
+	cookies middleware.CookieOptions
+	// afterLoginURL receives the browsers after a login, with the token in the cookies.
+	// The callback returns the token when it is empty.
+	afterLoginURL string
+}
+
+func NewHttpOIDCHandler(service ports.OIDCService, cookies middleware.CookieOptions, afterLoginURL string) *HttpOIDCHandler {
+	return &HttpOIDCHandler{service: service, cookies: cookies, afterLoginURL: afterLoginURL}
+}
+
+// Handler functions
+// GetOIDCProviders godoc
+// @Summary List the identity providers
+// @Description List the OpenID Connect providers the users can log in with
+// @Tags user
+// @Produce  json
+// @Success 200 {array} models.OIDCProviderResponse
+// @Router /user/oidc [get]
+func (h *HttpOIDCHandler) GetOIDCProviders(c *fiber.Ctx) error {
+	providers := []models.OIDCProviderResponse{}
+	for _, name := range h.service.Providers() {
+		providers = append(providers, models.OIDCProviderResponse{Name: name, LoginURL: "/user/oidc/" + name + "/login"})
+	}
+	return c.JSON(providers)
+}
+
+// Handler functions
+// LoginOIDC godoc
+// @Summary Log in with an identity provider
+// @Description Redirect the browser to the OpenID Connect provider, which redirects it back to the callback
+// @Tags user
+// @Param provider path string true "Provider name"
+// @Success 302
+// @Failure 404 {object} models.MessageResponse "Unknown provider"
+// @Failure 502 {object} models.MessageResponse "Provider unavailable"
+// @Router /user/oidc/{provider}/login [get]
+func (h *HttpOIDCHandler) LoginOIDC(c *fiber.Ctx) error {
+	authorizationURL, state, err := h.service.BeginLogin(c.Params("provider"))
+	if err != nil {
+		return oidcError(c, err)
+	}
+
+	// The callback is a navigation from the provider, the cookie cannot be SameSite=Strict
+	c.Cookie(&fiber.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     "/user/oidc",
+		Domain:   h.cookies.Domain,
+		Secure:   h.cookies.Secure,
+		HTTPOnly: true,
+		SameSite: fiber.CookieSameSiteLaxMode,
+	})
+	return c.Redirect(authorizationURL, fiber.StatusFound)
+}
+
+// Handler functions
+// OIDCCallback godoc
+// @Summary Complete a login with an identity provider
+// @Description Redirect URL of the OpenID Connect provider. The user of the identity is created on its first login
+// @Description and its groups give its role. Sets the token cookies and redirects to the page after the login,
+// @Description or returns the token when there is none
+// @Tags user
+// @Produce  json
+// @Param provider path string true "Provider name"
+// @Param code query string true "Authorization code"
+// @Param state query string true "State of the login"
+// @Success 200 {object} models.LoginSuccess
+// @Success 303
+// @Failure 401 {object} models.MessageResponse "Invalid or expired login, or login refused by the provider"
+// @Failure 403 {object} models.MessageResponse "Identity not allowed or user disabled"
+// @Failure 409 {object} models.MessageResponse "Username of another user"
+// @Failure 502 {object} models.MessageResponse "Provider unavailable"
+// @Router /user/oidc/{provider}/callback [get]
+func (h *HttpOIDCHandler) OIDCCallback(c *fiber.Ctx) error {
+	if refused := c.Query("error"); refused != "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.MessageResponse{
+			Message: "login refused by the identity provider: " + refused + " " + c.Query("error_description"),
+		})
+	}
+
+	state := c.Query("state")
+	if state == "" || subtle.ConstantTimeCompare([]byte(state), []byte(c.Cookies(oidcStateCookie))) != 1 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.MessageResponse{Message: ports.ErrInvalidOIDCLogin.Error()})
+	}
+	c.Cookie(&fiber.Cookie{
+		Name:    oidcStateCookie,
+		Path:    "/user/oidc",
+		Domain:  h.cookies.Domain,
+		Expires: time.Unix(0, 0),
+		MaxAge:  -1,
+	})
+
+	token, err := h.service.CompleteLogin(c.Params("provider"), state, c.Query("code"))
+	if err != nil {
+		return oidcError(c, err)
+	}
+
+	if err := middleware.SetTokenCookies(c, token, h.cookies); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.MessageResponse{Message: err.Error()})
+	}
+	if h.afterLoginURL != "" {
+		return c.Redirect(h.afterLoginURL, fiber.StatusSeeOther)
+	}
+	return c.JSON(models.LoginSuccess{Message: "Login success", Token: token})
+}
+
+func oidcError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, ports.ErrUnknownIdentityProvider):
+		return c.Status(fiber.StatusNotFound).JSON(models.MessageResponse{Message: err.Error()})
+	case errors.Is(err, ports.ErrInvalidOIDCLogin):
+		return c.Status(fiber.StatusUnauthorized).JSON(models.MessageResponse{Message: err.Error()})
+	case errors.Is(err, ports.ErrOIDCAccessDenied) || errors.Is(err, ports.ErrOIDCUnknownUser) || errors.Is(err, ports.ErrUserDisabled):
+		return c.Status(fiber.StatusForbidden).JSON(models.MessageResponse{Message: err.Error()})
+	case errors.Is(err, ports.ErrIdentityConflict):
+		return c.Status(fiber.StatusConflict).JSON(models.MessageResponse{Message: err.Error()})
+	case errors.Is(err, ports.ErrIdentityProvider):
+		return c.Status(fiber.StatusBadGateway).JSON(models.MessageResponse{Message: err.Error()})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(models.MessageResponse{Message: err.Error()})
+}
@@ -1,12 +1,20 @@
 package http
 
 import (
+	"errors"
 	"strconv"
+	"strings"
 
 	"github.com/WarisLi/Golang-mini-project/internal/core/models"
 	"github.com/WarisLi/Golang-mini-project/internal/core/ports"
 	"github.com/go-playground/validator/v10"
 	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+const (
+	mergePatchContentType = "application/merge-patch+json"
+	jsonPatchContentType  = "application/json-patch+json"
 )
 
 type HttpProductHandler struct {
@@ -20,16 +28,23 @@ func NewHttpProductHandler(service ports.ProductService) *HttpProductHandler {
 // Handler functions
 // GetProducts godoc
 // @Summary Get all products
-// @Description Get details of all products
+// @Description Get a page of the products
 // @Tags product
 // @Accept  json
 // @Produce  json
 // @Security ApiKeyAuth
-// @Success 200 {array} ports.Product
+// @Param page query int false "Page, from 1"
+// @Param page_size query int false "Page size, up to 100"
+// @Success 200 {object} models.Page[models.Product]
 // @Router /product [get]
 func (h *HttpProductHandler) GetProducts(c *fiber.Ctx) error {
+	var request models.PageRequest
+	if err := c.QueryParser(&request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.MessageResponse{Message: err.Error()})
+	}
+
 	// call primary port function
-	products, err := h.service.GetProducts()
+	products, err := h.service.ListProducts(request)
 	if err != nil {
 		return c.SendStatus(fiber.StatusBadRequest)
 	}
@@ -73,6 +88,7 @@ func (h *HttpProductHandler) GetProduct(c *fiber.Ctx) error {
 // @Security ApiKeyAuth
 // @Success 200 {object} models.MessageResponse
 // @Param product body models.ProductInput true "Product"
+// @Param Idempotency-Key header string false "Replays the stored response when the request is retried"
 // @Router /product [POST]
 func (h *HttpProductHandler) CreateProduct(c *fiber.Ctx) error {
 	var product models.ProductInput
@@ -101,8 +117,10 @@ func (h *HttpProductHandler) CreateProduct(c *fiber.Ctx) error {
 // @Produce  json
 // @Security ApiKeyAuth
 // @Success 200 {object} models.MessageResponse
+// @Failure 404 {object} models.MessageResponse "Product not found"
 // @Param product body models.ProductInput true "Product"
 // @Param id path uint true "ID"
+// @Param Idempotency-Key header string false "Replays the stored response when the request is retried"
 // @Router /product/{id} [PUT]
 func (h *HttpProductHandler) UpdateProduct(c *fiber.Ctx) error {
 	productId, err := strconv.Atoi(c.Params("id"))
@@ -120,13 +138,110 @@ func (h *HttpProductHandler) UpdateProduct(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(models.MessageResponse{Message: err.Error()})
 	}
 
-	if err := h.service.UpdateProduct(uint(productId), *productUpdate); err != nil {
+	err = h.service.UpdateProduct(uint(productId), *productUpdate)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(models.MessageResponse{Message: "product not found"})
+	}
+	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(models.MessageResponse{Message: err.Error()})
 	}
 
 	return c.Status(fiber.StatusOK).JSON(models.MessageResponse{Message: "success"})
 }
 
+// Handler functions
+// PatchProduct godoc
+// @Summary Patch product
+// @Description Partially update a product with a JSON Merge Patch (application/merge-patch+json, RFC 7396)
+// @Description or a JSON Patch (application/json-patch+json, RFC 6902)
+// @Tags product
+// @Accept  application/merge-patch+json,application/json-patch+json
+// @Produce  json
+// @Security ApiKeyAuth
+// @Success 200 {object} models.Product
+// @Failure 409 {object} models.MessageResponse "JSON Patch test operation failed"
+// @Failure 422 {object} models.MessageResponse "Patched product is invalid"
+// @Param patch body object true "Patch"
+// @Param id path uint true "ID"
+// @Param Idempotency-Key header string false "Replays the stored response when the request is retried"
+// @Router /product/{id} [PATCH]
+func (h *HttpProductHandler) PatchProduct(c *fiber.Ctx) error {
+	productId, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.MessageResponse{Message: err.Error()})
+	}
+
+	var product *models.Product
+	switch mediaType, _, _ := strings.Cut(c.Get(fiber.HeaderContentType), ";"); strings.TrimSpace(mediaType) {
+	case mergePatchContentType, fiber.MIMEApplicationJSON:
+		product, err = h.service.MergePatchProduct(uint(productId), c.Body())
+	case jsonPatchContentType:
+		product, err = h.service.JSONPatchProduct(uint(productId), c.Body())
+	default:
+		return c.Status(fiber.StatusUnsupportedMediaType).JSON(models.MessageResponse{
+			Message: "use " + mergePatchContentType + " or " + jsonPatchContentType,
+		})
+	}
+
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(models.MessageResponse{Message: "product not found"})
+	case errors.Is(err, ports.ErrInvalidPatch):
+		return c.Status(fiber.StatusBadRequest).JSON(models.MessageResponse{Message: err.Error()})
+	case errors.Is(err, ports.ErrPatchTestFailed):
+		return c.Status(fiber.StatusConflict).JSON(models.MessageResponse{Message: err.Error()})
+	case errors.Is(err, ports.ErrInvalidProduct):
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(models.MessageResponse{Message: err.Error()})
+	case err != nil:
+		return c.Status(fiber.StatusInternalServerError).JSON(models.MessageResponse{Message: err.Error()})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(product)
+}
+
+// Handler functions
+// BatchProducts godoc
+// @Summary Batch product operations
+// @Description Apply create, update and delete operations, atomically in one transaction or each on its own
+// @Tags product
+// @Accept  json
+// @Produce  json
+// @Security ApiKeyAuth
+// @Success 200 {object} models.ProductBatchResponse "Every operation succeeded"
+// @Success 207 {object} models.ProductBatchResponse "Some operations failed"
+// @Failure 413 {object} models.MessageResponse "Too many operations"
+// @Failure 422 {object} models.ProductBatchResponse "Atomic batch failed, nothing was applied"
+// @Param batch body models.ProductBatchRequest true "Operations"
+// @Param Idempotency-Key header string false "Replays the stored response when the request is retried"
+// @Router /product/batch [POST]
+func (h *HttpProductHandler) BatchProducts(c *fiber.Ctx) error {
+	var request models.ProductBatchRequest
+	if err := c.BodyParser(&request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.MessageResponse{Message: err.Error()})
+	}
+
+	var validate = validator.New()
+	if err := validate.Struct(request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.MessageResponse{Message: err.Error()})
+	}
+
+	response, err := h.service.BatchProducts(request)
+	if errors.Is(err, ports.ErrBatchTooLarge) {
+		return c.Status(fiber.StatusRequestEntityTooLarge).JSON(models.MessageResponse{Message: err.Error()})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.MessageResponse{Message: err.Error()})
+	}
+
+	switch {
+	case response.Failed == 0:
+		return c.Status(fiber.StatusOK).JSON(response)
+	case response.Atomic:
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(response)
+	}
+	return c.Status(fiber.StatusMultiStatus).JSON(response)
+}
+
 // Handler functions
 // DeleteProduct godoc
 // @Summary Delete product
@@ -136,7 +251,9 @@ func (h *HttpProductHandler) UpdateProduct(c *fiber.Ctx) error {
 // @Produce  json
 // @Security ApiKeyAuth
 // @Success 200 {object} models.MessageResponse
+// @Failure 404 {object} models.MessageResponse "Product not found"
 // @Param id path uint true "ID"
+// @Param Idempotency-Key header string false "Replays the stored response when the request is retried"
 // @Router /product/{id} [DELETE]
 func (h *HttpProductHandler) DeleteProduct(c *fiber.Ctx) error {
 	productId, err := strconv.Atoi(c.Params("id"))
@@ -145,6 +262,9 @@ func (h *HttpProductHandler) DeleteProduct(c *fiber.Ctx) error {
 	}
 
 	err = h.service.DeleteProduct(uint(productId))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(models.MessageResponse{Message: "product not found"})
+	}
 	if err != nil {
 		return c.SendStatus(fiber.StatusBadRequest)
 	}
@@ -0,0 +1,48 @@
+package http
+
+import (
+	"errors"
+
+	"github.com/WarisLi/Golang-mini-project/internal/core/models"
+	"github.com/WarisLi/Golang-mini-project/internal/core/ports"
+	"github.com/gofiber/fiber/v2"
+)
+
+type HttpProductSearchHandler struct {
+	service ports.ProductSearchService
+}
+
+func NewHttpProductSearchHandler(service ports.ProductSearchService) *HttpProductSearchHandler {
+	return &HttpProductSearchHandler{service: service}
+}
+
+// Handler functions
+// SearchProducts godoc
+// @Summary Search products
+// @Description Full-text search over the name, SKU and description of the products, best matches first.
+// @Description Misspelled queries fall back to similar products, marked as fuzzy.
+// @Tags product
+// @Accept  json
+// @Produce  json
+// @Security ApiKeyAuth
+// @Param q query string true "Search query"
+// @Param page query int false "Page, from 1"
+// @Param page_size query int false "Page size, up to 100"
+// @Success 200 {object} models.Page[models.ProductSearchResult]
+// @Router /product/search [get]
+func (h *HttpProductSearchHandler) SearchProducts(c *fiber.Ctx) error {
+	var query models.ProductSearchQuery
+	if err := c.QueryParser(&query); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.MessageResponse{Message: err.Error()})
+	}
+
+	results, err := h.service.SearchProducts(query)
+	if errors.Is(err, ports.ErrInvalidSearch) {
+		return c.Status(fiber.StatusBadRequest).JSON(models.MessageResponse{Message: err.Error()})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.MessageResponse{Message: err.Error()})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(results)
+}
@@ -0,0 +1,260 @@
+package http
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/WarisLi/Golang-mini-project/internal/adapters/http/middleware"
+	"github.com/WarisLi/Golang-mini-project/internal/core/models"
+	"github.com/WarisLi/Golang-mini-project/internal/core/ports"
+	"github.com/gofiber/contrib/websocket"
+	"github.com/gofiber/fiber/v2"
+)
+
+// streamHeartbeat is the interval of the keep-alive messages sent to idle stream clients.
+const streamHeartbeat = 15 * time.Second
+
+// streamRequestKey is the key of the parsed stream request in the Fiber context.
+const streamRequestKey = "productStream"
+
+type productStreamRequest struct {
+	filter      models.ProductStreamFilter
+	lastEventID uint64
+	user        *middleware.UserData
+}
+
+type HttpProductStreamHandler struct {
+	service       ports.ProductStreamService
+	userService   ports.UserService
+	apiKeyService ports.APIKeyService
+	// sessionCheckInterval is how often the session of a client is checked again.
+	sessionCheckInterval time.Duration
+}
+
+// NewHttpProductStreamHandler returns the stream handler. The streams are closed once
+// the session of their client is invalidated, its user disabled or its API key revoked,
+// which is checked every sessionCheckInterval or, when it is not positive, every heartbeat.
+func NewHttpProductStreamHandler(service ports.ProductStreamService, userService ports.UserService, apiKeyService ports.APIKeyService, sessionCheckInterval time.Duration) *HttpProductStreamHandler {
+	if sessionCheckInterval <= 0 {
+		sessionCheckInterval = streamHeartbeat
+	}
+
+	return &HttpProductStreamHandler{
+		service:              service,
+		userService:          userService,
+		apiKeyService:        apiKeyService,
+		sessionCheckInterval: sessionCheckInterval,
+	}
+}
+
+// parseProductStreamRequest reads the product and category filters and the
+// ID of the last event received, from the Last-Event-ID header or the last_event_id query.
+func parseProductStreamRequest(c *fiber.Ctx) (*productStreamRequest, error) {
+	request := &productStreamRequest{user: middleware.CurrentUser(c)}
+
+	for _, value := range strings.Split(c.Query("product"), ",") {
+		if value = strings.TrimSpace(value); value == "" {
+			continue
+		}
+		id, err := strconv.ParseUint(value, 10, 0)
+		if err != nil {
+			return nil, fmt.Errorf("invalid product %q", value)
+		}
+		request.filter.ProductIDs = append(request.filter.ProductIDs, uint(id))
+	}
+	for _, value := range strings.Split(c.Query("category"), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			request.filter.Categories = append(request.filter.Categories, value)
+		}
+	}
+
+	if lastEventID := c.Get("Last-Event-ID", c.Query("last_event_id")); lastEventID != "" {
+		id, err := strconv.ParseUint(lastEventID, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid last event ID %q", lastEventID)
+		}
+		request.lastEventID = id
+	}
+
+	return request, nil
+}
+
+// sessionValid reports whether the client of a stream may keep receiving it. A session
+// that cannot be checked is kept, the stream is not closed by a database outage.
+func (h *HttpProductStreamHandler) sessionValid(user *middleware.UserData) bool {
+	var err error
+	if user.APIKey != "" {
+		err = h.apiKeyService.CheckAPIKey(user.APIKey)
+	} else {
+		err = h.userService.CheckSession(user.Username, user.SessionID, user.SessionVersion, user.Role)
+	}
+	if errors.Is(err, ports.ErrInvalidSession) || errors.Is(err, ports.ErrInvalidAPIKey) {
+		return false
+	}
+	if err != nil {
+		log.Printf("Stream session check of %s failed %s\n", user.Username, err)
+	}
+	return true
+}
+
+// Handler functions
+// StreamProducts godoc
+// @Summary Stream product changes
+// @Description Server-Sent Events stream of product create, update, delete and low quantity events
+// @Tags product
+// @Produce  text/event-stream
+// @Security ApiKeyAuth
+// @Param product query string false "Comma separated product IDs"
+// @Param category query string false "Comma separated categories"
+// @Param last_event_id query uint false "Resume after this event ID, same as the Last-Event-ID header"
+// @Success 200 {object} models.ProductStreamEvent
+// @Router /stream/product [get]
+func (h *HttpProductStreamHandler) StreamProducts(c *fiber.Ctx) error {
+	request, err := parseProductStreamRequest(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.MessageResponse{Message: err.Error()})
+	}
+
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+
+	subscription, replay := h.service.Subscribe(request.filter, request.lastEventID)
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer h.service.Unsubscribe(subscription)
+
+		fmt.Fprintf(w, "retry: %d\n\n", (3 * time.Second).Milliseconds())
+		for _, event := range replay {
+			if err := writeServerSentEvent(w, event); err != nil {
+				return
+			}
+		}
+		if err := w.Flush(); err != nil {
+			return
+		}
+
+		heartbeat := time.NewTicker(streamHeartbeat)
+		defer heartbeat.Stop()
+		sessionCheck := time.NewTicker(h.sessionCheckInterval)
+		defer sessionCheck.Stop()
+		for {
+			select {
+			case event, ok := <-subscription.Events:
+				if !ok {
+					return
+				}
+				if err := writeServerSentEvent(w, event); err != nil {
+					return
+				}
+			case <-heartbeat.C:
+				fmt.Fprint(w, ": ping\n\n")
+			case <-sessionCheck.C:
+				if !h.sessionValid(request.user) {
+					return
+				}
+				continue
+			}
+			// Flush fails once the client is gone
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	})
+
+	return nil
+}
+
+func writeServerSentEvent(w *bufio.Writer, event models.ProductStreamEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+	return err
+}
+
+// UpgradeProductStream validates a WebSocket stream request before the connection is upgraded.
+func (h *HttpProductStreamHandler) UpgradeProductStream(c *fiber.Ctx) error {
+	if !websocket.IsWebSocketUpgrade(c) {
+		return fiber.ErrUpgradeRequired
+	}
+
+	request, err := parseProductStreamRequest(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.MessageResponse{Message: err.Error()})
+	}
+	c.Locals(streamRequestKey, request)
+
+	return c.Next()
+}
+
+// Handler functions
+// StreamProductsWebSocket godoc
+// @Summary Stream product changes over WebSocket
+// @Description WebSocket stream of product create, update, delete and low quantity events, one JSON message per event
+// @Tags product
+// @Security ApiKeyAuth
+// @Param product query string false "Comma separated product IDs"
+// @Param category query string false "Comma separated categories"
+// @Param last_event_id query uint false "Resume after this event ID"
+// @Success 101 {object} models.ProductStreamEvent
+// @Router /stream/product/ws [get]
+func (h *HttpProductStreamHandler) StreamProductsWebSocket(conn *websocket.Conn) {
+	request := conn.Locals(streamRequestKey).(*productStreamRequest)
+
+	subscription, replay := h.service.Subscribe(request.filter, request.lastEventID)
+	defer h.service.Unsubscribe(subscription)
+
+	// The client only sends control messages, reading ends when it goes away
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	for _, event := range replay {
+		if err := conn.WriteJSON(event); err != nil {
+			return
+		}
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	sessionCheck := time.NewTicker(h.sessionCheckInterval)
+	defer sessionCheck.Stop()
+	for {
+		select {
+		case event, ok := <-subscription.Events:
+			if !ok {
+				conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "stream lagging, resume from the last event ID"))
+				return
+			}
+			if err := conn.WriteJSON(event); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		case <-sessionCheck.C:
+			if !h.sessionValid(request.user) {
+				conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "session invalidated"))
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
@@ -1,20 +1,33 @@
 package http
 
 import (
-	"os"
-
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/expvar"
 	"github.com/gofiber/fiber/v2/middleware/logger"
 
 	"github.com/WarisLi/Golang-mini-project/internal/adapters/http/middleware"
+	"github.com/WarisLi/Golang-mini-project/internal/core/models"
 	jwtware "github.com/gofiber/contrib/jwt"
+	"github.com/gofiber/contrib/websocket"
 	"github.com/gofiber/swagger"
 )
 
 func SetupRoutes(
 	app *fiber.App,
 	productHandler *HttpProductHandler,
+	productSearchHandler *HttpProductSearchHandler,
 	userHandler *HttpUserHandler,
+	userAdminHandler *HttpUserAdminHandler,
+	tokenHandler *HttpTokenHandler,
+	oidcHandler *HttpOIDCHandler,
+	apiKeyHandler *HttpAPIKeyHandler,
+	deadLetterHandler *HttpDeadLetterHandler,
+	webhookHandler *HttpWebhookHandler,
+	productStreamHandler *HttpProductStreamHandler,
+	idempotency fiber.Handler,
+	loginRateLimit fiber.Handler,
+	apiRateLimit fiber.Handler,
+	apiKeyAuth fiber.Handler,
 ) {
 	app.Get("/swagger/*", swagger.HandlerDefault) // default
 
@@ -23,21 +36,122 @@ func SetupRoutes(
 		TimeZone: "Asia/Bangkok",
 	}))
 
+	// Public keys of the access tokens, for the services verifying them
+	app.Get("/.well-known/jwks.json", tokenHandler.GetJWKS)
+
 	userGroup := app.Group("/user")
-	userGroup.Post("", userHandler.CreateUser)
-	userGroup.Post("/login", userHandler.LoginUser)
+	// The sign-up keys are scoped to the client IP
+	userGroup.Post("", idempotency, userHandler.CreateUser)
+	userGroup.Post("/login", loginRateLimit, userHandler.LoginUser)
+	userGroup.Post("/login/2fa", loginRateLimit, userHandler.LoginTwoFactor)
+	userGroup.Post("/login/2fa/enroll", loginRateLimit, userHandler.EnrollTOTPChallenge)
+	userGroup.Post("/password/forgot", loginRateLimit, userHandler.ForgotPassword)
+	userGroup.Post("/password/reset", loginRateLimit, userHandler.ResetPassword)
+	userGroup.Post("/logout", userHandler.Logout)
+	// Logins with the OpenID Connect providers
+	userGroup.Get("/oidc", oidcHandler.GetOIDCProviders)
+	userGroup.Get("/oidc/:provider/login", loginRateLimit, oidcHandler.LoginOIDC)
+	userGroup.Get("/oidc/:provider/callback", loginRateLimit, oidcHandler.OIDCCallback)
 
+	// Product changes for every authenticated user. Browsers cannot set headers on
+	// EventSource and WebSocket requests, so the token is also read from the access_token query
+	// and the token cookie.
+	streamGroup := app.Group("/stream")
+	streamGroup.Use(apiKeyAuth)
+	streamGroup.Use(jwtware.New(jwtware.Config{
+		Filter:      middleware.APIKeyAuthenticated,
+		KeyFunc:     tokenHandler.Keyfunc,
+		TokenLookup: "header:" + fiber.HeaderAuthorization + ",query:access_token,cookie:" + middleware.TokenCookie,
+		AuthScheme:  "Bearer",
+	}))
+	streamGroup.Use(middleware.JWTAuthMiddleware)
+	streamGroup.Use(userHandler.CheckSession)
+	streamGroup.Use(middleware.CSRF)
+	streamGroup.Use(apiRateLimit)
+	streamGroup.Use(middleware.RequireScope(models.ScopeProductRead))
+	streamGroup.Get("/product", productStreamHandler.StreamProducts)
+	streamGroup.Get("/product/ws", productStreamHandler.UpgradeProductStream, websocket.New(productStreamHandler.StreamProductsWebSocket))
+
+	// API keys of the machine-to-machine clients, the other requests need a token
+	// of the Authorization header or, for the browsers, of the token cookie
+	app.Use(apiKeyAuth)
 	app.Use(jwtware.New(jwtware.Config{
-		SigningKey: jwtware.SigningKey{Key: []byte(os.Getenv("JWT_SECRET"))},
+		Filter:      middleware.APIKeyAuthenticated,
+		KeyFunc:     tokenHandler.Keyfunc,
+		TokenLookup: "header:" + fiber.HeaderAuthorization + ",cookie:" + middleware.TokenCookie,
+		AuthScheme:  "Bearer",
 	}))
 	// Middleware to extract user data from JWT
 	app.Use(middleware.JWTAuthMiddleware)
+	// Tokens are refused once a password change or reset invalidated them
+	app.Use(userHandler.CheckSession)
+	// The mutating requests of the token cookie send the CSRF token back
+	app.Use(middleware.CSRF)
+	app.Use(apiRateLimit)
+
+	// The account of a user is managed with its token, not with its API keys
+	app.Put("/user/password", middleware.DenyAPIKey, idempotency, userHandler.ChangePassword)
+	app.Post("/user/2fa/totp", middleware.DenyAPIKey, idempotency, userHandler.EnrollTOTP)
+	app.Post("/user/2fa/totp/confirm", middleware.DenyAPIKey, idempotency, userHandler.ConfirmTOTP)
+	app.Delete("/user/2fa/totp", middleware.DenyAPIKey, idempotency, userHandler.DisableTOTP)
+	app.Post("/user/2fa/recovery-codes", middleware.DenyAPIKey, idempotency, userHandler.RegenerateRecoveryCodes)
+	app.Get("/user/api-keys", middleware.DenyAPIKey, apiKeyHandler.GetAPIKeys)
+	app.Post("/user/api-keys", middleware.DenyAPIKey, idempotency, apiKeyHandler.CreateAPIKey)
+	app.Post("/user/api-keys/:id/rotate", middleware.DenyAPIKey, idempotency, apiKeyHandler.RotateAPIKey)
+	app.Delete("/user/api-keys/:id", middleware.DenyAPIKey, idempotency, apiKeyHandler.RevokeAPIKey)
+
+	// Runtime and producer metrics
+	debugGroup := app.Group("/debug")
+	debugGroup.Use(middleware.CheckRole)
+	debugGroup.Use(middleware.RequireScope(models.ScopeAdmin))
+	debugGroup.Use(expvar.New())
 
 	productGroup := app.Group("/product")
 	productGroup.Use(middleware.CheckRole)
-	productGroup.Get("", productHandler.GetProducts)
-	productGroup.Get("/:id", productHandler.GetProduct)
+	productGroup.Use(middleware.RequireScopes(models.ScopeProductRead, models.ScopeProductWrite))
+	productGroup.Use(idempotency)
+	productGroup.Get("", middleware.Revalidate(), productHandler.GetProducts)
+	productGroup.Get("/search", productSearchHandler.SearchProducts)
+	productGroup.Get("/:id", middleware.Revalidate(), productHandler.GetProduct)
 	productGroup.Post("", productHandler.CreateProduct)
+	productGroup.Post("/batch", productHandler.BatchProducts)
 	productGroup.Put("/:id", productHandler.UpdateProduct)
+	productGroup.Patch("/:id", productHandler.PatchProduct)
 	productGroup.Delete("/:id", productHandler.DeleteProduct)
+
+	usersGroup := app.Group("/users")
+	usersGroup.Use(middleware.CheckRole)
+	usersGroup.Use(middleware.RequireScope(models.ScopeAdmin))
+	usersGroup.Use(idempotency)
+	usersGroup.Get("", userAdminHandler.GetUsers)
+	usersGroup.Post("/service-accounts", userAdminHandler.CreateServiceAccount)
+	usersGroup.Get("/:username", userAdminHandler.GetUser)
+	usersGroup.Put("/:username/role", userAdminHandler.SetUserRole)
+	usersGroup.Post("/:username/disable", userAdminHandler.DisableUser)
+	usersGroup.Post("/:username/enable", userAdminHandler.EnableUser)
+	usersGroup.Delete("/:username", userAdminHandler.DeleteUser)
+	usersGroup.Delete("/:username/2fa", userAdminHandler.ResetTwoFactor)
+	// API keys of the service accounts and of the other users
+	usersGroup.Get("/:username/api-keys", apiKeyHandler.GetAPIKeys)
+	usersGroup.Post("/:username/api-keys", apiKeyHandler.CreateAPIKey)
+	usersGroup.Post("/:username/api-keys/:id/rotate", apiKeyHandler.RotateAPIKey)
+	usersGroup.Delete("/:username/api-keys/:id", apiKeyHandler.RevokeAPIKey)
+
+	deadLetterGroup := app.Group("/dead-letter")
+	deadLetterGroup.Use(middleware.CheckRole)
+	deadLetterGroup.Use(middleware.RequireScope(models.ScopeAdmin))
+	deadLetterGroup.Get("", deadLetterHandler.GetDeadLetters)
+	deadLetterGroup.Get("/:id", deadLetterHandler.GetDeadLetter)
+	deadLetterGroup.Post("/:id/retry", deadLetterHandler.RetryDeadLetter)
+	deadLetterGroup.Delete("/:id", deadLetterHandler.DiscardDeadLetter)
+
+	webhookGroup := app.Group("/webhook")
+	webhookGroup.Use(middleware.CheckRole)
+	webhookGroup.Use(middleware.RequireScope(models.ScopeAdmin))
+	webhookGroup.Get("", webhookHandler.GetWebhooks)
+	webhookGroup.Get("/:id", webhookHandler.GetWebhook)
+	webhookGroup.Get("/:id/deliveries", webhookHandler.GetWebhookDeliveries)
+	webhookGroup.Post("", webhookHandler.CreateWebhook)
+	webhookGroup.Put("/:id", webhookHandler.UpdateWebhook)
+	webhookGroup.Delete("/:id", webhookHandler.DeleteWebhook)
 }
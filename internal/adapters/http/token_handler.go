@@ -0,0 +1,47 @@
+package http
+
+import (
+	"fmt"
+
+	"github.com/WarisLi/Golang-mini-project/internal/core/models"
+	"github.com/WarisLi/Golang-mini-project/internal/core/ports"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// jwksMaxAge is how long the verifiers may cache the JWKS, well within the
+// publish lead of the signing keys.
+const jwksMaxAge = 300
+
+// HttpTokenHandler publishes the public keys of the access tokens and verifies the
+// tokens for the JWT middleware.
+type HttpTokenHandler struct {
+	service ports.TokenService
+}
+
+func NewHttpTokenHandler(service ports.TokenService) *HttpTokenHandler {
+	return &HttpTokenHandler{service: service}
+}
+
+// Handler functions
+// GetJWKS godoc
+// @Summary Get JWKS
+// @Description Get the public keys verifying the access tokens, identified by the kid of the tokens. The next signing key is published ahead of its first token
+// @Tags token
+// @Produce  json
+// @Success 200 {object} models.JWKS
+// @Router /.well-known/jwks.json [get]
+func (h *HttpTokenHandler) GetJWKS(c *fiber.Ctx) error {
+	jwks, err := h.service.JWKS()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.MessageResponse{Message: err.Error()})
+	}
+
+	c.Set(fiber.HeaderCacheControl, fmt.Sprintf("public, max-age=%d", jwksMaxAge))
+	return c.Status(fiber.StatusOK).JSON(jwks)
+}
+
+// Keyfunc is the jwtware KeyFunc of the access tokens.
+func (h *HttpTokenHandler) Keyfunc(token *jwt.Token) (interface{}, error) {
+	return h.service.Keyfunc(token)
+}
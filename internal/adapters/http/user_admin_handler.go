@@ -0,0 +1,227 @@
+package http
+
+import (
+	"errors"
+
+	"github.com/WarisLi/Golang-mini-project/internal/adapters/http/middleware"
+	"github.com/WarisLi/Golang-mini-project/internal/core/models"
+	"github.com/WarisLi/Golang-mini-project/internal/core/ports"
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+type HttpUserAdminHandler struct {
+	service ports.UserAdminService
+}
+
+func NewHttpUserAdminHandler(service ports.UserAdminService) *HttpUserAdminHandler {
+	return &HttpUserAdminHandler{service: service}
+}
+
+// Handler functions
+// GetUsers godoc
+// @Summary Get users
+// @Description Get a page of the users, optionally searched by username or email and filtered by role or status
+// @Tags users
+// @Accept  json
+// @Produce  json
+// @Security ApiKeyAuth
+// @Param q query string false "Part of the username or email"
+// @Param role query string false "admin or user"
+// @Param disabled query bool false "Disabled users only when true, enabled users only when false"
+// @Param page query int false "Page, from 1"
+// @Param page_size query int false "Page size, up to 100"
+// @Success 200 {object} models.Page[models.UserResponse]
+// @Router /users [get]
+func (h *HttpUserAdminHandler) GetUsers(c *fiber.Ctx) error {
+	var query models.UserQuery
+	if err := c.QueryParser(&query); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.MessageResponse{Message: err.Error()})
+	}
+
+	var validate = validator.New()
+	if err := validate.Struct(query); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.MessageResponse{Message: err.Error()})
+	}
+
+	users, err := h.service.ListUsers(query)
+	if err != nil {
+		return userAdminError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(users)
+}
+
+// Handler functions
+// GetUser godoc
+// @Summary Get user
+// @Description Get the profile of a user
+// @Tags users
+// @Accept  json
+// @Produce  json
+// @Security ApiKeyAuth
+// @Success 200 {object} models.UserResponse
+// @Param username path string true "Username"
+// @Router /users/{username} [get]
+func (h *HttpUserAdminHandler) GetUser(c *fiber.Ctx) error {
+	user, err := h.service.GetUser(c.Params("username"))
+	if err != nil {
+		return userAdminError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(user)
+}
+
+// Handler functions
+// CreateServiceAccount godoc
+// @Summary Create service account
+// @Description Create a user without password for a machine-to-machine client, it authenticates with the API keys created at /users/{username}/api-keys
+// @Tags users
+// @Accept  json
+// @Produce  json
+// @Security ApiKeyAuth
+// @Param account body models.ServiceAccount true "Username and role"
+// @Success 201 {object} models.MessageResponse
+// @Failure 409 {object} models.MessageResponse "Username taken"
+// @Router /users/service-accounts [post]
+func (h *HttpUserAdminHandler) CreateServiceAccount(c *fiber.Ctx) error {
+	var account models.ServiceAccount
+	if err := c.BodyParser(&account); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.MessageResponse{Message: err.Error()})
+	}
+
+	var validate = validator.New()
+	if err := validate.Struct(account); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.MessageResponse{Message: err.Error()})
+	}
+
+	if err := h.service.CreateServiceAccount(middleware.CurrentUser(c).Username, account); err != nil {
+		return userAdminError(c, err)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(models.MessageResponse{Message: "success"})
+}
+
+// Handler functions
+// SetUserRole godoc
+// @Summary Set user role
+// @Description Change the role of a user, administrators cannot demote themselves
+// @Tags users
+// @Accept  json
+// @Produce  json
+// @Security ApiKeyAuth
+// @Param username path string true "Username"
+// @Param role body models.UserRole true "New role"
+// @Success 200 {object} models.MessageResponse
+// @Failure 403 {object} models.MessageResponse "Own user"
+// @Router /users/{username}/role [put]
+func (h *HttpUserAdminHandler) SetUserRole(c *fiber.Ctx) error {
+	var role models.UserRole
+	if err := c.BodyParser(&role); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.MessageResponse{Message: err.Error()})
+	}
+
+	var validate = validator.New()
+	if err := validate.Struct(role); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.MessageResponse{Message: err.Error()})
+	}
+
+	if err := h.service.SetUserRole(middleware.CurrentUser(c).Username, c.Params("username"), role.Role); err != nil {
+		return userAdminError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(models.MessageResponse{Message: "success"})
+}
+
+// Handler functions
+// DisableUser godoc
+// @Summary Disable user
+// @Description Block the logins of a user and invalidate its tokens
+// @Tags users
+// @Accept  json
+// @Produce  json
+// @Security ApiKeyAuth
+// @Param username path string true "Username"
+// @Success 200 {object} models.MessageResponse
+// @Failure 403 {object} models.MessageResponse "Own user"
+// @Router /users/{username}/disable [post]
+func (h *HttpUserAdminHandler) DisableUser(c *fiber.Ctx) error {
+	if err := h.service.SetUserDisabled(middleware.CurrentUser(c).Username, c.Params("username"), true); err != nil {
+		return userAdminError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(models.MessageResponse{Message: "success"})
+}
+
+// Handler functions
+// EnableUser godoc
+// @Summary Enable user
+// @Description Allow the logins of a disabled user again
+// @Tags users
+// @Accept  json
+// @Produce  json
+// @Security ApiKeyAuth
+// @Param username path string true "Username"
+// @Success 200 {object} models.MessageResponse
+// @Router /users/{username}/enable [post]
+func (h *HttpUserAdminHandler) EnableUser(c *fiber.Ctx) error {
+	if err := h.service.SetUserDisabled(middleware.CurrentUser(c).Username, c.Params("username"), false); err != nil {
+		return userAdminError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(models.MessageResponse{Message: "success"})
+}
+
+// Handler functions
+// DeleteUser godoc
+// @Summary Delete user
+// @Description Delete a user permanently, administrators cannot delete themselves
+// @Tags users
+// @Accept  json
+// @Produce  json
+// @Security ApiKeyAuth
+// @Param username path string true "Username"
+// @Success 200 {object} models.MessageResponse
+// @Failure 403 {object} models.MessageResponse "Own user"
+// @Router /users/{username} [DELETE]
+func (h *HttpUserAdminHandler) DeleteUser(c *fiber.Ctx) error {
+	if err := h.service.DeleteUser(middleware.CurrentUser(c).Username, c.Params("username")); err != nil {
+		return userAdminError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(models.MessageResponse{Message: "success"})
+}
+
+// Handler functions
+// ResetTwoFactor godoc
+// @Summary Reset two-factor authentication
+// @Description Remove the authenticator and the recovery codes of a user who lost them
+// @Tags users
+// @Accept  json
+// @Produce  json
+// @Security ApiKeyAuth
+// @Param username path string true "Username"
+// @Success 200 {object} models.MessageResponse
+// @Router /users/{username}/2fa [DELETE]
+func (h *HttpUserAdminHandler) ResetTwoFactor(c *fiber.Ctx) error {
+	if err := h.service.ResetTwoFactor(middleware.CurrentUser(c).Username, c.Params("username")); err != nil {
+		return userAdminError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(models.MessageResponse{Message: "success"})
+}
+
+func userAdminError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(models.MessageResponse{Message: "user not found"})
+	case errors.Is(err, ports.ErrOwnUser):
+		return c.Status(fiber.StatusForbidden).JSON(models.MessageResponse{Message: err.Error()})
+	case errors.Is(err, ports.ErrUnknownRole):
+		return c.Status(fiber.StatusBadRequest).JSON(models.MessageResponse{Message: err.Error()})
+	case errors.Is(err, gorm.ErrDuplicatedKey):
+		return c.Status(fiber.StatusConflict).JSON(models.MessageResponse{Message: "username already exists"})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(models.MessageResponse{Message: err.Error()})
+}
@@ -2,8 +2,8 @@ package http
 
 import (
 	"errors"
-	"time"
 
+	"github.com/WarisLi/Golang-mini-project/internal/adapters/http/middleware"
 	"github.com/WarisLi/Golang-mini-project/internal/core/models"
 	"github.com/WarisLi/Golang-mini-project/internal/core/ports"
 	"github.com/go-playground/validator/v10"
@@ -13,10 +13,12 @@ import (
 
 type HttpUserHandler struct {
 	service ports.UserService
+	// cookies are the attributes of the token cookies of the browsers.
+	cookies middleware.CookieOptions
 }
 
-func NewHttpUserHandler(service ports.UserService) *HttpUserHandler {
-	return &HttpUserHandler{service: service}
+func NewHttpUserHandler(service ports.UserService, cookies middleware.CookieOptions) *HttpUserHandler {
+	return &HttpUserHandler{service: service, cookies: cookies}
 }
 
 // Handler functions
@@ -28,6 +30,7 @@ func NewHttpUserHandler(service ports.UserService) *HttpUserHandler {
 // @Produce  json
 // @Param user body models.User true "Username/password"
 // @Success 201 {object} models.MessageResponse
+// @Failure 400 {object} models.MessageResponse "Username taken or password not meeting the policy"
 // @Router /user [post]
 func (h *HttpUserHandler) CreateUser(c *fiber.Ctx) error {
 	var user models.UsernamePassword
@@ -41,7 +44,7 @@ func (h *HttpUserHandler) CreateUser(c *fiber.Ctx) error {
 	}
 
 	if err := h.service.RegisterUser(user); err != nil {
-		if errors.Is(err, gorm.ErrDuplicatedKey) {
+		if errors.Is(err, gorm.ErrDuplicatedKey) || errors.Is(err, ports.ErrWeakPassword) {
 			return c.Status(fiber.StatusBadRequest).JSON(models.MessageResponse{Message: err.Error()})
 		}
 		return c.Status(fiber.StatusInternalServerError).JSON(models.MessageResponse{Message: err.Error()})
@@ -58,7 +61,8 @@ func (h *HttpUserHandler) CreateUser(c *fiber.Ctx) error {
 // @Accept  json
 // @Produce  json
 // @Param user body models.User true "Username/password"
-// @Success 200 {object} models.LoginSuccess
+// @Success 200 {object} models.LoginSuccess "Token, or models.TwoFactorChallenge when a second factor is required"
+// @Failure 429 {object} models.MessageResponse "Too many requests or failed logins, see Retry-After"
 // @Router /user/login [post]
 func (h *HttpUserHandler) LoginUser(c *fiber.Ctx) error {
 	var requestUser models.UsernamePassword
@@ -73,16 +77,356 @@ func (h *HttpUserHandler) LoginUser(c *fiber.Ctx) error {
 	}
 
 	token, err := h.service.LoginUser(requestUser)
+	var lockedErr *ports.UserLockedError
+	if errors.As(err, &lockedErr) {
+		middleware.SetRetryAfter(c, lockedErr.RetryAfter)
+		return c.Status(fiber.StatusTooManyRequests).JSON(models.MessageResponse{Message: err.Error()})
+	}
+	var twoFactorErr *ports.TwoFactorRequiredError
+	if errors.As(err, &twoFactorErr) {
+		return c.JSON(models.TwoFactorChallenge{
+			Message:        err.Error(),
+			ChallengeToken: twoFactorErr.ChallengeToken,
+			Enroll:         twoFactorErr.Enroll,
+		})
+	}
 	if err != nil {
 		return c.Status(fiber.StatusUnauthorized).JSON(models.MessageResponse{Message: "The username or password is incorrect"})
 	}
 
-	c.Cookie(&fiber.Cookie{
-		Name:     "jwt",
-		Value:    token,
-		Expires:  time.Now().Add(time.Hour * 72),
-		HTTPOnly: true,
-	})
+	if err := middleware.SetTokenCookies(c, token, h.cookies); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.MessageResponse{Message: err.Error()})
+	}
 
 	return c.JSON(models.LoginSuccess{Message: "Login success", Token: token})
 }
+
+// CheckSession refuses the tokens invalidated by a password change or reset, the
+// tokens of disabled or deleted users and the tokens of another role than the role
+// of the user, it runs after middleware.JWTAuthMiddleware. The API
+// keys were checked by middleware.APIKeyAuth and do not depend on the sessions.
+func (h *HttpUserHandler) CheckSession(c *fiber.Ctx) error {
+	user := middleware.CurrentUser(c)
+	if user.APIKey != "" {
+		return c.Next()
+	}
+	if err := h.service.CheckSession(user.Username, user.SessionID, user.SessionVersion, user.Role); err != nil {
+		if errors.Is(err, ports.ErrInvalidSession) {
+			return c.Status(fiber.StatusUnauthorized).JSON(models.MessageResponse{Message: err.Error()})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(models.MessageResponse{Message: err.Error()})
+	}
+
+	return c.Next()
+}
+
+// ChangePassword godoc
+// @Summary Change password
+// @Description Change the password of the current user, the other tokens of the user are invalidated
+// @Tags user
+// @Accept  json
+// @Produce  json
+// @Security ApiKeyAuth
+// @Param password body models.ChangePassword true "Current and new password"
+// @Success 200 {object} models.LoginSuccess
+// @Failure 400 {object} models.MessageResponse "Password not meeting the policy"
+// @Failure 401 {object} models.MessageResponse "Wrong current password"
+// @Failure 409 {object} models.MessageResponse "User of an identity provider"
+// @Router /user/password [put]
+func (h *HttpUserHandler) ChangePassword(c *fiber.Ctx) error {
+	var change models.ChangePassword
+	if err := c.BodyParser(&change); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.MessageResponse{Message: err.Error()})
+	}
+
+	var validate = validator.New()
+	if err := validate.Struct(change); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.MessageResponse{Message: err.Error()})
+	}
+
+	token, err := h.service.ChangePassword(middleware.CurrentUser(c).Username, change)
+	switch {
+	case errors.Is(err, ports.ErrWrongPassword):
+		return c.Status(fiber.StatusUnauthorized).JSON(models.MessageResponse{Message: err.Error()})
+	case errors.Is(err, ports.ErrWeakPassword):
+		return c.Status(fiber.StatusBadRequest).JSON(models.MessageResponse{Message: err.Error()})
+	case errors.Is(err, ports.ErrExternalUser):
+		return c.Status(fiber.StatusConflict).JSON(models.MessageResponse{Message: err.Error()})
+	case err != nil:
+		return c.Status(fiber.StatusInternalServerError).JSON(models.MessageResponse{Message: err.Error()})
+	}
+
+	if err := middleware.SetTokenCookies(c, token, h.cookies); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.MessageResponse{Message: err.Error()})
+	}
+
+	return c.JSON(models.LoginSuccess{Message: "Password changed", Token: token})
+}
+
+// Logout godoc
+// @Summary Log out
+// @Description Clear the token and CSRF cookies of the browser. The token itself stays valid until it expires
+// @Tags user
+// @Produce  json
+// @Success 200 {object} models.MessageResponse
+// @Router /user/logout [post]
+func (h *HttpUserHandler) Logout(c *fiber.Ctx) error {
+	middleware.ClearTokenCookies(c, h.cookies)
+
+	return c.JSON(models.MessageResponse{Message: "Logout success"})
+}
+
+// ForgotPassword godoc
+// @Summary Request a password reset
+// @Description Send a password reset token to the user. The response is the same whether the user exists or not
+// @Tags user
+// @Accept  json
+// @Produce  json
+// @Param user body models.ForgotPassword true "Username"
+// @Success 202 {object} models.MessageResponse
+// @Failure 429 {object} models.MessageResponse "Too many requests, see Retry-After"
+// @Router /user/password/forgot [post]
+func (h *HttpUserHandler) ForgotPassword(c *fiber.Ctx) error {
+	var forgot models.ForgotPassword
+	if err := c.BodyParser(&forgot); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.MessageResponse{Message: err.Error()})
+	}
+
+	var validate = validator.New()
+	if err := validate.Struct(forgot); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.MessageResponse{Message: err.Error()})
+	}
+
+	if err := h.service.RequestPasswordReset(forgot.Username); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.MessageResponse{Message: err.Error()})
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(models.MessageResponse{Message: "A password reset token was sent if the user exists"})
+}
+
+// ResetPassword godoc
+// @Summary Reset password
+// @Description Set a new password with a password reset token, the tokens of the user are invalidated
+// @Tags user
+// @Accept  json
+// @Produce  json
+// @Param reset body models.ResetPassword true "Reset token and new password"
+// @Success 200 {object} models.MessageResponse
+// @Failure 400 {object} models.MessageResponse "Invalid or expired token, or password not meeting the policy"
+// @Failure 429 {object} models.MessageResponse "Too many requests, see Retry-After"
+// @Router /user/password/reset [post]
+func (h *HttpUserHandler) ResetPassword(c *fiber.Ctx) error {
+	var reset models.ResetPassword
+	if err := c.BodyParser(&reset); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.MessageResponse{Message: err.Error()})
+	}
+
+	var validate = validator.New()
+	if err := validate.Struct(reset); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.MessageResponse{Message: err.Error()})
+	}
+
+	if err := h.service.ResetPassword(reset); err != nil {
+		if errors.Is(err, ports.ErrInvalidResetToken) || errors.Is(err, ports.ErrWeakPassword) {
+			return c.Status(fiber.StatusBadRequest).JSON(models.MessageResponse{Message: err.Error()})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(models.MessageResponse{Message: err.Error()})
+	}
+
+	return c.JSON(models.MessageResponse{Message: "Password reset"})
+}
+
+// Handler functions
+// LoginTwoFactor godoc
+// @Summary Complete a two-factor login
+// @Description Complete a login with the challenge token and a code of the authenticator or a recovery code.
+// @Description The code confirming an enrollment returns the recovery codes
+// @Tags user
+// @Accept  json
+// @Produce  json
+// @Param login body models.TwoFactorLogin true "Challenge token and code"
+// @Success 200 {object} models.LoginSuccess
+// @Failure 401 {object} models.MessageResponse "Invalid code or challenge"
+// @Failure 429 {object} models.MessageResponse "Too many requests or failed logins, see Retry-After"
+// @Router /user/login/2fa [post]
+func (h *HttpUserHandler) LoginTwoFactor(c *fiber.Ctx) error {
+	var login models.TwoFactorLogin
+	if err := c.BodyParser(&login); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.MessageResponse{Message: err.Error()})
+	}
+
+	var validate = validator.New()
+	if err := validate.Struct(login); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.MessageResponse{Message: err.Error()})
+	}
+
+	token, recoveryCodes, err := h.service.LoginTwoFactor(login)
+	if err != nil {
+		return twoFactorError(c, err)
+	}
+
+	if err := middleware.SetTokenCookies(c, token, h.cookies); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.MessageResponse{Message: err.Error()})
+	}
+
+	return c.JSON(models.LoginSuccess{Message: "Login success", Token: token, RecoveryCodes: recoveryCodes})
+}
+
+// Handler functions
+// EnrollTOTPChallenge godoc
+// @Summary Enroll an authenticator to log in
+// @Description Start the enrollment of the users who have to enroll to log in, the login is then
+// @Description completed with a code of the authenticator
+// @Tags user
+// @Accept  json
+// @Produce  json
+// @Param challenge body models.TwoFactorEnrollChallenge true "Challenge token"
+// @Success 200 {object} models.TOTPEnrollment
+// @Failure 401 {object} models.MessageResponse "Invalid challenge"
+// @Router /user/login/2fa/enroll [post]
+func (h *HttpUserHandler) EnrollTOTPChallenge(c *fiber.Ctx) error {
+	var challenge models.TwoFactorEnrollChallenge
+	if err := c.BodyParser(&challenge); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.MessageResponse{Message: err.Error()})
+	}
+
+	var validate = validator.New()
+	if err := validate.Struct(challenge); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.MessageResponse{Message: err.Error()})
+	}
+
+	enrollment, err := h.service.EnrollTOTPChallenge(challenge.ChallengeToken)
+	if err != nil {
+		return twoFactorError(c, err)
+	}
+
+	return c.JSON(enrollment)
+}
+
+// Handler functions
+// EnrollTOTP godoc
+// @Summary Enroll an authenticator
+// @Description Create the secret of an authenticator app, it is enabled once confirmed with one of its codes
+// @Tags user
+// @Accept  json
+// @Produce  json
+// @Security ApiKeyAuth
+// @Success 200 {object} models.TOTPEnrollment
+// @Failure 409 {object} models.MessageResponse "Already enabled"
+// @Router /user/2fa/totp [post]
+func (h *HttpUserHandler) EnrollTOTP(c *fiber.Ctx) error {
+	enrollment, err := h.service.EnrollTOTP(middleware.CurrentUser(c).Username)
+	if err != nil {
+		return twoFactorError(c, err)
+	}
+
+	return c.JSON(enrollment)
+}
+
+// Handler functions
+// ConfirmTOTP godoc
+// @Summary Confirm an authenticator
+// @Description Enable the enrolled authenticator with one of its codes, returns the recovery codes once
+// @Tags user
+// @Accept  json
+// @Produce  json
+// @Security ApiKeyAuth
+// @Param code body models.TOTPCode true "Code of the authenticator"
+// @Success 200 {object} models.RecoveryCodes
+// @Failure 401 {object} models.MessageResponse "Invalid code"
+// @Router /user/2fa/totp/confirm [post]
+func (h *HttpUserHandler) ConfirmTOTP(c *fiber.Ctx) error {
+	code, err := parseTOTPCode(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.MessageResponse{Message: err.Error()})
+	}
+
+	recoveryCodes, err := h.service.ConfirmTOTP(middleware.CurrentUser(c).Username, code)
+	if err != nil {
+		return twoFactorError(c, err)
+	}
+
+	return c.JSON(models.RecoveryCodes{RecoveryCodes: recoveryCodes})
+}
+
+// Handler functions
+// DisableTOTP godoc
+// @Summary Disable two-factor authentication
+// @Description Remove the authenticator and the recovery codes, refused when the role requires two-factor authentication
+// @Tags user
+// @Accept  json
+// @Produce  json
+// @Security ApiKeyAuth
+// @Param code body models.TOTPCode true "Code of the authenticator or recovery code"
+// @Success 200 {object} models.MessageResponse
+// @Failure 401 {object} models.MessageResponse "Invalid code"
+// @Failure 403 {object} models.MessageResponse "Required for the role"
+// @Router /user/2fa/totp [DELETE]
+func (h *HttpUserHandler) DisableTOTP(c *fiber.Ctx) error {
+	code, err := parseTOTPCode(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.MessageResponse{Message: err.Error()})
+	}
+
+	if err := h.service.DisableTOTP(middleware.CurrentUser(c).Username, code); err != nil {
+		return twoFactorError(c, err)
+	}
+
+	return c.JSON(models.MessageResponse{Message: "success"})
+}
+
+// Handler functions
+// RegenerateRecoveryCodes godoc
+// @Summary Regenerate recovery codes
+// @Description Replace the recovery codes, the previous ones stop working
+// @Tags user
+// @Accept  json
+// @Produce  json
+// @Security ApiKeyAuth
+// @Param code body models.TOTPCode true "Code of the authenticator or recovery code"
+// @Success 200 {object} models.RecoveryCodes
+// @Failure 401 {object} models.MessageResponse "Invalid code"
+// @Router /user/2fa/recovery-codes [post]
+func (h *HttpUserHandler) RegenerateRecoveryCodes(c *fiber.Ctx) error {
+	code, err := parseTOTPCode(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.MessageResponse{Message: err.Error()})
+	}
+
+	recoveryCodes, err := h.service.RegenerateRecoveryCodes(middleware.CurrentUser(c).Username, code)
+	if err != nil {
+		return twoFactorError(c, err)
+	}
+
+	return c.JSON(models.RecoveryCodes{RecoveryCodes: recoveryCodes})
+}
+
+func parseTOTPCode(c *fiber.Ctx) (string, error) {
+	var code models.TOTPCode
+	if err := c.BodyParser(&code); err != nil {
+		return "", err
+	}
+
+	var validate = validator.New()
+	if err := validate.Struct(code); err != nil {
+		return "", err
+	}
+	return code.Code, nil
+}
+
+func twoFactorError(c *fiber.Ctx, err error) error {
+	var lockedErr *ports.UserLockedError
+	switch {
+	case errors.As(err, &lockedErr):
+		middleware.SetRetryAfter(c, lockedErr.RetryAfter)
+		return c.Status(fiber.StatusTooManyRequests).JSON(models.MessageResponse{Message: err.Error()})
+	case errors.Is(err, ports.ErrInvalidChallenge) || errors.Is(err, ports.ErrInvalidTwoFactorCode):
+		return c.Status(fiber.StatusUnauthorized).JSON(models.MessageResponse{Message: err.Error()})
+	case errors.Is(err, ports.ErrTwoFactorEnabled) || errors.Is(err, ports.ErrTwoFactorNotEnrolled) ||
+		errors.Is(err, ports.ErrTwoFactorChanged):
+		return c.Status(fiber.StatusConflict).JSON(models.MessageResponse{Message: err.Error()})
+	case errors.Is(err, ports.ErrTwoFactorRequiredByRole):
+		return c.Status(fiber.StatusForbidden).JSON(models.MessageResponse{Message: err.Error()})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(models.MessageResponse{Message: err.Error()})
+}
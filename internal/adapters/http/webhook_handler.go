@@ -0,0 +1,194 @@
+package http
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/WarisLi/Golang-mini-project/internal/core/models"
+	"github.com/WarisLi/Golang-mini-project/internal/core/ports"
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+type HttpWebhookHandler struct {
+	service ports.WebhookService
+}
+
+func NewHttpWebhookHandler(service ports.WebhookService) *HttpWebhookHandler {
+	return &HttpWebhookHandler{service: service}
+}
+
+// Handler functions
+// GetWebhooks godoc
+// @Summary Get webhooks
+// @Description Get all webhook subscriptions
+// @Tags webhook
+// @Accept  json
+// @Produce  json
+// @Security ApiKeyAuth
+// @Success 200 {array} models.WebhookResponse
+// @Router /webhook [get]
+func (h *HttpWebhookHandler) GetWebhooks(c *fiber.Ctx) error {
+	webhooks, err := h.service.GetWebhooks()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.MessageResponse{Message: err.Error()})
+	}
+
+	response := make([]models.WebhookResponse, 0, len(webhooks))
+	for _, webhook := range webhooks {
+		response = append(response, models.NewWebhookResponse(webhook))
+	}
+	return c.Status(fiber.StatusOK).JSON(response)
+}
+
+// Handler functions
+// GetWebhook godoc
+// @Summary Get webhook
+// @Description Get a webhook subscription
+// @Tags webhook
+// @Accept  json
+// @Produce  json
+// @Security ApiKeyAuth
+// @Success 200 {object} models.WebhookResponse
+// @Param id path uint true "ID"
+// @Router /webhook/{id} [get]
+func (h *HttpWebhookHandler) GetWebhook(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.MessageResponse{Message: err.Error()})
+	}
+
+	webhook, err := h.service.GetWebhook(uint(id))
+	if err != nil {
+		return webhookError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(models.NewWebhookResponse(*webhook))
+}
+
+// Handler functions
+// CreateWebhook godoc
+// @Summary Create webhook
+// @Description Subscribe a URL to event types, use "*" for every event type
+// @Tags webhook
+// @Accept  json
+// @Produce  json
+// @Security ApiKeyAuth
+// @Success 201 {object} models.WebhookResponse
+// @Param webhook body models.WebhookInput true "Webhook"
+// @Router /webhook [POST]
+func (h *HttpWebhookHandler) CreateWebhook(c *fiber.Ctx) error {
+	var input models.WebhookInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.MessageResponse{Message: err.Error()})
+	}
+
+	var validate = validator.New()
+	if err := validate.Struct(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.MessageResponse{Message: err.Error()})
+	}
+
+	webhook, err := h.service.CreateWebhook(input)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.MessageResponse{Message: err.Error()})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(models.NewWebhookResponse(*webhook))
+}
+
+// Handler functions
+// UpdateWebhook godoc
+// @Summary Update webhook
+// @Description Update a webhook subscription, enabling a disabled webhook resets its failures
+// @Tags webhook
+// @Accept  json
+// @Produce  json
+// @Security ApiKeyAuth
+// @Success 200 {object} models.WebhookResponse
+// @Param webhook body models.WebhookInput true "Webhook"
+// @Param id path uint true "ID"
+// @Router /webhook/{id} [PUT]
+func (h *HttpWebhookHandler) UpdateWebhook(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.MessageResponse{Message: err.Error()})
+	}
+
+	var input models.WebhookInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.MessageResponse{Message: err.Error()})
+	}
+
+	var validate = validator.New()
+	if err := validate.Struct(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.MessageResponse{Message: err.Error()})
+	}
+
+	webhook, err := h.service.UpdateWebhook(uint(id), input)
+	if err != nil {
+		return webhookError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(models.NewWebhookResponse(*webhook))
+}
+
+// Handler functions
+// DeleteWebhook godoc
+// @Summary Delete webhook
+// @Description Delete a webhook subscription
+// @Tags webhook
+// @Accept  json
+// @Produce  json
+// @Security ApiKeyAuth
+// @Success 200 {object} models.MessageResponse
+// @Param id path uint true "ID"
+// @Router /webhook/{id} [DELETE]
+func (h *HttpWebhookHandler) DeleteWebhook(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.MessageResponse{Message: err.Error()})
+	}
+
+	if err := h.service.DeleteWebhook(uint(id)); err != nil {
+		return webhookError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(models.MessageResponse{Message: "success"})
+}
+
+// Handler functions
+// GetWebhookDeliveries godoc
+// @Summary Get webhook deliveries
+// @Description Get the latest delivery attempts of a webhook
+// @Tags webhook
+// @Accept  json
+// @Produce  json
+// @Security ApiKeyAuth
+// @Success 200 {array} models.WebhookDeliveryResponse
+// @Param id path uint true "ID"
+// @Router /webhook/{id}/deliveries [get]
+func (h *HttpWebhookHandler) GetWebhookDeliveries(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.MessageResponse{Message: err.Error()})
+	}
+
+	deliveries, err := h.service.GetWebhookDeliveries(uint(id))
+	if err != nil {
+		return webhookError(c, err)
+	}
+
+	response := make([]models.WebhookDeliveryResponse, 0, len(deliveries))
+	for _, delivery := range deliveries {
+		response = append(response, models.NewWebhookDeliveryResponse(delivery))
+	}
+	return c.Status(fiber.StatusOK).JSON(response)
+}
+
+func webhookError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(models.MessageResponse{Message: "webhook not found"})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(models.MessageResponse{Message: err.Error()})
+}
@@ -0,0 +1,970 @@
+package memory
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/WarisLi/Golang-mini-project/internal/core/models"
+	"github.com/WarisLi/Golang-mini-project/internal/core/ports"
+	"gorm.io/gorm"
+)
+
+// MemoryRepository keeps every repository in memory. It implements the same
+// semantics as the GORM adapter, not found and duplicated key errors included,
+// so the service can run without a database.
+type MemoryRepository struct {
+	// writeMu serializes the writes, a unit of work holds it until it is committed.
+	writeMu sync.Mutex
+	mu      sync.RWMutex
+
+	lastID          map[string]uint
+	products        map[uint]models.Product
+	users           map[uint]models.User
+	outboxEvents    map[uint]models.OutboxEvent
+	processedEvents map[string]time.Time
+	webhooks        map[uint]models.Webhook
+	deliveries      []models.WebhookDelivery
+	idempotencyKeys map[[2]string]models.IdempotencyKey
+	passwordResets  map[string]models.PasswordResetToken
+	apiKeys         map[uint]models.APIKey
+	signingKeys     map[uint]models.SigningKey
+	oidcLogins      map[string]models.OIDCLogin
+}
+
+func NewMemoryRepository() *MemoryRepository {
+	r := &MemoryRepository{}
+	r.Reset()
+	return r
+}
+
+func NewMemoryProductRepository(r *MemoryRepository) ports.ProductRepository {
+	return r
+}
+
+func NewMemoryUserRepository(r *MemoryRepository) ports.UserRepository {
+	return r
+}
+
+func NewMemoryOutboxRepository(r *MemoryRepository) ports.OutboxRepository {
+	return r
+}
+
+func NewMemoryStockRepository(r *MemoryRepository) ports.StockRepository {
+	return r
+}
+
+func NewMemoryWebhookRepository(r *MemoryRepository) ports.WebhookRepository {
+	return r
+}
+
+func NewMemoryIdempotencyRepository(r *MemoryRepository) ports.IdempotencyRepository {
+	return r
+}
+
+func NewMemoryPasswordResetRepository(r *MemoryRepository) ports.PasswordResetRepository {
+	return r
+}
+
+func NewMemoryAPIKeyRepository(r *MemoryRepository) ports.APIKeyRepository {
+	return r
+}
+
+func NewMemorySigningKeyRepository(r *MemoryRepository) ports.SigningKeyRepository {
+	return r
+}
+
+func NewMemoryOIDCLoginRepository(r *MemoryRepository) ports.OIDCLoginRepository {
+	return r
+}
+
+// Reset deletes all data.
+func (r *MemoryRepository) Reset() {
+	defer r.lock()()
+
+	r.lastID = map[string]uint{}
+	r.products = map[uint]models.Product{}
+	r.users = map[uint]models.User{}
+	r.outboxEvents = map[uint]models.OutboxEvent{}
+	r.processedEvents = map[string]time.Time{}
+	r.webhooks = map[uint]models.Webhook{}
+	r.deliveries = nil
+	r.idempotencyKeys = map[[2]string]models.IdempotencyKey{}
+	r.passwordResets = map[string]models.PasswordResetToken{}
+	r.apiKeys = map[uint]models.APIKey{}
+	r.signingKeys = map[uint]models.SigningKey{}
+	r.oidcLogins = map[string]models.OIDCLogin{}
+}
+
+// lock locks the repository for a write and returns the function unlocking it.
+func (r *MemoryRepository) lock() func() {
+	r.writeMu.Lock()
+	r.mu.Lock()
+
+	return func() {
+		r.mu.Unlock()
+		r.writeMu.Unlock()
+	}
+}
+
+// nextID returns the next ID of a table, like an auto increment column.
+func (r *MemoryRepository) nextID(table string) uint {
+	r.lastID[table]++
+	return r.lastID[table]
+}
+
+// sortedKeys returns the keys of m in increasing order.
+func sortedKeys[V any](m map[uint]V) []uint {
+	keys := slices.Collect(maps.Keys(m))
+	slices.Sort(keys)
+	return keys
+}
+
+func (r *MemoryRepository) GetAll() ([]models.Product, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	products := []models.Product{}
+	for _, id := range sortedKeys(r.products) {
+		products = append(products, r.products[id])
+	}
+	return products, nil
+}
+
+func (r *MemoryRepository) GetPage(request models.PageRequest) ([]models.Product, int64, error) {
+	products, _ := r.GetAll()
+
+	total := int64(len(products))
+	start := min(request.Offset(), len(products))
+	end := min(start+request.PageSize, len(products))
+	return products[start:end], total, nil
+}
+
+func (r *MemoryRepository) GetOne(id uint) (*models.Product, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	product, ok := r.products[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &product, nil
+}
+
+func (r *MemoryRepository) Save(product models.Product) (uint, error) {
+	defer r.lock()()
+
+	product = r.createProduct(r.products, product)
+	return product.ID, nil
+}
+
+func (r *MemoryRepository) createProduct(products map[uint]models.Product, product models.Product) models.Product {
+	now := time.Now()
+	product.ID = r.nextID("products")
+	product.Model.ID = product.ID
+	product.CreatedAt = now
+	product.UpdatedAt = now
+	products[product.ID] = product
+	return product
+}
+
+func (r *MemoryRepository) Update(product models.Product) error {
+	defer r.lock()()
+
+	if _, ok := updateProduct(r.products, product); !ok {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// updateProduct writes the updatable columns of product and returns the stored
+// product, or false when it does not exist.
+func updateProduct(products map[uint]models.Product, product models.Product) (models.Product, bool) {
+	stored, ok := products[product.ID]
+	if !ok {
+		return stored, false
+	}
+
+	stored.Name = product.Name
+	stored.Quantity = product.Quantity
+	stored.Category = product.Category
+	stored.SKU = product.SKU
+	stored.Description = product.Description
+	stored.UpdatedAt = time.Now()
+	products[product.ID] = stored
+	return stored, true
+}
+
+func (r *MemoryRepository) Delete(id uint) error {
+	defer r.lock()()
+
+	if _, ok := r.products[id]; !ok {
+		return gorm.ErrRecordNotFound
+	}
+	delete(r.products, id)
+	return nil
+}
+
+func (r *MemoryRepository) ApplyProductOperations(operations []models.ProductOperation) ([]models.Product, error) {
+	defer r.lock()()
+
+	// Operations are applied to a copy, which replaces the products once they all succeeded
+	lastID := r.lastID["products"]
+	products := maps.Clone(r.products)
+	results := make([]models.Product, len(operations))
+	for i, operation := range operations {
+		var err error
+		switch operation.Op {
+		case models.ProductOperationCreate:
+			results[i] = r.createProduct(products, operation.Product)
+		case models.ProductOperationUpdate:
+			var ok bool
+			if results[i], ok = updateProduct(products, operation.Product); !ok {
+				err = gorm.ErrRecordNotFound
+			}
+		case models.ProductOperationDelete:
+			var ok bool
+			if results[i], ok = products[operation.Product.ID]; ok {
+				delete(products, operation.Product.ID)
+			} else {
+				err = gorm.ErrRecordNotFound
+			}
+		default:
+			err = fmt.Errorf("unknown operation %q", operation.Op)
+		}
+		if err != nil {
+			r.lastID["products"] = lastID
+			return nil, &ports.BatchOperationError{Index: i, Err: err}
+		}
+	}
+
+	r.products = products
+	return results, nil
+}
+
+func (r *MemoryRepository) GetUser(username string) (*models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, user := range r.users {
+		if user.Username == username {
+			return &user, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+// updateUser applies update to the user of username.
+func (r *MemoryRepository) updateUser(username string, update func(user *models.User) bool) error {
+	defer r.lock()()
+
+	for id, user := range r.users {
+		if user.Username != username {
+			continue
+		}
+		if update(&user) {
+			user.UpdatedAt = time.Now()
+			r.users[id] = user
+		}
+		return nil
+	}
+	return gorm.ErrRecordNotFound
+}
+
+func (r *MemoryRepository) AddFailedLogin(username string) (int, error) {
+	failedLogins := 0
+	err := r.updateUser(username, func(user *models.User) bool {
+		user.FailedLogins++
+		failedLogins = user.FailedLogins
+		return true
+	})
+	return failedLogins, err
+}
+
+func (r *MemoryRepository) LockUser(username string, lockedUntil time.Time) error {
+	err := r.updateUser(username, func(user *models.User) bool {
+		if user.LockedUntil != nil && !user.LockedUntil.Before(lockedUntil) {
+			return false
+		}
+		user.LockedUntil = &lockedUntil
+		return true
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	return err
+}
+
+func (r *MemoryRepository) ResetFailedLogins(username string) error {
+	err := r.updateUser(username, func(user *models.User) bool {
+		user.FailedLogins = 0
+		user.LockedUntil = nil
+		return true
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	return err
+}
+
+func (r *MemoryRepository) UpdatePasswordHash(username string, oldHash string, newHash string) error {
+	updated := false
+	err := r.updateUser(username, func(user *models.User) bool {
+		if user.Password != oldHash {
+			return false
+		}
+		user.Password = newHash
+		updated = true
+		return true
+	})
+	if err == nil && !updated {
+		return gorm.ErrRecordNotFound
+	}
+	return err
+}
+
+func (r *MemoryRepository) UpdateTwoFactor(username string, from models.TwoFactorState, state models.TwoFactorState) error {
+	updated := false
+	err := r.updateUser(username, func(user *models.User) bool {
+		if user.TwoFactorState() != from {
+			return false
+		}
+		user.TOTPSecret = state.TOTPSecret
+		user.TOTPEnabled = state.TOTPEnabled
+		user.TOTPLastStep = state.TOTPLastStep
+		user.RecoveryCodes = state.RecoveryCodes
+		updated = true
+		return true
+	})
+	if err == nil && !updated {
+		return gorm.ErrRecordNotFound
+	}
+	return err
+}
+
+func (r *MemoryRepository) GetUserByIdentity(provider string, subject string) (*models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, user := range r.users {
+		if user.ExternalSubject != nil && user.IdentityProvider == provider && *user.ExternalSubject == subject {
+			return &user, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+// sameIdentity reports whether a and b are linked to the same identity.
+func sameIdentity(a models.User, b models.User) bool {
+	return a.ExternalSubject != nil && b.ExternalSubject != nil &&
+		a.IdentityProvider == b.IdentityProvider && *a.ExternalSubject == *b.ExternalSubject
+}
+
+func (r *MemoryRepository) Create(user models.User) error {
+	defer r.lock()()
+
+	for _, existing := range r.users {
+		if existing.Username == user.Username || sameIdentity(existing, user) {
+			return gorm.ErrDuplicatedKey
+		}
+	}
+
+	now := time.Now()
+	user.ID = r.nextID("users")
+	user.Model.ID = user.ID
+	user.CreatedAt = now
+	user.UpdatedAt = now
+	if user.Role == "" {
+		user.Role = models.RoleUser
+	}
+	r.users[user.ID] = user
+	return nil
+}
+
+func (r *MemoryRepository) UpdateUser(user models.User) error {
+	defer r.lock()()
+
+	stored, ok := r.users[user.ID]
+	if !ok {
+		return nil
+	}
+	for id, existing := range r.users {
+		if id != user.ID && sameIdentity(existing, user) {
+			return gorm.ErrDuplicatedKey
+		}
+	}
+	stored.Password = user.Password
+	stored.Role = user.Role
+	stored.Disabled = user.Disabled
+	stored.FailedLogins = user.FailedLogins
+	stored.LockedUntil = user.LockedUntil
+	stored.SessionVersion = user.SessionVersion
+	stored.TOTPSecret = user.TOTPSecret
+	stored.TOTPEnabled = user.TOTPEnabled
+	stored.TOTPLastStep = user.TOTPLastStep
+	stored.RecoveryCodes = user.RecoveryCodes
+	stored.IdentityProvider = user.IdentityProvider
+	stored.ExternalSubject = user.ExternalSubject
+	stored.UpdatedAt = time.Now()
+	r.users[user.ID] = stored
+	return nil
+}
+
+func (r *MemoryRepository) GetUsers(query models.UserQuery) ([]models.User, int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	search := strings.ToLower(query.Query)
+	users := []models.User{}
+	for _, id := range sortedKeys(r.users) {
+		user := r.users[id]
+		if search != "" && !strings.Contains(strings.ToLower(user.Username), search) &&
+			!strings.Contains(strings.ToLower(user.Email), search) {
+			continue
+		}
+		if query.Role != "" && user.Role != query.Role {
+			continue
+		}
+		if query.Disabled != nil && user.Disabled != *query.Disabled {
+			continue
+		}
+		users = append(users, user)
+	}
+
+	total := int64(len(users))
+	start := min(query.Offset(), len(users))
+	end := min(start+query.PageSize, len(users))
+	return users[start:end], total, nil
+}
+
+func (r *MemoryRepository) DeleteUser(username string) error {
+	defer r.lock()()
+
+	for id, user := range r.users {
+		if user.Username == username {
+			delete(r.users, id)
+			return nil
+		}
+	}
+	return gorm.ErrRecordNotFound
+}
+
+func (r *MemoryRepository) SaveEvent(event models.OutboxEvent) (uint, error) {
+	defer r.lock()()
+
+	now := time.Now()
+	event.ID = r.nextID("outbox_events")
+	event.CreatedAt = now
+	event.UpdatedAt = now
+	r.outboxEvents[event.ID] = event
+	return event.ID, nil
+}
+
+func (r *MemoryRepository) GetPendingEvents() ([]models.OutboxEvent, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var events []models.OutboxEvent
+	for _, id := range sortedKeys(r.outboxEvents) {
+		if event := r.outboxEvents[id]; event.PublishedAt == nil && !event.Consumed {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+// failedEvent reports whether event is pending and its publishing failed at least
+// once, the events of a unit of work being published are not attempted yet.
+func failedEvent(event models.OutboxEvent) bool {
+	return event.PublishedAt == nil && event.Attempts > 0
+}
+
+func (r *MemoryRepository) GetFailedEvents() ([]models.OutboxEvent, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var events []models.OutboxEvent
+	for _, id := range sortedKeys(r.outboxEvents) {
+		if event := r.outboxEvents[id]; failedEvent(event) {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+func (r *MemoryRepository) GetFailedEvent(id uint) (*models.OutboxEvent, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	event, ok := r.outboxEvents[id]
+	if !ok || !failedEvent(event) {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &event, nil
+}
+
+func (r *MemoryRepository) CountFailedEvents() (int64, error) {
+	events, _ := r.GetFailedEvents()
+	return int64(len(events)), nil
+}
+
+func (r *MemoryRepository) MarkEventPublished(id uint) error {
+	defer r.lock()()
+
+	if event, ok := r.outboxEvents[id]; ok {
+		now := time.Now()
+		event.PublishedAt = &now
+		event.UpdatedAt = now
+		r.outboxEvents[id] = event
+	}
+	return nil
+}
+
+func (r *MemoryRepository) RecordEventFailure(id uint, lastError string) error {
+	defer r.lock()()
+
+	if event, ok := r.outboxEvents[id]; ok {
+		event.Attempts++
+		event.LastError = lastError
+		event.UpdatedAt = time.Now()
+		r.outboxEvents[id] = event
+	}
+	return nil
+}
+
+func (r *MemoryRepository) DeleteFailedEvent(id uint) error {
+	defer r.lock()()
+
+	if event, ok := r.outboxEvents[id]; !ok || !failedEvent(event) {
+		return gorm.ErrRecordNotFound
+	}
+	delete(r.outboxEvents, id)
+	return nil
+}
+
+func (r *MemoryRepository) ApplyStockMovements(eventID string, movements []models.StockMovement) ([]models.Product, error) {
+	defer r.lock()()
+
+	if _, ok := r.processedEvents[eventID]; ok {
+		return nil, ports.ErrEventAlreadyProcessed
+	}
+
+	products := maps.Clone(r.products)
+	var updated []models.Product
+	for _, movement := range movements {
+		product, ok := products[movement.ProductID]
+		if !ok {
+			return nil, gorm.ErrRecordNotFound
+		}
+
+		product.Quantity += movement.Delta
+		if product.Quantity < 0 {
+			return nil, fmt.Errorf("%w: product %d", ports.ErrInsufficientStock, product.ID)
+		}
+		product.UpdatedAt = time.Now()
+		products[product.ID] = product
+		updated = append(updated, product)
+	}
+
+	r.products = products
+	r.processedEvents[eventID] = time.Now()
+	return updated, nil
+}
+
+func (r *MemoryRepository) GetWebhooks() ([]models.Webhook, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	webhooks := []models.Webhook{}
+	for _, id := range sortedKeys(r.webhooks) {
+		webhooks = append(webhooks, r.webhooks[id])
+	}
+	return webhooks, nil
+}
+
+func (r *MemoryRepository) GetActiveWebhooks() ([]models.Webhook, error) {
+	webhooks, _ := r.GetWebhooks()
+
+	var active []models.Webhook
+	for _, webhook := range webhooks {
+		if webhook.Active {
+			active = append(active, webhook)
+		}
+	}
+	return active, nil
+}
+
+func (r *MemoryRepository) GetWebhook(id uint) (*models.Webhook, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	webhook, ok := r.webhooks[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &webhook, nil
+}
+
+func (r *MemoryRepository) CreateWebhook(webhook models.Webhook) (uint, error) {
+	defer r.lock()()
+
+	now := time.Now()
+	webhook.ID = r.nextID("webhooks")
+	webhook.CreatedAt = now
+	webhook.UpdatedAt = now
+	r.webhooks[webhook.ID] = webhook
+	return webhook.ID, nil
+}
+
+func (r *MemoryRepository) UpdateWebhook(webhook models.Webhook) error {
+	defer r.lock()()
+
+	stored, ok := r.webhooks[webhook.ID]
+	if !ok {
+		return nil
+	}
+	stored.URL = webhook.URL
+	stored.EventTypes = webhook.EventTypes
+	stored.Secret = webhook.Secret
+	stored.Active = webhook.Active
+	stored.FailureCount = webhook.FailureCount
+	stored.DisabledAt = webhook.DisabledAt
+	stored.UpdatedAt = time.Now()
+	r.webhooks[webhook.ID] = stored
+	return nil
+}
+
+func (r *MemoryRepository) DeleteWebhook(id uint) error {
+	defer r.lock()()
+
+	if _, ok := r.webhooks[id]; !ok {
+		return gorm.ErrRecordNotFound
+	}
+	delete(r.webhooks, id)
+	return nil
+}
+
+func (r *MemoryRepository) SaveWebhookDelivery(delivery models.WebhookDelivery) error {
+	defer r.lock()()
+
+	delivery.ID = r.nextID("webhook_deliveries")
+	delivery.CreatedAt = time.Now()
+	delivery.UpdatedAt = delivery.CreatedAt
+	r.deliveries = append(r.deliveries, delivery)
+	return nil
+}
+
+func (r *MemoryRepository) GetWebhookDeliveries(webhookID uint) ([]models.WebhookDelivery, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var deliveries []models.WebhookDelivery
+	for i := len(r.deliveries) - 1; i >= 0 && len(deliveries) < 100; i-- {
+		if r.deliveries[i].WebhookID == webhookID {
+			deliveries = append(deliveries, r.deliveries[i])
+		}
+	}
+	return deliveries, nil
+}
+
+func (r *MemoryRepository) GetDueWebhookDeliveries(now time.Time) ([]models.WebhookDelivery, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var deliveries []models.WebhookDelivery
+	for _, delivery := range r.deliveries {
+		if delivery.RetryAt != nil && !delivery.RetryAt.After(now) {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	slices.SortStableFunc(deliveries, func(a, b models.WebhookDelivery) int {
+		return a.RetryAt.Compare(*b.RetryAt)
+	})
+	if len(deliveries) > 100 {
+		deliveries = deliveries[:100]
+	}
+	return deliveries, nil
+}
+
+func (r *MemoryRepository) ClaimWebhookDelivery(id uint) error {
+	defer r.lock()()
+
+	for i := range r.deliveries {
+		if r.deliveries[i].ID == id && r.deliveries[i].RetryAt != nil {
+			r.deliveries[i].RetryAt = nil
+			r.deliveries[i].UpdatedAt = time.Now()
+			return nil
+		}
+	}
+	return gorm.ErrRecordNotFound
+}
+
+func (r *MemoryRepository) CreateIdempotencyKey(key models.IdempotencyKey) error {
+	defer r.lock()()
+
+	id := [2]string{key.Scope, key.Key}
+	if _, ok := r.idempotencyKeys[id]; ok {
+		return ports.ErrIdempotencyKeyExists
+	}
+	r.idempotencyKeys[id] = key
+	return nil
+}
+
+func (r *MemoryRepository) GetIdempotencyKey(scope string, key string) (*models.IdempotencyKey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	idempotencyKey, ok := r.idempotencyKeys[[2]string{scope, key}]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &idempotencyKey, nil
+}
+
+func (r *MemoryRepository) UpdateIdempotencyKey(key models.IdempotencyKey) error {
+	defer r.lock()()
+
+	id := [2]string{key.Scope, key.Key}
+	if stored, ok := r.idempotencyKeys[id]; ok {
+		stored.StatusCode = key.StatusCode
+		stored.ContentType = key.ContentType
+		stored.Body = key.Body
+		r.idempotencyKeys[id] = stored
+	}
+	return nil
+}
+
+func (r *MemoryRepository) DeleteIdempotencyKey(scope string, key string) error {
+	defer r.lock()()
+
+	delete(r.idempotencyKeys, [2]string{scope, key})
+	return nil
+}
+
+func (r *MemoryRepository) DeleteExpiredIdempotencyKeys(now time.Time) error {
+	defer r.lock()()
+
+	for id, key := range r.idempotencyKeys {
+		if !key.ExpiresAt.After(now) {
+			delete(r.idempotencyKeys, id)
+		}
+	}
+	return nil
+}
+
+func (r *MemoryRepository) CreatePasswordResetToken(token models.PasswordResetToken) error {
+	defer r.lock()()
+
+	if _, ok := r.passwordResets[token.TokenHash]; ok {
+		return gorm.ErrDuplicatedKey
+	}
+	r.passwordResets[token.TokenHash] = token
+	return nil
+}
+
+func (r *MemoryRepository) GetPasswordResetToken(tokenHash string) (*models.PasswordResetToken, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	token, ok := r.passwordResets[tokenHash]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &token, nil
+}
+
+func (r *MemoryRepository) UsePasswordResetToken(tokenHash string, usedAt time.Time) error {
+	defer r.lock()()
+
+	token, ok := r.passwordResets[tokenHash]
+	if !ok || token.UsedAt != nil {
+		return ports.ErrInvalidResetToken
+	}
+	token.UsedAt = &usedAt
+	r.passwordResets[tokenHash] = token
+	return nil
+}
+
+func (r *MemoryRepository) DeleteExpiredPasswordResetTokens(now time.Time) error {
+	defer r.lock()()
+
+	for tokenHash, token := range r.passwordResets {
+		if !token.ExpiresAt.After(now) {
+			delete(r.passwordResets, tokenHash)
+		}
+	}
+	return nil
+}
+
+func (r *MemoryRepository) DeleteUserPasswordResetTokens(username string) error {
+	defer r.lock()()
+
+	for tokenHash, token := range r.passwordResets {
+		if token.Username == username {
+			delete(r.passwordResets, tokenHash)
+		}
+	}
+	return nil
+}
+
+func (r *MemoryRepository) CreateAPIKey(key models.APIKey) (uint, error) {
+	defer r.lock()()
+
+	for _, stored := range r.apiKeys {
+		if stored.KeyID == key.KeyID {
+			return 0, gorm.ErrDuplicatedKey
+		}
+	}
+	now := time.Now()
+	key.ID = r.nextID("api_keys")
+	key.CreatedAt = now
+	key.UpdatedAt = now
+	r.apiKeys[key.ID] = key
+	return key.ID, nil
+}
+
+func (r *MemoryRepository) GetAPIKey(id uint) (*models.APIKey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	key, ok := r.apiKeys[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &key, nil
+}
+
+func (r *MemoryRepository) GetAPIKeyByKeyID(keyID string) (*models.APIKey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, key := range r.apiKeys {
+		if key.KeyID == keyID {
+			return &key, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *MemoryRepository) GetUserAPIKeys(username string) ([]models.APIKey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	keys := []models.APIKey{}
+	for _, id := range sortedKeys(r.apiKeys) {
+		if key := r.apiKeys[id]; key.Username == username {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+func (r *MemoryRepository) UpdateAPIKey(key models.APIKey) error {
+	defer r.lock()()
+
+	stored, ok := r.apiKeys[key.ID]
+	if !ok {
+		return nil
+	}
+	stored.Name = key.Name
+	stored.Scopes = key.Scopes
+	stored.ExpiresAt = key.ExpiresAt
+	stored.RevokedAt = key.RevokedAt
+	stored.UpdatedAt = time.Now()
+	r.apiKeys[key.ID] = stored
+	return nil
+}
+
+func (r *MemoryRepository) TouchAPIKey(id uint, usedAt time.Time) error {
+	defer r.lock()()
+
+	if key, ok := r.apiKeys[id]; ok {
+		key.LastUsedAt = &usedAt
+		r.apiKeys[id] = key
+	}
+	return nil
+}
+
+func (r *MemoryRepository) DeleteUserAPIKeys(username string) error {
+	defer r.lock()()
+
+	for id, key := range r.apiKeys {
+		if key.Username == username {
+			delete(r.apiKeys, id)
+		}
+	}
+	return nil
+}
+
+func (r *MemoryRepository) CreateSigningKey(key models.SigningKey) error {
+	defer r.lock()()
+
+	for _, stored := range r.signingKeys {
+		if stored.KeyID == key.KeyID {
+			return gorm.ErrDuplicatedKey
+		}
+	}
+	now := time.Now()
+	key.ID = r.nextID("signing_keys")
+	key.CreatedAt = now
+	key.UpdatedAt = now
+	r.signingKeys[key.ID] = key
+	return nil
+}
+
+func (r *MemoryRepository) GetSigningKeys() ([]models.SigningKey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	keys := make([]models.SigningKey, 0, len(r.signingKeys))
+	for _, id := range sortedKeys(r.signingKeys) {
+		keys = append(keys, r.signingKeys[id])
+	}
+	slices.SortStableFunc(keys, func(a, b models.SigningKey) int {
+		return a.ActivatesAt.Compare(b.ActivatesAt)
+	})
+	return keys, nil
+}
+
+func (r *MemoryRepository) DeleteSigningKey(id uint) error {
+	defer r.lock()()
+
+	delete(r.signingKeys, id)
+	return nil
+}
+
+func (r *MemoryRepository) CreateOIDCLogin(login models.OIDCLogin) error {
+	defer r.lock()()
+
+	if _, ok := r.oidcLogins[login.StateHash]; ok {
+		return gorm.ErrDuplicatedKey
+	}
+	r.oidcLogins[login.StateHash] = login
+	return nil
+}
+
+func (r *MemoryRepository) TakeOIDCLogin(stateHash string) (*models.OIDCLogin, error) {
+	defer r.lock()()
+
+	login, ok := r.oidcLogins[stateHash]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	delete(r.oidcLogins, stateHash)
+	return &login, nil
+}
+
+func (r *MemoryRepository) DeleteExpiredOIDCLogins(now time.Time) error {
+	defer r.lock()()
+
+	for stateHash, login := range r.oidcLogins {
+		if !login.ExpiresAt.After(now) {
+			delete(r.oidcLogins, stateHash)
+		}
+	}
+	return nil
+}
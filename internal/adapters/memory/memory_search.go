@@ -0,0 +1,115 @@
+package memory
+
+import (
+	"html"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/WarisLi/Golang-mini-project/internal/core/models"
+	"github.com/WarisLi/Golang-mini-project/internal/core/ports"
+)
+
+func NewMemoryProductSearcher(r *MemoryRepository) ports.ProductSearcher {
+	return r
+}
+
+// searchWords splits a text into its lower case words.
+func searchWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// SearchProducts matches every term of the query as a word prefix of the
+// name, SKU or description of the products, like the Postgres searcher does.
+// The rank is the share of the product words that matched a term.
+func (r *MemoryRepository) SearchProducts(query models.ProductSearchQuery) ([]models.ProductSearchResult, int64, error) {
+	terms := searchWords(query.Query)
+	if len(terms) == 0 {
+		return nil, 0, nil
+	}
+
+	products, _ := r.GetAll()
+
+	var results []models.ProductSearchResult
+	for _, product := range products {
+		fields := map[string]string{
+			"name":        product.Name,
+			"sku":         product.SKU,
+			"description": product.Description,
+		}
+
+		matchedTerms := map[string]bool{}
+		matchedWords, totalWords := 0, 0
+		highlights := map[string]string{}
+		for field, text := range fields {
+			words := searchWords(text)
+			totalWords += len(words)
+
+			matched := false
+			for _, word := range words {
+				for _, term := range terms {
+					if strings.HasPrefix(word, term) {
+						matchedTerms[term] = true
+						matchedWords++
+						matched = true
+						break
+					}
+				}
+			}
+			if matched {
+				highlights[field] = highlightTerms(text, terms)
+			}
+		}
+		if len(matchedTerms) < len(terms) {
+			continue
+		}
+
+		results = append(results, models.ProductSearchResult{
+			Product:    product,
+			Rank:       float64(matchedWords) / float64(totalWords),
+			Highlights: highlights,
+		})
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Rank > results[j].Rank
+	})
+
+	total := int64(len(results))
+	start := min(query.Offset(), len(results))
+	end := min(start+query.PageSize, len(results))
+	return results[start:end], total, nil
+}
+
+// highlightTerms escapes a text and puts the words starting with a term in <mark> tags.
+func highlightTerms(text string, terms []string) string {
+	var highlighted strings.Builder
+	word := []rune{}
+	flush := func() {
+		if len(word) == 0 {
+			return
+		}
+		escaped := html.EscapeString(string(word))
+		lower := strings.ToLower(string(word))
+		for _, term := range terms {
+			if strings.HasPrefix(lower, term) {
+				escaped = "<mark>" + escaped + "</mark>"
+				break
+			}
+		}
+		highlighted.WriteString(escaped)
+		word = word[:0]
+	}
+
+	for _, r := range text {
+		if unicode.IsLetter(r) || unicode.IsNumber(r) {
+			word = append(word, r)
+			continue
+		}
+		flush()
+		highlighted.WriteString(html.EscapeString(string(r)))
+	}
+	flush()
+	return highlighted.String()
+}
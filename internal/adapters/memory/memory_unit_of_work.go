@@ -0,0 +1,69 @@
+package memory
+
+import (
+	"maps"
+	"slices"
+
+	"github.com/WarisLi/Golang-mini-project/internal/core/ports"
+)
+
+// MemoryUnitOfWork runs the units of work on a copy of the data, which replaces
+// the data once the unit of work succeeded. Writes outside of the unit of work
+// wait for it, reads see the data as it was before it.
+type MemoryUnitOfWork struct {
+	repo *MemoryRepository
+}
+
+func NewMemoryUnitOfWork(r *MemoryRepository) ports.UnitOfWork {
+	return &MemoryUnitOfWork{repo: r}
+}
+
+func (u *MemoryUnitOfWork) Do(fn func(repos ports.TransactionRepositories) error) error {
+	u.repo.writeMu.Lock()
+	defer u.repo.writeMu.Unlock()
+
+	// A panic leaves the data untouched
+	tx := u.repo.clone()
+	if err := fn(ports.TransactionRepositories{
+		Product:       tx,
+		Stock:         tx,
+		Outbox:        tx,
+		User:          tx,
+		PasswordReset: tx,
+		APIKey:        tx,
+		Webhook:       tx,
+	}); err != nil {
+		return err
+	}
+
+	u.repo.mu.Lock()
+	defer u.repo.mu.Unlock()
+	u.repo.copyData(tx)
+	return nil
+}
+
+// clone returns a repository with a copy of the data.
+func (r *MemoryRepository) clone() *MemoryRepository {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	clone := &MemoryRepository{}
+	clone.copyData(r)
+	return clone
+}
+
+// copyData replaces the data of r with a copy of the data of from.
+func (r *MemoryRepository) copyData(from *MemoryRepository) {
+	r.lastID = maps.Clone(from.lastID)
+	r.products = maps.Clone(from.products)
+	r.users = maps.Clone(from.users)
+	r.outboxEvents = maps.Clone(from.outboxEvents)
+	r.processedEvents = maps.Clone(from.processedEvents)
+	r.webhooks = maps.Clone(from.webhooks)
+	r.deliveries = slices.Clone(from.deliveries)
+	r.idempotencyKeys = maps.Clone(from.idempotencyKeys)
+	r.passwordResets = maps.Clone(from.passwordResets)
+	r.apiKeys = maps.Clone(from.apiKeys)
+	r.signingKeys = maps.Clone(from.signingKeys)
+	r.oidcLogins = maps.Clone(from.oidcLogins)
+}
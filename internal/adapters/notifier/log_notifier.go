@@ -0,0 +1,20 @@
+package notifier
+
+import (
+	"log"
+
+	"github.com/WarisLi/Golang-mini-project/internal/core/models"
+	"github.com/WarisLi/Golang-mini-project/internal/core/ports"
+)
+
+// logNotifier logs the notifications instead of sending them, for local use.
+type logNotifier struct{}
+
+func NewLogNotifier() ports.Notifier {
+	return &logNotifier{}
+}
+
+func (n *logNotifier) Notify(notification models.Notification) error {
+	log.Printf("Notification to %q: %s\n%s\n", notification.To, notification.Subject, notification.Body)
+	return nil
+}
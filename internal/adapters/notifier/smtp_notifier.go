@@ -0,0 +1,96 @@
+package notifier
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/WarisLi/Golang-mini-project/internal/core/models"
+	"github.com/WarisLi/Golang-mini-project/internal/core/ports"
+)
+
+type SmtpOptions struct {
+	Host string
+	Port int
+	// Username and Password authenticate with PLAIN when Username is set.
+	Username string
+	Password string
+	From     string
+	Timeout  time.Duration
+}
+
+// smtpNotifier sends the notifications as plain text emails, with STARTTLS when
+// the server supports it.
+type smtpNotifier struct {
+	options SmtpOptions
+}
+
+func NewSmtpNotifier(options SmtpOptions) ports.Notifier {
+	return &smtpNotifier{options: options}
+}
+
+func (n *smtpNotifier) Notify(notification models.Notification) error {
+	if notification.To == "" {
+		return errors.New("smtp: the user has no email address")
+	}
+
+	addr := net.JoinHostPort(n.options.Host, strconv.Itoa(n.options.Port))
+	conn, err := net.DialTimeout("tcp", addr, n.options.Timeout)
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(n.options.Timeout))
+
+	client, err := smtp.NewClient(conn, n.options.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: n.options.Host}); err != nil {
+			return err
+		}
+	}
+	if n.options.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", n.options.Username, n.options.Password, n.options.Host)); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(n.options.From); err != nil {
+		return err
+	}
+	if err := client.Rcpt(notification.To); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(n.message(notification)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+func (n *smtpNotifier) message(notification models.Notification) []byte {
+	var message strings.Builder
+	fmt.Fprintf(&message, "From: %s\r\n", n.options.From)
+	fmt.Fprintf(&message, "To: %s\r\n", notification.To)
+	fmt.Fprintf(&message, "Subject: %s\r\n", notification.Subject)
+	fmt.Fprintf(&message, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	message.WriteString("MIME-Version: 1.0\r\n")
+	message.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	message.WriteString(strings.ReplaceAll(notification.Body, "\n", "\r\n"))
+	return []byte(message.String())
+}
@@ -0,0 +1,372 @@
+package oidc
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/WarisLi/Golang-mini-project/internal/core/models"
+	"github.com/WarisLi/Golang-mini-project/internal/core/ports"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// maxResponseSize limits the responses read from the provider.
+	maxResponseSize = 1 << 20
+	// minKeyReload is the shortest time between two reads of the keys, tokens of unknown
+	// keys do not make every login read them.
+	minKeyReload = 10 * time.Second
+	// clockSkew is tolerated on the times of the ID tokens.
+	clockSkew = time.Minute
+)
+
+type ProviderOptions struct {
+	// Issuer is the issuer URL of the provider, its configuration is read from
+	// <Issuer>/.well-known/openid-configuration.
+	Issuer   string
+	ClientID string
+	// ClientSecret authenticates the client at the token endpoint, public clients have none.
+	ClientSecret string
+	// RedirectURL is the callback of the provider in this service, as registered at the provider.
+	RedirectURL string
+	Scopes      []string
+	Timeout     time.Duration
+}
+
+// configuration is the part of the provider metadata used by the logins, OpenID Connect Discovery 1.0.
+type configuration struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type providerKey struct {
+	public interface{}
+	// alg restricts the algorithm of the key when the JWK names it.
+	alg string
+}
+
+// httpIdentityProvider runs the authorization code flow with an OpenID Connect provider.
+// The configuration of the provider is read on the first login, its keys when an ID
+// token names a key which is not known yet.
+type httpIdentityProvider struct {
+	options ProviderOptions
+	client  *http.Client
+
+	mu           sync.Mutex
+	config       *configuration
+	keys         map[string]providerKey
+	keysLoadedAt time.Time
+}
+
+func NewHttpIdentityProvider(options ProviderOptions) ports.IdentityProvider {
+	return &httpIdentityProvider{options: options, client: &http.Client{Timeout: options.Timeout}}
+}
+
+func (p *httpIdentityProvider) AuthorizationURL(state string, nonce string, codeChallenge string) (string, error) {
+	config, err := p.configuration()
+	if err != nil {
+		return "", err
+	}
+	authorizationURL, err := url.Parse(config.AuthorizationEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("%w: authorization endpoint: %s", ports.ErrIdentityProvider, err)
+	}
+
+	query := authorizationURL.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", p.options.ClientID)
+	query.Set("redirect_uri", p.options.RedirectURL)
+	query.Set("scope", strings.Join(p.options.Scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", codeChallenge)
+	query.Set("code_challenge_method", "S256")
+	authorizationURL.RawQuery = query.Encode()
+	return authorizationURL.String(), nil
+}
+
+func (p *httpIdentityProvider) Exchange(code string, codeVerifier string) (models.OIDCClaims, error) {
+	config, err := p.configuration()
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.options.RedirectURL},
+		"code_verifier": {codeVerifier},
+		"client_id":     {p.options.ClientID},
+	}
+	req, err := http.NewRequest(http.MethodPost, config.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("%w: token endpoint: %s", ports.ErrIdentityProvider, err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.options.ClientSecret != "" {
+		// client_secret_basic, RFC 6749 2.3.1
+		req.SetBasicAuth(url.QueryEscape(p.options.ClientID), url.QueryEscape(p.options.ClientSecret))
+	}
+
+	var response struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	status, err := p.getJSON(req, &response)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		// The code was used, expired or issued for another verifier
+		if response.Error == "invalid_grant" {
+			return nil, fmt.Errorf("%w: %s", ports.ErrInvalidOIDCLogin, response.ErrorDescription)
+		}
+		return nil, fmt.Errorf("%w: token endpoint answered %d %s %s", ports.ErrIdentityProvider, status, response.Error, response.ErrorDescription)
+	}
+	if response.IDToken == "" {
+		return nil, fmt.Errorf("%w: no ID token", ports.ErrIdentityProvider)
+	}
+
+	return p.verify(config, response.IDToken)
+}
+
+// verify checks the signature, the issuer, the audience and the times of an ID token.
+func (p *httpIdentityProvider) verify(config *configuration, idToken string) (models.OIDCClaims, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(idToken, claims, p.keyfunc,
+		jwt.WithIssuer(config.Issuer),
+		jwt.WithAudience(p.options.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(clockSkew),
+	)
+	if errors.Is(err, ports.ErrIdentityProvider) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: ID token: %s", ports.ErrInvalidOIDCLogin, err)
+	}
+	// A token of several audiences is for the authorized party only
+	if azp, ok := claims["azp"].(string); ok && azp != p.options.ClientID {
+		return nil, fmt.Errorf("%w: ID token: authorized party %q", ports.ErrInvalidOIDCLogin, azp)
+	}
+
+	return models.OIDCClaims(claims), nil
+}
+
+func (p *httpIdentityProvider) keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, err := p.key(kid)
+	if err != nil {
+		return nil, err
+	}
+	if key.alg != "" && key.alg != token.Method.Alg() {
+		return nil, fmt.Errorf("algorithm %s of key %q", token.Method.Alg(), kid)
+	}
+
+	// The algorithm has to be the one of the key, an RSA public key is not an HMAC secret
+	var matches bool
+	switch key.public.(type) {
+	case *rsa.PublicKey:
+		_, rs := token.Method.(*jwt.SigningMethodRSA)
+		_, ps := token.Method.(*jwt.SigningMethodRSAPSS)
+		matches = rs || ps
+	case *ecdsa.PublicKey:
+		_, matches = token.Method.(*jwt.SigningMethodECDSA)
+	case ed25519.PublicKey:
+		_, matches = token.Method.(*jwt.SigningMethodEd25519)
+	}
+	if !matches {
+		return nil, fmt.Errorf("algorithm %s of key %q", token.Method.Alg(), kid)
+	}
+	return key.public, nil
+}
+
+// key returns the key of kid, the keys are read again when kid is unknown. A token
+// without kid is accepted when the provider has a single key.
+func (p *httpIdentityProvider) key(kid string) (providerKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	find := func() (providerKey, bool) {
+		if kid == "" && len(p.keys) == 1 {
+			for _, key := range p.keys {
+				return key, true
+			}
+		}
+		key, ok := p.keys[kid]
+		return key, ok
+	}
+
+	if key, ok := find(); ok {
+		return key, nil
+	}
+	if time.Since(p.keysLoadedAt) < minKeyReload {
+		return providerKey{}, fmt.Errorf("unknown key %q", kid)
+	}
+	if err := p.loadKeys(); err != nil {
+		return providerKey{}, err
+	}
+	if key, ok := find(); ok {
+		return key, nil
+	}
+	return providerKey{}, fmt.Errorf("unknown key %q", kid)
+}
+
+// loadKeys reads the JWKS of the provider, p.mu is held.
+func (p *httpIdentityProvider) loadKeys() error {
+	if p.config == nil {
+		return fmt.Errorf("%w: no configuration", ports.ErrIdentityProvider)
+	}
+	req, err := http.NewRequest(http.MethodGet, p.config.JWKSURI, nil)
+	if err != nil {
+		return fmt.Errorf("%w: JWKS: %s", ports.ErrIdentityProvider, err)
+	}
+
+	var jwks models.JWKS
+	status, err := p.getJSON(req, &jwks)
+	if err != nil {
+		return err
+	}
+	if status != http.StatusOK {
+		return fmt.Errorf("%w: JWKS answered %d", ports.ErrIdentityProvider, status)
+	}
+
+	keys := map[string]providerKey{}
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		public, err := publicKey(jwk)
+		if err != nil {
+			// The keys of other types do not prevent the use of the others
+			continue
+		}
+		keys[jwk.Kid] = providerKey{public: public, alg: jwk.Alg}
+	}
+	p.keys = keys
+	p.keysLoadedAt = time.Now()
+	return nil
+}
+
+// publicKey decodes an RSA, ECDSA or Ed25519 JWK.
+func publicKey(jwk models.JWK) (interface{}, error) {
+	decode := func(value string) (*big.Int, error) {
+		decoded, err := base64.RawURLEncoding.DecodeString(value)
+		if err != nil {
+			return nil, err
+		}
+		return new(big.Int).SetBytes(decoded), nil
+	}
+
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decode(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		curves := map[string]elliptic.Curve{"P-256": elliptic.P256(), "P-384": elliptic.P384(), "P-521": elliptic.P521()}
+		curve, ok := curves[jwk.Crv]
+		if !ok {
+			return nil, fmt.Errorf("unknown curve %q", jwk.Crv)
+		}
+		x, err := decode(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("invalid EC point")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "OKP":
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		if jwk.Crv != "Ed25519" || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("unknown curve %q", jwk.Crv)
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, fmt.Errorf("unknown key type %q", jwk.Kty)
+}
+
+// configuration returns the metadata of the provider, read on the first call which succeeds.
+func (p *httpIdentityProvider) configuration() (*configuration, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.config != nil {
+		return p.config, nil
+	}
+
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(p.options.Issuer, "/")+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: configuration: %s", ports.ErrIdentityProvider, err)
+	}
+	var config configuration
+	status, err := p.getJSON(req, &config)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("%w: configuration answered %d", ports.ErrIdentityProvider, status)
+	}
+	// The ID tokens are only trusted from the configured issuer
+	if config.Issuer != p.options.Issuer {
+		return nil, fmt.Errorf("%w: configuration of issuer %q", ports.ErrIdentityProvider, config.Issuer)
+	}
+	if config.AuthorizationEndpoint == "" || config.TokenEndpoint == "" || config.JWKSURI == "" {
+		return nil, fmt.Errorf("%w: incomplete configuration", ports.ErrIdentityProvider)
+	}
+
+	p.config = &config
+	return p.config, nil
+}
+
+// getJSON sends req and decodes the JSON response into v, whatever its status.
+func (p *httpIdentityProvider) getJSON(req *http.Request, v interface{}) (int, error) {
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s", ports.ErrIdentityProvider, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s", ports.ErrIdentityProvider, err)
+	}
+	if err := json.Unmarshal(body, v); err != nil && resp.StatusCode == http.StatusOK {
+		return 0, fmt.Errorf("%w: %s %s", ports.ErrIdentityProvider, req.URL.Path, err)
+	}
+	return resp.StatusCode, nil
+}
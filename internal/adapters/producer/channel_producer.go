@@ -0,0 +1,83 @@
+package producer
+
+import (
+	"encoding/json"
+	"sync"
+
+	events "github.com/WarisLi/Golang-shared-events"
+)
+
+// Message is an event published on the channel bus.
+type Message struct {
+	Topic string
+	Value []byte
+}
+
+// ChannelBus is an in-process event producer. Every subscriber receives the
+// messages of its topic on a buffered channel; messages are dropped for
+// subscribers whose buffer is full so producing never blocks.
+type ChannelBus struct {
+	mu          sync.RWMutex
+	subscribers map[string][]chan Message
+	bufferSize  int
+}
+
+func NewChannelBus(bufferSize int) *ChannelBus {
+	return &ChannelBus{
+		subscribers: map[string][]chan Message{},
+		bufferSize:  bufferSize,
+	}
+}
+
+// Subscribe returns a channel receiving the messages of topic.
+// An empty topic subscribes to every topic.
+func (b *ChannelBus) Subscribe(topic string) <-chan Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ch := make(chan Message, b.bufferSize)
+	b.subscribers[topic] = append(b.subscribers[topic], ch)
+	return ch
+}
+
+// Unsubscribe stops delivering messages to ch and closes it.
+func (b *ChannelBus) Unsubscribe(ch <-chan Message) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for topic, subscribers := range b.subscribers {
+		for i, subscriber := range subscribers {
+			if subscriber == ch {
+				b.subscribers[topic] = append(subscribers[:i], subscribers[i+1:]...)
+				close(subscriber)
+				return
+			}
+		}
+	}
+}
+
+func (b *ChannelBus) Produce(event events.Event) error {
+	value, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	return b.ProduceMessage(TopicOf(event), value)
+}
+
+func (b *ChannelBus) ProduceMessage(topic string, value []byte) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	msg := Message{Topic: topic, Value: value}
+	for _, subscribers := range [][]chan Message{b.subscribers[topic], b.subscribers[""]} {
+		for _, subscriber := range subscribers {
+			select {
+			case subscriber <- msg:
+			default:
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,182 @@
+package producer
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	events "github.com/WarisLi/Golang-shared-events"
+	"github.com/google/uuid"
+)
+
+const (
+	// FormatRaw publishes the event JSON as is.
+	FormatRaw = "raw"
+	// FormatStructured wraps the event in a CloudEvents JSON envelope.
+	FormatStructured = "cloudevents-structured"
+	// FormatBinary publishes the event JSON with the CloudEvents attributes in message headers.
+	FormatBinary = "cloudevents-binary"
+
+	cloudEventsSpecVersion = "1.0"
+	cloudEventsContentType = "application/cloudevents+json"
+)
+
+// HeaderProducer is implemented by producers able to attach headers to a message.
+type HeaderProducer interface {
+	ProduceMessageWithHeaders(topic string, value []byte, headers map[string]string) error
+}
+
+// headerDeliveryProducer is implemented by the producers queuing the messages
+// which are able to attach headers to a message.
+type headerDeliveryProducer interface {
+	DeliverMessageWithHeaders(topic string, value []byte, headers map[string]string) error
+}
+
+// CloudEvent is the CloudEvents 1.0 JSON envelope of an event.
+type CloudEvent struct {
+	SpecVersion     string          `json:"specversion"`
+	ID              string          `json:"id"`
+	Source          string          `json:"source"`
+	Type            string          `json:"type"`
+	Time            time.Time       `json:"time"`
+	DataContentType string          `json:"datacontenttype"`
+	SchemaVersion   string          `json:"schemaversion"`
+	Data            json.RawMessage `json:"data"`
+}
+
+type EnvelopeOptions struct {
+	Format      string
+	Source      string
+	TopicPrefix string
+}
+
+// envelopeProducer prefixes topics and wraps events in CloudEvents before
+// handing them to the backend producer.
+type envelopeProducer struct {
+	producer EventProducer
+	options  EnvelopeOptions
+}
+
+func NewEnvelopeProducer(producer EventProducer, options EnvelopeOptions) (EventProducer, error) {
+	switch options.Format {
+	case FormatRaw, FormatStructured:
+	case FormatBinary:
+		if _, ok := producer.(HeaderProducer); !ok {
+			return nil, fmt.Errorf("%s requires a producer supporting message headers", FormatBinary)
+		}
+	default:
+		return nil, fmt.Errorf("unknown event format %q", options.Format)
+	}
+
+	return &envelopeProducer{producer: producer, options: options}, nil
+}
+
+func (p *envelopeProducer) Produce(event events.Event) error {
+	value, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	return p.ProduceMessage(TopicOf(event), value)
+}
+
+// ProduceMessage publishes the event JSON value of topic, topic being the event name.
+func (p *envelopeProducer) ProduceMessage(topic string, value []byte) error {
+	headerProducer, _ := p.producer.(HeaderProducer)
+	return p.produceMessage(topic, value, p.producer.ProduceMessage, headerProducer)
+}
+
+// DeliverMessage publishes like ProduceMessage, and waits for the delivery when
+// the backend producer queues the messages.
+func (p *envelopeProducer) DeliverMessage(topic string, value []byte) error {
+	deliveryProducer, ok := p.producer.(DeliveryProducer)
+	headerDelivery, deliversHeaders := p.producer.(headerDeliveryProducer)
+	if !ok || (p.options.Format == FormatBinary && !deliversHeaders) {
+		return p.ProduceMessage(topic, value)
+	}
+
+	var headerProducer HeaderProducer
+	if deliversHeaders {
+		headerProducer = headerDeliveryFunc(headerDelivery.DeliverMessageWithHeaders)
+	}
+	return p.produceMessage(topic, value, deliveryProducer.DeliverMessage, headerProducer)
+}
+
+// headerDeliveryFunc hands the messages with headers to a delivering function.
+type headerDeliveryFunc func(topic string, value []byte, headers map[string]string) error
+
+func (f headerDeliveryFunc) ProduceMessageWithHeaders(topic string, value []byte, headers map[string]string) error {
+	return f(topic, value, headers)
+}
+
+// produceMessage wraps the event and hands it to produce, or to headerProducer
+// when it has headers and headerProducer is not nil.
+func (p *envelopeProducer) produceMessage(topic string, value []byte, produce func(topic string, value []byte) error,
+	headerProducer HeaderProducer) error {
+	prefixedTopic := p.options.TopicPrefix + topic
+	if p.options.Format == FormatRaw {
+		return produce(prefixedTopic, value)
+	}
+
+	cloudEvent, err := p.newCloudEvent(topic, value)
+	if err != nil {
+		return err
+	}
+
+	if p.options.Format == FormatBinary {
+		headers := map[string]string{
+			"ce_specversion":   cloudEvent.SpecVersion,
+			"ce_id":            cloudEvent.ID,
+			"ce_source":        cloudEvent.Source,
+			"ce_type":          cloudEvent.Type,
+			"ce_time":          cloudEvent.Time.Format(time.RFC3339Nano),
+			"ce_schemaversion": cloudEvent.SchemaVersion,
+			"content-type":     cloudEvent.DataContentType,
+		}
+		return headerProducer.ProduceMessageWithHeaders(prefixedTopic, value, headers)
+	}
+
+	envelope, err := json.Marshal(cloudEvent)
+	if err != nil {
+		return err
+	}
+	if headerProducer != nil {
+		return headerProducer.ProduceMessageWithHeaders(prefixedTopic, envelope, map[string]string{"content-type": cloudEventsContentType})
+	}
+	return produce(prefixedTopic, envelope)
+}
+
+func (p *envelopeProducer) newCloudEvent(topic string, value []byte) (*CloudEvent, error) {
+	schema, ok := SchemaOf(topic)
+	if !ok {
+		return nil, fmt.Errorf("no schema registered for %s", topic)
+	}
+
+	return &CloudEvent{
+		SpecVersion:     cloudEventsSpecVersion,
+		ID:              uuid.NewString(),
+		Source:          p.options.Source,
+		Type:            topic,
+		Time:            time.Now().UTC(),
+		DataContentType: "application/json",
+		SchemaVersion:   strconv.Itoa(schema.Version),
+		Data:            value,
+	}, nil
+}
+
+// Unwrap returns the event name and event JSON of a message published with these
+// options, so failed deliveries can be stored and replayed without the envelope.
+func (o EnvelopeOptions) Unwrap(topic string, value []byte) (string, []byte) {
+	topic = strings.TrimPrefix(topic, o.TopicPrefix)
+	if o.Format != FormatStructured {
+		return topic, value
+	}
+
+	var cloudEvent CloudEvent
+	if err := json.Unmarshal(value, &cloudEvent); err != nil || cloudEvent.Data == nil {
+		return topic, value
+	}
+	return topic, cloudEvent.Data
+}
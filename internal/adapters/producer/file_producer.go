@@ -0,0 +1,57 @@
+package producer
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	events "github.com/WarisLi/Golang-shared-events"
+)
+
+type fileRecord struct {
+	Time  time.Time       `json:"time"`
+	Topic string          `json:"topic"`
+	Value json.RawMessage `json:"value"`
+}
+
+// fileProducer writes every event as a JSON line, for local development.
+type fileProducer struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewFileProducer(w io.Writer) EventProducer {
+	return &fileProducer{w: w}
+}
+
+func (p *fileProducer) Produce(event events.Event) error {
+	value, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	return p.ProduceMessage(TopicOf(event), value)
+}
+
+func (p *fileProducer) ProduceMessage(topic string, value []byte) error {
+	record := fileRecord{Time: time.Now(), Topic: topic, Value: value}
+	if !json.Valid(value) {
+		quoted, err := json.Marshal(string(value))
+		if err != nil {
+			return err
+		}
+		record.Value = quoted
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	_, err = p.w.Write(append(line, '\n'))
+	return err
+}
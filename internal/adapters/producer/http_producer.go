@@ -0,0 +1,57 @@
+package producer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	events "github.com/WarisLi/Golang-shared-events"
+)
+
+// TopicHeader carries the topic of an event published over HTTP.
+const TopicHeader = "X-Event-Topic"
+
+// httpProducer posts every event as JSON to a webhook URL.
+type httpProducer struct {
+	url    string
+	client *http.Client
+}
+
+func NewHttpProducer(url string, timeout time.Duration) EventProducer {
+	return &httpProducer{
+		url:    url,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+func (p *httpProducer) Produce(event events.Event) error {
+	value, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	return p.ProduceMessage(TopicOf(event), value)
+}
+
+func (p *httpProducer) ProduceMessage(topic string, value []byte) error {
+	req, err := http.NewRequest(http.MethodPost, p.url, bytes.NewReader(value))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(TopicHeader, topic)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook %s responded %s", p.url, resp.Status)
+	}
+
+	return nil
+}
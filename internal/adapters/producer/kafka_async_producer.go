@@ -0,0 +1,144 @@
+package producer
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+
+	events "github.com/WarisLi/Golang-shared-events"
+
+	"gopkg.in/Shopify/sarama.v1"
+)
+
+// ErrorHandler is called with the messages an asynchronous producer failed to deliver.
+type ErrorHandler func(topic string, value []byte, err error)
+
+var errProducerClosed = errors.New("producer is closed")
+
+// AsyncEventProducer queues events on a sarama.AsyncProducer, which batches
+// them in the background. Delivery failures are reported to the error handler
+// instead of the caller of Produce.
+type AsyncEventProducer struct {
+	producer sarama.AsyncProducer
+	onError  ErrorHandler
+
+	mu     sync.RWMutex
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// NewAsyncEventProducer starts draining the success and error channels of producer,
+// which must be created with Producer.Return.Successes and Producer.Return.Errors enabled.
+// A nil onError logs failed deliveries.
+func NewAsyncEventProducer(producer sarama.AsyncProducer, onError ErrorHandler) *AsyncEventProducer {
+	if onError == nil {
+		onError = func(topic string, value []byte, err error) {
+			log.Printf("Produce to %s failed %s\n", topic, err)
+		}
+	}
+
+	p := &AsyncEventProducer{producer: producer, onError: onError}
+	p.wg.Add(2)
+	go p.handleSuccesses()
+	go p.handleErrors()
+	return p
+}
+
+func (p *AsyncEventProducer) handleSuccesses() {
+	defer p.wg.Done()
+	for msg := range p.producer.Successes() {
+		kafkaMetrics.Add(metricDelivered, 1)
+		if delivered, ok := msg.Metadata.(chan error); ok {
+			delivered <- nil
+		}
+	}
+}
+
+func (p *AsyncEventProducer) handleErrors() {
+	defer p.wg.Done()
+	for producerErr := range p.producer.Errors() {
+		kafkaMetrics.Add(metricFailed, 1)
+
+		// The failure of a delivered message goes to the caller waiting for it
+		if delivered, ok := producerErr.Msg.Metadata.(chan error); ok {
+			delivered <- producerErr.Err
+			continue
+		}
+
+		var value []byte
+		if producerErr.Msg.Value != nil {
+			value, _ = producerErr.Msg.Value.Encode()
+		}
+		p.onError(producerErr.Msg.Topic, value, producerErr.Err)
+	}
+}
+
+func (p *AsyncEventProducer) Produce(event events.Event) error {
+	value, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	return p.ProduceMessage(TopicOf(event), value)
+}
+
+func (p *AsyncEventProducer) ProduceMessage(topic string, value []byte) error {
+	return p.ProduceMessageWithHeaders(topic, value, nil)
+}
+
+func (p *AsyncEventProducer) ProduceMessageWithHeaders(topic string, value []byte, headers map[string]string) error {
+	return p.send(&sarama.ProducerMessage{
+		Topic:   topic,
+		Value:   sarama.ByteEncoder(value),
+		Headers: recordHeaders(headers),
+	})
+}
+
+func (p *AsyncEventProducer) DeliverMessage(topic string, value []byte) error {
+	return p.DeliverMessageWithHeaders(topic, value, nil)
+}
+
+// DeliverMessageWithHeaders queues a message and waits for its delivery report,
+// a failure is returned instead of being reported to the error handler.
+func (p *AsyncEventProducer) DeliverMessageWithHeaders(topic string, value []byte, headers map[string]string) error {
+	delivered := make(chan error, 1)
+	if err := p.send(&sarama.ProducerMessage{
+		Topic:    topic,
+		Value:    sarama.ByteEncoder(value),
+		Headers:  recordHeaders(headers),
+		Metadata: delivered,
+	}); err != nil {
+		return err
+	}
+
+	return <-delivered
+}
+
+func (p *AsyncEventProducer) send(msg *sarama.ProducerMessage) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.closed {
+		return errProducerClosed
+	}
+
+	kafkaMetrics.Add(metricProduced, 1)
+	p.producer.Input() <- msg
+	return nil
+}
+
+// Close flushes the queued messages and waits for their delivery reports.
+func (p *AsyncEventProducer) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	p.mu.Unlock()
+
+	p.producer.AsyncClose()
+	p.wg.Wait()
+	return nil
+}
@@ -11,6 +11,19 @@ import (
 
 type EventProducer interface {
 	Produce(event events.Event) error
+	ProduceMessage(topic string, value []byte) error
+}
+
+// DeliveryProducer is implemented by the producers queuing the messages, whose
+// ProduceMessage returns before the message is delivered. DeliverMessage waits
+// for the delivery and returns its failure.
+type DeliveryProducer interface {
+	DeliverMessage(topic string, value []byte) error
+}
+
+// TopicOf returns the topic an event is published to.
+func TopicOf(event events.Event) string {
+	return reflect.TypeOf(event).Name()
 }
 
 type eventProducer struct {
@@ -22,22 +35,40 @@ func NewEventProducer(producer sarama.SyncProducer) EventProducer {
 }
 
 func (obj eventProducer) Produce(event events.Event) error {
-	topic := reflect.TypeOf(event).Name()
-
 	value, err := json.Marshal(event)
 	if err != nil {
 		return err
 	}
 
+	return obj.ProduceMessage(TopicOf(event), value)
+}
+
+func (obj eventProducer) ProduceMessage(topic string, value []byte) error {
+	return obj.ProduceMessageWithHeaders(topic, value, nil)
+}
+
+func (obj eventProducer) ProduceMessageWithHeaders(topic string, value []byte, headers map[string]string) error {
 	msg := sarama.ProducerMessage{
-		Topic: topic,
-		Value: sarama.ByteEncoder(value),
+		Topic:   topic,
+		Value:   sarama.ByteEncoder(value),
+		Headers: recordHeaders(headers),
 	}
 
-	_, _, err = obj.producer.SendMessage(&msg)
+	kafkaMetrics.Add(metricProduced, 1)
+	_, _, err := obj.producer.SendMessage(&msg)
 	if err != nil {
+		kafkaMetrics.Add(metricFailed, 1)
 		return err
 	}
+	kafkaMetrics.Add(metricDelivered, 1)
 
 	return nil
 }
+
+func recordHeaders(headers map[string]string) []sarama.RecordHeader {
+	recordHeaders := make([]sarama.RecordHeader, 0, len(headers))
+	for key, value := range headers {
+		recordHeaders = append(recordHeaders, sarama.RecordHeader{Key: []byte(key), Value: []byte(value)})
+	}
+	return recordHeaders
+}
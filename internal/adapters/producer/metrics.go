@@ -0,0 +1,12 @@
+package producer
+
+import "expvar"
+
+// kafkaMetrics counts Kafka deliveries, exposed through expvar as "kafka_producer".
+var kafkaMetrics = expvar.NewMap("kafka_producer")
+
+const (
+	metricProduced  = "produced"
+	metricDelivered = "delivered"
+	metricFailed    = "failed"
+)
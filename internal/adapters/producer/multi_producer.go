@@ -0,0 +1,36 @@
+package producer
+
+import (
+	"encoding/json"
+	"errors"
+
+	events "github.com/WarisLi/Golang-shared-events"
+)
+
+// multiProducer publishes every event to several producers.
+type multiProducer struct {
+	producers []EventProducer
+}
+
+func NewMultiProducer(producers ...EventProducer) EventProducer {
+	return &multiProducer{producers: producers}
+}
+
+func (p *multiProducer) Produce(event events.Event) error {
+	value, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	return p.ProduceMessage(TopicOf(event), value)
+}
+
+func (p *multiProducer) ProduceMessage(topic string, value []byte) error {
+	var errs []error
+	for _, producer := range p.producers {
+		if err := producer.ProduceMessage(topic, value); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
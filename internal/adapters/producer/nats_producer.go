@@ -0,0 +1,265 @@
+package producer
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	events "github.com/WarisLi/Golang-shared-events"
+)
+
+const natsDefaultPort = "4222"
+
+type natsConnectOptions struct {
+	Verbose  bool   `json:"verbose"`
+	Pedantic bool   `json:"pedantic"`
+	Name     string `json:"name"`
+	Lang     string `json:"lang"`
+	User     string `json:"user,omitempty"`
+	Pass     string `json:"pass,omitempty"`
+}
+
+// NatsProducer publishes events to a NATS-compatible server using the
+// plain text client protocol. Each publish is followed by a PING so that the
+// -ERR of a refused message is returned by the publish. It reconnects on the
+// next publish after the connection is lost.
+type NatsProducer struct {
+	url     *url.URL
+	timeout time.Duration
+
+	// mu serializes the publishes, one PING is in flight at a time.
+	mu   sync.Mutex
+	conn *natsConn
+}
+
+// natsConn is a connection to the server, its replies are read by readLoop.
+type natsConn struct {
+	conn net.Conn
+	// wmu serializes the writes of the publishes and of the PONG replies to the server PINGs.
+	wmu sync.Mutex
+	w   *bufio.Writer
+	// pongs receives the result of the PING of each publish, the -ERR the server
+	// replied before the PONG or nil.
+	pongs chan error
+	// closed is closed by readLoop once the connection is lost.
+	closed chan struct{}
+}
+
+func NewNatsProducer(rawURL string, timeout time.Duration) (*NatsProducer, error) {
+	natsURL, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &NatsProducer{url: natsURL, timeout: timeout}
+	if err := p.connect(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// connect must be called with p.mu held or before p is shared.
+func (p *NatsProducer) connect() error {
+	host := p.url.Host
+	if p.url.Port() == "" {
+		host = net.JoinHostPort(p.url.Hostname(), natsDefaultPort)
+	}
+
+	conn, err := net.DialTimeout("tcp", host, p.timeout)
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(p.timeout))
+
+	r := bufio.NewReader(conn)
+	line, err := r.ReadString('\n')
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	if !strings.HasPrefix(line, "INFO") {
+		conn.Close()
+		return fmt.Errorf("nats: unexpected greeting %q", strings.TrimSpace(line))
+	}
+
+	options := natsConnectOptions{Name: "golang-mini-project", Lang: "go"}
+	if p.url.User != nil {
+		options.User = p.url.User.Username()
+		options.Pass, _ = p.url.User.Password()
+	}
+	connectOptions, err := json.Marshal(options)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	w := bufio.NewWriter(conn)
+	fmt.Fprintf(w, "CONNECT %s\r\nPING\r\n", connectOptions)
+	if err := w.Flush(); err != nil {
+		conn.Close()
+		return err
+	}
+
+	line, err = r.ReadString('\n')
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	if !strings.HasPrefix(line, "PONG") {
+		conn.Close()
+		return fmt.Errorf("nats: connect failed %q", strings.TrimSpace(line))
+	}
+	conn.SetDeadline(time.Time{})
+
+	c := &natsConn{conn: conn, w: w, pongs: make(chan error, 1), closed: make(chan struct{})}
+	p.conn = c
+	go p.readLoop(c, r)
+
+	return nil
+}
+
+// write writes to c and flushes it within the timeout, the deadline is cleared
+// afterwards so that it does not fail a later write after an idle period.
+func (p *NatsProducer) write(c *natsConn, write func(w *bufio.Writer)) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	c.conn.SetWriteDeadline(time.Now().Add(p.timeout))
+	write(c.w)
+	err := c.w.Flush()
+	c.conn.SetWriteDeadline(time.Time{})
+	if err != nil {
+		// The writer keeps the error, the connection cannot be used anymore
+		c.conn.Close()
+	}
+	return err
+}
+
+// readLoop answers server pings and passes the replies to the pings of the
+// publishes until c is closed.
+func (p *NatsProducer) readLoop(c *natsConn, r *bufio.Reader) {
+	defer close(c.closed)
+	defer c.conn.Close()
+
+	var serverErr error
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			if serverErr != nil {
+				// The server refused the message and closed the connection
+				c.reply(serverErr)
+			}
+			return
+		}
+
+		switch {
+		case strings.HasPrefix(line, "PING"):
+			if err := p.write(c, func(w *bufio.Writer) { w.WriteString("PONG\r\n") }); err != nil {
+				log.Printf("nats: PONG failed %s\n", err)
+				return
+			}
+		case strings.HasPrefix(line, "PONG"):
+			c.reply(serverErr)
+			serverErr = nil
+		case strings.HasPrefix(line, "-ERR"):
+			log.Printf("nats: %s\n", strings.TrimSpace(line))
+			serverErr = fmt.Errorf("nats: %s", strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+		}
+	}
+}
+
+func (p *NatsProducer) Produce(event events.Event) error {
+	value, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	return p.ProduceMessage(TopicOf(event), value)
+}
+
+func (p *NatsProducer) ProduceMessage(topic string, value []byte) error {
+	if topic == "" || strings.ContainsAny(topic, " \t\r\n") {
+		return fmt.Errorf("nats: invalid subject %q", topic)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.conn != nil && p.conn.isClosed() {
+		p.conn = nil
+	}
+	if p.conn == nil {
+		if err := p.connect(); err != nil {
+			return err
+		}
+	}
+
+	c := p.conn
+	err := p.write(c, func(w *bufio.Writer) {
+		fmt.Fprintf(w, "PUB %s %d\r\n", topic, len(value))
+		w.Write(value)
+		w.WriteString("\r\nPING\r\n")
+	})
+	if err != nil {
+		p.conn = nil
+		return err
+	}
+
+	// The server replies to the PING once it has processed the message
+	timer := time.NewTimer(p.timeout)
+	defer timer.Stop()
+	select {
+	case err := <-c.pongs:
+		return err
+	case <-c.closed:
+		p.conn = nil
+		select {
+		case err := <-c.pongs:
+			return err
+		default:
+			return errors.New("nats: connection lost before the message was acknowledged")
+		}
+	case <-timer.C:
+		c.conn.Close()
+		p.conn = nil
+		return errors.New("nats: no reply after publish")
+	}
+}
+
+// reply passes the result of a PING to the publish waiting for it, the replies of
+// a publish that gave up waiting are dropped.
+func (c *natsConn) reply(err error) {
+	select {
+	case c.pongs <- err:
+	default:
+	}
+}
+
+// isClosed reports whether the connection was lost.
+func (c *natsConn) isClosed() bool {
+	select {
+	case <-c.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+func (p *NatsProducer) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.conn == nil {
+		return nil
+	}
+	err := p.conn.conn.Close()
+	p.conn = nil
+	return err
+}
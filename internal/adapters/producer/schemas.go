@@ -0,0 +1,49 @@
+package producer
+
+import (
+	"reflect"
+
+	events "github.com/WarisLi/Golang-shared-events"
+
+	"github.com/WarisLi/Golang-mini-project/internal/core/models"
+)
+
+// Schema describes the payload of the events published to a topic.
+type Schema struct {
+	Version int
+	Type    reflect.Type
+}
+
+var schemas = map[string]Schema{}
+
+// RegisterSchema declares the schema version of an event. The version must be
+// incremented on every incompatible change of the event payload.
+func RegisterSchema(event events.Event, version int) {
+	schemas[TopicOf(event)] = Schema{Version: version, Type: reflect.TypeOf(event)}
+}
+
+// SchemaOf returns the schema registered for a topic.
+func SchemaOf(topic string) (Schema, bool) {
+	schema, ok := schemas[topic]
+	return schema, ok
+}
+
+// Schemas returns every registered schema by topic.
+func Schemas() map[string]Schema {
+	registered := make(map[string]Schema, len(schemas))
+	for topic, schema := range schemas {
+		registered[topic] = schema
+	}
+	return registered
+}
+
+func init() {
+	RegisterSchema(events.LowProductQuantityNotificationEvent{}, 1)
+	RegisterSchema(events.NewOrderNotificationEvent{}, 1)
+	RegisterSchema(models.OrderPlacedEvent{}, 1)
+	RegisterSchema(models.OrderCancelledEvent{}, 1)
+	RegisterSchema(models.ProductCreatedEvent{}, 1)
+	RegisterSchema(models.ProductUpdatedEvent{}, 1)
+	RegisterSchema(models.ProductDeletedEvent{}, 1)
+	RegisterSchema(models.UserAuditEvent{}, 1)
+}
@@ -0,0 +1,37 @@
+package webhook
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/WarisLi/Golang-mini-project/internal/core/ports"
+)
+
+type httpWebhookSender struct {
+	client *http.Client
+}
+
+func NewHttpWebhookSender(timeout time.Duration) ports.WebhookSender {
+	return &httpWebhookSender{client: &http.Client{Timeout: timeout}}
+}
+
+func (s *httpWebhookSender) Send(url string, body []byte, headers map[string]string) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	return resp.StatusCode, nil
+}
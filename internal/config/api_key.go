@@ -0,0 +1,29 @@
+package config
+
+import (
+	"time"
+
+	"github.com/WarisLi/Golang-mini-project/internal/core/ports"
+)
+
+// LoadAPIKeyConfig reads the API_KEY_* environment variables.
+func LoadAPIKeyConfig() (*ports.APIKeyOptions, error) {
+	maxTTL, err := envDuration("API_KEY_MAX_TTL", 365*24*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+	rotationGrace, err := envDuration("API_KEY_ROTATION_GRACE", 24*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+	lastUsedInterval, err := envDuration("API_KEY_LAST_USED_INTERVAL", time.Minute)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ports.APIKeyOptions{
+		MaxTTL:           maxTTL,
+		RotationGrace:    rotationGrace,
+		LastUsedInterval: lastUsedInterval,
+	}, nil
+}
@@ -0,0 +1,82 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/WarisLi/Golang-mini-project/internal/adapters/cache"
+	"github.com/WarisLi/Golang-mini-project/internal/core/ports"
+)
+
+const (
+	CacheNone  = "none"
+	CacheLRU   = "lru"
+	CacheRedis = "redis"
+)
+
+type ProductCacheConfig struct {
+	Backend string
+	// Size is the maximum number of entries of the LRU cache.
+	Size         int
+	RedisURL     string
+	RedisTimeout time.Duration
+	Options      cache.ProductCacheOptions
+}
+
+// LoadProductCacheConfig reads the PRODUCT_CACHE_* and REDIS_* environment variables.
+func LoadProductCacheConfig() (*ProductCacheConfig, error) {
+	size, err := envInt("PRODUCT_CACHE_SIZE", 1000)
+	if err != nil {
+		return nil, err
+	}
+	ttl, err := envDuration("PRODUCT_CACHE_TTL", time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	redisTimeout, err := envDuration("REDIS_TIMEOUT", time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ProductCacheConfig{
+		Backend:      strings.ToLower(envString("PRODUCT_CACHE", CacheNone)),
+		Size:         size,
+		RedisURL:     envString("REDIS_URL", "redis://localhost:6379/0"),
+		RedisTimeout: redisTimeout,
+		Options:      cache.ProductCacheOptions{TTL: ttl},
+	}, nil
+}
+
+// SetupProductCache decorates the product and stock repositories and the unit of work with the cache
+// selected by PRODUCT_CACHE (none by default) and returns a function releasing its resources.
+func SetupProductCache(repos *Repositories) (func(), error) {
+	cacheConfig, err := LoadProductCacheConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	var backend ports.Cache
+	closeCache := func() {}
+	switch cacheConfig.Backend {
+	case CacheNone:
+		return closeCache, nil
+	case CacheLRU:
+		backend = cache.NewLRUCache(cacheConfig.Size)
+	case CacheRedis:
+		redisCache, err := cache.NewRedisCache(cacheConfig.RedisURL, cacheConfig.RedisTimeout)
+		if err != nil {
+			return nil, err
+		}
+		backend = redisCache
+		closeCache = func() { redisCache.Close() }
+	default:
+		return nil, fmt.Errorf("PRODUCT_CACHE: unknown cache %q, use none, lru or redis", cacheConfig.Backend)
+	}
+
+	productCache := cache.NewProductCache(backend, cacheConfig.Options)
+	repos.Product = productCache.ProductRepository(repos.Product)
+	repos.Stock = productCache.StockRepository(repos.Stock)
+	repos.UnitOfWork = productCache.UnitOfWork(repos.UnitOfWork)
+	return closeCache, nil
+}
@@ -0,0 +1,34 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/WarisLi/Golang-mini-project/internal/adapters/http/middleware"
+	"github.com/gofiber/fiber/v2"
+)
+
+// LoadCookieConfig reads the AUTH_COOKIE_* environment variables of the token cookies of the
+// browsers, which live as long as the access tokens.
+func LoadCookieConfig(tokenTTL time.Duration) (*middleware.CookieOptions, error) {
+	secure, err := envBool("AUTH_COOKIE_SECURE", true)
+	if err != nil {
+		return nil, err
+	}
+	sameSite := strings.ToLower(envString("AUTH_COOKIE_SAMESITE", fiber.CookieSameSiteLaxMode))
+	if sameSite != fiber.CookieSameSiteStrictMode && sameSite != fiber.CookieSameSiteLaxMode && sameSite != fiber.CookieSameSiteNoneMode {
+		return nil, fmt.Errorf("AUTH_COOKIE_SAMESITE: unknown mode %q, use Strict, Lax or None", sameSite)
+	}
+	// The browsers refuse the cross-site cookies which are not secure
+	if sameSite == fiber.CookieSameSiteNoneMode && !secure {
+		return nil, fmt.Errorf("AUTH_COOKIE_SAMESITE: None requires AUTH_COOKIE_SECURE")
+	}
+
+	return &middleware.CookieOptions{
+		Secure:   secure,
+		SameSite: sameSite,
+		Domain:   envString("AUTH_COOKIE_DOMAIN", ""),
+		TTL:      tokenTTL,
+	}, nil
+}
@@ -0,0 +1,30 @@
+package config
+
+import (
+	"os"
+	"time"
+)
+
+type DeadLetterConfig struct {
+	AlertThreshold  int64
+	CheckInterval   time.Duration
+	AlertWebhookURL string
+}
+
+// LoadDeadLetterConfig reads the DEAD_LETTER_* environment variables.
+func LoadDeadLetterConfig() (*DeadLetterConfig, error) {
+	threshold, err := envInt("DEAD_LETTER_ALERT_THRESHOLD", 100)
+	if err != nil {
+		return nil, err
+	}
+	interval, err := envDuration("DEAD_LETTER_CHECK_INTERVAL", time.Minute)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DeadLetterConfig{
+		AlertThreshold:  int64(threshold),
+		CheckInterval:   interval,
+		AlertWebhookURL: os.Getenv("DEAD_LETTER_ALERT_WEBHOOK_URL"),
+	}, nil
+}
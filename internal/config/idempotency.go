@@ -0,0 +1,29 @@
+package config
+
+import (
+	"time"
+
+	"github.com/WarisLi/Golang-mini-project/internal/core/ports"
+)
+
+// LoadIdempotencyConfig reads the IDEMPOTENCY_* environment variables.
+func LoadIdempotencyConfig() (*ports.IdempotencyOptions, error) {
+	ttl, err := envDuration("IDEMPOTENCY_TTL", 24*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+	lockTimeout, err := envDuration("IDEMPOTENCY_LOCK_TIMEOUT", time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	sweepInterval, err := envDuration("IDEMPOTENCY_SWEEP_INTERVAL", 10*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ports.IdempotencyOptions{
+		TTL:           ttl,
+		LockTimeout:   lockTimeout,
+		SweepInterval: sweepInterval,
+	}, nil
+}
@@ -0,0 +1,262 @@
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/Shopify/sarama.v1"
+)
+
+// KafkaConfig holds the Kafka settings read from the environment.
+type KafkaConfig struct {
+	Servers []string
+	Async   bool
+	Sarama  *sarama.Config
+}
+
+// KafkaConsumerConfig holds the settings of the order consumer.
+type KafkaConsumerConfig struct {
+	Enabled      bool
+	Servers      []string
+	Group        string
+	TopicPrefix  string
+	RetryBackoff time.Duration
+	Sarama       *sarama.Config
+}
+
+// LoadKafkaConfig reads the KAFKA_* environment variables of the producer.
+func LoadKafkaConfig() (*KafkaConfig, error) {
+	cfg, servers, err := newSaramaConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	switch strings.ToLower(envString("KAFKA_REQUIRED_ACKS", "all")) {
+	case "all":
+		cfg.Producer.RequiredAcks = sarama.WaitForAll
+	case "local":
+		cfg.Producer.RequiredAcks = sarama.WaitForLocal
+	case "none":
+		cfg.Producer.RequiredAcks = sarama.NoResponse
+	default:
+		return nil, fmt.Errorf("KAFKA_REQUIRED_ACKS must be all, local or none")
+	}
+
+	compressions := map[string]sarama.CompressionCodec{
+		"none":   sarama.CompressionNone,
+		"gzip":   sarama.CompressionGZIP,
+		"snappy": sarama.CompressionSnappy,
+		"lz4":    sarama.CompressionLZ4,
+		"zstd":   sarama.CompressionZSTD,
+	}
+	compression, ok := compressions[strings.ToLower(envString("KAFKA_COMPRESSION", "none"))]
+	if !ok {
+		return nil, fmt.Errorf("KAFKA_COMPRESSION must be none, gzip, snappy, lz4 or zstd")
+	}
+	cfg.Producer.Compression = compression
+
+	if cfg.Producer.Retry.Max, err = envInt("KAFKA_RETRY_MAX", 5); err != nil {
+		return nil, err
+	}
+	if cfg.Producer.Retry.Backoff, err = envDuration("KAFKA_RETRY_BACKOFF", 100*time.Millisecond); err != nil {
+		return nil, err
+	}
+	if cfg.Producer.Timeout, err = envDuration("KAFKA_TIMEOUT", 10*time.Second); err != nil {
+		return nil, err
+	}
+
+	idempotent, err := envBool("KAFKA_IDEMPOTENT", false)
+	if err != nil {
+		return nil, err
+	}
+	if idempotent {
+		// Idempotent delivery requires acks from all replicas and a single
+		// in-flight request per connection to keep ordering.
+		cfg.Producer.Idempotent = true
+		cfg.Producer.RequiredAcks = sarama.WaitForAll
+		cfg.Net.MaxOpenRequests = 1
+	}
+
+	async, err := envBool("KAFKA_ASYNC", false)
+	if err != nil {
+		return nil, err
+	}
+	if async {
+		if cfg.Producer.Flush.Frequency, err = envDuration("KAFKA_FLUSH_FREQUENCY", 500*time.Millisecond); err != nil {
+			return nil, err
+		}
+		if cfg.Producer.Flush.Messages, err = envInt("KAFKA_FLUSH_MESSAGES", 100); err != nil {
+			return nil, err
+		}
+	}
+	cfg.Producer.Return.Successes = true
+	cfg.Producer.Return.Errors = true
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &KafkaConfig{Servers: servers, Async: async, Sarama: cfg}, nil
+}
+
+// LoadKafkaConsumerConfig reads the KAFKA_* environment variables of the order consumer.
+func LoadKafkaConsumerConfig() (*KafkaConsumerConfig, error) {
+	enabled, err := envBool("KAFKA_CONSUMER_ENABLED", false)
+	if err != nil || !enabled {
+		return &KafkaConsumerConfig{}, err
+	}
+
+	cfg, servers, err := newSaramaConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.Consumer.Return.Errors = true
+	switch strings.ToLower(envString("KAFKA_CONSUMER_INITIAL_OFFSET", "oldest")) {
+	case "oldest":
+		cfg.Consumer.Offsets.Initial = sarama.OffsetOldest
+	case "newest":
+		cfg.Consumer.Offsets.Initial = sarama.OffsetNewest
+	default:
+		return nil, fmt.Errorf("KAFKA_CONSUMER_INITIAL_OFFSET must be oldest or newest")
+	}
+
+	retryBackoff, err := envDuration("KAFKA_CONSUMER_RETRY_BACKOFF", time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &KafkaConsumerConfig{
+		Enabled:      true,
+		Servers:      servers,
+		Group:        envString("KAFKA_CONSUMER_GROUP", "golang-mini-project"),
+		TopicPrefix:  os.Getenv("EVENT_TOPIC_PREFIX"),
+		RetryBackoff: retryBackoff,
+		Sarama:       cfg,
+	}, nil
+}
+
+// newSaramaConfig returns the brokers and the connection settings shared by
+// the producer and the consumer.
+func newSaramaConfig() (*sarama.Config, []string, error) {
+	cfg := sarama.NewConfig()
+	cfg.ClientID = "golang-mini-project"
+
+	var err error
+	cfg.Version, err = sarama.ParseKafkaVersion(envString("KAFKA_VERSION", "1.0.0"))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := setupKafkaTLS(cfg); err != nil {
+		return nil, nil, err
+	}
+
+	if cfg.Net.SASL.Enable, err = envBool("KAFKA_SASL_ENABLED", false); err != nil {
+		return nil, nil, err
+	}
+	cfg.Net.SASL.Handshake = true
+	cfg.Net.SASL.User = os.Getenv("KAFKA_SASL_USERNAME")
+	cfg.Net.SASL.Password = os.Getenv("KAFKA_SASL_PASSWORD")
+
+	var servers []string
+	for _, server := range strings.Split(os.Getenv("KAFKA_SERVERS"), ",") {
+		if server = strings.TrimSpace(server); server != "" {
+			servers = append(servers, server)
+		}
+	}
+	if len(servers) == 0 {
+		return nil, nil, fmt.Errorf("KAFKA_SERVERS is required")
+	}
+
+	return cfg, servers, nil
+}
+
+func setupKafkaTLS(cfg *sarama.Config) error {
+	enabled, err := envBool("KAFKA_TLS_ENABLED", false)
+	if err != nil || !enabled {
+		return err
+	}
+
+	insecureSkipVerify, err := envBool("KAFKA_TLS_INSECURE_SKIP_VERIFY", false)
+	if err != nil {
+		return err
+	}
+	tlsConfig := &tls.Config{InsecureSkipVerify: insecureSkipVerify}
+
+	if caFile := os.Getenv("KAFKA_TLS_CA_FILE"); caFile != "" {
+		caCert, err := os.ReadFile(caFile)
+		if err != nil {
+			return err
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(caCert) {
+			return fmt.Errorf("no certificate found in %s", caFile)
+		}
+	}
+
+	certFile, keyFile := os.Getenv("KAFKA_TLS_CERT_FILE"), os.Getenv("KAFKA_TLS_KEY_FILE")
+	if certFile != "" && keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	cfg.Net.TLS.Enable = true
+	cfg.Net.TLS.Config = tlsConfig
+	return nil
+}
+
+func envString(key string, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func envInt(key string, fallback int) (int, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback, nil
+	}
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", key, err)
+	}
+	return i, nil
+}
+
+func envBool(key string, fallback bool) (bool, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", key, err)
+	}
+	return b, nil
+}
+
+func envDuration(key string, fallback time.Duration) (time.Duration, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", key, err)
+	}
+	return d, nil
+}
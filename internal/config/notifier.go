@@ -0,0 +1,42 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/WarisLi/Golang-mini-project/internal/adapters/notifier"
+	"github.com/WarisLi/Golang-mini-project/internal/core/ports"
+)
+
+const (
+	NotifierLog  = "log"
+	NotifierSmtp = "smtp"
+)
+
+// SetupNotifier reads NOTIFIER (log by default) and the SMTP_* environment variables.
+func SetupNotifier() (ports.Notifier, error) {
+	switch name := strings.ToLower(envString("NOTIFIER", NotifierLog)); name {
+	case NotifierLog:
+		return notifier.NewLogNotifier(), nil
+	case NotifierSmtp:
+		port, err := envInt("SMTP_PORT", 587)
+		if err != nil {
+			return nil, err
+		}
+		timeout, err := envDuration("SMTP_TIMEOUT", 10*time.Second)
+		if err != nil {
+			return nil, err
+		}
+		return notifier.NewSmtpNotifier(notifier.SmtpOptions{
+			Host:     envString("SMTP_HOST", "localhost"),
+			Port:     port,
+			Username: envString("SMTP_USERNAME", ""),
+			Password: envString("SMTP_PASSWORD", ""),
+			From:     envString("SMTP_FROM", "no-reply@localhost"),
+			Timeout:  timeout,
+		}), nil
+	default:
+		return nil, fmt.Errorf("NOTIFIER: unknown notifier %q, use log or smtp", name)
+	}
+}
@@ -0,0 +1,102 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/WarisLi/Golang-mini-project/internal/adapters/oidc"
+	"github.com/WarisLi/Golang-mini-project/internal/core/ports"
+)
+
+// oidcProviderName matches the provider names, part of the routes and of the variables.
+var oidcProviderName = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+type OIDCConfig struct {
+	Providers map[string]ports.OIDCProvider
+	Options   ports.OIDCOptions
+	// AfterLoginURL receives the browsers after a login, the callback returns the token when empty.
+	AfterLoginURL string
+}
+
+// SetupOIDC reads OIDC_PROVIDERS, the comma separated names of the OpenID Connect providers,
+// the OIDC_<NAME>_* variables of each provider and the other OIDC_* variables.
+func SetupOIDC() (*OIDCConfig, error) {
+	timeout, err := envDuration("OIDC_TIMEOUT", 10*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	loginTTL, err := envDuration("OIDC_LOGIN_TTL", 10*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+
+	providers := map[string]ports.OIDCProvider{}
+	for _, name := range strings.Split(envString("OIDC_PROVIDERS", ""), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if !oidcProviderName.MatchString(name) {
+			return nil, fmt.Errorf("OIDC_PROVIDERS: invalid name %q, use letters, digits and _", name)
+		}
+		provider, err := loadOIDCProvider(name, timeout)
+		if err != nil {
+			return nil, err
+		}
+		providers[name] = *provider
+	}
+
+	return &OIDCConfig{
+		Providers:     providers,
+		Options:       ports.OIDCOptions{LoginTTL: loginTTL},
+		AfterLoginURL: envString("OIDC_AFTER_LOGIN_URL", ""),
+	}, nil
+}
+
+func loadOIDCProvider(name string, timeout time.Duration) (*ports.OIDCProvider, error) {
+	prefix := "OIDC_" + strings.ToUpper(name) + "_"
+	options := oidc.ProviderOptions{
+		Issuer:       envString(prefix+"ISSUER", ""),
+		ClientID:     envString(prefix+"CLIENT_ID", ""),
+		ClientSecret: envString(prefix+"CLIENT_SECRET", ""),
+		RedirectURL:  envString(prefix+"REDIRECT_URL", ""),
+		Scopes:       strings.Fields(envString(prefix+"SCOPES", "openid profile email")),
+		Timeout:      timeout,
+	}
+	for _, required := range []string{"ISSUER", "CLIENT_ID", "REDIRECT_URL"} {
+		if envString(prefix+required, "") == "" {
+			return nil, fmt.Errorf("%s%s is required", prefix, required)
+		}
+	}
+	provision, err := envBool(prefix+"PROVISION", true)
+	if err != nil {
+		return nil, err
+	}
+	linkUsers, err := envBool(prefix+"LINK_USERS", false)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ports.OIDCProvider{
+		IdentityProvider: oidc.NewHttpIdentityProvider(options),
+		UsernameClaim:    envString(prefix+"USERNAME_CLAIM", ""),
+		GroupsClaim:      envString(prefix+"GROUPS_CLAIM", ""),
+		AdminGroups:      envList(prefix + "ADMIN_GROUPS"),
+		AllowedGroups:    envList(prefix + "ALLOWED_GROUPS"),
+		Provision:        provision,
+		LinkUsers:        linkUsers,
+	}, nil
+}
+
+// envList reads a comma separated list, without its empty items.
+func envList(key string) []string {
+	var items []string
+	for _, item := range strings.Split(envString(key, ""), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -4,8 +4,8 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/WarisLi/Golang-mini-project/internal/adapters/database"
 	"github.com/WarisLi/Golang-mini-project/internal/core/models"
-	"golang.org/x/crypto/bcrypt"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
@@ -19,38 +19,13 @@ const (
 	password     = "mypassword"
 )
 
-func initData(db *gorm.DB) {
-	// init test data
-	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("Pass@12345"), bcrypt.DefaultCost)
-	user := models.User{
-		Username: "user_1",
-		Password: string(hashedPassword),
-	}
-	if result := db.Create(&user); result.Error != nil {
-		fmt.Printf("Initial user data failed %s\n", result.Error)
-	}
-
-	books := []*models.Product{{
-		Name:     "Book A",
-		Quantity: 1200,
-	}, {
-		Name:     "Book B",
-		Quantity: 400,
-	},
-	}
-	if result := db.Create(&books); result.Error != nil {
-		fmt.Printf("Initial product data failed %s\n", result.Error)
-	}
+var dbModels = []interface{}{models.Product{}, models.User{}, models.OutboxEvent{}, models.ProcessedEvent{}, models.Webhook{}, models.WebhookDelivery{}, models.IdempotencyKey{}, models.PasswordResetToken{}, models.APIKey{}, models.SigningKey{}, models.OIDCLogin{}}
 
-	fmt.Printf("Initial data completed\n")
-}
-
-func SetupDB() *gorm.DB {
+func ConnectDB() *gorm.DB {
 	psqlInfo := fmt.Sprintf("host=%v port=%v user=%v password=%v dbname=%v sslmode=disable",
 		os.Getenv("PG_HOST"), os.Getenv("PG_PORT"), os.Getenv("PG_USERNAME"),
 		os.Getenv("PG_PASSWORD"), os.Getenv("PG_DATABASE_NAME"))
-	db, err := gorm.Open(postgres.Open(psqlInfo), &gorm.Config{TranslateError: true,
-		Logger: logger.Default.LogMode(logger.Silent)})
+	db, err := OpenPostgres(psqlInfo)
 
 	if err != nil {
 		panic("fail to connect database\n")
@@ -58,19 +33,34 @@ func SetupDB() *gorm.DB {
 
 	fmt.Printf("Database Connecction successful\n")
 
-	models := []interface{}{models.Product{}, models.User{}}
+	return db
+}
 
-	db.AutoMigrate(models...)
+// OpenPostgres opens the Postgres database of a DSN, e.g. "host=localhost user=myuser dbname=mydatabase".
+func OpenPostgres(dsn string) (*gorm.DB, error) {
+	return gorm.Open(postgres.Open(dsn), &gorm.Config{TranslateError: true,
+		Logger: logger.Default.LogMode(logger.Silent)})
+}
+
+func MigrateDB(db *gorm.DB) error {
+	if err := db.AutoMigrate(dbModels...); err != nil {
+		return err
+	}
+	if db.Dialector.Name() == "postgres" {
+		if err := database.SetupPostgresSearch(db); err != nil {
+			return err
+		}
+	}
 	fmt.Printf("Database migration completed\n")
 
-	for _, model := range models {
+	return nil
+}
+
+func ResetData(db *gorm.DB) {
+	for _, model := range dbModels {
 		if err := db.Session(&gorm.Session{AllowGlobalUpdate: true}).Unscoped().Delete(model).Error; err != nil {
 			fmt.Printf("Data reset failed %s\n", err.Error())
 		}
 	}
 	fmt.Printf("Data reset completed\n")
-
-	initData(db)
-
-	return db
 }
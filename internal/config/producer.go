@@ -0,0 +1,109 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/WarisLi/Golang-mini-project/internal/adapters/producer"
+	"gopkg.in/Shopify/sarama.v1"
+)
+
+const (
+	ProducerKafka   = "kafka"
+	ProducerChannel = "channel"
+	ProducerNats    = "nats"
+	ProducerWebhook = "webhook"
+	ProducerFile    = "file"
+
+	producerTimeout = 5 * time.Second
+)
+
+// SetupEventProducer creates the event producer selected by EVENT_PRODUCER
+// (kafka by default) and returns a function releasing its resources.
+// Messages are formatted according to EVENT_FORMAT, EVENT_SOURCE and EVENT_TOPIC_PREFIX.
+// onError receives the events an asynchronous producer failed to deliver.
+func SetupEventProducer(onError producer.ErrorHandler) (producer.EventProducer, func(), error) {
+	envelopeOptions := producer.EnvelopeOptions{
+		Format:      strings.ToLower(envString("EVENT_FORMAT", producer.FormatRaw)),
+		Source:      envString("EVENT_SOURCE", "/golang-mini-project/product-service"),
+		TopicPrefix: os.Getenv("EVENT_TOPIC_PREFIX"),
+	}
+
+	if onError != nil {
+		handleError := onError
+		onError = func(topic string, value []byte, err error) {
+			topic, value = envelopeOptions.Unwrap(topic, value)
+			handleError(topic, value, err)
+		}
+	}
+
+	backendProducer, closeProducer, err := setupBackendProducer(strings.ToLower(envString("EVENT_PRODUCER", ProducerKafka)), onError)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	eventProducer, err := producer.NewEnvelopeProducer(backendProducer, envelopeOptions)
+	if err != nil {
+		closeProducer()
+		return nil, nil, err
+	}
+
+	return eventProducer, closeProducer, nil
+}
+
+func setupBackendProducer(backend string, onError producer.ErrorHandler) (producer.EventProducer, func(), error) {
+	switch backend {
+	case ProducerKafka:
+		kafkaConfig, err := LoadKafkaConfig()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if kafkaConfig.Async {
+			saramaProducer, err := sarama.NewAsyncProducer(kafkaConfig.Servers, kafkaConfig.Sarama)
+			if err != nil {
+				return nil, nil, err
+			}
+			asyncProducer := producer.NewAsyncEventProducer(saramaProducer, onError)
+			return asyncProducer, func() { asyncProducer.Close() }, nil
+		}
+
+		saramaProducer, err := sarama.NewSyncProducer(kafkaConfig.Servers, kafkaConfig.Sarama)
+		if err != nil {
+			return nil, nil, err
+		}
+		return producer.NewEventProducer(saramaProducer), func() { saramaProducer.Close() }, nil
+
+	case ProducerChannel:
+		return producer.NewChannelBus(100), func() {}, nil
+
+	case ProducerNats:
+		natsProducer, err := producer.NewNatsProducer(os.Getenv("NATS_URL"), producerTimeout)
+		if err != nil {
+			return nil, nil, err
+		}
+		return natsProducer, func() { natsProducer.Close() }, nil
+
+	case ProducerWebhook:
+		webhookURL := os.Getenv("EVENT_WEBHOOK_URL")
+		if webhookURL == "" {
+			return nil, nil, fmt.Errorf("EVENT_WEBHOOK_URL is required for the %s producer", ProducerWebhook)
+		}
+		return producer.NewHttpProducer(webhookURL, producerTimeout), func() {}, nil
+
+	case ProducerFile:
+		path := os.Getenv("EVENT_FILE")
+		if path == "" || path == "-" {
+			return producer.NewFileProducer(os.Stdout), func() {}, nil
+		}
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			return nil, nil, err
+		}
+		return producer.NewFileProducer(f), func() { f.Close() }, nil
+	}
+
+	return nil, nil, fmt.Errorf("unknown event producer %q", backend)
+}
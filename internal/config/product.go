@@ -0,0 +1,17 @@
+package config
+
+import (
+	"github.com/WarisLi/Golang-mini-project/internal/core/ports"
+)
+
+// LoadProductConfig reads the PRODUCT_* environment variables.
+func LoadProductConfig() (*ports.ProductServiceOptions, error) {
+	maxBatchSize, err := envInt("PRODUCT_BATCH_MAX_SIZE", 1000)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ports.ProductServiceOptions{
+		MaxBatchSize: maxBatchSize,
+	}, nil
+}
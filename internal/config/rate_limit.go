@@ -0,0 +1,102 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/WarisLi/Golang-mini-project/internal/adapters/cache"
+	"github.com/WarisLi/Golang-mini-project/internal/adapters/http/middleware"
+	"github.com/WarisLi/Golang-mini-project/internal/core/ports"
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	RateLimitMemory = "memory"
+	RateLimitRedis  = "redis"
+)
+
+type RateLimitConfig struct {
+	Store        string
+	RedisURL     string
+	RedisTimeout time.Duration
+	// LoginIP and LoginUsername limit POST /user/login and /user/login/2fa per client IP
+	// and per username.
+	LoginIP       middleware.RateLimitRule
+	LoginUsername middleware.RateLimitRule
+	// API limits the authenticated requests per token.
+	API middleware.RateLimitRule
+}
+
+// RateLimits holds the rate limit middlewares of the routes.
+type RateLimits struct {
+	Login fiber.Handler
+	API   fiber.Handler
+}
+
+// LoadRateLimitConfig reads the RATE_LIMIT_* and REDIS_* environment variables.
+func LoadRateLimitConfig() (*RateLimitConfig, error) {
+	loginIP, err := envInt("RATE_LIMIT_LOGIN_IP", 20)
+	if err != nil {
+		return nil, err
+	}
+	loginUsername, err := envInt("RATE_LIMIT_LOGIN_USERNAME", 10)
+	if err != nil {
+		return nil, err
+	}
+	loginWindow, err := envDuration("RATE_LIMIT_LOGIN_WINDOW", time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	api, err := envInt("RATE_LIMIT_API", 600)
+	if err != nil {
+		return nil, err
+	}
+	apiWindow, err := envDuration("RATE_LIMIT_API_WINDOW", time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	redisTimeout, err := envDuration("REDIS_TIMEOUT", time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RateLimitConfig{
+		Store:         strings.ToLower(envString("RATE_LIMIT_STORE", RateLimitMemory)),
+		RedisURL:      envString("REDIS_URL", "redis://localhost:6379/0"),
+		RedisTimeout:  redisTimeout,
+		LoginIP:       middleware.RateLimitRule{Name: "login-ip", Limit: loginIP, Window: loginWindow, Key: middleware.ClientIP},
+		LoginUsername: middleware.RateLimitRule{Name: "login-username", Limit: loginUsername, Window: loginWindow, Key: middleware.LoginUsername},
+		API:           middleware.RateLimitRule{Name: "api", Limit: api, Window: apiWindow, Key: middleware.AccessToken},
+	}, nil
+}
+
+// SetupRateLimits returns the rate limit middlewares counting in the store selected by
+// RATE_LIMIT_STORE (memory by default) and a function releasing its resources.
+func SetupRateLimits() (*RateLimits, func(), error) {
+	rateLimitConfig, err := LoadRateLimitConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var limiter ports.RateLimiter
+	closeLimiter := func() {}
+	switch rateLimitConfig.Store {
+	case RateLimitMemory:
+		limiter = cache.NewMemoryRateLimiter()
+	case RateLimitRedis:
+		redisCache, err := cache.NewRedisCache(rateLimitConfig.RedisURL, rateLimitConfig.RedisTimeout)
+		if err != nil {
+			return nil, nil, err
+		}
+		limiter = cache.NewRedisRateLimiter(redisCache)
+		closeLimiter = func() { redisCache.Close() }
+	default:
+		return nil, nil, fmt.Errorf("RATE_LIMIT_STORE: unknown store %q, use memory or redis", rateLimitConfig.Store)
+	}
+
+	return &RateLimits{
+		Login: middleware.RateLimit(limiter, rateLimitConfig.LoginIP, rateLimitConfig.LoginUsername),
+		API:   middleware.RateLimit(limiter, rateLimitConfig.API),
+	}, closeLimiter, nil
+}
@@ -0,0 +1,141 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/WarisLi/Golang-mini-project/internal/adapters/database"
+	"github.com/WarisLi/Golang-mini-project/internal/adapters/memory"
+	"github.com/WarisLi/Golang-mini-project/internal/core/models"
+	"github.com/WarisLi/Golang-mini-project/internal/core/ports"
+	"gorm.io/gorm"
+)
+
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+	DriverMemory   = "memory"
+)
+
+// Repositories are the secondary ports of the storage selected by DB_DRIVER.
+type Repositories struct {
+	Product         ports.ProductRepository
+	ProductSearcher ports.ProductSearcher
+	User            ports.UserRepository
+	Outbox          ports.OutboxRepository
+	Stock           ports.StockRepository
+	Webhook         ports.WebhookRepository
+	Idempotency     ports.IdempotencyRepository
+	PasswordReset   ports.PasswordResetRepository
+	APIKey          ports.APIKeyRepository
+	SigningKey      ports.SigningKeyRepository
+	OIDCLogin       ports.OIDCLoginRepository
+	UnitOfWork      ports.UnitOfWork
+	// Persistent is false when the data is lost on exit, i.e. for the memory driver.
+	Persistent bool
+
+	migrate func() error
+	reset   func()
+}
+
+// SetupRepositories reads DB_DRIVER (postgres, sqlite or memory) and connects the repositories.
+func SetupRepositories() (*Repositories, error) {
+	switch driver := envString("DB_DRIVER", DriverPostgres); driver {
+	case DriverPostgres:
+		return NewGormRepositories(ConnectDB()), nil
+	case DriverSQLite:
+		db, err := ConnectSQLite(envString("SQLITE_PATH", "golang-mini-project.db"))
+		if err != nil {
+			return nil, err
+		}
+		return NewGormRepositories(db), nil
+	case DriverMemory:
+		return NewMemoryRepositories(), nil
+	default:
+		return nil, fmt.Errorf("DB_DRIVER: unknown driver %q, use postgres, sqlite or memory", driver)
+	}
+}
+
+// NewGormRepositories returns the repositories of a Postgres or SQLite database.
+func NewGormRepositories(db *gorm.DB) *Repositories {
+	searcher := database.NewGormProductSearcher(db)
+	if db.Dialector.Name() == DriverPostgres {
+		searcher = database.NewPostgresProductSearcher(db)
+	}
+
+	return &Repositories{
+		Product:         database.NewGormProductRepository(db),
+		ProductSearcher: searcher,
+		User:            database.NewGormUserRepository(db),
+		Outbox:          database.NewGormOutboxRepository(db),
+		Stock:           database.NewGormStockRepository(db),
+		Webhook:         database.NewGormWebhookRepository(db),
+		Idempotency:     database.NewGormIdempotencyRepository(db),
+		PasswordReset:   database.NewGormPasswordResetRepository(db),
+		APIKey:          database.NewGormAPIKeyRepository(db),
+		SigningKey:      database.NewGormSigningKeyRepository(db),
+		OIDCLogin:       database.NewGormOIDCLoginRepository(db),
+		UnitOfWork:      database.NewGormUnitOfWork(db),
+		Persistent:      true,
+		migrate:         func() error { return MigrateDB(db) },
+		reset:           func() { ResetData(db) },
+	}
+}
+
+// NewMemoryRepositories returns empty in-memory repositories.
+func NewMemoryRepositories() *Repositories {
+	repo := memory.NewMemoryRepository()
+
+	return &Repositories{
+		Product:         memory.NewMemoryProductRepository(repo),
+		ProductSearcher: memory.NewMemoryProductSearcher(repo),
+		User:            memory.NewMemoryUserRepository(repo),
+		Outbox:          memory.NewMemoryOutboxRepository(repo),
+		Stock:           memory.NewMemoryStockRepository(repo),
+		Webhook:         memory.NewMemoryWebhookRepository(repo),
+		Idempotency:     memory.NewMemoryIdempotencyRepository(repo),
+		PasswordReset:   memory.NewMemoryPasswordResetRepository(repo),
+		APIKey:          memory.NewMemoryAPIKeyRepository(repo),
+		SigningKey:      memory.NewMemorySigningKeyRepository(repo),
+		OIDCLogin:       memory.NewMemoryOIDCLoginRepository(repo),
+		UnitOfWork:      memory.NewMemoryUnitOfWork(repo),
+		migrate:         func() error { return nil },
+		reset:           repo.Reset,
+	}
+}
+
+// Migrate migrates the database schema.
+func (r *Repositories) Migrate() error {
+	return r.migrate()
+}
+
+// Reset deletes all data.
+func (r *Repositories) Reset() {
+	r.reset()
+}
+
+// Seed inserts the initial data, the user from LoadSeedUser is registered through userService.
+func (r *Repositories) Seed(userService ports.UserService) {
+	if user := LoadSeedUser(); user != nil {
+		if err := userService.CreateUser(*user, models.RoleAdmin); err != nil {
+			fmt.Printf("Initial user data failed %s\n", err)
+		}
+	} else {
+		fmt.Printf("Initial user skipped, SEED_PASSWORD is not set\n")
+	}
+
+	books := []models.Product{{
+		Name:     "Book A",
+		Quantity: 1200,
+	}, {
+		Name:     "Book B",
+		Quantity: 400,
+	},
+	}
+	for _, book := range books {
+		if _, err := r.Product.Save(book); err != nil {
+			fmt.Printf("Initial product data failed %s\n", err)
+		}
+	}
+
+	fmt.Printf("Initial data completed\n")
+}
@@ -0,0 +1,29 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// ConnectSQLite opens the SQLite database file at path, it is created when missing.
+func ConnectSQLite(path string) (*gorm.DB, error) {
+	db, err := gorm.Open(sqlite.Open(path), &gorm.Config{TranslateError: true,
+		Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite allows a single writer, concurrent writes would fail with "database is locked"
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	sqlDB.SetMaxOpenConns(1)
+
+	fmt.Printf("SQLite database %s opened\n", path)
+
+	return db, nil
+}
@@ -0,0 +1,29 @@
+package config
+
+import (
+	"time"
+
+	"github.com/WarisLi/Golang-mini-project/internal/core/ports"
+)
+
+// LoadProductStreamConfig reads the STREAM_* environment variables.
+func LoadProductStreamConfig() (*ports.ProductStreamOptions, error) {
+	historySize, err := envInt("STREAM_HISTORY_SIZE", 1000)
+	if err != nil {
+		return nil, err
+	}
+	bufferSize, err := envInt("STREAM_BUFFER_SIZE", 100)
+	if err != nil {
+		return nil, err
+	}
+	sessionCheckInterval, err := envDuration("STREAM_SESSION_CHECK_INTERVAL", 30*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ports.ProductStreamOptions{
+		HistorySize:          historySize,
+		BufferSize:           bufferSize,
+		SessionCheckInterval: sessionCheckInterval,
+	}, nil
+}
@@ -0,0 +1,68 @@
+package config
+
+import (
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	"github.com/WarisLi/Golang-mini-project/internal/core/models"
+	"github.com/WarisLi/Golang-mini-project/internal/core/ports"
+)
+
+type TokenConfig struct {
+	// RotationCheckInterval is how often the signing keys are checked for rotation.
+	RotationCheckInterval time.Duration
+	Options               ports.TokenOptions
+}
+
+// LoadTokenConfig reads the JWT_* environment variables of the access tokens.
+func LoadTokenConfig() (*TokenConfig, error) {
+	algorithm := envString("JWT_ALGORITHM", models.AlgorithmRS256)
+	if algorithm != models.AlgorithmRS256 && algorithm != models.AlgorithmEdDSA {
+		return nil, fmt.Errorf("JWT_ALGORITHM: unknown algorithm %q, use RS256 or EdDSA", algorithm)
+	}
+	ttl, err := envDuration("JWT_TTL", 72*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+	rotationInterval, err := envDuration("JWT_KEY_ROTATION_INTERVAL", 30*24*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+	publishLead, err := envDuration("JWT_KEY_PUBLISH_LEAD", time.Hour)
+	if err != nil {
+		return nil, err
+	}
+	if publishLead >= rotationInterval {
+		return nil, fmt.Errorf("JWT_KEY_PUBLISH_LEAD: %s is not shorter than JWT_KEY_ROTATION_INTERVAL", publishLead)
+	}
+	cacheTTL, err := envDuration("JWT_KEY_CACHE_TTL", time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	checkInterval, err := envDuration("JWT_KEY_CHECK_INTERVAL", time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	keyEncryptionKey, err := base64.StdEncoding.DecodeString(envString("JWT_KEY_ENCRYPTION_KEY", ""))
+	if err != nil {
+		return nil, fmt.Errorf("JWT_KEY_ENCRYPTION_KEY: %w", err)
+	}
+	if len(keyEncryptionKey) != ports.KeyEncryptionKeySize {
+		return nil, fmt.Errorf("JWT_KEY_ENCRYPTION_KEY is required, %d bytes encoded in base64", ports.KeyEncryptionKeySize)
+	}
+
+	return &TokenConfig{
+		RotationCheckInterval: checkInterval,
+		Options: ports.TokenOptions{
+			Algorithm:        algorithm,
+			Issuer:           envString("JWT_ISSUER", "golang-mini-project"),
+			Audience:         envString("JWT_AUDIENCE", "golang-mini-project"),
+			TTL:              ttl,
+			RotationInterval: rotationInterval,
+			PublishLead:      publishLead,
+			KeyCacheTTL:      cacheTTL,
+			KeyEncryptionKey: keyEncryptionKey,
+		},
+	}, nil
+}
@@ -0,0 +1,209 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/WarisLi/Golang-mini-project/internal/core/models"
+	"github.com/WarisLi/Golang-mini-project/internal/core/ports"
+)
+
+const (
+	EnvDevelopment = "development"
+	EnvProduction  = "production"
+
+	devSeedPassword = "Pass@12345"
+)
+
+// breachedHashLine matches the lines of the Have I Been Pwned lists, "<SHA-1>:<count>".
+var breachedHashLine = regexp.MustCompile(`^([0-9A-Fa-f]{40})(:\d+)?$`)
+
+// LoadUserConfig reads the LOGIN_*, PASSWORD_*, PASSWORD_RESET_*, TWO_FACTOR_* and TOTP_ISSUER
+// environment variables.
+func LoadUserConfig() (*ports.UserServiceOptions, error) {
+	maxFailures, err := envInt("LOGIN_MAX_FAILURES", 5)
+	if err != nil {
+		return nil, err
+	}
+	lockout, err := envDuration("LOGIN_LOCKOUT", 15*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	failureDelay, err := envDuration("LOGIN_FAILURE_DELAY", time.Second)
+	if err != nil {
+		return nil, err
+	}
+	maxFailureDelay, err := envDuration("LOGIN_MAX_FAILURE_DELAY", 30*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	passwordPolicy, err := loadPasswordPolicy()
+	if err != nil {
+		return nil, err
+	}
+	passwordHash, err := loadPasswordHash()
+	if err != nil {
+		return nil, err
+	}
+	passwordResetTTL, err := envDuration("PASSWORD_RESET_TTL", 30*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	twoFactorRoles, err := loadTwoFactorRoles()
+	if err != nil {
+		return nil, err
+	}
+	challengeTTL, err := envDuration("TWO_FACTOR_CHALLENGE_TTL", 5*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ports.UserServiceOptions{
+		MaxFailedLogins:       maxFailures,
+		LockoutDuration:       lockout,
+		FailedLoginDelay:      failureDelay,
+		MaxFailedLoginDelay:   maxFailureDelay,
+		PasswordPolicy:        *passwordPolicy,
+		PasswordHash:          *passwordHash,
+		PasswordResetTTL:      passwordResetTTL,
+		PasswordResetURL:      envString("PASSWORD_RESET_URL", ""),
+		TwoFactorRoles:        twoFactorRoles,
+		TOTPIssuer:            envString("TOTP_ISSUER", "Golang-mini-project"),
+		TwoFactorChallengeTTL: challengeTTL,
+	}, nil
+}
+
+// loadTwoFactorRoles reads TWO_FACTOR_ROLES, the comma separated roles which have to
+// log in with a second factor.
+func loadTwoFactorRoles() ([]string, error) {
+	var roles []string
+	for _, role := range strings.Split(envString("TWO_FACTOR_ROLES", ""), ",") {
+		role = strings.TrimSpace(role)
+		if role == "" {
+			continue
+		}
+		if role != models.RoleAdmin && role != models.RoleUser {
+			return nil, fmt.Errorf("TWO_FACTOR_ROLES: unknown role %q, use admin or user", role)
+		}
+		roles = append(roles, role)
+	}
+	return roles, nil
+}
+
+func loadPasswordPolicy() (*ports.PasswordPolicy, error) {
+	minLength, err := envInt("PASSWORD_MIN_LENGTH", 8)
+	if err != nil {
+		return nil, err
+	}
+	requireUpper, err := envBool("PASSWORD_REQUIRE_UPPER", true)
+	if err != nil {
+		return nil, err
+	}
+	requireLower, err := envBool("PASSWORD_REQUIRE_LOWER", true)
+	if err != nil {
+		return nil, err
+	}
+	requireDigit, err := envBool("PASSWORD_REQUIRE_DIGIT", true)
+	if err != nil {
+		return nil, err
+	}
+	requireSymbol, err := envBool("PASSWORD_REQUIRE_SYMBOL", false)
+	if err != nil {
+		return nil, err
+	}
+	breached, err := LoadBreachedPasswords(envString("PASSWORD_BREACHED_FILE", ""))
+	if err != nil {
+		return nil, err
+	}
+
+	return &ports.PasswordPolicy{
+		MinLength:     minLength,
+		RequireUpper:  requireUpper,
+		RequireLower:  requireLower,
+		RequireDigit:  requireDigit,
+		RequireSymbol: requireSymbol,
+		Breached:      breached,
+	}, nil
+}
+
+func loadPasswordHash() (*ports.PasswordHashOptions, error) {
+	bcryptCost, err := envInt("BCRYPT_COST", 0)
+	if err != nil {
+		return nil, err
+	}
+	argon2Time, err := envInt("ARGON2_TIME", 0)
+	if err != nil {
+		return nil, err
+	}
+	argon2Memory, err := envInt("ARGON2_MEMORY", 0)
+	if err != nil {
+		return nil, err
+	}
+	argon2Threads, err := envInt("ARGON2_THREADS", 0)
+	if err != nil {
+		return nil, err
+	}
+	algorithm := strings.ToLower(envString("PASSWORD_HASH", ports.PasswordBcrypt))
+	if algorithm != ports.PasswordBcrypt && algorithm != ports.PasswordArgon2id {
+		return nil, fmt.Errorf("PASSWORD_HASH: unknown hash %q, use bcrypt or argon2id", algorithm)
+	}
+
+	return &ports.PasswordHashOptions{
+		Algorithm:     algorithm,
+		BcryptCost:    bcryptCost,
+		Argon2Time:    uint32(argon2Time),
+		Argon2Memory:  uint32(argon2Memory),
+		Argon2Threads: uint8(argon2Threads),
+	}, nil
+}
+
+// LoadBreachedPasswords reads a list of breached passwords, one per line, either in
+// clear or as the SHA-1 of a Have I Been Pwned list. An empty path is an empty list.
+func LoadBreachedPasswords(path string) (map[string]struct{}, error) {
+	breached := map[string]struct{}{}
+	if path == "" {
+		return breached, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if match := breachedHashLine.FindStringSubmatch(line); match != nil {
+			breached[strings.ToUpper(match[1])] = struct{}{}
+		} else {
+			breached[ports.BreachedPasswordKey(line)] = struct{}{}
+		}
+	}
+	return breached, scanner.Err()
+}
+
+// LoadSeedUser reads SEED_USERNAME and SEED_PASSWORD. Only an explicit APP_ENV=development
+// has a default password, elsewhere, APP_ENV unset included, no user is seeded without
+// SEED_PASSWORD.
+func LoadSeedUser() *models.UsernamePassword {
+	password := os.Getenv("SEED_PASSWORD")
+	if password == "" && strings.ToLower(envString("APP_ENV", EnvProduction)) == EnvDevelopment {
+		password = devSeedPassword
+	}
+	if password == "" {
+		return nil
+	}
+
+	return &models.UsernamePassword{
+		Username: envString("SEED_USERNAME", "user_1"),
+		Password: password,
+	}
+}
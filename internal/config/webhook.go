@@ -0,0 +1,48 @@
+package config
+
+import (
+	"time"
+
+	"github.com/WarisLi/Golang-mini-project/internal/core/ports"
+)
+
+type WebhookConfig struct {
+	Timeout time.Duration
+	// RetryInterval is how often the due retries are started.
+	RetryInterval time.Duration
+	Options       ports.WebhookOptions
+}
+
+// LoadWebhookConfig reads the WEBHOOK_* environment variables.
+func LoadWebhookConfig() (*WebhookConfig, error) {
+	timeout, err := envDuration("WEBHOOK_TIMEOUT", 10*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	maxAttempts, err := envInt("WEBHOOK_MAX_ATTEMPTS", 5)
+	if err != nil {
+		return nil, err
+	}
+	retryBackoff, err := envDuration("WEBHOOK_RETRY_BACKOFF", time.Second)
+	if err != nil {
+		return nil, err
+	}
+	retryInterval, err := envDuration("WEBHOOK_RETRY_INTERVAL", time.Second)
+	if err != nil {
+		return nil, err
+	}
+	disableAfter, err := envInt("WEBHOOK_DISABLE_AFTER", 10)
+	if err != nil {
+		return nil, err
+	}
+
+	return &WebhookConfig{
+		Timeout:       timeout,
+		RetryInterval: retryInterval,
+		Options: ports.WebhookOptions{
+			MaxAttempts:  maxAttempts,
+			RetryBackoff: retryBackoff,
+			DisableAfter: disableAfter,
+		},
+	}, nil
+}
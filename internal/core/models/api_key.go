@@ -0,0 +1,94 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// APIKeyPrefix starts every API key, so that a key is told apart from a JWT and found by secret scanners.
+const APIKeyPrefix = "mpk_"
+
+// Scopes of the API keys. The tokens of the users have every scope, the role of
+// the owner of a key still applies.
+const (
+	ScopeProductRead  = "product:read"
+	ScopeProductWrite = "product:write"
+	// ScopeAdmin allows the administration routes: users, dead letters, webhooks and metrics.
+	ScopeAdmin = "admin"
+)
+
+// APIKeyScopes are the scopes an API key can be given.
+var APIKeyScopes = []string{ScopeProductRead, ScopeProductWrite, ScopeAdmin}
+
+// APIKey authenticates a machine-to-machine client as its user. Only the SHA-256
+// of the key is stored, the key is shown once when it is created.
+type APIKey struct {
+	gorm.Model
+	Username string `gorm:"not null;index"`
+	Name     string `gorm:"not null"`
+	// KeyID is the public part of the key, it finds the key and names it in the logs.
+	KeyID      string    `gorm:"not null;uniqueIndex"`
+	SecretHash string    `gorm:"not null"`
+	Scopes     string    `gorm:"not null"` // comma separated scopes
+	ExpiresAt  time.Time `gorm:"not null"`
+	LastUsedAt *time.Time
+	RevokedAt  *time.Time
+}
+
+func (k APIKey) ScopeList() []string {
+	if k.Scopes == "" {
+		return nil
+	}
+	return strings.Split(k.Scopes, ",")
+}
+
+// Active reports whether the key is neither revoked nor expired at now.
+func (k APIKey) Active(now time.Time) bool {
+	return k.RevokedAt == nil && now.Before(k.ExpiresAt)
+}
+
+type APIKeyInput struct {
+	Name   string   `json:"name" binding:"required" example:"ERP integration" validate:"required,max=100"`
+	Scopes []string `json:"scopes" binding:"required" example:"product:read,product:write" validate:"required,min=1,dive,oneof=product:read product:write admin"`
+	// ExpiresAt defaults to the longest lifetime of the keys.
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+type APIKeyResponse struct {
+	ID         uint       `json:"id" example:"1"`
+	Name       string     `json:"name" example:"ERP integration"`
+	KeyID      string     `json:"key_id" example:"3f9a1c0b7d2e4a65"`
+	Scopes     []string   `json:"scopes" example:"product:read,product:write"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+func NewAPIKeyResponse(key APIKey) APIKeyResponse {
+	return APIKeyResponse{
+		ID:         key.ID,
+		Name:       key.Name,
+		KeyID:      key.KeyID,
+		Scopes:     key.ScopeList(),
+		ExpiresAt:  key.ExpiresAt,
+		LastUsedAt: key.LastUsedAt,
+		RevokedAt:  key.RevokedAt,
+		CreatedAt:  key.CreatedAt,
+	}
+}
+
+// APIKeyCreated is the response of a new or rotated key, the only one containing the key.
+type APIKeyCreated struct {
+	APIKeyResponse
+	Key string `json:"key" example:"mpk_3f9a1c0b7d2e4a65_Vt0tG8lR2l1rX3mF0yH6cQk9eW4pZs7aBn5uJd2oYiE"`
+}
+
+// ServiceAccount is a user of the machine-to-machine clients, it has no password
+// and authenticates with API keys only.
+type ServiceAccount struct {
+	Username string `json:"username" example:"erp" validate:"required"`
+	Role     string `json:"role" example:"admin" validate:"required,oneof=admin user"`
+}
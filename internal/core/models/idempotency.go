@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// IdempotencyKey stores the response of a request sent with an Idempotency-Key
+// header so that retries of the request get the same response.
+type IdempotencyKey struct {
+	// Scope is the user the key belongs to, empty for anonymous requests.
+	Scope string `gorm:"primaryKey"`
+	Key   string `gorm:"primaryKey"`
+	// RequestHash identifies the method, URL and body the key was first used with.
+	RequestHash string `gorm:"not null"`
+	// StatusCode is zero while the first request is in progress.
+	StatusCode  int
+	ContentType string
+	Body        []byte
+	CreatedAt   time.Time
+	ExpiresAt   time.Time `gorm:"not null;index"`
+}
+
+func (k IdempotencyKey) Completed() bool {
+	return k.StatusCode != 0
+}
@@ -0,0 +1,8 @@
+package models
+
+// Notification is a message sent to a user, To is the address of the user.
+type Notification struct {
+	To      string
+	Subject string
+	Body    string
+}
@@ -0,0 +1,49 @@
+package models
+
+import "time"
+
+// OIDCLogin is a login started at an OpenID Connect provider, completed by its callback.
+// Only the SHA-256 of the state is stored, the state is single-use.
+type OIDCLogin struct {
+	StateHash string `gorm:"primaryKey"`
+	Provider  string `gorm:"not null"`
+	// Nonce is the nonce the ID token of the login has to carry.
+	Nonce string `gorm:"not null"`
+	// CodeVerifier is the PKCE secret of the code challenge sent to the provider.
+	CodeVerifier string `gorm:"not null"`
+	CreatedAt    time.Time
+	ExpiresAt    time.Time `gorm:"not null;index"`
+}
+
+// OIDCClaims are the claims of a verified ID token.
+type OIDCClaims map[string]interface{}
+
+// String returns the string claim name, empty when it is missing or not a string.
+func (c OIDCClaims) String(name string) string {
+	value, _ := c[name].(string)
+	return value
+}
+
+// Strings returns the claim name, a list of strings or a single string.
+func (c OIDCClaims) Strings(name string) []string {
+	switch value := c[name].(type) {
+	case string:
+		return []string{value}
+	case []interface{}:
+		values := make([]string, 0, len(value))
+		for _, item := range value {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+// OIDCProviderResponse is a provider the users can log in with.
+type OIDCProviderResponse struct {
+	Name string `json:"name" example:"corp"`
+	// LoginURL starts the login, the browser is redirected to the provider.
+	LoginURL string `json:"login_url" example:"/user/oidc/corp/login"`
+}
@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// OrderItem is a product and quantity of an order.
+type OrderItem struct {
+	ProductID uint `json:"product_id"`
+	Quantity  int  `json:"quantity"`
+}
+
+// OrderPlacedEvent is consumed to take the ordered quantities out of stock.
+type OrderPlacedEvent struct {
+	EventID string      `json:"event_id"`
+	OrderID uint        `json:"order_id"`
+	Items   []OrderItem `json:"items"`
+}
+
+// OrderCancelledEvent is consumed to put the quantities of a cancelled order back in stock.
+type OrderCancelledEvent struct {
+	EventID string      `json:"event_id"`
+	OrderID uint        `json:"order_id"`
+	Items   []OrderItem `json:"items"`
+}
+
+// StockMovement changes the quantity of a product by Delta.
+type StockMovement struct {
+	ProductID uint
+	Delta     int
+}
+
+// ProcessedEvent records a consumed event so it is applied only once.
+type ProcessedEvent struct {
+	EventID     string `gorm:"primaryKey"`
+	ProcessedAt time.Time
+}
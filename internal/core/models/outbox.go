@@ -0,0 +1,51 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// OutboxEvent is an event that could not be delivered to the event producer.
+// Pending outbox events form the dead-letter store and are kept until they are
+// replayed or discarded. Consumed events are the consumer messages that could
+// not be applied, they are never published by this service.
+type OutboxEvent struct {
+	gorm.Model
+	Topic       string `gorm:"not null;index"`
+	Payload     []byte `gorm:"not null"`
+	Attempts    int    `gorm:"not null;default:0"`
+	LastError   string
+	PublishedAt *time.Time
+	Consumed    bool `gorm:"not null;default:false;index"`
+}
+
+type DeadLetter struct {
+	ID        uint            `json:"id" example:"1"`
+	Topic     string          `json:"topic" example:"LowProductQuantityNotificationEvent"`
+	Payload   json.RawMessage `json:"payload" swaggertype:"object"`
+	Attempts  int             `json:"attempts" example:"3"`
+	LastError string          `json:"last_error" example:"kafka: client has run out of available brokers"`
+	Consumed  bool            `json:"consumed" example:"false"`
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+func NewDeadLetter(event OutboxEvent) DeadLetter {
+	payload := json.RawMessage(event.Payload)
+	if !json.Valid(payload) {
+		payload, _ = json.Marshal(string(event.Payload))
+	}
+
+	return DeadLetter{
+		ID:        event.ID,
+		Topic:     event.Topic,
+		Payload:   payload,
+		Attempts:  event.Attempts,
+		LastError: event.LastError,
+		Consumed:  event.Consumed,
+		CreatedAt: event.CreatedAt,
+		UpdatedAt: event.UpdatedAt,
+	}
+}
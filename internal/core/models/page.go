@@ -0,0 +1,50 @@
+package models
+
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+)
+
+// PageRequest selects a page of a list. Pages start at 1.
+type PageRequest struct {
+	Page     int `query:"page" example:"1"`
+	PageSize int `query:"page_size" example:"20"`
+}
+
+// Normalize replaces missing or out of range values by their defaults.
+func (r PageRequest) Normalize() PageRequest {
+	if r.Page < 1 {
+		r.Page = 1
+	}
+	if r.PageSize < 1 {
+		r.PageSize = DefaultPageSize
+	}
+	if r.PageSize > MaxPageSize {
+		r.PageSize = MaxPageSize
+	}
+	return r
+}
+
+func (r PageRequest) Offset() int {
+	return (r.Page - 1) * r.PageSize
+}
+
+// Page is the envelope of a paginated list.
+type Page[T any] struct {
+	Items    []T   `json:"items"`
+	Total    int64 `json:"total" example:"42"`
+	Page     int   `json:"page" example:"1"`
+	PageSize int   `json:"page_size" example:"20"`
+}
+
+func NewPage[T any](items []T, total int64, request PageRequest) *Page[T] {
+	if items == nil {
+		items = []T{}
+	}
+	return &Page[T]{
+		Items:    items,
+		Total:    total,
+		Page:     request.Page,
+		PageSize: request.PageSize,
+	}
+}
@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// PasswordResetToken is a single-use token of the forgot-password flow, only the
+// SHA-256 of the token is stored.
+type PasswordResetToken struct {
+	TokenHash string `gorm:"primaryKey"`
+	Username  string `gorm:"not null;index"`
+	CreatedAt time.Time
+	ExpiresAt time.Time `gorm:"not null;index"`
+	UsedAt    *time.Time
+}
+
+type ChangePassword struct {
+	CurrentPassword string `json:"current_password" example:"Pass@1234" validate:"required"`
+	NewPassword     string `json:"new_password" example:"NewPass@1234" validate:"required"`
+}
+
+type ForgotPassword struct {
+	Username string `json:"username" example:"admin" validate:"required"`
+}
+
+type ResetPassword struct {
+	Token       string `json:"token" validate:"required"`
+	NewPassword string `json:"new_password" example:"NewPass@1234" validate:"required"`
+}
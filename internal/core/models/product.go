@@ -3,13 +3,29 @@ package models
 import "gorm.io/gorm"
 
 type Product struct {
-	gorm.Model `swaggerignore:"true"`
-	ID         uint   `gorm:"AUTO_INCREMENT"`
-	Name       string `json:"name" binding:"required" example:"Book"`
-	Quantity   int    `json:"quantity" binding:"required" example:"1234"`
+	gorm.Model  `swaggerignore:"true"`
+	ID          uint   `gorm:"AUTO_INCREMENT"`
+	Name        string `json:"name" binding:"required" example:"Book"`
+	Quantity    int    `json:"quantity" binding:"required" example:"1234"`
+	Category    string `json:"category" gorm:"index" example:"Books"`
+	SKU         string `json:"sku" gorm:"index" example:"BK-0001"`
+	Description string `json:"description" example:"Hardcover, 320 pages"`
 }
 
 type ProductInput struct {
-	Name     string `json:"name" binding:"required" example:"Book" validate:"required"`
-	Quantity int    `json:"quantity" binding:"required" example:"1234" validate:"required,min=1"`
+	Name        string `json:"name" binding:"required" example:"Book" validate:"required"`
+	Quantity    int    `json:"quantity" binding:"required" example:"1234" validate:"required,min=1"`
+	Category    string `json:"category" example:"Books"`
+	SKU         string `json:"sku" example:"BK-0001"`
+	Description string `json:"description" example:"Hardcover, 320 pages"`
+}
+
+// ProductFields are the fields of a product a partial update applies to.
+// Unlike ProductInput the quantity can be set to zero.
+type ProductFields struct {
+	Name        string `json:"name" validate:"required"`
+	Quantity    int    `json:"quantity" validate:"min=0"`
+	Category    string `json:"category"`
+	SKU         string `json:"sku"`
+	Description string `json:"description"`
 }
@@ -0,0 +1,56 @@
+package models
+
+const (
+	ProductOperationCreate = "create"
+	ProductOperationUpdate = "update"
+	ProductOperationDelete = "delete"
+)
+
+// ProductBatchOperation is one operation of a batch request. ID is required to
+// update or delete a product, Product to create or update one.
+type ProductBatchOperation struct {
+	Op      string        `json:"op" example:"update"`
+	ID      uint          `json:"id,omitempty" example:"1"`
+	Product *ProductInput `json:"product,omitempty"`
+}
+
+type ProductBatchRequest struct {
+	// Atomic applies every operation or none of them. Otherwise each operation
+	// is applied on its own and its result reported.
+	Atomic     bool                    `json:"atomic"`
+	Operations []ProductBatchOperation `json:"operations" validate:"required,min=1"`
+}
+
+type ProductBatchResult struct {
+	Index   int    `json:"index" example:"0"`
+	Op      string `json:"op" example:"update"`
+	ID      uint   `json:"id,omitempty" example:"1"`
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
+
+type ProductBatchResponse struct {
+	Atomic    bool                 `json:"atomic"`
+	Succeeded int                  `json:"succeeded"`
+	Failed    int                  `json:"failed"`
+	Results   []ProductBatchResult `json:"results"`
+}
+
+// ProductOperation is a validated batch operation applied by the product repository.
+type ProductOperation struct {
+	Op      string
+	Product Product
+}
+
+// Count sets the number of operations that succeeded and failed.
+func (r *ProductBatchResponse) Count() *ProductBatchResponse {
+	r.Succeeded, r.Failed = 0, 0
+	for _, result := range r.Results {
+		if result.Success {
+			r.Succeeded++
+		} else {
+			r.Failed++
+		}
+	}
+	return r
+}
@@ -0,0 +1,22 @@
+package models
+
+// ProductCreatedEvent is produced after a product is created.
+type ProductCreatedEvent struct {
+	ID       uint   `json:"id"`
+	Name     string `json:"name"`
+	Quantity int    `json:"quantity"`
+	Category string `json:"category"`
+}
+
+// ProductUpdatedEvent is produced after a product is updated.
+type ProductUpdatedEvent struct {
+	ID       uint   `json:"id"`
+	Name     string `json:"name"`
+	Quantity int    `json:"quantity"`
+	Category string `json:"category"`
+}
+
+// ProductDeletedEvent is produced after a product is deleted.
+type ProductDeletedEvent struct {
+	ID uint `json:"id"`
+}
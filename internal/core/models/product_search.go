@@ -0,0 +1,17 @@
+package models
+
+// ProductSearchQuery is a full-text search over the name, SKU and description of the products.
+type ProductSearchQuery struct {
+	Query string `query:"q"`
+	PageRequest
+}
+
+// ProductSearchResult is a product matching a search, best matches first.
+type ProductSearchResult struct {
+	Product Product `json:"product"`
+	Rank    float64 `json:"rank" example:"0.6"`
+	// Fuzzy is set when the product only matched approximately, e.g. a misspelled name.
+	Fuzzy bool `json:"fuzzy"`
+	// Highlights are the matching fields with the matched terms in <mark> tags.
+	Highlights map[string]string `json:"highlights,omitempty"`
+}
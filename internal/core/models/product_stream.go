@@ -0,0 +1,32 @@
+package models
+
+import (
+	"encoding/json"
+	"slices"
+)
+
+// ProductStreamEvent is a product change pushed to the clients of the product stream.
+type ProductStreamEvent struct {
+	ID        uint64          `json:"id"`
+	Type      string          `json:"type"`
+	ProductID uint            `json:"product_id,omitempty"`
+	Category  string          `json:"category,omitempty"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// ProductStreamFilter selects the events sent to a stream client.
+// An empty list matches every product or category.
+type ProductStreamFilter struct {
+	ProductIDs []uint
+	Categories []string
+}
+
+func (f ProductStreamFilter) Match(event ProductStreamEvent) bool {
+	if len(f.ProductIDs) > 0 && !slices.Contains(f.ProductIDs, event.ProductID) {
+		return false
+	}
+	if len(f.Categories) > 0 && !slices.Contains(f.Categories, event.Category) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Algorithms of the signing keys of the access tokens.
+const (
+	AlgorithmRS256 = "RS256"
+	AlgorithmEdDSA = "EdDSA"
+)
+
+// SigningKey is a key pair signing the access tokens. It is published in the JWKS
+// from its creation and signs the tokens from ActivatesAt until the next key does.
+type SigningKey struct {
+	gorm.Model
+	// KeyID is the kid of the tokens and of the JWKS.
+	KeyID     string `gorm:"not null;uniqueIndex"`
+	Algorithm string `gorm:"not null"`
+	// PrivateKey is the PEM encoded PKCS #8 private key, encrypted with the key
+	// encryption key of the service.
+	PrivateKey  string    `gorm:"not null"`
+	ActivatesAt time.Time `gorm:"not null"`
+}
+
+// JWK is the public key of a signing key, RFC 7517.
+type JWK struct {
+	Kty string `json:"kty" example:"RSA"`
+	Kid string `json:"kid"`
+	Use string `json:"use" example:"sig"`
+	Alg string `json:"alg" example:"RS256"`
+	// N and E are the modulus and the exponent of the RSA keys.
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Crv and X are the curve and the public key of the EdDSA keys, with Y the
+	// coordinates of the ECDSA keys of the identity providers.
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JWKS is the JSON Web Key Set verifying the access tokens.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
@@ -0,0 +1,54 @@
+package models
+
+// TwoFactorChallenge is the response of a login that needs a second factor. The
+// challenge token completes the login at POST /user/login/2fa.
+type TwoFactorChallenge struct {
+	Message        string `json:"message"`
+	ChallengeToken string `json:"challenge_token"`
+	// Enroll is set when the role of the user requires two-factor authentication
+	// and the user has to enroll an authenticator first.
+	Enroll bool `json:"enroll"`
+}
+
+type TwoFactorLogin struct {
+	ChallengeToken string `json:"challenge_token" validate:"required"`
+	// Code is a code of the authenticator or a recovery code.
+	Code string `json:"code" example:"123456" validate:"required"`
+}
+
+type TwoFactorEnrollChallenge struct {
+	ChallengeToken string `json:"challenge_token" validate:"required"`
+}
+
+// TOTPEnrollment is the secret of a new authenticator, the URI is rendered as a QR code.
+type TOTPEnrollment struct {
+	Secret string `json:"secret" example:"JBSWY3DPEHPK3PXP"`
+	URI    string `json:"uri" example:"otpauth://totp/Golang-mini-project:admin?secret=JBSWY3DPEHPK3PXP&issuer=Golang-mini-project"`
+}
+
+type TOTPCode struct {
+	Code string `json:"code" example:"123456" validate:"required"`
+}
+
+// RecoveryCodes are shown once, each one replaces a code of the authenticator for one login.
+type RecoveryCodes struct {
+	RecoveryCodes []string `json:"recovery_codes" example:"k3d9f-2mx7q"`
+}
+
+// TwoFactorState is the authenticator and the recovery codes of a user.
+type TwoFactorState struct {
+	TOTPSecret    string
+	TOTPEnabled   bool
+	TOTPLastStep  int64
+	RecoveryCodes string
+}
+
+// TwoFactorState returns the two-factor state of the user.
+func (u *User) TwoFactorState() TwoFactorState {
+	return TwoFactorState{
+		TOTPSecret:    u.TOTPSecret,
+		TOTPEnabled:   u.TOTPEnabled,
+		TOTPLastStep:  u.TOTPLastStep,
+		RecoveryCodes: u.RecoveryCodes,
+	}
+}
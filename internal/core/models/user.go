@@ -1,22 +1,104 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	RoleAdmin = "admin"
+	RoleUser  = "user"
+)
 
 type User struct {
 	gorm.Model `swaggerignore:"true"`
 	ID         uint   `gorm:"AUTO_INCREMENT" json:"-" `
 	Username   string `gorm:"unique;not null" json:"username" binding:"required" example:"admin"`
 	Password   string `json:"password" binding:"required" example:"Pass@1234"`
+	Email      string `json:"email" example:"admin@example.com"`
+	Role       string `gorm:"not null;default:user" json:"-"`
+	Disabled   bool   `gorm:"not null;default:false" json:"-"`
+	// FailedLogins counts the consecutive failed logins, a successful login resets it.
+	FailedLogins int `gorm:"not null;default:0" json:"-"`
+	// LockedUntil refuses logins until then after failed logins.
+	LockedUntil *time.Time `json:"-"`
+	// SessionVersion is part of the tokens, incrementing it invalidates the issued tokens.
+	SessionVersion int `gorm:"not null;default:0" json:"-"`
+	// SessionID is a random ID of the user, part of the tokens. A user deleted and
+	// created again with the same username gets another one, refusing the old tokens.
+	SessionID string `gorm:"not null;default:''" json:"-"`
+	// TOTPSecret is the base32 secret of the authenticator, pending until TOTPEnabled.
+	TOTPSecret  string `json:"-"`
+	TOTPEnabled bool   `gorm:"not null;default:false" json:"-"`
+	// TOTPLastStep is the time step of the last accepted code, a code is accepted once.
+	TOTPLastStep int64 `gorm:"not null;default:0" json:"-"`
+	// RecoveryCodes are the SHA-256 of the unused recovery codes, comma separated.
+	RecoveryCodes string `json:"-"`
+	// ServiceAccount users have no password, they authenticate with API keys.
+	ServiceAccount bool `gorm:"not null;default:false" json:"-"`
+	// IdentityProvider and ExternalSubject link the user to its identity at an OpenID Connect
+	// provider, the user has no password and logs in with the provider.
+	IdentityProvider string  `gorm:"not null;default:'';uniqueIndex:idx_users_identity" json:"-"`
+	ExternalSubject  *string `gorm:"uniqueIndex:idx_users_identity" json:"-"`
 }
 
 type UsernamePassword struct {
 	Username string `json:"username" binding:"required" example:"admin" validate:"required"`
 	Password string `json:"password" binding:"required" example:"Pass@1234" validate:"required"`
+	// Email receives the password reset tokens.
+	Email string `json:"email,omitempty" example:"admin@example.com" validate:"omitempty,email"`
+}
+
+// UserQuery filters the users listed to administrators.
+type UserQuery struct {
+	// Query matches a part of the username or the email, case insensitively.
+	Query    string `query:"q"`
+	Role     string `query:"role" validate:"omitempty,oneof=admin user"`
+	Disabled *bool  `query:"disabled"`
+	PageRequest
+}
+
+// UserResponse is a user as shown to administrators, without its password.
+type UserResponse struct {
+	Username  string `json:"username" example:"admin"`
+	Email     string `json:"email" example:"admin@example.com"`
+	Role      string `json:"role" example:"admin"`
+	Disabled  bool   `json:"disabled"`
+	TwoFactor bool   `json:"two_factor"`
+	// ServiceAccount users authenticate with API keys only.
+	ServiceAccount bool `json:"service_account"`
+	// IdentityProvider is the OpenID Connect provider the user logs in with.
+	IdentityProvider string     `json:"identity_provider,omitempty" example:"corp"`
+	LockedUntil      *time.Time `json:"locked_until"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+}
+
+func NewUserResponse(user User) UserResponse {
+	return UserResponse{
+		Username:         user.Username,
+		Email:            user.Email,
+		Role:             user.Role,
+		Disabled:         user.Disabled,
+		TwoFactor:        user.TOTPEnabled,
+		ServiceAccount:   user.ServiceAccount,
+		IdentityProvider: user.IdentityProvider,
+		LockedUntil:      user.LockedUntil,
+		CreatedAt:        user.CreatedAt,
+		UpdatedAt:        user.UpdatedAt,
+	}
+}
+
+type UserRole struct {
+	Role string `json:"role" example:"user" validate:"required,oneof=admin user"`
 }
 
 type LoginSuccess struct {
 	Message string `json:"message"`
 	Token   string `json:"token"`
+	// RecoveryCodes are returned once by the login confirming a two-factor enrollment.
+	RecoveryCodes []string `json:"recovery_codes,omitempty"`
 }
 
 type MessageResponse struct {
@@ -0,0 +1,39 @@
+package models
+
+import "time"
+
+const (
+	UserRoleChanged           = "role_changed"
+	UserDisabled              = "disabled"
+	UserEnabled               = "enabled"
+	UserDeleted               = "deleted"
+	UserTwoFactorReset        = "two_factor_reset"
+	UserServiceAccountCreated = "service_account_created"
+	UserAPIKeyCreated         = "api_key_created"
+	UserAPIKeyRotated         = "api_key_rotated"
+	UserAPIKeyRevoked         = "api_key_revoked"
+	UserProvisioned           = "provisioned"
+	UserIdentityLinked        = "identity_linked"
+
+	// ActorCommandLine is the actor of the changes made with the user commands.
+	ActorCommandLine = "command-line"
+	// ActorOIDCPrefix is followed by the name of the OpenID Connect provider in the
+	// actor of the changes made by its logins.
+	ActorOIDCPrefix = "oidc:"
+)
+
+// UserAuditEvent is produced after an administrator changes a user, after the
+// API keys of a user change, and after an OpenID Connect login provisions a user
+// or changes its role.
+type UserAuditEvent struct {
+	Action   string `json:"action"`
+	Username string `json:"username"`
+	// Actor is the username of the administrator, of the user changing its own API keys,
+	// ActorCommandLine, or ActorOIDCPrefix and the provider.
+	Actor string `json:"actor"`
+	// Role is the new role of a role change.
+	Role string `json:"role,omitempty"`
+	// APIKey is the key ID of the API key of an API key change.
+	APIKey string    `json:"api_key,omitempty"`
+	Time   time.Time `json:"time"`
+}
@@ -0,0 +1,106 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// WebhookAllEvents subscribes a webhook to every event type.
+const WebhookAllEvents = "*"
+
+type Webhook struct {
+	gorm.Model
+	URL          string `gorm:"not null"`
+	EventTypes   string `gorm:"not null"` // comma separated event types
+	Secret       string `gorm:"not null"`
+	Active       bool   `gorm:"not null;default:true"`
+	FailureCount int    `gorm:"not null;default:0"`
+	DisabledAt   *time.Time
+}
+
+// Subscribes reports whether the webhook receives events of eventType.
+func (w Webhook) Subscribes(eventType string) bool {
+	for _, subscribed := range w.EventTypeList() {
+		if subscribed == eventType || subscribed == WebhookAllEvents {
+			return true
+		}
+	}
+	return false
+}
+
+func (w Webhook) EventTypeList() []string {
+	if w.EventTypes == "" {
+		return nil
+	}
+	return strings.Split(w.EventTypes, ",")
+}
+
+type WebhookDelivery struct {
+	gorm.Model
+	WebhookID  uint   `gorm:"not null;index"`
+	EventType  string `gorm:"not null"`
+	Payload    []byte `gorm:"not null"`
+	Attempt    int    `gorm:"not null"`
+	StatusCode int
+	Error      string
+	Success    bool `gorm:"not null"`
+	Duration   time.Duration
+	// RetryAt is when the failed attempt is retried, nil when it is not retried
+	// or its retry was started.
+	RetryAt *time.Time `gorm:"index"`
+}
+
+type WebhookInput struct {
+	URL        string   `json:"url" binding:"required" example:"https://partner.example.com/hooks/products" validate:"required,url"`
+	EventTypes []string `json:"event_types" binding:"required" example:"ProductUpdatedEvent,ProductDeletedEvent" validate:"required,min=1,dive,required"`
+	Secret     string   `json:"secret" binding:"required" example:"4f1c2e9a7b3d5f60" validate:"required,min=16"`
+	Active     *bool    `json:"active" example:"true"`
+}
+
+type WebhookResponse struct {
+	ID           uint       `json:"id" example:"1"`
+	URL          string     `json:"url" example:"https://partner.example.com/hooks/products"`
+	EventTypes   []string   `json:"event_types" example:"ProductUpdatedEvent,ProductDeletedEvent"`
+	Active       bool       `json:"active" example:"true"`
+	FailureCount int        `json:"failure_count" example:"0"`
+	DisabledAt   *time.Time `json:"disabled_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+func NewWebhookResponse(webhook Webhook) WebhookResponse {
+	return WebhookResponse{
+		ID:           webhook.ID,
+		URL:          webhook.URL,
+		EventTypes:   webhook.EventTypeList(),
+		Active:       webhook.Active,
+		FailureCount: webhook.FailureCount,
+		DisabledAt:   webhook.DisabledAt,
+		CreatedAt:    webhook.CreatedAt,
+	}
+}
+
+type WebhookDeliveryResponse struct {
+	ID         uint      `json:"id" example:"1"`
+	EventType  string    `json:"event_type" example:"ProductUpdatedEvent"`
+	Attempt    int       `json:"attempt" example:"1"`
+	StatusCode int       `json:"status_code" example:"200"`
+	Error      string    `json:"error"`
+	Success    bool      `json:"success" example:"true"`
+	DurationMs int64     `json:"duration_ms" example:"120"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func NewWebhookDeliveryResponse(delivery WebhookDelivery) WebhookDeliveryResponse {
+	return WebhookDeliveryResponse{
+		ID:         delivery.ID,
+		EventType:  delivery.EventType,
+		Attempt:    delivery.Attempt,
+		StatusCode: delivery.StatusCode,
+		Error:      delivery.Error,
+		Success:    delivery.Success,
+		DurationMs: delivery.Duration.Milliseconds(),
+		CreatedAt:  delivery.CreatedAt,
+	}
+}
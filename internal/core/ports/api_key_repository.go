@@ -0,0 +1,19 @@
+package ports
+
+import (
+	"time"
+
+	"github.com/WarisLi/Golang-mini-project/internal/core/models"
+)
+
+type APIKeyRepository interface {
+	CreateAPIKey(key models.APIKey) (uint, error)
+	GetAPIKey(id uint) (*models.APIKey, error)
+	GetAPIKeyByKeyID(keyID string) (*models.APIKey, error)
+	// GetUserAPIKeys returns the keys of a user, revoked and expired ones included, ordered by ID.
+	GetUserAPIKeys(username string) ([]models.APIKey, error)
+	UpdateAPIKey(key models.APIKey) error
+	// TouchAPIKey records the last use of a key.
+	TouchAPIKey(id uint, usedAt time.Time) error
+	DeleteUserAPIKeys(username string) error
+}
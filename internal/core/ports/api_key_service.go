@@ -0,0 +1,319 @@
+package ports
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/WarisLi/Golang-mini-project/internal/adapters/producer"
+	"github.com/WarisLi/Golang-mini-project/internal/core/models"
+	"gorm.io/gorm"
+)
+
+const (
+	apiKeyIDLength     = 8
+	apiKeySecretLength = 32
+
+	defaultAPIKeyMaxTTL = 365 * 24 * time.Hour
+)
+
+// APIKeyService manages the API keys of the users and the service accounts.
+// Every change produces a models.UserAuditEvent naming the actor, the owner of
+// the key or an administrator.
+type APIKeyService interface {
+	ListAPIKeys(username string) ([]models.APIKeyResponse, error)
+	CreateAPIKey(actor string, username string, input models.APIKeyInput) (*models.APIKeyCreated, error)
+	// RotateAPIKey returns a new key of the same name and scopes, the rotated key
+	// keeps working for the rotation grace period so that the clients can switch.
+	RotateAPIKey(actor string, username string, id uint) (*models.APIKeyCreated, error)
+	RevokeAPIKey(actor string, username string, id uint) error
+	// AuthenticateAPIKey returns the user of a key and the key, ErrInvalidAPIKey when
+	// the key is unknown, revoked or expired or when its user is disabled.
+	AuthenticateAPIKey(key string) (*models.User, *models.APIKey, error)
+	// CheckAPIKey returns ErrInvalidAPIKey when the key of keyID was revoked or expired
+	// since it was authenticated, or when its user was disabled.
+	CheckAPIKey(keyID string) error
+}
+
+type APIKeyOptions struct {
+	// MaxTTL is the longest lifetime of a key, and the lifetime of the keys created without expiry.
+	MaxTTL time.Duration
+	// RotationGrace is how long a rotated key keeps working, 0 revokes it at once.
+	RotationGrace time.Duration
+	// LastUsedInterval is how often the last use of a key is recorded, sparing a write per request.
+	LastUsedInterval time.Duration
+}
+
+type apiKeyServiceImpl struct {
+	repo          APIKeyRepository
+	userRepo      UserRepository
+	eventProducer producer.EventProducer
+	outboxRepo    OutboxRepository
+	options       APIKeyOptions
+}
+
+func NewAPIKeyService(repo APIKeyRepository, userRepo UserRepository, eventProducer producer.EventProducer,
+	outboxRepo OutboxRepository, options APIKeyOptions) APIKeyService {
+	if options.MaxTTL <= 0 {
+		options.MaxTTL = defaultAPIKeyMaxTTL
+	}
+	return &apiKeyServiceImpl{
+		repo:          repo,
+		userRepo:      userRepo,
+		eventProducer: eventProducer,
+		outboxRepo:    outboxRepo,
+		options:       options,
+	}
+}
+
+func (s *apiKeyServiceImpl) ListAPIKeys(username string) ([]models.APIKeyResponse, error) {
+	if _, err := s.userRepo.GetUser(username); err != nil {
+		return nil, err
+	}
+
+	keys, err := s.repo.GetUserAPIKeys(username)
+	if err != nil {
+		return nil, err
+	}
+
+	responses := make([]models.APIKeyResponse, 0, len(keys))
+	for _, key := range keys {
+		responses = append(responses, models.NewAPIKeyResponse(key))
+	}
+	return responses, nil
+}
+
+func (s *apiKeyServiceImpl) CreateAPIKey(actor string, username string, input models.APIKeyInput) (*models.APIKeyCreated, error) {
+	user, err := s.userRepo.GetUser(username)
+	if err != nil {
+		return nil, err
+	}
+
+	scopes := slices.Clone(input.Scopes)
+	slices.Sort(scopes)
+	scopes = slices.Compact(scopes)
+	for _, scope := range scopes {
+		if !slices.Contains(models.APIKeyScopes, scope) {
+			return nil, fmt.Errorf("%w: unknown scope %q", ErrInvalidAPIKeyScope, scope)
+		}
+		if scope == models.ScopeAdmin && user.Role != models.RoleAdmin {
+			return nil, fmt.Errorf("%w: the scope %q requires the role admin", ErrInvalidAPIKeyScope, scope)
+		}
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(s.options.MaxTTL)
+	if input.ExpiresAt != nil {
+		if !input.ExpiresAt.After(now) || input.ExpiresAt.After(expiresAt) {
+			return nil, fmt.Errorf("%w: the key has to expire within %s", ErrInvalidAPIKeyExpiry, s.options.MaxTTL)
+		}
+		expiresAt = *input.ExpiresAt
+	}
+
+	created, err := s.createAPIKey(models.APIKey{
+		Username:  username,
+		Name:      input.Name,
+		Scopes:    strings.Join(scopes, ","),
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.audit(models.UserAuditEvent{Action: models.UserAPIKeyCreated, Username: username, Actor: actor, APIKey: created.KeyID})
+	return created, nil
+}
+
+// createAPIKey saves key with a new secret and returns it with the key.
+func (s *apiKeyServiceImpl) createAPIKey(key models.APIKey) (*models.APIKeyCreated, error) {
+	plain, keyID, err := newAPIKey()
+	if err != nil {
+		return nil, err
+	}
+	key.KeyID = keyID
+	key.SecretHash = apiKeyHash(plain)
+
+	id, err := s.repo.CreateAPIKey(key)
+	if err != nil {
+		return nil, err
+	}
+	saved, err := s.repo.GetAPIKey(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.APIKeyCreated{APIKeyResponse: models.NewAPIKeyResponse(*saved), Key: plain}, nil
+}
+
+func (s *apiKeyServiceImpl) RotateAPIKey(actor string, username string, id uint) (*models.APIKeyCreated, error) {
+	key, err := s.userAPIKey(username, id)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if !key.Active(now) {
+		return nil, ErrAPIKeyInactive
+	}
+
+	lifetime := min(key.ExpiresAt.Sub(key.CreatedAt), s.options.MaxTTL)
+	created, err := s.createAPIKey(models.APIKey{
+		Username:  username,
+		Name:      key.Name,
+		Scopes:    key.Scopes,
+		ExpiresAt: now.Add(lifetime),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if s.options.RotationGrace <= 0 {
+		key.RevokedAt = &now
+	} else if graceEnd := now.Add(s.options.RotationGrace); graceEnd.Before(key.ExpiresAt) {
+		key.ExpiresAt = graceEnd
+	}
+	if err := s.repo.UpdateAPIKey(*key); err != nil {
+		return nil, err
+	}
+
+	s.audit(models.UserAuditEvent{Action: models.UserAPIKeyRotated, Username: username, Actor: actor, APIKey: key.KeyID})
+	return created, nil
+}
+
+func (s *apiKeyServiceImpl) RevokeAPIKey(actor string, username string, id uint) error {
+	key, err := s.userAPIKey(username, id)
+	if err != nil {
+		return err
+	}
+	if key.RevokedAt != nil {
+		return nil
+	}
+
+	now := time.Now()
+	key.RevokedAt = &now
+	if err := s.repo.UpdateAPIKey(*key); err != nil {
+		return err
+	}
+
+	s.audit(models.UserAuditEvent{Action: models.UserAPIKeyRevoked, Username: username, Actor: actor, APIKey: key.KeyID})
+	return nil
+}
+
+// userAPIKey returns the key of id, gorm.ErrRecordNotFound when it is not a key of username.
+func (s *apiKeyServiceImpl) userAPIKey(username string, id uint) (*models.APIKey, error) {
+	key, err := s.repo.GetAPIKey(id)
+	if err != nil {
+		return nil, err
+	}
+	if key.Username != username {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return key, nil
+}
+
+func (s *apiKeyServiceImpl) AuthenticateAPIKey(plain string) (*models.User, *models.APIKey, error) {
+	keyID, ok := apiKeyID(plain)
+	if !ok {
+		return nil, nil, ErrInvalidAPIKey
+	}
+	key, err := s.repo.GetAPIKeyByKeyID(keyID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	if subtle.ConstantTimeCompare([]byte(key.SecretHash), []byte(apiKeyHash(plain))) != 1 || !key.Active(now) {
+		return nil, nil, ErrInvalidAPIKey
+	}
+
+	user, err := s.keyUser(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= s.options.LastUsedInterval {
+		if err := s.repo.TouchAPIKey(key.ID, now); err != nil {
+			log.Printf("Last use of API key %s not recorded %s\n", key.KeyID, err)
+		} else {
+			key.LastUsedAt = &now
+		}
+	}
+	return user, key, nil
+}
+
+func (s *apiKeyServiceImpl) CheckAPIKey(keyID string) error {
+	key, err := s.repo.GetAPIKeyByKeyID(keyID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrInvalidAPIKey
+	}
+	if err != nil {
+		return err
+	}
+	if !key.Active(time.Now()) {
+		return ErrInvalidAPIKey
+	}
+
+	_, err = s.keyUser(key)
+	return err
+}
+
+// keyUser returns the user of a key, ErrInvalidAPIKey when it was deleted or disabled.
+func (s *apiKeyServiceImpl) keyUser(key *models.APIKey) (*models.User, error) {
+	user, err := s.userRepo.GetUser(key.Username)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, err
+	}
+	if user.Disabled {
+		return nil, ErrInvalidAPIKey
+	}
+	return user, nil
+}
+
+func (s *apiKeyServiceImpl) audit(event models.UserAuditEvent) {
+	event.Time = time.Now().UTC()
+	produceEvent(s.eventProducer, s.outboxRepo, event)
+}
+
+// newAPIKey returns a new key, "<prefix><key ID>_<secret>", and its key ID.
+func newAPIKey() (string, string, error) {
+	random := make([]byte, apiKeyIDLength+apiKeySecretLength)
+	if _, err := rand.Read(random); err != nil {
+		return "", "", err
+	}
+	keyID := hex.EncodeToString(random[:apiKeyIDLength])
+	secret := base64.RawURLEncoding.EncodeToString(random[apiKeyIDLength:])
+	return models.APIKeyPrefix + keyID + "_" + secret, keyID, nil
+}
+
+// apiKeyID returns the key ID of a key, the secret may contain underscores but the key ID does not.
+func apiKeyID(key string) (string, bool) {
+	rest, ok := strings.CutPrefix(key, models.APIKeyPrefix)
+	if !ok {
+		return "", false
+	}
+	keyID, _, ok := strings.Cut(rest, "_")
+	if !ok || len(keyID) != 2*apiKeyIDLength {
+		return "", false
+	}
+	return keyID, true
+}
+
+// apiKeyHash is the stored hash of a key. The keys are random, so a fast hash is
+// enough where the passwords need bcrypt or argon2id.
+func apiKeyHash(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,12 @@
+package ports
+
+import "time"
+
+// Cache is a key value store whose entries expire, e.g. an in-process LRU or Redis.
+type Cache interface {
+	// Get returns ErrCacheMiss when the key is not cached or expired.
+	Get(key string) ([]byte, error)
+	// Set caches a value for ttl, a zero ttl never expires.
+	Set(key string, value []byte, ttl time.Duration) error
+	Delete(keys ...string) error
+}
@@ -0,0 +1,64 @@
+package ports
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// DeadLetterAlert is produced when the dead-letter backlog reaches the alert threshold.
+type DeadLetterAlert struct {
+	Pending   int64
+	Threshold int64
+	Time      time.Time
+}
+
+type DeadLetterMonitor struct {
+	service   OutboxService
+	threshold int64
+	alert     func(alert DeadLetterAlert)
+}
+
+// NewDeadLetterMonitor creates a monitor calling alert whenever the number of
+// dead letters is at least threshold and has grown since the previous alert.
+func NewDeadLetterMonitor(service OutboxService, threshold int64, alert func(alert DeadLetterAlert)) *DeadLetterMonitor {
+	return &DeadLetterMonitor{
+		service:   service,
+		threshold: threshold,
+		alert:     alert,
+	}
+}
+
+// Run checks the backlog every interval until ctx is done.
+func (m *DeadLetterMonitor) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var lastAlerted int64
+	for {
+		lastAlerted = m.check(lastAlerted)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (m *DeadLetterMonitor) check(lastAlerted int64) int64 {
+	pending, err := m.service.CountDeadLetters()
+	if err != nil {
+		log.Printf("Dead letter check failed %s\n", err)
+		return lastAlerted
+	}
+
+	if pending < m.threshold {
+		return 0
+	}
+	if pending > lastAlerted {
+		m.alert(DeadLetterAlert{Pending: pending, Threshold: m.threshold, Time: time.Now()})
+		return pending
+	}
+	return lastAlerted
+}
@@ -0,0 +1,104 @@
+package ports
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrInvalidEvent          = errors.New("invalid event")
+	ErrEventAlreadyProcessed = errors.New("event already processed")
+	ErrInsufficientStock     = errors.New("insufficient stock")
+
+	ErrInvalidPatch    = errors.New("invalid patch")
+	ErrPatchTestFailed = errors.New("patch test failed")
+	ErrInvalidProduct  = errors.New("invalid product")
+
+	ErrBatchTooLarge = errors.New("too many operations in batch")
+	ErrInvalidSearch = errors.New("invalid search")
+
+	ErrIdempotencyKeyExists     = errors.New("idempotency key already exists")
+	ErrIdempotencyKeyInProgress = errors.New("a request with this idempotency key is in progress")
+	ErrIdempotencyKeyMismatch   = errors.New("idempotency key was used for a different request")
+
+	ErrCacheMiss = errors.New("cache miss")
+
+	ErrUserLocked        = errors.New("too many failed logins, try again later")
+	ErrWeakPassword      = errors.New("password does not meet the policy")
+	ErrWrongPassword     = errors.New("current password is incorrect")
+	ErrInvalidResetToken = errors.New("invalid or expired password reset token")
+	ErrInvalidSession    = errors.New("session is no longer valid")
+	ErrUnknownRole       = errors.New("unknown role")
+	ErrOwnUser           = errors.New("administrators cannot demote, disable or delete themselves")
+	ErrUserDisabled      = errors.New("user is disabled")
+
+	ErrTwoFactorRequired       = errors.New("two-factor authentication required")
+	ErrInvalidTwoFactorCode    = errors.New("invalid two-factor code")
+	ErrInvalidChallenge        = errors.New("invalid or expired two-factor challenge")
+	ErrTwoFactorEnabled        = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorNotEnrolled    = errors.New("no authenticator is enrolled")
+	ErrTwoFactorRequiredByRole = errors.New("two-factor authentication is required for the role of the user")
+	ErrTwoFactorChanged        = errors.New("two-factor authentication was changed by another request")
+
+	ErrInvalidAPIKey       = errors.New("invalid, expired or revoked API key")
+	ErrAPIKeyInactive      = errors.New("API key is revoked or expired")
+	ErrInvalidAPIKeyScope  = errors.New("invalid API key scope")
+	ErrInvalidAPIKeyExpiry = errors.New("invalid API key expiry")
+	ErrMissingScope        = errors.New("API key does not have the required scope")
+
+	ErrInvalidToken = errors.New("invalid token")
+
+	ErrUnknownIdentityProvider = errors.New("unknown identity provider")
+	ErrIdentityProvider        = errors.New("identity provider failed")
+	ErrInvalidOIDCLogin        = errors.New("invalid or expired login")
+	ErrOIDCAccessDenied        = errors.New("the groups of the identity do not allow the login")
+	ErrOIDCUnknownUser         = errors.New("no user is linked to the identity")
+	ErrIdentityConflict        = errors.New("the username of the identity belongs to another user")
+	ErrExternalUser            = errors.New("the user logs in with its identity provider")
+
+	ErrConsumedDeadLetter = errors.New("consumed messages are not published again, discard the dead letter once handled")
+)
+
+// BatchOperationError is the error of the operation at Index of a batch.
+type BatchOperationError struct {
+	Index int
+	Err   error
+}
+
+func (e *BatchOperationError) Error() string {
+	return fmt.Sprintf("operation %d: %s", e.Index, e.Err)
+}
+
+func (e *BatchOperationError) Unwrap() error {
+	return e.Err
+}
+
+// UserLockedError is returned by logins refused until RetryAfter has passed.
+type UserLockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *UserLockedError) Error() string {
+	return ErrUserLocked.Error()
+}
+
+func (e *UserLockedError) Unwrap() error {
+	return ErrUserLocked
+}
+
+// TwoFactorRequiredError is returned by logins which need a second factor, given
+// with the ChallengeToken.
+type TwoFactorRequiredError struct {
+	ChallengeToken string
+	// Enroll is set when the user has to enroll an authenticator first.
+	Enroll bool
+}
+
+func (e *TwoFactorRequiredError) Error() string {
+	return ErrTwoFactorRequired.Error()
+}
+
+func (e *TwoFactorRequiredError) Unwrap() error {
+	return ErrTwoFactorRequired
+}
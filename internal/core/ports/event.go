@@ -0,0 +1,92 @@
+package ports
+
+import (
+	"encoding/json"
+	"log"
+
+	events "github.com/WarisLi/Golang-shared-events"
+
+	"github.com/WarisLi/Golang-mini-project/internal/adapters/producer"
+	"github.com/WarisLi/Golang-mini-project/internal/core/models"
+)
+
+// lowQuantityThreshold is the quantity under which a low quantity notification is produced.
+const lowQuantityThreshold = 100
+
+// produceEvent publishes an event and keeps it in the outbox when the producer fails,
+// so it can be replayed later.
+func produceEvent(eventProducer producer.EventProducer, outboxRepo OutboxRepository, event events.Event) {
+	produceErr := eventProducer.Produce(event)
+	if produceErr == nil {
+		return
+	}
+	log.Println(produceErr)
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	outboxEvent := models.OutboxEvent{
+		Topic:     producer.TopicOf(event),
+		Payload:   payload,
+		Attempts:  1,
+		LastError: produceErr.Error(),
+	}
+	if _, err := outboxRepo.SaveEvent(outboxEvent); err != nil {
+		log.Println(err)
+	}
+}
+
+// saveEvents keeps events in the outbox until they are published. Saved in a
+// unit of work, the events are kept if and only if its writes are.
+func saveEvents(outboxRepo OutboxRepository, pending ...events.Event) ([]models.OutboxEvent, error) {
+	outboxEvents := make([]models.OutboxEvent, 0, len(pending))
+	for _, event := range pending {
+		payload, err := json.Marshal(event)
+		if err != nil {
+			return nil, err
+		}
+
+		outboxEvent := models.OutboxEvent{
+			Topic:   producer.TopicOf(event),
+			Payload: payload,
+		}
+		outboxEvent.ID, err = outboxRepo.SaveEvent(outboxEvent)
+		if err != nil {
+			return nil, err
+		}
+		outboxEvents = append(outboxEvents, outboxEvent)
+	}
+
+	return outboxEvents, nil
+}
+
+// publishEvent produces an outbox event and records the outcome on it, an
+// event that fails stays pending. The event is only marked published once a
+// producer queuing the messages delivered it.
+func publishEvent(eventProducer producer.EventProducer, outboxRepo OutboxRepository, event models.OutboxEvent) error {
+	produce := eventProducer.ProduceMessage
+	if deliveryProducer, ok := eventProducer.(producer.DeliveryProducer); ok {
+		produce = deliveryProducer.DeliverMessage
+	}
+	if err := produce(event.Topic, event.Payload); err != nil {
+		if recordErr := outboxRepo.RecordEventFailure(event.ID, err.Error()); recordErr != nil {
+			log.Println(recordErr)
+		}
+		return err
+	}
+
+	return outboxRepo.MarkEventPublished(event.ID)
+}
+
+// publishEvents publishes the outbox events saved by a committed unit of work,
+// the events that fail stay pending for the outbox retries.
+func publishEvents(eventProducer producer.EventProducer, outboxRepo OutboxRepository, outboxEvents []models.OutboxEvent) {
+	for _, event := range outboxEvents {
+		if err := publishEvent(eventProducer, outboxRepo, event); err != nil {
+			log.Printf("Publish outbox event %d failed %s\n", event.ID, err)
+		}
+	}
+}
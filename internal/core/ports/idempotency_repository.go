@@ -0,0 +1,16 @@
+package ports
+
+import (
+	"time"
+
+	"github.com/WarisLi/Golang-mini-project/internal/core/models"
+)
+
+type IdempotencyRepository interface {
+	// CreateIdempotencyKey returns ErrIdempotencyKeyExists when the key is already stored.
+	CreateIdempotencyKey(key models.IdempotencyKey) error
+	GetIdempotencyKey(scope string, key string) (*models.IdempotencyKey, error)
+	UpdateIdempotencyKey(key models.IdempotencyKey) error
+	DeleteIdempotencyKey(scope string, key string) error
+	DeleteExpiredIdempotencyKeys(now time.Time) error
+}
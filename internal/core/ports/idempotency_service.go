@@ -0,0 +1,129 @@
+package ports
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/WarisLi/Golang-mini-project/internal/core/models"
+)
+
+type IdempotencyOptions struct {
+	// TTL is how long a response is kept for retries.
+	TTL time.Duration
+	// LockTimeout is how long a request in progress blocks its key. A key left
+	// in progress longer, e.g. by a crashed server, is taken over by the next retry.
+	LockTimeout time.Duration
+	// SweepInterval is how often the expired keys are deleted.
+	SweepInterval time.Duration
+}
+
+// IdempotencyService makes sure a request sent with an idempotency key is
+// processed once; retries get the stored response.
+type IdempotencyService interface {
+	// Begin reserves key for a request. It returns the stored response when the
+	// request was already completed, ErrIdempotencyKeyInProgress while it is
+	// processed and ErrIdempotencyKeyMismatch when the key was used for another request.
+	Begin(scope string, key string, requestHash string) (*models.IdempotencyKey, error)
+	// Complete stores the response of a reserved key.
+	Complete(scope string, key string, statusCode int, contentType string, body []byte) error
+	// Release frees a reserved key so the request can be retried.
+	Release(scope string, key string) error
+	// DeleteExpiredKeys deletes the keys whose response is no longer kept.
+	DeleteExpiredKeys() error
+	// RunSweep deletes the expired keys every interval until ctx is done.
+	RunSweep(ctx context.Context, interval time.Duration)
+}
+
+type idempotencyServiceImpl struct {
+	repo    IdempotencyRepository
+	options IdempotencyOptions
+}
+
+func NewIdempotencyService(repo IdempotencyRepository, options IdempotencyOptions) IdempotencyService {
+	return &idempotencyServiceImpl{
+		repo:    repo,
+		options: options,
+	}
+}
+
+func (s *idempotencyServiceImpl) Begin(scope string, key string, requestHash string) (*models.IdempotencyKey, error) {
+	now := time.Now()
+	idempotencyKey := models.IdempotencyKey{
+		Scope:       scope,
+		Key:         key,
+		RequestHash: requestHash,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(s.options.TTL),
+	}
+
+	// A stale key is deleted and created again once
+	for attempt := 0; attempt < 2; attempt++ {
+		err := s.repo.CreateIdempotencyKey(idempotencyKey)
+		if err == nil {
+			return nil, nil
+		}
+		if !errors.Is(err, ErrIdempotencyKeyExists) {
+			return nil, err
+		}
+
+		existing, err := s.repo.GetIdempotencyKey(scope, key)
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case !existing.ExpiresAt.After(now),
+			!existing.Completed() && s.options.LockTimeout > 0 && existing.CreatedAt.Add(s.options.LockTimeout).Before(now):
+			if err := s.repo.DeleteIdempotencyKey(scope, key); err != nil {
+				return nil, err
+			}
+		case existing.RequestHash != requestHash:
+			return nil, ErrIdempotencyKeyMismatch
+		case !existing.Completed():
+			return nil, ErrIdempotencyKeyInProgress
+		default:
+			return existing, nil
+		}
+	}
+
+	return nil, ErrIdempotencyKeyInProgress
+}
+
+func (s *idempotencyServiceImpl) Complete(scope string, key string, statusCode int, contentType string, body []byte) error {
+	existing, err := s.repo.GetIdempotencyKey(scope, key)
+	if err != nil {
+		return err
+	}
+
+	existing.StatusCode = statusCode
+	existing.ContentType = contentType
+	existing.Body = body
+	return s.repo.UpdateIdempotencyKey(*existing)
+}
+
+func (s *idempotencyServiceImpl) Release(scope string, key string) error {
+	return s.repo.DeleteIdempotencyKey(scope, key)
+}
+
+func (s *idempotencyServiceImpl) DeleteExpiredKeys() error {
+	return s.repo.DeleteExpiredIdempotencyKeys(time.Now())
+}
+
+func (s *idempotencyServiceImpl) RunSweep(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.DeleteExpiredKeys(); err != nil {
+			log.Printf("Idempotency key sweep failed %s\n", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
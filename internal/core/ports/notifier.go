@@ -0,0 +1,7 @@
+package ports
+
+import "github.com/WarisLi/Golang-mini-project/internal/core/models"
+
+type Notifier interface {
+	Notify(notification models.Notification) error
+}
@@ -0,0 +1,15 @@
+package ports
+
+import (
+	"time"
+
+	"github.com/WarisLi/Golang-mini-project/internal/core/models"
+)
+
+type OIDCLoginRepository interface {
+	CreateOIDCLogin(login models.OIDCLogin) error
+	// TakeOIDCLogin returns and deletes the login of the state hash, so that a state completes
+	// one login. It returns gorm.ErrRecordNotFound when there is no such login.
+	TakeOIDCLogin(stateHash string) (*models.OIDCLogin, error)
+	DeleteExpiredOIDCLogins(now time.Time) error
+}
@@ -0,0 +1,303 @@
+package ports
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/WarisLi/Golang-mini-project/internal/adapters/producer"
+	"github.com/WarisLi/Golang-mini-project/internal/core/models"
+	"gorm.io/gorm"
+)
+
+// IdentityProvider is an OpenID Connect provider of the authorization code flow with PKCE.
+type IdentityProvider interface {
+	// AuthorizationURL returns the URL of the provider the browser is sent to for a login.
+	AuthorizationURL(state string, nonce string, codeChallenge string) (string, error)
+	// Exchange redeems the code of a callback with the PKCE code verifier and returns the
+	// claims of the verified ID token. The errors of the provider wrap ErrIdentityProvider,
+	// the rejected codes and the invalid ID tokens wrap ErrInvalidOIDCLogin.
+	Exchange(code string, codeVerifier string) (models.OIDCClaims, error)
+}
+
+// OIDCService logs the users in with OpenID Connect providers. The identities are linked
+// to local users, which are provisioned on their first login, and their groups give their role.
+type OIDCService interface {
+	// Providers returns the names of the providers, in order.
+	Providers() []string
+	// BeginLogin returns the authorization URL of the provider and the state of the login,
+	// which the browser brings back to CompleteLogin.
+	BeginLogin(provider string) (authorizationURL string, state string, err error)
+	// CompleteLogin redeems the code of the callback of a login and returns a token of the
+	// user of the identity.
+	CompleteLogin(provider string, state string, code string) (string, error)
+}
+
+// OIDCProvider is an identity provider and the mapping of its identities to the users.
+type OIDCProvider struct {
+	IdentityProvider IdentityProvider
+	// UsernameClaim gives the username of the provisioned users, preferred_username by
+	// default. The email is used when the claim is missing.
+	UsernameClaim string
+	// GroupsClaim lists the groups of the identity, groups by default.
+	GroupsClaim string
+	// AdminGroups are given the admin role, the other identities the user role.
+	AdminGroups []string
+	// AllowedGroups only allow the logins of their members and of the admin groups when set.
+	AllowedGroups []string
+	// Provision creates the user of an identity on its first login.
+	Provision bool
+	// LinkUsers links an identity to the existing user of its username on its first login, the
+	// password of the user is then removed. Only for providers whose users cannot choose their username.
+	LinkUsers bool
+}
+
+type OIDCOptions struct {
+	// LoginTTL is how long a login can be completed at the provider, 10 minutes by default.
+	LoginTTL time.Duration
+}
+
+const (
+	defaultOIDCLoginTTL      = 10 * time.Minute
+	defaultOIDCUsernameClaim = "preferred_username"
+	defaultOIDCGroupsClaim   = "groups"
+	// oidcSecretLength is the length of the states, nonces and code verifiers.
+	oidcSecretLength = 32
+)
+
+type oidcServiceImpl struct {
+	users         UserRepository
+	logins        OIDCLoginRepository
+	tokens        TokenService
+	eventProducer producer.EventProducer
+	outboxRepo    OutboxRepository
+	providers     map[string]OIDCProvider
+	options       OIDCOptions
+}
+
+func NewOIDCService(users UserRepository, logins OIDCLoginRepository, tokens TokenService, eventProducer producer.EventProducer,
+	outboxRepo OutboxRepository, providers map[string]OIDCProvider, options OIDCOptions) OIDCService {
+	if options.LoginTTL <= 0 {
+		options.LoginTTL = defaultOIDCLoginTTL
+	}
+	configured := make(map[string]OIDCProvider, len(providers))
+	for name, provider := range providers {
+		if provider.UsernameClaim == "" {
+			provider.UsernameClaim = defaultOIDCUsernameClaim
+		}
+		if provider.GroupsClaim == "" {
+			provider.GroupsClaim = defaultOIDCGroupsClaim
+		}
+		configured[name] = provider
+	}
+
+	return &oidcServiceImpl{
+		users:         users,
+		logins:        logins,
+		tokens:        tokens,
+		eventProducer: eventProducer,
+		outboxRepo:    outboxRepo,
+		providers:     configured,
+		options:       options,
+	}
+}
+
+func (s *oidcServiceImpl) Providers() []string {
+	names := make([]string, 0, len(s.providers))
+	for name := range s.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (s *oidcServiceImpl) BeginLogin(name string) (string, string, error) {
+	provider, ok := s.providers[name]
+	if !ok {
+		return "", "", ErrUnknownIdentityProvider
+	}
+
+	now := time.Now()
+	if err := s.logins.DeleteExpiredOIDCLogins(now); err != nil {
+		log.Printf("Delete expired OIDC logins failed %s\n", err)
+	}
+
+	secrets := make([]string, 3)
+	for i := range secrets {
+		secret := make([]byte, oidcSecretLength)
+		if _, err := rand.Read(secret); err != nil {
+			return "", "", err
+		}
+		secrets[i] = base64.RawURLEncoding.EncodeToString(secret)
+	}
+	state, nonce, codeVerifier := secrets[0], secrets[1], secrets[2]
+
+	err := s.logins.CreateOIDCLogin(models.OIDCLogin{
+		StateHash:    oidcStateHash(state),
+		Provider:     name,
+		Nonce:        nonce,
+		CodeVerifier: codeVerifier,
+		CreatedAt:    now,
+		ExpiresAt:    now.Add(s.options.LoginTTL),
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	challenge := sha256.Sum256([]byte(codeVerifier))
+	authorizationURL, err := provider.IdentityProvider.AuthorizationURL(state, nonce, base64.RawURLEncoding.EncodeToString(challenge[:]))
+	if err != nil {
+		return "", "", err
+	}
+	return authorizationURL, state, nil
+}
+
+func (s *oidcServiceImpl) CompleteLogin(name string, state string, code string) (string, error) {
+	provider, ok := s.providers[name]
+	if !ok {
+		return "", ErrUnknownIdentityProvider
+	}
+
+	login, err := s.logins.TakeOIDCLogin(oidcStateHash(state))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", ErrInvalidOIDCLogin
+	}
+	if err != nil {
+		return "", err
+	}
+	if login.Provider != name || !login.ExpiresAt.After(time.Now()) {
+		return "", ErrInvalidOIDCLogin
+	}
+
+	claims, err := provider.IdentityProvider.Exchange(code, login.CodeVerifier)
+	if err != nil {
+		return "", err
+	}
+	// The nonce binds the ID token to this login, it cannot be replayed in another one
+	if subtle.ConstantTimeCompare([]byte(claims.String("nonce")), []byte(login.Nonce)) != 1 {
+		return "", fmt.Errorf("%w: nonce mismatch", ErrInvalidOIDCLogin)
+	}
+	subject := claims.String("sub")
+	if subject == "" {
+		return "", fmt.Errorf("%w: no subject", ErrInvalidOIDCLogin)
+	}
+	role, err := provider.role(claims)
+	if err != nil {
+		return "", err
+	}
+
+	user, err := s.users.GetUserByIdentity(name, subject)
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		user, err = s.linkUser(name, provider, subject, claims, role)
+		if err != nil {
+			return "", err
+		}
+	case err != nil:
+		return "", err
+	case user.Role != role:
+		// The groups at the provider decide the role, the tokens of the former role are signed out
+		user.Role = role
+		user.SessionVersion++
+		if err := s.users.UpdateUser(*user); err != nil {
+			return "", err
+		}
+		s.audit(name, models.UserAuditEvent{Action: models.UserRoleChanged, Username: user.Username, Role: role})
+	}
+
+	if user.Disabled {
+		return "", ErrUserDisabled
+	}
+	return s.tokens.SignToken(user)
+}
+
+// linkUser links the identity of subject to the user of its username, or to a new user.
+func (s *oidcServiceImpl) linkUser(name string, provider OIDCProvider, subject string, claims models.OIDCClaims, role string) (*models.User, error) {
+	username := claims.String(provider.UsernameClaim)
+	if username == "" {
+		username = claims.String("email")
+	}
+	if username == "" {
+		return nil, fmt.Errorf("%w: no %s or email claim", ErrInvalidOIDCLogin, provider.UsernameClaim)
+	}
+
+	existing, err := s.users.GetUser(username)
+	switch {
+	case err == nil:
+		if !provider.LinkUsers || existing.ServiceAccount || existing.IdentityProvider != "" {
+			return nil, ErrIdentityConflict
+		}
+		// The user logs in with the provider from now on, its password and sessions end
+		existing.IdentityProvider = name
+		existing.ExternalSubject = &subject
+		existing.Password = ""
+		existing.Role = role
+		existing.SessionVersion++
+		if err := s.users.UpdateUser(*existing); err != nil {
+			return nil, err
+		}
+		s.audit(name, models.UserAuditEvent{Action: models.UserIdentityLinked, Username: username, Role: role})
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return nil, err
+	case !provider.Provision:
+		return nil, ErrOIDCUnknownUser
+	default:
+		sessionID, err := newSessionID()
+		if err != nil {
+			return nil, err
+		}
+		err = s.users.Create(models.User{
+			Username:         username,
+			Email:            claims.String("email"),
+			Role:             role,
+			SessionID:        sessionID,
+			IdentityProvider: name,
+			ExternalSubject:  &subject,
+		})
+		// A concurrent login of the identity may have provisioned it
+		if user, getErr := s.users.GetUserByIdentity(name, subject); err != nil && getErr == nil {
+			return user, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		s.audit(name, models.UserAuditEvent{Action: models.UserProvisioned, Username: username, Role: role})
+	}
+
+	return s.users.GetUserByIdentity(name, subject)
+}
+
+// role returns the role of the groups of claims, ErrOIDCAccessDenied when they do not allow the login.
+func (p OIDCProvider) role(claims models.OIDCClaims) (string, error) {
+	groups := claims.Strings(p.GroupsClaim)
+	member := func(allowed []string) bool {
+		return slices.ContainsFunc(groups, func(group string) bool { return slices.Contains(allowed, group) })
+	}
+
+	if member(p.AdminGroups) {
+		return models.RoleAdmin, nil
+	}
+	if len(p.AllowedGroups) > 0 && !member(p.AllowedGroups) {
+		return "", ErrOIDCAccessDenied
+	}
+	return models.RoleUser, nil
+}
+
+func (s *oidcServiceImpl) audit(provider string, event models.UserAuditEvent) {
+	event.Actor = models.ActorOIDCPrefix + provider
+	event.Time = time.Now().UTC()
+	produceEvent(s.eventProducer, s.outboxRepo, event)
+}
+
+func oidcStateHash(state string) string {
+	hash := sha256.Sum256([]byte(state))
+	return hex.EncodeToString(hash[:])
+}
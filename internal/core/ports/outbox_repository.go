@@ -0,0 +1,22 @@
+package ports
+
+import (
+	"github.com/WarisLi/Golang-mini-project/internal/core/models"
+)
+
+type OutboxRepository interface {
+	// SaveEvent saves an outbox event and returns its ID.
+	SaveEvent(event models.OutboxEvent) (uint, error)
+	// GetPendingEvents returns the events not published yet, those being published included.
+	// Consumed events are not returned.
+	GetPendingEvents() ([]models.OutboxEvent, error)
+	// GetFailedEvents returns the dead letters, the pending events whose publishing failed.
+	GetFailedEvents() ([]models.OutboxEvent, error)
+	GetFailedEvent(id uint) (*models.OutboxEvent, error)
+	CountFailedEvents() (int64, error)
+	MarkEventPublished(id uint) error
+	RecordEventFailure(id uint, lastError string) error
+	// DeleteFailedEvent returns gorm.ErrRecordNotFound when the event does not exist, was
+	// published or was not attempted yet.
+	DeleteFailedEvent(id uint) error
+}
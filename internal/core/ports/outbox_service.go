@@ -0,0 +1,99 @@
+package ports
+
+import (
+	"log"
+
+	"github.com/WarisLi/Golang-mini-project/internal/adapters/producer"
+	"github.com/WarisLi/Golang-mini-project/internal/core/models"
+)
+
+type OutboxService interface {
+	Replay() (int, error)
+	GetDeadLetters() ([]models.DeadLetter, error)
+	GetDeadLetter(id uint) (*models.DeadLetter, error)
+	RetryDeadLetter(id uint) error
+	DiscardDeadLetter(id uint) error
+	CountDeadLetters() (int64, error)
+}
+
+type outboxServiceImpl struct {
+	repo          OutboxRepository
+	eventProducer producer.EventProducer
+}
+
+func NewOutboxService(repo OutboxRepository, eventProducer producer.EventProducer) OutboxService {
+	return &outboxServiceImpl{
+		repo:          repo,
+		eventProducer: eventProducer,
+	}
+}
+
+// Replay publishes every pending outbox event and returns how many were published.
+// Events that fail again stay pending, consumed messages are never published.
+func (s *outboxServiceImpl) Replay() (int, error) {
+	pendingEvents, err := s.repo.GetPendingEvents()
+	if err != nil {
+		return 0, err
+	}
+
+	published := 0
+	for _, event := range pendingEvents {
+		if err := s.publish(event); err != nil {
+			log.Printf("Replay outbox event %d failed %s\n", event.ID, err)
+			continue
+		}
+		published++
+	}
+
+	return published, nil
+}
+
+// GetDeadLetters returns the events whose publishing failed, the events of the
+// units of work being published are not dead letters.
+func (s *outboxServiceImpl) GetDeadLetters() ([]models.DeadLetter, error) {
+	failedEvents, err := s.repo.GetFailedEvents()
+	if err != nil {
+		return nil, err
+	}
+
+	deadLetters := make([]models.DeadLetter, 0, len(failedEvents))
+	for _, event := range failedEvents {
+		deadLetters = append(deadLetters, models.NewDeadLetter(event))
+	}
+	return deadLetters, nil
+}
+
+func (s *outboxServiceImpl) GetDeadLetter(id uint) (*models.DeadLetter, error) {
+	event, err := s.repo.GetFailedEvent(id)
+	if err != nil {
+		return nil, err
+	}
+
+	deadLetter := models.NewDeadLetter(*event)
+	return &deadLetter, nil
+}
+
+func (s *outboxServiceImpl) RetryDeadLetter(id uint) error {
+	event, err := s.repo.GetFailedEvent(id)
+	if err != nil {
+		return err
+	}
+	if event.Consumed {
+		return ErrConsumedDeadLetter
+	}
+
+	return s.publish(*event)
+}
+
+func (s *outboxServiceImpl) DiscardDeadLetter(id uint) error {
+	return s.repo.DeleteFailedEvent(id)
+}
+
+func (s *outboxServiceImpl) CountDeadLetters() (int64, error) {
+	return s.repo.CountFailedEvents()
+}
+
+// publish produces an outbox event and records the outcome on it.
+func (s *outboxServiceImpl) publish(event models.OutboxEvent) error {
+	return publishEvent(s.eventProducer, s.repo, event)
+}
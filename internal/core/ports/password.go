@@ -0,0 +1,222 @@
+package ports
+
+import (
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	PasswordBcrypt   = "bcrypt"
+	PasswordArgon2id = "argon2id"
+
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+)
+
+// PasswordPolicy is the policy of new passwords.
+type PasswordPolicy struct {
+	MinLength     int
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+	// Breached holds the BreachedPasswordKey of known breached passwords.
+	Breached map[string]struct{}
+}
+
+// PasswordPolicyError lists the rules of the policy a password breaks.
+type PasswordPolicyError struct {
+	Violations []string
+}
+
+func (e *PasswordPolicyError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrWeakPassword, strings.Join(e.Violations, ", "))
+}
+
+func (e *PasswordPolicyError) Unwrap() error {
+	return ErrWeakPassword
+}
+
+// BreachedPasswordKey is the upper case hex SHA-1 of password, the format of the
+// Have I Been Pwned password lists.
+func BreachedPasswordKey(password string) string {
+	hash := sha1.Sum([]byte(password))
+	return strings.ToUpper(hex.EncodeToString(hash[:]))
+}
+
+// Check returns a *PasswordPolicyError when password breaks the policy.
+func (p PasswordPolicy) Check(password string) error {
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			symbol = true
+		}
+	}
+
+	var violations []string
+	if len([]rune(password)) < p.MinLength {
+		violations = append(violations, fmt.Sprintf("at least %d characters", p.MinLength))
+	}
+	if p.RequireUpper && !upper {
+		violations = append(violations, "an upper case letter")
+	}
+	if p.RequireLower && !lower {
+		violations = append(violations, "a lower case letter")
+	}
+	if p.RequireDigit && !digit {
+		violations = append(violations, "a digit")
+	}
+	if p.RequireSymbol && !symbol {
+		violations = append(violations, "a symbol")
+	}
+	if _, breached := p.Breached[BreachedPasswordKey(password)]; breached {
+		violations = append(violations, "not found in a data breach")
+	}
+
+	if len(violations) > 0 {
+		return &PasswordPolicyError{Violations: violations}
+	}
+	return nil
+}
+
+// PasswordHashOptions selects the hash of new passwords, zero values take the defaults.
+type PasswordHashOptions struct {
+	// Algorithm is bcrypt (default) or argon2id.
+	Algorithm  string
+	BcryptCost int
+	// Argon2Memory is in KiB.
+	Argon2Time    uint32
+	Argon2Memory  uint32
+	Argon2Threads uint8
+}
+
+func (o PasswordHashOptions) withDefaults() PasswordHashOptions {
+	if o.Algorithm == "" {
+		o.Algorithm = PasswordBcrypt
+	}
+	if o.BcryptCost == 0 {
+		o.BcryptCost = bcrypt.DefaultCost
+	}
+	// OWASP minimum for argon2id
+	if o.Argon2Time == 0 {
+		o.Argon2Time = 2
+	}
+	if o.Argon2Memory == 0 {
+		o.Argon2Memory = 19 * 1024
+	}
+	if o.Argon2Threads == 0 {
+		o.Argon2Threads = 1
+	}
+	return o
+}
+
+// HashPassword hashes password with the algorithm of options.
+func HashPassword(password string, options PasswordHashOptions) (string, error) {
+	options = options.withDefaults()
+
+	switch options.Algorithm {
+	case PasswordBcrypt:
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), options.BcryptCost)
+		if err != nil {
+			return "", err
+		}
+		return string(hash), nil
+	case PasswordArgon2id:
+		salt := make([]byte, argon2SaltLength)
+		if _, err := rand.Read(salt); err != nil {
+			return "", err
+		}
+		params := argon2Params{time: options.Argon2Time, memory: options.Argon2Memory, threads: options.Argon2Threads}
+		key := argon2.IDKey([]byte(password), salt, params.time, params.memory, params.threads, argon2KeyLength)
+		return params.encode(salt, key), nil
+	}
+	return "", fmt.Errorf("unknown password hash %q", options.Algorithm)
+}
+
+// VerifyPassword compares password with a bcrypt or argon2id hash.
+func VerifyPassword(hash string, password string) error {
+	if !strings.HasPrefix(hash, "$"+PasswordArgon2id+"$") {
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	}
+
+	params, salt, key, err := decodeArgon2(hash)
+	if err != nil {
+		return err
+	}
+	other := argon2.IDKey([]byte(password), salt, params.time, params.memory, params.threads, uint32(len(key)))
+	if subtle.ConstantTimeCompare(key, other) != 1 {
+		return bcrypt.ErrMismatchedHashAndPassword
+	}
+	return nil
+}
+
+// PasswordNeedsRehash reports whether hash was made with another algorithm or
+// other parameters than options.
+func PasswordNeedsRehash(hash string, options PasswordHashOptions) bool {
+	options = options.withDefaults()
+
+	switch options.Algorithm {
+	case PasswordBcrypt:
+		cost, err := bcrypt.Cost([]byte(hash))
+		return err != nil || cost != options.BcryptCost
+	case PasswordArgon2id:
+		params, _, _, err := decodeArgon2(hash)
+		return err != nil || params != argon2Params{time: options.Argon2Time, memory: options.Argon2Memory, threads: options.Argon2Threads}
+	}
+	return false
+}
+
+type argon2Params struct {
+	time    uint32
+	memory  uint32
+	threads uint8
+}
+
+// encode returns the PHC string of an argon2id hash, e.g. "$argon2id$v=19$m=19456,t=2,p=1$<salt>$<key>".
+func (p argon2Params) encode(salt []byte, key []byte) string {
+	return fmt.Sprintf("$%s$v=%d$m=%d,t=%d,p=%d$%s$%s", PasswordArgon2id, argon2.Version, p.memory, p.time, p.threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+}
+
+func decodeArgon2(hash string) (argon2Params, []byte, []byte, error) {
+	errInvalid := errors.New("invalid argon2id hash")
+
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != PasswordArgon2id {
+		return argon2Params{}, nil, nil, errInvalid
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return argon2Params{}, nil, nil, errInvalid
+	}
+	var params argon2Params
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.time, &params.threads); err != nil {
+		return argon2Params{}, nil, nil, errInvalid
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return argon2Params{}, nil, nil, errInvalid
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return argon2Params{}, nil, nil, errInvalid
+	}
+	return params, salt, key, nil
+}
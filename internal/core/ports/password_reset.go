@@ -0,0 +1,118 @@
+package ports
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/WarisLi/Golang-mini-project/internal/core/models"
+	"gorm.io/gorm"
+)
+
+const passwordResetTokenLength = 32
+
+func (s *userServiceImpl) RequestPasswordReset(username string) error {
+	user, err := s.repo.GetUser(username)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if user.Disabled || user.ServiceAccount || user.IdentityProvider != "" {
+		return nil
+	}
+
+	// The token is created and sent in the background, the response of a user
+	// would otherwise take longer than the response of an unknown user.
+	s.passwordResets.Add(1)
+	go func() {
+		defer s.passwordResets.Done()
+
+		if err := s.sendPasswordReset(*user); err != nil {
+			log.Printf("Password reset of %s failed %s\n", user.Username, err)
+		}
+	}()
+	return nil
+}
+
+func (s *userServiceImpl) Wait() {
+	s.passwordResets.Wait()
+}
+
+// sendPasswordReset creates a reset token of the user and notifies the user of it.
+func (s *userServiceImpl) sendPasswordReset(user models.User) error {
+	now := time.Now()
+	if err := s.passwordReset.DeleteExpiredPasswordResetTokens(now); err != nil {
+		log.Printf("Delete expired password reset tokens failed %s\n", err)
+	}
+
+	secret := make([]byte, passwordResetTokenLength)
+	if _, err := rand.Read(secret); err != nil {
+		return err
+	}
+	token := base64.RawURLEncoding.EncodeToString(secret)
+
+	err := s.passwordReset.CreatePasswordResetToken(models.PasswordResetToken{
+		TokenHash: passwordResetTokenHash(token),
+		Username:  user.Username,
+		CreatedAt: now,
+		ExpiresAt: now.Add(s.options.PasswordResetTTL),
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.notifier.Notify(models.Notification{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("A password reset was requested for %s. Reset your password within %s with:\n\n%s%s\n\n"+
+			"Ignore this message if you did not request it.", user.Username, s.options.PasswordResetTTL, s.options.PasswordResetURL, token),
+	})
+}
+
+func (s *userServiceImpl) ResetPassword(reset models.ResetPassword) error {
+	// The password is checked first so that a rejected password does not use the token
+	if err := s.options.PasswordPolicy.Check(reset.NewPassword); err != nil {
+		return err
+	}
+
+	tokenHash := passwordResetTokenHash(reset.Token)
+	token, err := s.passwordReset.GetPasswordResetToken(tokenHash)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrInvalidResetToken
+	}
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	if token.UsedAt != nil || !token.ExpiresAt.After(now) {
+		return ErrInvalidResetToken
+	}
+	if err := s.passwordReset.UsePasswordResetToken(tokenHash, now); err != nil {
+		return err
+	}
+
+	user, err := s.repo.GetUser(token.Username)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrInvalidResetToken
+	}
+	if err != nil {
+		return err
+	}
+	// The user was linked to an identity provider after the token was sent
+	if user.IdentityProvider != "" {
+		return ErrInvalidResetToken
+	}
+	return s.setPassword(user, reset.NewPassword)
+}
+
+func passwordResetTokenHash(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
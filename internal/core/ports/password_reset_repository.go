@@ -0,0 +1,16 @@
+package ports
+
+import (
+	"time"
+
+	"github.com/WarisLi/Golang-mini-project/internal/core/models"
+)
+
+type PasswordResetRepository interface {
+	CreatePasswordResetToken(token models.PasswordResetToken) error
+	GetPasswordResetToken(tokenHash string) (*models.PasswordResetToken, error)
+	// UsePasswordResetToken marks the token used, it returns ErrInvalidResetToken when it already was.
+	UsePasswordResetToken(tokenHash string, usedAt time.Time) error
+	DeleteExpiredPasswordResetTokens(now time.Time) error
+	DeleteUserPasswordResetTokens(username string) error
+}
@@ -0,0 +1,164 @@
+package ports
+
+import (
+	"errors"
+	"fmt"
+
+	events "github.com/WarisLi/Golang-shared-events"
+	"github.com/go-playground/validator/v10"
+
+	"github.com/WarisLi/Golang-mini-project/internal/core/models"
+)
+
+// BatchProducts applies the operations of a batch request. An atomic batch is
+// applied in one unit of work and fails as a whole; otherwise every operation is
+// applied in its own. The events of the products affected are saved in the outbox
+// in the same unit of work and published once it is committed.
+func (s *productServiceImpl) BatchProducts(request models.ProductBatchRequest) (*models.ProductBatchResponse, error) {
+	if len(request.Operations) > s.options.MaxBatchSize {
+		return nil, fmt.Errorf("%w: %d operations, the maximum is %d", ErrBatchTooLarge, len(request.Operations), s.options.MaxBatchSize)
+	}
+
+	response := &models.ProductBatchResponse{
+		Atomic:  request.Atomic,
+		Results: make([]models.ProductBatchResult, len(request.Operations)),
+	}
+
+	validate := validator.New()
+	operations := make([]models.ProductOperation, len(request.Operations))
+	invalid := false
+	for i, batchOperation := range request.Operations {
+		response.Results[i] = models.ProductBatchResult{Index: i, Op: batchOperation.Op, ID: batchOperation.ID}
+
+		operation, err := productOperation(validate, batchOperation)
+		if err != nil {
+			response.Results[i].Error = err.Error()
+			invalid = true
+			continue
+		}
+		operations[i] = operation
+	}
+
+	if request.Atomic {
+		return s.applyAtomic(response, operations, invalid)
+	}
+
+	for i, operation := range operations {
+		if response.Results[i].Error != "" {
+			continue
+		}
+
+		products, err := s.applyOperations([]models.ProductOperation{operation})
+		var operationErr *BatchOperationError
+		if errors.As(err, &operationErr) {
+			response.Results[i].Error = operationErr.Err.Error()
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		response.Results[i].ID = products[0].ID
+		response.Results[i].Success = true
+	}
+
+	return response.Count(), nil
+}
+
+func (s *productServiceImpl) applyAtomic(response *models.ProductBatchResponse, operations []models.ProductOperation, invalid bool) (*models.ProductBatchResponse, error) {
+	if invalid {
+		return response.Count(), nil
+	}
+
+	products, err := s.applyOperations(operations)
+	var operationErr *BatchOperationError
+	if errors.As(err, &operationErr) {
+		response.Results[operationErr.Index].Error = operationErr.Err.Error()
+		return response.Count(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for i, product := range products {
+		response.Results[i].ID = product.ID
+		response.Results[i].Success = true
+	}
+
+	return response.Count(), nil
+}
+
+// applyOperations applies operations and saves the events of the products in one
+// unit of work, the events are published once it is committed.
+func (s *productServiceImpl) applyOperations(operations []models.ProductOperation) ([]models.Product, error) {
+	var products []models.Product
+	var outboxEvents []models.OutboxEvent
+	err := s.unitOfWork.Do(func(repos TransactionRepositories) error {
+		var err error
+		products, err = repos.Product.ApplyProductOperations(operations)
+		if err != nil {
+			return err
+		}
+
+		var pending []events.Event
+		for i, product := range products {
+			pending = append(pending, operationEvents(operations[i].Op, product)...)
+		}
+		outboxEvents, err = saveEvents(repos.Outbox, pending...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	publishEvents(s.eventProducer, s.outboxRepo, outboxEvents)
+	return products, nil
+}
+
+// productOperation validates a batch operation and converts it to a repository operation.
+func productOperation(validate *validator.Validate, operation models.ProductBatchOperation) (models.ProductOperation, error) {
+	switch operation.Op {
+	case models.ProductOperationCreate, models.ProductOperationUpdate:
+		if operation.Op == models.ProductOperationUpdate && operation.ID == 0 {
+			return models.ProductOperation{}, errors.New("id is required")
+		}
+		if operation.Product == nil {
+			return models.ProductOperation{}, errors.New("product is required")
+		}
+		if err := validate.Struct(operation.Product); err != nil {
+			return models.ProductOperation{}, err
+		}
+
+		return models.ProductOperation{
+			Op: operation.Op,
+			Product: models.Product{
+				ID:          operation.ID,
+				Name:        operation.Product.Name,
+				Quantity:    operation.Product.Quantity,
+				Category:    operation.Product.Category,
+				SKU:         operation.Product.SKU,
+				Description: operation.Product.Description,
+			},
+		}, nil
+	case models.ProductOperationDelete:
+		if operation.ID == 0 {
+			return models.ProductOperation{}, errors.New("id is required")
+		}
+		return models.ProductOperation{Op: operation.Op, Product: models.Product{ID: operation.ID}}, nil
+	}
+
+	return models.ProductOperation{}, fmt.Errorf("unknown operation %q", operation.Op)
+}
+
+// operationEvents are the events of a product after an operation.
+func operationEvents(op string, product models.Product) []events.Event {
+	switch op {
+	case models.ProductOperationCreate:
+		return []events.Event{createdEvent(product)}
+	case models.ProductOperationUpdate:
+		return updateEvents(product)
+	case models.ProductOperationDelete:
+		return []events.Event{models.ProductDeletedEvent{ID: product.ID}}
+	}
+	return nil
+}
@@ -7,7 +7,13 @@ import (
 type ProductRepository interface {
 	GetAll() ([]models.Product, error)
 	GetOne(id uint) (*models.Product, error)
-	Save(product models.Product) error
+	// GetPage returns a page of the products ordered by ID and the total number of products.
+	GetPage(request models.PageRequest) ([]models.Product, int64, error)
+	Save(product models.Product) (uint, error)
+	// Update and Delete return gorm.ErrRecordNotFound when the product does not exist or was deleted.
 	Update(product models.Product) error
 	Delete(id uint) error
+	// ApplyProductOperations applies the operations in one transaction and returns
+	// the products they affected. A failing operation is reported as a *BatchOperationError.
+	ApplyProductOperations(operations []models.ProductOperation) ([]models.Product, error)
 }
@@ -0,0 +1,47 @@
+package ports
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/WarisLi/Golang-mini-project/internal/core/models"
+)
+
+// maxSearchQueryLength is the maximum length of a search query.
+const maxSearchQueryLength = 200
+
+// ProductSearcher is a search engine over the products. It returns a page of
+// the matching products, best matches first, and the total number of matches.
+type ProductSearcher interface {
+	SearchProducts(query models.ProductSearchQuery) ([]models.ProductSearchResult, int64, error)
+}
+
+type ProductSearchService interface {
+	SearchProducts(query models.ProductSearchQuery) (*models.Page[models.ProductSearchResult], error)
+}
+
+type productSearchServiceImpl struct {
+	searcher ProductSearcher
+}
+
+func NewProductSearchService(searcher ProductSearcher) ProductSearchService {
+	return &productSearchServiceImpl{searcher: searcher}
+}
+
+func (s *productSearchServiceImpl) SearchProducts(query models.ProductSearchQuery) (*models.Page[models.ProductSearchResult], error) {
+	query.Query = strings.TrimSpace(query.Query)
+	if query.Query == "" {
+		return nil, fmt.Errorf("%w: empty query", ErrInvalidSearch)
+	}
+	if len(query.Query) > maxSearchQueryLength {
+		return nil, fmt.Errorf("%w: query longer than %d characters", ErrInvalidSearch, maxSearchQueryLength)
+	}
+	query.PageRequest = query.PageRequest.Normalize()
+
+	results, total, err := s.searcher.SearchProducts(query)
+	if err != nil {
+		return nil, err
+	}
+
+	return models.NewPage(results, total, query.PageRequest), nil
+}
@@ -1,12 +1,14 @@
 package ports
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
 
 	events "github.com/WarisLi/Golang-shared-events"
+	jsonpatch "github.com/evanphx/json-patch/v5"
+	"github.com/go-playground/validator/v10"
 
 	"github.com/WarisLi/Golang-mini-project/internal/adapters/producer"
 	"github.com/WarisLi/Golang-mini-project/internal/core/models"
@@ -14,21 +16,45 @@ import (
 
 type ProductService interface {
 	GetProducts() ([]models.Product, error)
+	ListProducts(request models.PageRequest) (*models.Page[models.Product], error)
 	GetProduct(id uint) (*models.Product, error)
 	CreateProduct(productInput models.ProductInput) error
+	// ImportProducts creates products in one unit of work, their quantity can be zero.
+	ImportProducts(productFields []models.ProductFields) error
 	UpdateProduct(id uint, productInput models.ProductInput) error
+	// MergePatchProduct applies a JSON Merge Patch (RFC 7396) to a product.
+	MergePatchProduct(id uint, patch []byte) (*models.Product, error)
+	// JSONPatchProduct applies a JSON Patch (RFC 6902) to a product.
+	JSONPatchProduct(id uint, patch []byte) (*models.Product, error)
+	BatchProducts(request models.ProductBatchRequest) (*models.ProductBatchResponse, error)
 	DeleteProduct(id uint) error
 }
 
+type ProductServiceOptions struct {
+	// MaxBatchSize is the maximum number of operations of a batch request.
+	MaxBatchSize int
+}
+
 type productServiceImpl struct {
 	repo          ProductRepository
+	unitOfWork    UnitOfWork
 	eventProducer producer.EventProducer
+	outboxRepo    OutboxRepository
+	options       ProductServiceOptions
 }
 
-func NewProductService(repo ProductRepository, eventProducer producer.EventProducer) ProductService {
+func NewProductService(repo ProductRepository, unitOfWork UnitOfWork, eventProducer producer.EventProducer, outboxRepo OutboxRepository,
+	options ProductServiceOptions) ProductService {
+	if options.MaxBatchSize <= 0 {
+		options.MaxBatchSize = 1000
+	}
+
 	return &productServiceImpl{
 		repo:          repo,
+		unitOfWork:    unitOfWork,
 		eventProducer: eventProducer,
+		outboxRepo:    outboxRepo,
+		options:       options,
 	}
 }
 
@@ -41,6 +67,17 @@ func (s *productServiceImpl) GetProducts() ([]models.Product, error) {
 	return products, nil
 }
 
+func (s *productServiceImpl) ListProducts(request models.PageRequest) (*models.Page[models.Product], error) {
+	request = request.Normalize()
+
+	products, total, err := s.repo.GetPage(request)
+	if err != nil {
+		return nil, err
+	}
+
+	return models.NewPage(products, total, request), nil
+}
+
 func (s *productServiceImpl) GetProduct(id uint) (*models.Product, error) {
 	product, err := s.repo.GetOne(id)
 	if err != nil {
@@ -70,13 +107,80 @@ func (s *productServiceImpl) CreateProduct(productInput models.ProductInput) err
 		return err
 	}
 
-	if err := s.repo.Save(product); err != nil {
+	// The created event is saved in the outbox with the product
+	var outboxEvents []models.OutboxEvent
+	err = s.unitOfWork.Do(func(repos TransactionRepositories) error {
+		id, err := repos.Product.Save(product)
+		if err != nil {
+			return err
+		}
+
+		product.ID = id
+		outboxEvents, err = saveEvents(repos.Outbox, createdEvent(product))
+		return err
+	})
+	if err != nil {
 		return err
 	}
 
+	publishEvents(s.eventProducer, s.outboxRepo, outboxEvents)
 	return nil
 }
 
+// ImportProducts creates the products of an import, unlike CreateProduct their
+// quantity can be zero so that an export can be imported again. The products are
+// created in one unit of work with their created events, an import fails as a
+// whole with the *BatchOperationError of the product at fault.
+func (s *productServiceImpl) ImportProducts(productFields []models.ProductFields) error {
+	validate := validator.New()
+	for i, fields := range productFields {
+		if err := validate.Struct(fields); err != nil {
+			return &BatchOperationError{Index: i, Err: fmt.Errorf("%w: %s", ErrInvalidProduct, err)}
+		}
+	}
+
+	var outboxEvents []models.OutboxEvent
+	err := s.unitOfWork.Do(func(repos TransactionRepositories) error {
+		createdEvents := make([]events.Event, 0, len(productFields))
+		for i, fields := range productFields {
+			product := models.Product{
+				Name:        fields.Name,
+				Quantity:    fields.Quantity,
+				Category:    fields.Category,
+				SKU:         fields.SKU,
+				Description: fields.Description,
+			}
+			id, err := repos.Product.Save(product)
+			if err != nil {
+				return &BatchOperationError{Index: i, Err: err}
+			}
+
+			product.ID = id
+			createdEvents = append(createdEvents, createdEvent(product))
+		}
+
+		var err error
+		outboxEvents, err = saveEvents(repos.Outbox, createdEvents...)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	publishEvents(s.eventProducer, s.outboxRepo, outboxEvents)
+	return nil
+}
+
+// createdEvent is the created event of a product.
+func createdEvent(product models.Product) events.Event {
+	return models.ProductCreatedEvent{
+		ID:       product.ID,
+		Name:     product.Name,
+		Quantity: product.Quantity,
+		Category: product.Category,
+	}
+}
+
 func (s *productServiceImpl) UpdateProduct(id uint, productInput models.ProductInput) error {
 	if productInput.Quantity <= 0 {
 		return errors.New("quantity must be positive")
@@ -99,28 +203,151 @@ func (s *productServiceImpl) UpdateProduct(id uint, productInput models.ProductI
 
 	product.ID = id
 
-	if err := s.repo.Update(product); err != nil {
-		return err
+	return s.update(product)
+}
+
+func (s *productServiceImpl) MergePatchProduct(id uint, patch []byte) (*models.Product, error) {
+	return s.patch(id, func(document []byte) ([]byte, error) {
+		return jsonpatch.MergePatch(document, patch)
+	})
+}
+
+func (s *productServiceImpl) JSONPatchProduct(id uint, patch []byte) (*models.Product, error) {
+	operations, err := jsonpatch.DecodePatch(patch)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidPatch, err)
 	}
 
-	if product.Quantity < 100 {
-		event := events.LowProductQuantityNotificationEvent{
-			Name:     product.Name,
-			Quantity: product.Quantity,
-		}
-		err := s.eventProducer.Produce(event)
+	return s.patch(id, operations.Apply)
+}
+
+// patch applies a patch to the JSON document of the product fields, validates
+// the patched fields and saves them, zero values included. The product is read
+// locked and saved in one unit of work, its update events are saved in the
+// outbox with it and published once it is committed.
+func (s *productServiceImpl) patch(id uint, apply func(document []byte) ([]byte, error)) (*models.Product, error) {
+	var product *models.Product
+	var outboxEvents []models.OutboxEvent
+	err := s.unitOfWork.Do(func(repos TransactionRepositories) error {
+		var err error
+		product, err = patchProduct(repos.Product, id, apply)
 		if err != nil {
-			log.Println(err)
+			return err
 		}
+
+		outboxEvents, err = saveEvents(repos.Outbox, updateEvents(*product)...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	publishEvents(s.eventProducer, s.outboxRepo, outboxEvents)
+	return product, nil
+}
+
+func patchProduct(repo ProductRepository, id uint, apply func(document []byte) ([]byte, error)) (*models.Product, error) {
+	product, err := repo.GetOne(id)
+	if err != nil {
+		return nil, err
+	}
+
+	document, err := json.Marshal(models.ProductFields{
+		Name:        product.Name,
+		Quantity:    product.Quantity,
+		Category:    product.Category,
+		SKU:         product.SKU,
+		Description: product.Description,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	patched, err := apply(document)
+	if errors.Is(err, jsonpatch.ErrTestFailed) {
+		return nil, fmt.Errorf("%w: %s", ErrPatchTestFailed, err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidPatch, err)
+	}
+
+	var fields models.ProductFields
+	decoder := json.NewDecoder(bytes.NewReader(patched))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&fields); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidProduct, err)
+	}
+	if err := validator.New().Struct(fields); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidProduct, err)
+	}
+
+	product.Name = fields.Name
+	product.Quantity = fields.Quantity
+	product.Category = fields.Category
+	product.SKU = fields.SKU
+	product.Description = fields.Description
+	if err := repo.Update(*product); err != nil {
+		return nil, err
+	}
+
+	return product, nil
+}
+
+// update saves a product and its update events in one unit of work, the events
+// are published once it is committed.
+func (s *productServiceImpl) update(product models.Product) error {
+	var outboxEvents []models.OutboxEvent
+	err := s.unitOfWork.Do(func(repos TransactionRepositories) error {
+		if err := repos.Product.Update(product); err != nil {
+			return err
+		}
+
+		var err error
+		outboxEvents, err = saveEvents(repos.Outbox, updateEvents(product)...)
+		return err
+	})
+	if err != nil {
+		return err
 	}
 
+	publishEvents(s.eventProducer, s.outboxRepo, outboxEvents)
 	return nil
 }
 
+// updateEvents are the update event of a product and the low quantity
+// notification when its quantity is under the threshold.
+func updateEvents(product models.Product) []events.Event {
+	updateEvents := []events.Event{models.ProductUpdatedEvent{
+		ID:       product.ID,
+		Name:     product.Name,
+		Quantity: product.Quantity,
+		Category: product.Category,
+	}}
+
+	if product.Quantity < lowQuantityThreshold {
+		updateEvents = append(updateEvents, events.LowProductQuantityNotificationEvent{
+			Name:     product.Name,
+			Quantity: product.Quantity,
+		})
+	}
+	return updateEvents
+}
+
 func (s *productServiceImpl) DeleteProduct(id uint) error {
-	if err := s.repo.Delete(id); err != nil {
+	var outboxEvents []models.OutboxEvent
+	err := s.unitOfWork.Do(func(repos TransactionRepositories) error {
+		if err := repos.Product.Delete(id); err != nil {
+			return err
+		}
+
+		var err error
+		outboxEvents, err = saveEvents(repos.Outbox, models.ProductDeletedEvent{ID: id})
+		return err
+	})
+	if err != nil {
 		return err
 	}
 
+	publishEvents(s.eventProducer, s.outboxRepo, outboxEvents)
 	return nil
 }
@@ -0,0 +1,202 @@
+package ports
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	events "github.com/WarisLi/Golang-shared-events"
+
+	"github.com/WarisLi/Golang-mini-project/internal/adapters/producer"
+	"github.com/WarisLi/Golang-mini-project/internal/core/models"
+)
+
+type ProductStreamOptions struct {
+	// HistorySize is the number of recent events kept to resume a stream from its last event ID.
+	HistorySize int
+	// BufferSize is the number of events buffered for each client. A client falling
+	// further behind is disconnected and has to resume from its last event ID.
+	BufferSize int
+	// SessionCheckInterval is how often the session of a client is checked again, its
+	// stream is closed once the session is invalidated.
+	SessionCheckInterval time.Duration
+}
+
+// ProductStreamSubscription receives the events of a stream client on Events,
+// which is closed when the subscription ends.
+type ProductStreamSubscription struct {
+	Events <-chan models.ProductStreamEvent
+
+	events chan models.ProductStreamEvent
+	filter models.ProductStreamFilter
+}
+
+// ProductStreamService is an event producer turning product changes into
+// stream events for the subscribed clients.
+type ProductStreamService interface {
+	// Subscribe starts a subscription and returns the events after lastEventID
+	// still in the history. A zero lastEventID starts with the next event.
+	Subscribe(filter models.ProductStreamFilter, lastEventID uint64) (*ProductStreamSubscription, []models.ProductStreamEvent)
+	Unsubscribe(subscription *ProductStreamSubscription)
+	Produce(event events.Event) error
+	ProduceMessage(topic string, value []byte) error
+}
+
+// productRef is what the stream knows about a product to match the filters
+// of the events that do not carry it.
+type productRef struct {
+	id       uint
+	name     string
+	category string
+}
+
+type productStreamServiceImpl struct {
+	options ProductStreamOptions
+
+	mu            sync.Mutex
+	lastID        uint64
+	history       []models.ProductStreamEvent
+	subscriptions map[*ProductStreamSubscription]struct{}
+	productsByID  map[uint]productRef
+	// productsByName resolves low quantity notifications, which only carry the product name.
+	productsByName map[string]productRef
+}
+
+func NewProductStreamService(options ProductStreamOptions) ProductStreamService {
+	if options.HistorySize <= 0 {
+		options.HistorySize = 1
+	}
+	if options.BufferSize <= 0 {
+		options.BufferSize = 1
+	}
+
+	return &productStreamServiceImpl{
+		options:        options,
+		subscriptions:  map[*ProductStreamSubscription]struct{}{},
+		productsByID:   map[uint]productRef{},
+		productsByName: map[string]productRef{},
+	}
+}
+
+func (s *productStreamServiceImpl) Subscribe(filter models.ProductStreamFilter, lastEventID uint64) (*ProductStreamSubscription, []models.ProductStreamEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ch := make(chan models.ProductStreamEvent, s.options.BufferSize)
+	subscription := &ProductStreamSubscription{Events: ch, events: ch, filter: filter}
+	s.subscriptions[subscription] = struct{}{}
+
+	var replay []models.ProductStreamEvent
+	if lastEventID == 0 {
+		return subscription, replay
+	}
+	// An ID ahead of the stream comes from before a restart, every kept event is new to the client.
+	if lastEventID > s.lastID {
+		lastEventID = 0
+	}
+	for _, event := range s.history {
+		if event.ID > lastEventID && filter.Match(event) {
+			replay = append(replay, event)
+		}
+	}
+	return subscription, replay
+}
+
+func (s *productStreamServiceImpl) Unsubscribe(subscription *ProductStreamSubscription) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.remove(subscription)
+}
+
+func (s *productStreamServiceImpl) remove(subscription *ProductStreamSubscription) {
+	if _, ok := s.subscriptions[subscription]; ok {
+		delete(s.subscriptions, subscription)
+		close(subscription.events)
+	}
+}
+
+func (s *productStreamServiceImpl) Produce(event events.Event) error {
+	value, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	return s.ProduceMessage(producer.TopicOf(event), value)
+}
+
+// ProduceMessage pushes product changes to the subscribed clients, other topics are ignored.
+func (s *productStreamServiceImpl) ProduceMessage(topic string, value []byte) error {
+	var product struct {
+		ID       uint   `json:"id"`
+		Name     string `json:"name"`
+		Category string `json:"category"`
+	}
+	var lowQuantity events.LowProductQuantityNotificationEvent
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var ref productRef
+	switch topic {
+	case producer.TopicOf(models.ProductCreatedEvent{}), producer.TopicOf(models.ProductUpdatedEvent{}):
+		if err := json.Unmarshal(value, &product); err != nil {
+			return err
+		}
+		ref = productRef{id: product.ID, name: product.Name, category: product.Category}
+		if previous, ok := s.productsByID[product.ID]; ok {
+			s.forget(previous)
+		}
+		s.productsByID[product.ID] = ref
+		s.productsByName[product.Name] = ref
+	case producer.TopicOf(models.ProductDeletedEvent{}):
+		if err := json.Unmarshal(value, &product); err != nil {
+			return err
+		}
+		ref = s.productsByID[product.ID]
+		ref.id = product.ID
+		s.forget(ref)
+	case producer.TopicOf(events.LowProductQuantityNotificationEvent{}):
+		if err := json.Unmarshal(value, &lowQuantity); err != nil {
+			return err
+		}
+		ref = s.productsByName[lowQuantity.Name]
+	default:
+		return nil
+	}
+
+	s.lastID++
+	event := models.ProductStreamEvent{
+		ID:        s.lastID,
+		Type:      topic,
+		ProductID: ref.id,
+		Category:  ref.category,
+		Data:      value,
+	}
+
+	s.history = append(s.history, event)
+	if len(s.history) > s.options.HistorySize {
+		s.history = s.history[len(s.history)-s.options.HistorySize:]
+	}
+
+	for subscription := range s.subscriptions {
+		if !subscription.filter.Match(event) {
+			continue
+		}
+		select {
+		case subscription.events <- event:
+		default:
+			// The client is too slow, it resumes from its last event ID after reconnecting
+			s.remove(subscription)
+		}
+	}
+
+	return nil
+}
+
+func (s *productStreamServiceImpl) forget(ref productRef) {
+	delete(s.productsByID, ref.id)
+	if named, ok := s.productsByName[ref.name]; ok && named.id == ref.id {
+		delete(s.productsByName, ref.name)
+	}
+}
@@ -0,0 +1,17 @@
+package ports
+
+import "time"
+
+// RateLimit is the state of a rate limit after a hit.
+type RateLimit struct {
+	Allowed   bool
+	Remaining int
+	// RetryAfter is the time left until the window of the limit resets.
+	RetryAfter time.Duration
+}
+
+// RateLimiter counts hits in fixed windows.
+type RateLimiter interface {
+	// Allow counts a hit on key and reports whether it is within limit hits per window.
+	Allow(key string, limit int, window time.Duration) (RateLimit, error)
+}
@@ -0,0 +1,12 @@
+package ports
+
+import (
+	"github.com/WarisLi/Golang-mini-project/internal/core/models"
+)
+
+type SigningKeyRepository interface {
+	CreateSigningKey(key models.SigningKey) error
+	// GetSigningKeys returns the keys ordered by ActivatesAt then ID.
+	GetSigningKeys() ([]models.SigningKey, error)
+	DeleteSigningKey(id uint) error
+}
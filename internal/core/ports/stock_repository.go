@@ -0,0 +1,12 @@
+package ports
+
+import (
+	"github.com/WarisLi/Golang-mini-project/internal/core/models"
+)
+
+type StockRepository interface {
+	// ApplyStockMovements atomically records eventID and applies the movements,
+	// returning the updated products. It returns ErrEventAlreadyProcessed when
+	// eventID was applied before.
+	ApplyStockMovements(eventID string, movements []models.StockMovement) ([]models.Product, error)
+}
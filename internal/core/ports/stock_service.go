@@ -0,0 +1,84 @@
+package ports
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	events "github.com/WarisLi/Golang-shared-events"
+
+	"github.com/WarisLi/Golang-mini-project/internal/adapters/producer"
+	"github.com/WarisLi/Golang-mini-project/internal/core/models"
+)
+
+type StockService interface {
+	HandleOrderPlaced(event models.OrderPlacedEvent) error
+	HandleOrderCancelled(event models.OrderCancelledEvent) error
+}
+
+type stockServiceImpl struct {
+	unitOfWork    UnitOfWork
+	eventProducer producer.EventProducer
+	outboxRepo    OutboxRepository
+}
+
+func NewStockService(unitOfWork UnitOfWork, eventProducer producer.EventProducer, outboxRepo OutboxRepository) StockService {
+	return &stockServiceImpl{
+		unitOfWork:    unitOfWork,
+		eventProducer: eventProducer,
+		outboxRepo:    outboxRepo,
+	}
+}
+
+func (s *stockServiceImpl) HandleOrderPlaced(event models.OrderPlacedEvent) error {
+	return s.applyOrder(event.EventID, event.Items, -1)
+}
+
+func (s *stockServiceImpl) HandleOrderCancelled(event models.OrderCancelledEvent) error {
+	return s.applyOrder(event.EventID, event.Items, 1)
+}
+
+// applyOrder moves the quantities of the order items in the given direction and
+// saves the events of the products in one unit of work. An event that was already
+// applied is ignored.
+func (s *stockServiceImpl) applyOrder(eventID string, items []models.OrderItem, direction int) error {
+	if eventID == "" {
+		return fmt.Errorf("%w: missing event id", ErrInvalidEvent)
+	}
+	if len(items) == 0 {
+		return fmt.Errorf("%w: no items", ErrInvalidEvent)
+	}
+
+	movements := make([]models.StockMovement, 0, len(items))
+	for _, item := range items {
+		if item.ProductID == 0 || item.Quantity <= 0 {
+			return fmt.Errorf("%w: invalid item %+v", ErrInvalidEvent, item)
+		}
+		movements = append(movements, models.StockMovement{ProductID: item.ProductID, Delta: direction * item.Quantity})
+	}
+
+	var outboxEvents []models.OutboxEvent
+	err := s.unitOfWork.Do(func(repos TransactionRepositories) error {
+		products, err := repos.Stock.ApplyStockMovements(eventID, movements)
+		if err != nil {
+			return err
+		}
+
+		var pending []events.Event
+		for _, product := range products {
+			pending = append(pending, updateEvents(product)...)
+		}
+		outboxEvents, err = saveEvents(repos.Outbox, pending...)
+		return err
+	})
+	if errors.Is(err, ErrEventAlreadyProcessed) {
+		log.Printf("Event %s already processed\n", eventID)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	publishEvents(s.eventProducer, s.outboxRepo, outboxEvents)
+	return nil
+}
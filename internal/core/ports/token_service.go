@@ -0,0 +1,545 @@
+package ports
+
+import (
+	"context"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/WarisLi/Golang-mini-project/internal/core/models"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	defaultTokenTTL            = 72 * time.Hour
+	defaultKeyRotationInterval = 30 * 24 * time.Hour
+	defaultKeyPublishLead      = time.Hour
+	defaultKeyCacheTTL         = time.Minute
+
+	// minKeyReload spaces the reloads of the keys for the tokens of unknown key IDs.
+	minKeyReload = time.Second
+	rsaKeyBits   = 2048
+
+	// KeyEncryptionKeySize is the size of the AES-256 key encrypting the private keys.
+	KeyEncryptionKeySize = 32
+	// encryptedKeyType is the PEM type of the encrypted private keys, the block is the
+	// AES-GCM nonce followed by the sealed PKCS #8 key. "PRIVATE KEY" blocks are not encrypted.
+	encryptedKeyType = "AES-256-GCM PRIVATE KEY"
+
+	// challengeTokenType and challengeAudience are the typ header and the aud claim of the
+	// two-factor challenge tokens, which are no access tokens for this service or the verifiers of the JWKS.
+	challengeTokenType = "2fa-challenge+jwt"
+	challengeAudience  = "two-factor-challenge"
+)
+
+// TokenService signs the access tokens with asymmetric keys and publishes their
+// public keys, so that other services verify the tokens without being able to sign them.
+type TokenService interface {
+	// SignToken returns an access token of the current session of user.
+	SignToken(user *models.User) (string, error)
+	// SignChallenge returns a two-factor challenge token of the login of user, expiring
+	// after ttl. Keyfunc refuses it.
+	SignChallenge(user *models.User, ttl time.Duration) (string, error)
+	// ParseChallenge returns the username, the session ID and the session version of a
+	// challenge token, ErrInvalidToken when it is no valid challenge token.
+	ParseChallenge(challengeToken string) (username string, sessionID string, sessionVersion int, err error)
+	// Keyfunc returns the public key verifying a token for jwt.Parse and the JWT
+	// middleware, once the algorithm, the key ID and the claims of the token are checked.
+	Keyfunc(token *jwt.Token) (interface{}, error)
+	// JWKS returns the public keys of the tokens, the next signing key included.
+	JWKS() (*models.JWKS, error)
+	// RotateKeys creates the next key when the current one signed for the rotation
+	// interval and deletes the keys whose tokens all expired.
+	RotateKeys() error
+	// RunKeyRotation rotates the keys every interval until ctx is done.
+	RunKeyRotation(ctx context.Context, interval time.Duration)
+}
+
+type TokenOptions struct {
+	// Algorithm of the new keys, models.AlgorithmRS256 or models.AlgorithmEdDSA. The
+	// keys of the other algorithm keep verifying their tokens.
+	Algorithm string
+	// Issuer and Audience are the iss and aud claims of the tokens.
+	Issuer   string
+	Audience string
+	// TTL is the lifetime of the tokens.
+	TTL time.Duration
+	// RotationInterval is how long a key signs the tokens.
+	RotationInterval time.Duration
+	// PublishLead is how long a new key is published before it signs, so that the
+	// verifiers caching the JWKS, and the other instances, know it before its first token.
+	PublishLead time.Duration
+	// KeyCacheTTL is how long the keys are cached before they are read again.
+	KeyCacheTTL time.Duration
+	// KeyEncryptionKey encrypts the private keys stored, KeyEncryptionKeySize bytes.
+	// The keys stored before it are read unencrypted until they are rotated out.
+	KeyEncryptionKey []byte
+}
+
+// tokenKey is a signing key and its parsed private key.
+type tokenKey struct {
+	models.SigningKey
+	private crypto.Signer
+	method  jwt.SigningMethod
+}
+
+type tokenServiceImpl struct {
+	repo      SigningKeyRepository
+	options   TokenOptions
+	validator *jwt.Validator
+	// challengeValidator checks the claims of the challenge tokens.
+	challengeValidator *jwt.Validator
+
+	mu       sync.Mutex
+	keys     []tokenKey
+	loadedAt time.Time
+	// rotateMu keeps concurrent first logins from creating a key each.
+	rotateMu sync.Mutex
+}
+
+func NewTokenService(repo SigningKeyRepository, options TokenOptions) TokenService {
+	if options.Algorithm == "" {
+		options.Algorithm = models.AlgorithmRS256
+	}
+	if options.TTL <= 0 {
+		options.TTL = defaultTokenTTL
+	}
+	if options.RotationInterval <= 0 {
+		options.RotationInterval = defaultKeyRotationInterval
+	}
+	if options.PublishLead <= 0 {
+		options.PublishLead = defaultKeyPublishLead
+	}
+	if options.KeyCacheTTL <= 0 {
+		options.KeyCacheTTL = defaultKeyCacheTTL
+	}
+	return &tokenServiceImpl{
+		repo:    repo,
+		options: options,
+		validator: jwt.NewValidator(jwt.WithIssuer(options.Issuer), jwt.WithAudience(options.Audience),
+			jwt.WithExpirationRequired(), jwt.WithIssuedAt()),
+		challengeValidator: jwt.NewValidator(jwt.WithIssuer(options.Issuer), jwt.WithAudience(challengeAudience),
+			jwt.WithExpirationRequired(), jwt.WithIssuedAt()),
+	}
+}
+
+func (s *tokenServiceImpl) SignToken(user *models.User) (string, error) {
+	now := time.Now()
+	key, err := s.signingKey(now)
+	if err != nil {
+		return "", err
+	}
+	tokenID, err := randomHex(16)
+	if err != nil {
+		return "", err
+	}
+
+	claims := jwt.MapClaims{
+		"iss":  s.options.Issuer,
+		"aud":  s.options.Audience,
+		"sub":  user.Username,
+		"jti":  tokenID,
+		"iat":  now.Unix(),
+		"exp":  now.Add(s.options.TTL).Unix(),
+		"role": user.Role,
+		"sid":  user.SessionID,
+		"ver":  user.SessionVersion,
+	}
+	token := jwt.NewWithClaims(key.method, claims)
+	token.Header["kid"] = key.KeyID
+	return token.SignedString(key.private)
+}
+
+func (s *tokenServiceImpl) SignChallenge(user *models.User, ttl time.Duration) (string, error) {
+	now := time.Now()
+	key, err := s.signingKey(now)
+	if err != nil {
+		return "", err
+	}
+
+	claims := jwt.MapClaims{
+		"iss": s.options.Issuer,
+		"aud": challengeAudience,
+		"sub": user.Username,
+		"iat": now.Unix(),
+		"exp": now.Add(ttl).Unix(),
+		"sid": user.SessionID,
+		"ver": user.SessionVersion,
+	}
+	token := jwt.NewWithClaims(key.method, claims)
+	token.Header["kid"] = key.KeyID
+	token.Header["typ"] = challengeTokenType
+	return token.SignedString(key.private)
+}
+
+func (s *tokenServiceImpl) ParseChallenge(challengeToken string) (string, string, int, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(challengeToken, claims, func(token *jwt.Token) (interface{}, error) {
+		if typ, _ := token.Header["typ"].(string); typ != challengeTokenType {
+			return nil, fmt.Errorf("%w: type %q", ErrInvalidToken, typ)
+		}
+		key, err := s.tokenKey(token)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.challengeValidator.Validate(claims); err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidToken, err)
+		}
+		return key.private.Public(), nil
+	})
+	if err != nil {
+		return "", "", 0, fmt.Errorf("%w: %s", ErrInvalidToken, err)
+	}
+
+	username, _ := claims.GetSubject()
+	sessionID, _ := claims["sid"].(string)
+	version, ok := claims["ver"].(float64)
+	if username == "" || !ok {
+		return "", "", 0, fmt.Errorf("%w: no subject or version", ErrInvalidToken)
+	}
+	return username, sessionID, int(version), nil
+}
+
+// signingKey returns the key signing the tokens at now, the first key is created
+// when there is none.
+func (s *tokenServiceImpl) signingKey(now time.Time) (*tokenKey, error) {
+	keys, err := s.loadKeys(s.options.KeyCacheTTL)
+	if err != nil {
+		return nil, err
+	}
+	if key := activeKey(keys, now); key != nil {
+		return key, nil
+	}
+
+	if err := s.RotateKeys(); err != nil {
+		return nil, err
+	}
+	keys, err = s.loadKeys(s.options.KeyCacheTTL)
+	if err != nil {
+		return nil, err
+	}
+	if key := activeKey(keys, time.Now()); key != nil {
+		return key, nil
+	}
+	return nil, errors.New("no signing key")
+}
+
+func (s *tokenServiceImpl) Keyfunc(token *jwt.Token) (interface{}, error) {
+	// The challenge tokens are signed with the same keys
+	if typ, ok := token.Header["typ"].(string); ok && typ != "JWT" {
+		return nil, fmt.Errorf("%w: type %q", ErrInvalidToken, typ)
+	}
+	key, err := s.tokenKey(token)
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+	if err := s.validator.Validate(claims); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidToken, err)
+	}
+	if subject, _ := claims.GetSubject(); subject == "" {
+		return nil, fmt.Errorf("%w: no subject", ErrInvalidToken)
+	}
+
+	return key.private.Public(), nil
+}
+
+// tokenKey returns the key of the kid of token, whose algorithm has to be the one of the key.
+func (s *tokenServiceImpl) tokenKey(token *jwt.Token) (*tokenKey, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, err := s.verifyingKey(kid)
+	if err != nil {
+		return nil, err
+	}
+	// The algorithm is the one of the key, a token cannot pick another one
+	if token.Method.Alg() != key.Algorithm {
+		return nil, fmt.Errorf("%w: algorithm %s", ErrInvalidToken, token.Method.Alg())
+	}
+	return key, nil
+}
+
+// verifyingKey returns the key of kid. The keys are read again for an unknown key
+// ID, which may be a key created by another instance.
+func (s *tokenServiceImpl) verifyingKey(kid string) (*tokenKey, error) {
+	for _, maxAge := range []time.Duration{s.options.KeyCacheTTL, minKeyReload} {
+		keys, err := s.loadKeys(maxAge)
+		if err != nil {
+			return nil, err
+		}
+		for i := range keys {
+			if keys[i].KeyID == kid {
+				return &keys[i], nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("%w: unknown key ID %q", ErrInvalidToken, kid)
+}
+
+func (s *tokenServiceImpl) JWKS() (*models.JWKS, error) {
+	keys, err := s.loadKeys(s.options.KeyCacheTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	jwks := &models.JWKS{Keys: make([]models.JWK, 0, len(keys))}
+	for _, key := range keys {
+		jwks.Keys = append(jwks.Keys, key.jwk())
+	}
+	return jwks, nil
+}
+
+func (s *tokenServiceImpl) RotateKeys() error {
+	s.rotateMu.Lock()
+	defer s.rotateMu.Unlock()
+
+	keys, err := s.loadKeys(0)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+
+	switch {
+	// The first key signs at once, no verifier can know it before the first token anyway
+	case activeKey(keys, now) == nil:
+		if err := s.createKey(now); err != nil {
+			return err
+		}
+	case !now.Before(keys[len(keys)-1].ActivatesAt.Add(s.options.RotationInterval - s.options.PublishLead)):
+		if err := s.createKey(now.Add(s.options.PublishLead)); err != nil {
+			return err
+		}
+	}
+
+	// A key signs until the next key is active, its tokens expire a TTL later.
+	// The instances with stale keys may sign with it for a KeyCacheTTL longer.
+	for i := 0; i+1 < len(keys); i++ {
+		signedUntil := keys[i+1].ActivatesAt
+		if signedUntil.Add(s.options.TTL + s.options.KeyCacheTTL).Before(now) {
+			if err := s.repo.DeleteSigningKey(keys[i].ID); err != nil {
+				return err
+			}
+			log.Printf("Signing key %s deleted\n", keys[i].KeyID)
+		}
+	}
+
+	_, err = s.loadKeys(0)
+	return err
+}
+
+func (s *tokenServiceImpl) RunKeyRotation(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.RotateKeys(); err != nil {
+			log.Printf("Signing key rotation failed %s\n", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *tokenServiceImpl) createKey(activatesAt time.Time) error {
+	key, err := newSigningKey(s.options.Algorithm, s.options.KeyEncryptionKey)
+	if err != nil {
+		return err
+	}
+	key.ActivatesAt = activatesAt
+	if err := s.repo.CreateSigningKey(*key); err != nil {
+		return err
+	}
+
+	log.Printf("Signing key %s created, signing from %s\n", key.KeyID, activatesAt.Format(time.RFC3339))
+	return nil
+}
+
+// loadKeys returns the cached keys, read again when they were read more than maxAge ago.
+// The keys which cannot be parsed are left out.
+func (s *tokenServiceImpl) loadKeys(maxAge time.Duration) ([]tokenKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.keys != nil && time.Since(s.loadedAt) < maxAge {
+		return s.keys, nil
+	}
+
+	stored, err := s.repo.GetSigningKeys()
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]tokenKey, 0, len(stored))
+	for _, key := range stored {
+		parsed, err := parseSigningKey(key, s.options.KeyEncryptionKey)
+		if err != nil {
+			log.Printf("Signing key %s skipped %s\n", key.KeyID, err)
+			continue
+		}
+		keys = append(keys, *parsed)
+	}
+	s.keys = keys
+	s.loadedAt = time.Now()
+	return keys, nil
+}
+
+// activeKey returns the key signing at now, the last one activated, nil when there is none.
+func activeKey(keys []tokenKey, now time.Time) *tokenKey {
+	for i := len(keys) - 1; i >= 0; i-- {
+		if !keys[i].ActivatesAt.After(now) {
+			return &keys[i]
+		}
+	}
+	return nil
+}
+
+// newSigningKey returns a new key of algorithm with its private key encrypted by
+// keyEncryptionKey, ActivatesAt is left to the caller.
+func newSigningKey(algorithm string, keyEncryptionKey []byte) (*models.SigningKey, error) {
+	var private crypto.Signer
+	var err error
+	switch algorithm {
+	case models.AlgorithmRS256:
+		private, err = rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	case models.AlgorithmEdDSA:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, fmt.Errorf("unknown signing algorithm %q", algorithm)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, err
+	}
+	keyID, err := randomHex(8)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := encryptPrivateKey(keyEncryptionKey, keyID, der)
+	if err != nil {
+		return nil, err
+	}
+	return &models.SigningKey{
+		KeyID:      keyID,
+		Algorithm:  algorithm,
+		PrivateKey: string(pem.EncodeToMemory(&pem.Block{Type: encryptedKeyType, Bytes: sealed})),
+	}, nil
+}
+
+func parseSigningKey(key models.SigningKey, keyEncryptionKey []byte) (*tokenKey, error) {
+	block, _ := pem.Decode([]byte(key.PrivateKey))
+	if block == nil {
+		return nil, errors.New("no PEM private key")
+	}
+	der := block.Bytes
+	if block.Type == encryptedKeyType {
+		var err error
+		if der, err = decryptPrivateKey(keyEncryptionKey, key.KeyID, block.Bytes); err != nil {
+			return nil, err
+		}
+	}
+	private, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+
+	var method jwt.SigningMethod
+	switch private.(type) {
+	case *rsa.PrivateKey:
+		method = jwt.SigningMethodRS256
+	case ed25519.PrivateKey:
+		method = jwt.SigningMethodEdDSA
+	}
+	if method == nil || method.Alg() != key.Algorithm {
+		return nil, fmt.Errorf("private key is not a %s key", key.Algorithm)
+	}
+	return &tokenKey{SigningKey: key, private: private.(crypto.Signer), method: method}, nil
+}
+
+// keyCipher returns the AES-GCM cipher of the key encryption key.
+func keyCipher(keyEncryptionKey []byte) (cipher.AEAD, error) {
+	if len(keyEncryptionKey) != KeyEncryptionKeySize {
+		return nil, fmt.Errorf("the key encryption key has %d bytes instead of %d", len(keyEncryptionKey), KeyEncryptionKeySize)
+	}
+	block, err := aes.NewCipher(keyEncryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encryptPrivateKey seals a private key, bound to its key ID so that it cannot be
+// swapped with the private key of another row.
+func encryptPrivateKey(keyEncryptionKey []byte, keyID string, der []byte) ([]byte, error) {
+	aead, err := keyCipher(keyEncryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, der, []byte(keyID)), nil
+}
+
+func decryptPrivateKey(keyEncryptionKey []byte, keyID string, sealed []byte) ([]byte, error) {
+	aead, err := keyCipher(keyEncryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("encrypted private key too short")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	der, err := aead.Open(nil, nonce, ciphertext, []byte(keyID))
+	if err != nil {
+		return nil, fmt.Errorf("decrypt private key: %w", err)
+	}
+	return der, nil
+}
+
+// jwk returns the public key of k.
+func (k tokenKey) jwk() models.JWK {
+	jwk := models.JWK{Kid: k.KeyID, Use: "sig", Alg: k.Algorithm}
+	switch public := k.private.Public().(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(public)
+	}
+	return jwk
+}
+
+func randomHex(length int) (string, error) {
+	random := make([]byte, length)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(random), nil
+}
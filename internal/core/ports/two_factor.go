@@ -0,0 +1,267 @@
+package ports
+
+import (
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/WarisLi/Golang-mini-project/internal/core/models"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultTOTPIssuer            = "Golang-mini-project"
+	defaultTwoFactorChallengeTTL = 5 * time.Minute
+)
+
+// twoFactorRequired reports whether the logins of user need a second factor.
+func (s *userServiceImpl) twoFactorRequired(user *models.User) bool {
+	return user.TOTPEnabled || slices.Contains(s.options.TwoFactorRoles, user.Role)
+}
+
+// twoFactorChallenge returns the *TwoFactorRequiredError of a login of user.
+func (s *userServiceImpl) twoFactorChallenge(user *models.User) error {
+	ttl := s.options.TwoFactorChallengeTTL
+	if ttl <= 0 {
+		ttl = defaultTwoFactorChallengeTTL
+	}
+
+	token, err := s.tokens.SignChallenge(user, ttl)
+	if err != nil {
+		return err
+	}
+	return &TwoFactorRequiredError{ChallengeToken: token, Enroll: !user.TOTPEnabled}
+}
+
+// challengeUser returns the user of a challenge token, the challenge is invalidated
+// with the sessions of the user.
+func (s *userServiceImpl) challengeUser(challengeToken string) (*models.User, error) {
+	username, sessionID, version, err := s.tokens.ParseChallenge(challengeToken)
+	if err != nil {
+		return nil, ErrInvalidChallenge
+	}
+
+	user, err := s.repo.GetUser(username)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrInvalidChallenge
+	}
+	if err != nil {
+		return nil, err
+	}
+	if user.Disabled || user.SessionID != sessionID || user.SessionVersion != version {
+		return nil, ErrInvalidChallenge
+	}
+	return user, nil
+}
+
+func (s *userServiceImpl) LoginTwoFactor(login models.TwoFactorLogin) (string, []string, error) {
+	user, err := s.challengeUser(login.ChallengeToken)
+	if err != nil {
+		return "", nil, err
+	}
+
+	now := time.Now()
+	if user.LockedUntil != nil && now.Before(*user.LockedUntil) {
+		return "", nil, &UserLockedError{RetryAfter: user.LockedUntil.Sub(now)}
+	}
+
+	from := user.TwoFactorState()
+	var recoveryCodes []string
+	switch {
+	case user.TOTPEnabled:
+		if !verifySecondFactor(user, login.Code, now) {
+			s.failLogin(user, now)
+			return "", nil, ErrInvalidTwoFactorCode
+		}
+	case user.TOTPSecret != "":
+		// The first code of the authenticator confirms its enrollment
+		step, ok := ValidateTOTP(user.TOTPSecret, login.Code, now, user.TOTPLastStep)
+		if !ok {
+			s.failLogin(user, now)
+			return "", nil, ErrInvalidTwoFactorCode
+		}
+		user.TOTPLastStep = step
+		if recoveryCodes, err = enableTOTP(user); err != nil {
+			return "", nil, err
+		}
+	case s.twoFactorRequired(user):
+		return "", nil, ErrTwoFactorNotEnrolled
+	default:
+		// The login of a user without second factor never needed a challenge
+		return "", nil, ErrInvalidChallenge
+	}
+
+	if err := s.useTwoFactorCode(user, from); err != nil {
+		if errors.Is(err, ErrInvalidTwoFactorCode) {
+			s.failLogin(user, now)
+		}
+		return "", nil, err
+	}
+	if err := s.repo.ResetFailedLogins(user.Username); err != nil {
+		return "", nil, err
+	}
+
+	token, err := s.tokens.SignToken(user)
+	if err != nil {
+		return "", nil, err
+	}
+	return token, recoveryCodes, nil
+}
+
+func (s *userServiceImpl) EnrollTOTPChallenge(challengeToken string) (*models.TOTPEnrollment, error) {
+	user, err := s.challengeUser(challengeToken)
+	if err != nil {
+		return nil, err
+	}
+	return s.enrollTOTP(user)
+}
+
+func (s *userServiceImpl) EnrollTOTP(username string) (*models.TOTPEnrollment, error) {
+	user, err := s.repo.GetUser(username)
+	if err != nil {
+		return nil, err
+	}
+	return s.enrollTOTP(user)
+}
+
+// enrollTOTP saves a new pending secret of user, replacing a pending one.
+func (s *userServiceImpl) enrollTOTP(user *models.User) (*models.TOTPEnrollment, error) {
+	if user.TOTPEnabled {
+		return nil, ErrTwoFactorEnabled
+	}
+
+	secret, err := NewTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	from := user.TwoFactorState()
+	user.TOTPSecret = secret
+	user.TOTPLastStep = 0
+	if err := s.repo.UpdateTwoFactor(user.Username, from, user.TwoFactorState()); errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrTwoFactorChanged
+	} else if err != nil {
+		return nil, err
+	}
+
+	issuer := s.options.TOTPIssuer
+	if issuer == "" {
+		issuer = defaultTOTPIssuer
+	}
+	return &models.TOTPEnrollment{Secret: secret, URI: TOTPURI(issuer, user.Username, secret)}, nil
+}
+
+func (s *userServiceImpl) ConfirmTOTP(username string, code string) ([]string, error) {
+	user, err := s.repo.GetUser(username)
+	if err != nil {
+		return nil, err
+	}
+	if user.TOTPEnabled {
+		return nil, ErrTwoFactorEnabled
+	}
+	if user.TOTPSecret == "" {
+		return nil, ErrTwoFactorNotEnrolled
+	}
+
+	from := user.TwoFactorState()
+	step, ok := ValidateTOTP(user.TOTPSecret, code, time.Now(), user.TOTPLastStep)
+	if !ok {
+		return nil, ErrInvalidTwoFactorCode
+	}
+	user.TOTPLastStep = step
+	recoveryCodes, err := enableTOTP(user)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.useTwoFactorCode(user, from); err != nil {
+		return nil, err
+	}
+	return recoveryCodes, nil
+}
+
+func (s *userServiceImpl) DisableTOTP(username string, code string) error {
+	user, err := s.repo.GetUser(username)
+	if err != nil {
+		return err
+	}
+	if !user.TOTPEnabled {
+		return ErrTwoFactorNotEnrolled
+	}
+	if slices.Contains(s.options.TwoFactorRoles, user.Role) {
+		return ErrTwoFactorRequiredByRole
+	}
+	from := user.TwoFactorState()
+	if !verifySecondFactor(user, code, time.Now()) {
+		return ErrInvalidTwoFactorCode
+	}
+
+	clearTOTP(user)
+	return s.useTwoFactorCode(user, from)
+}
+
+func (s *userServiceImpl) RegenerateRecoveryCodes(username string, code string) ([]string, error) {
+	user, err := s.repo.GetUser(username)
+	if err != nil {
+		return nil, err
+	}
+	if !user.TOTPEnabled {
+		return nil, ErrTwoFactorNotEnrolled
+	}
+	from := user.TwoFactorState()
+	if !verifySecondFactor(user, code, time.Now()) {
+		return nil, ErrInvalidTwoFactorCode
+	}
+
+	recoveryCodes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	user.RecoveryCodes = hashes
+	if err := s.useTwoFactorCode(user, from); err != nil {
+		return nil, err
+	}
+	return recoveryCodes, nil
+}
+
+// useTwoFactorCode saves the two-factor state of user after the use of a code, from is
+// the state the code was checked against. The code is refused when a concurrent
+// request changed the state since, so that it is accepted once.
+func (s *userServiceImpl) useTwoFactorCode(user *models.User, from models.TwoFactorState) error {
+	err := s.repo.UpdateTwoFactor(user.Username, from, user.TwoFactorState())
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrInvalidTwoFactorCode
+	}
+	return err
+}
+
+// verifySecondFactor checks a code of the authenticator or a recovery code of user
+// and records its use on user, which has to be saved with useTwoFactorCode.
+func verifySecondFactor(user *models.User, code string, now time.Time) bool {
+	if step, ok := ValidateTOTP(user.TOTPSecret, code, now, user.TOTPLastStep); ok {
+		user.TOTPLastStep = step
+		return true
+	}
+	if remaining, ok := useRecoveryCode(user.RecoveryCodes, code); ok {
+		user.RecoveryCodes = remaining
+		return true
+	}
+	return false
+}
+
+// enableTOTP enables the pending authenticator of user and returns its new recovery codes.
+func enableTOTP(user *models.User) ([]string, error) {
+	recoveryCodes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	user.TOTPEnabled = true
+	user.RecoveryCodes = hashes
+	return recoveryCodes, nil
+}
+
+// clearTOTP removes the authenticator and the recovery codes of user.
+func clearTOTP(user *models.User) {
+	user.TOTPSecret = ""
+	user.TOTPEnabled = false
+	user.TOTPLastStep = 0
+	user.RecoveryCodes = ""
+}
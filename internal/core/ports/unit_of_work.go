@@ -0,0 +1,21 @@
+package ports
+
+// TransactionRepositories are the repositories of a unit of work, their
+// operations are part of its transaction.
+type TransactionRepositories struct {
+	Product       ProductRepository
+	Stock         StockRepository
+	Outbox        OutboxRepository
+	User          UserRepository
+	PasswordReset PasswordResetRepository
+	APIKey        APIKeyRepository
+	Webhook       WebhookRepository
+}
+
+// UnitOfWork runs several repository operations in one transaction.
+type UnitOfWork interface {
+	// Do calls fn in a transaction which is committed when fn returns nil and
+	// rolled back when it returns an error or panics, the panic is then raised
+	// again. fn must only use the repositories it receives.
+	Do(fn func(repos TransactionRepositories) error) error
+}
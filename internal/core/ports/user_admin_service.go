@@ -0,0 +1,196 @@
+package ports
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/WarisLi/Golang-mini-project/internal/adapters/producer"
+	"github.com/WarisLi/Golang-mini-project/internal/core/models"
+)
+
+// UserAdminService manages the users for the administrators. Every change produces
+// a models.UserAuditEvent naming the actor, the administrator making it.
+type UserAdminService interface {
+	ListUsers(query models.UserQuery) (*models.Page[models.UserResponse], error)
+	GetUser(username string) (*models.UserResponse, error)
+	// CreateServiceAccount creates a user without password for the API keys of a client.
+	CreateServiceAccount(actor string, account models.ServiceAccount) error
+	SetUserRole(actor string, username string, role string) error
+	// SetUserDisabled blocks or allows the logins of the user, disabling it also
+	// invalidates its tokens.
+	SetUserDisabled(actor string, username string, disabled bool) error
+	DeleteUser(actor string, username string) error
+	// ResetTwoFactor removes the authenticator and the recovery codes of a user who lost them.
+	ResetTwoFactor(actor string, username string) error
+}
+
+type userAdminServiceImpl struct {
+	repo          UserRepository
+	unitOfWork    UnitOfWork
+	eventProducer producer.EventProducer
+	outboxRepo    OutboxRepository
+}
+
+func NewUserAdminService(repo UserRepository, unitOfWork UnitOfWork, eventProducer producer.EventProducer,
+	outboxRepo OutboxRepository) UserAdminService {
+	return &userAdminServiceImpl{
+		repo:          repo,
+		unitOfWork:    unitOfWork,
+		eventProducer: eventProducer,
+		outboxRepo:    outboxRepo,
+	}
+}
+
+func (s *userAdminServiceImpl) ListUsers(query models.UserQuery) (*models.Page[models.UserResponse], error) {
+	query.PageRequest = query.PageRequest.Normalize()
+
+	users, total, err := s.repo.GetUsers(query)
+	if err != nil {
+		return nil, err
+	}
+
+	responses := make([]models.UserResponse, 0, len(users))
+	for _, user := range users {
+		responses = append(responses, models.NewUserResponse(user))
+	}
+	return models.NewPage(responses, total, query.PageRequest), nil
+}
+
+func (s *userAdminServiceImpl) GetUser(username string) (*models.UserResponse, error) {
+	user, err := s.repo.GetUser(username)
+	if err != nil {
+		return nil, err
+	}
+
+	response := models.NewUserResponse(*user)
+	return &response, nil
+}
+
+func (s *userAdminServiceImpl) CreateServiceAccount(actor string, account models.ServiceAccount) error {
+	if account.Role != models.RoleAdmin && account.Role != models.RoleUser {
+		return fmt.Errorf("%w %q", ErrUnknownRole, account.Role)
+	}
+
+	sessionID, err := newSessionID()
+	if err != nil {
+		return err
+	}
+	user := models.User{Username: account.Username, Role: account.Role, ServiceAccount: true, SessionID: sessionID}
+	if err := s.repo.Create(user); err != nil {
+		return err
+	}
+
+	s.audit(models.UserAuditEvent{Action: models.UserServiceAccountCreated, Username: account.Username, Actor: actor, Role: account.Role})
+	return nil
+}
+
+func (s *userAdminServiceImpl) SetUserRole(actor string, username string, role string) error {
+	if role != models.RoleAdmin && role != models.RoleUser {
+		return fmt.Errorf("%w %q", ErrUnknownRole, role)
+	}
+	// An administrator cannot lose the access to the user management
+	if actor == username && role != models.RoleAdmin {
+		return ErrOwnUser
+	}
+
+	user, err := s.repo.GetUser(username)
+	if err != nil {
+		return err
+	}
+	if user.Role == role {
+		return nil
+	}
+	// The tokens carry the role, those of the former role are signed out
+	user.Role = role
+	user.SessionVersion++
+	if err := s.repo.UpdateUser(*user); err != nil {
+		return err
+	}
+
+	s.audit(models.UserAuditEvent{Action: models.UserRoleChanged, Username: username, Actor: actor, Role: role})
+	return nil
+}
+
+func (s *userAdminServiceImpl) SetUserDisabled(actor string, username string, disabled bool) error {
+	if actor == username && disabled {
+		return ErrOwnUser
+	}
+
+	user, err := s.repo.GetUser(username)
+	if err != nil {
+		return err
+	}
+	if user.Disabled == disabled {
+		return nil
+	}
+	user.Disabled = disabled
+	// The tokens of a disabled user stay refused once it is enabled again
+	if disabled {
+		user.SessionVersion++
+	}
+	if err := s.repo.UpdateUser(*user); err != nil {
+		return err
+	}
+
+	action := models.UserEnabled
+	if disabled {
+		action = models.UserDisabled
+	}
+	s.audit(models.UserAuditEvent{Action: action, Username: username, Actor: actor})
+	return nil
+}
+
+func (s *userAdminServiceImpl) DeleteUser(actor string, username string) error {
+	if actor == username {
+		return ErrOwnUser
+	}
+
+	// The reset tokens and the API keys would otherwise be used by a new user of the
+	// same username, they are deleted with the user and its audit event is saved with them
+	var outboxEvents []models.OutboxEvent
+	err := s.unitOfWork.Do(func(repos TransactionRepositories) error {
+		if err := repos.PasswordReset.DeleteUserPasswordResetTokens(username); err != nil {
+			return err
+		}
+		if err := repos.APIKey.DeleteUserAPIKeys(username); err != nil {
+			return err
+		}
+		if err := repos.User.DeleteUser(username); err != nil {
+			return err
+		}
+
+		var err error
+		outboxEvents, err = saveEvents(repos.Outbox, models.UserAuditEvent{
+			Action: models.UserDeleted, Username: username, Actor: actor, Time: time.Now().UTC(),
+		})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	publishEvents(s.eventProducer, s.outboxRepo, outboxEvents)
+	return nil
+}
+
+func (s *userAdminServiceImpl) ResetTwoFactor(actor string, username string) error {
+	user, err := s.repo.GetUser(username)
+	if err != nil {
+		return err
+	}
+	if !user.TOTPEnabled && user.TOTPSecret == "" {
+		return nil
+	}
+	clearTOTP(user)
+	if err := s.repo.UpdateUser(*user); err != nil {
+		return err
+	}
+
+	s.audit(models.UserAuditEvent{Action: models.UserTwoFactorReset, Username: username, Actor: actor})
+	return nil
+}
+
+func (s *userAdminServiceImpl) audit(event models.UserAuditEvent) {
+	event.Time = time.Now().UTC()
+	produceEvent(s.eventProducer, s.outboxRepo, event)
+}
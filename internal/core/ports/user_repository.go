@@ -1,10 +1,32 @@
 package ports
 
 import (
+	"time"
+
 	"github.com/WarisLi/Golang-mini-project/internal/core/models"
 )
 
 type UserRepository interface {
 	GetUser(username string) (*models.User, error)
+	// GetUserByIdentity returns the user linked to the subject of an OpenID Connect provider.
+	GetUserByIdentity(provider string, subject string) (*models.User, error)
 	Create(user models.User) error
+	UpdateUser(user models.User) error
+	// AddFailedLogin increments the failed logins of the user in one statement and
+	// returns them, the concurrent failures are all counted.
+	AddFailedLogin(username string) (int, error)
+	// LockUser refuses the logins of the user until lockedUntil, a longer lock is kept.
+	LockUser(username string, lockedUntil time.Time) error
+	// ResetFailedLogins clears the failed logins and the lock of the user.
+	ResetFailedLogins(username string) error
+	// UpdatePasswordHash replaces the password hash of the user with newHash when it is
+	// still oldHash, it returns gorm.ErrRecordNotFound when the password was changed since.
+	UpdatePasswordHash(username string, oldHash string, newHash string) error
+	// UpdateTwoFactor replaces the two-factor state of the user with state when it is still
+	// from, it returns gorm.ErrRecordNotFound when it was changed since, e.g. by a
+	// concurrent use of the same code.
+	UpdateTwoFactor(username string, from models.TwoFactorState, state models.TwoFactorState) error
+	// GetUsers returns a page of the users matching query, ordered by ID, and their total.
+	GetUsers(query models.UserQuery) ([]models.User, int64, error)
+	DeleteUser(username string) error
 }
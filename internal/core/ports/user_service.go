@@ -2,34 +2,110 @@ package ports
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
-	"os"
+	"log"
+	"sync"
 	"time"
 
 	"github.com/WarisLi/Golang-mini-project/internal/core/models"
-	"github.com/golang-jwt/jwt/v5"
 	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
 )
 
 type UserService interface {
+	// RegisterUser creates a user of the role user, administrators are granted their role.
 	RegisterUser(usernamePassword models.UsernamePassword) error
+	// CreateUser creates a user of role, for the seed and the command line.
+	CreateUser(usernamePassword models.UsernamePassword, role string) error
 	LoginUser(usernamePassword models.UsernamePassword) (string, error)
+	// ChangePassword invalidates the tokens of the user and returns a new one.
+	ChangePassword(username string, change models.ChangePassword) (string, error)
+	// RequestPasswordReset notifies the user of a reset token, unknown and disabled
+	// users are ignored so that the response does not tell which users exist. The
+	// token is created and sent in the background, see Wait.
+	RequestPasswordReset(username string) error
+	// Wait waits for the password resets being sent.
+	Wait()
+	// ResetPassword sets the password of a reset token and invalidates the tokens of the user.
+	ResetPassword(reset models.ResetPassword) error
+	// CheckSession returns ErrInvalidSession when a token of the session version was
+	// invalidated, the user is disabled or was deleted, or its role is not the role of the token.
+	CheckSession(username string, sessionID string, sessionVersion int, role string) error
+	// LoginTwoFactor completes a login with a code of the authenticator or a recovery
+	// code. When the code confirms an enrollment, the new recovery codes are returned.
+	LoginTwoFactor(login models.TwoFactorLogin) (string, []string, error)
+	// EnrollTOTPChallenge starts the enrollment of a user who has to enroll to log in.
+	EnrollTOTPChallenge(challengeToken string) (*models.TOTPEnrollment, error)
+	// EnrollTOTP starts the enrollment of an authenticator, it is enabled once ConfirmTOTP
+	// receives one of its codes.
+	EnrollTOTP(username string) (*models.TOTPEnrollment, error)
+	ConfirmTOTP(username string, code string) ([]string, error)
+	DisableTOTP(username string, code string) error
+	RegenerateRecoveryCodes(username string, code string) ([]string, error)
+}
+
+type UserServiceOptions struct {
+	// MaxFailedLogins consecutive failed logins lock the user for LockoutDuration, 0 disables the lockout.
+	MaxFailedLogins int
+	LockoutDuration time.Duration
+	// FailedLoginDelay refuses the next login for this long after a failed login, doubling
+	// with every consecutive failure up to MaxFailedLoginDelay when set. 0 disables the delay.
+	FailedLoginDelay    time.Duration
+	MaxFailedLoginDelay time.Duration
+	PasswordPolicy      PasswordPolicy
+	// PasswordHash hashes the new passwords, the passwords of other hashes are rehashed on login.
+	PasswordHash PasswordHashOptions
+	// PasswordResetTTL is how long a password reset token can be used.
+	PasswordResetTTL time.Duration
+	// PasswordResetURL is followed by the token in the notification, e.g. a page of the frontend.
+	// The notification contains the token alone when empty.
+	PasswordResetURL string
+	// TwoFactorRoles are the roles which have to log in with a second factor, the
+	// users of these roles enroll an authenticator on their next login.
+	TwoFactorRoles []string
+	// TOTPIssuer names the application in the authenticator apps.
+	TOTPIssuer string
+	// TwoFactorChallengeTTL is how long the second factor of a login can be given.
+	TwoFactorChallengeTTL time.Duration
 }
 
 type userServiceImpl struct {
-	repo UserRepository
+	repo          UserRepository
+	passwordReset PasswordResetRepository
+	notifier      Notifier
+	tokens        TokenService
+	options       UserServiceOptions
+
+	// dummyHash is verified on logins of unknown users so that they take as long as the others.
+	dummyHashOnce sync.Once
+	dummyHash     string
+
+	// passwordResets are the password resets being sent.
+	passwordResets sync.WaitGroup
 }
 
-func NewUserService(repo UserRepository) UserService {
-	return &userServiceImpl{repo: repo}
+func NewUserService(repo UserRepository, passwordReset PasswordResetRepository, notifier Notifier, tokens TokenService, options UserServiceOptions) UserService {
+	return &userServiceImpl{repo: repo, passwordReset: passwordReset, notifier: notifier, tokens: tokens, options: options}
 }
 
 func (s *userServiceImpl) RegisterUser(usernamePassword models.UsernamePassword) error {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(usernamePassword.Password), bcrypt.DefaultCost)
+	return s.CreateUser(usernamePassword, models.RoleUser)
+}
+
+func (s *userServiceImpl) CreateUser(usernamePassword models.UsernamePassword, role string) error {
+	if role != models.RoleAdmin && role != models.RoleUser {
+		return fmt.Errorf("%w %q", ErrUnknownRole, role)
+	}
+	if err := s.options.PasswordPolicy.Check(usernamePassword.Password); err != nil {
+		return err
+	}
+
+	hashedPassword, err := HashPassword(usernamePassword.Password, s.options.PasswordHash)
 	if err != nil {
 		return err
 	}
-	usernamePassword.Password = string(hashedPassword)
+	usernamePassword.Password = hashedPassword
 
 	// Convert user to JSON
 	data, err := json.Marshal(usernamePassword)
@@ -46,6 +122,12 @@ func (s *userServiceImpl) RegisterUser(usernamePassword models.UsernamePassword)
 		return err
 	}
 
+	user.Role = role
+	user.SessionID, err = newSessionID()
+	if err != nil {
+		return err
+	}
+
 	// call secondary port
 	err = s.repo.Create(user)
 	if err != nil {
@@ -58,30 +140,146 @@ func (s *userServiceImpl) RegisterUser(usernamePassword models.UsernamePassword)
 func (s *userServiceImpl) LoginUser(requestUser models.UsernamePassword) (string, error) {
 	userData, err := s.repo.GetUser(requestUser.Username)
 	if err != nil {
+		s.verifyDummyPassword(requestUser.Password)
 		return "", err
 	}
+	// Service accounts have no password, they authenticate with API keys, and the
+	// users of an identity provider log in with it
+	if userData.ServiceAccount || userData.IdentityProvider != "" {
+		s.verifyDummyPassword(requestUser.Password)
+		return "", bcrypt.ErrMismatchedHashAndPassword
+	}
+
+	now := time.Now()
+	if userData.LockedUntil != nil && now.Before(*userData.LockedUntil) {
+		return "", &UserLockedError{RetryAfter: userData.LockedUntil.Sub(now)}
+	}
 
 	// Validate password
-	err = bcrypt.CompareHashAndPassword([]byte(userData.Password), []byte(requestUser.Password))
+	err = VerifyPassword(userData.Password, requestUser.Password)
 	if err != nil {
+		s.failLogin(userData, now)
 		return "", err
 	}
 
-	// Create the Claims
-	claims := jwt.MapClaims{
-		"username": userData.Username,
-		"role":     "admin",
-		"exp":      time.Now().Add(time.Hour * 72).Unix(),
+	// The login only writes the columns it owns, the user read before the password
+	// check may be outdated. The failed logins are reset once the second factor is given.
+	twoFactor := s.twoFactorRequired(userData)
+	if !twoFactor && (userData.FailedLogins > 0 || userData.LockedUntil != nil) {
+		if err := s.repo.ResetFailedLogins(userData.Username); err != nil {
+			return "", err
+		}
+	}
+	if PasswordNeedsRehash(userData.Password, s.options.PasswordHash) {
+		if hashedPassword, err := HashPassword(requestUser.Password, s.options.PasswordHash); err != nil {
+			log.Printf("Rehash password of %s failed %s\n", userData.Username, err)
+		} else if err := s.repo.UpdatePasswordHash(userData.Username, userData.Password, hashedPassword); err != nil {
+			log.Printf("Rehashed password of %s not saved %s\n", userData.Username, err)
+		}
+	}
+
+	if userData.Disabled {
+		return "", ErrUserDisabled
+	}
+	if twoFactor {
+		return "", s.twoFactorChallenge(userData)
 	}
 
-	// Create token
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return s.tokens.SignToken(userData)
+}
 
-	// Generate encoded token
-	signedToken, err := token.SignedString([]byte(os.Getenv("JWT_SECRET")))
+func (s *userServiceImpl) verifyDummyPassword(password string) {
+	s.dummyHashOnce.Do(func() {
+		s.dummyHash, _ = HashPassword("dummy password", s.options.PasswordHash)
+	})
+	VerifyPassword(s.dummyHash, password)
+}
+
+// failLogin counts a failed login of user and locks it for the delay of its consecutive
+// failures. The count is incremented by the repository, the concurrent failures are all counted.
+func (s *userServiceImpl) failLogin(user *models.User, now time.Time) {
+	if s.options.MaxFailedLogins <= 0 && s.options.FailedLoginDelay <= 0 {
+		return
+	}
+
+	failedLogins, err := s.repo.AddFailedLogin(user.Username)
+	if err != nil {
+		log.Printf("Failed login of %s not recorded %s\n", user.Username, err)
+		return
+	}
+	if delay := s.failedLoginDelay(failedLogins); delay > 0 {
+		if err := s.repo.LockUser(user.Username, now.Add(delay)); err != nil {
+			log.Printf("Lock of %s not recorded %s\n", user.Username, err)
+		}
+	}
+}
+
+func (s *userServiceImpl) failedLoginDelay(failures int) time.Duration {
+	if s.options.MaxFailedLogins > 0 && failures >= s.options.MaxFailedLogins {
+		return s.options.LockoutDuration
+	}
+
+	delay := s.options.FailedLoginDelay
+	maxDelay := s.options.MaxFailedLoginDelay
+	if maxDelay <= 0 {
+		maxDelay = delay
+	}
+	for i := 1; i < failures && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxDelay)
+}
+
+func (s *userServiceImpl) ChangePassword(username string, change models.ChangePassword) (string, error) {
+	user, err := s.repo.GetUser(username)
 	if err != nil {
 		return "", err
 	}
+	if user.IdentityProvider != "" {
+		return "", ErrExternalUser
+	}
+	if err := VerifyPassword(user.Password, change.CurrentPassword); err != nil {
+		return "", ErrWrongPassword
+	}
+	if err := s.setPassword(user, change.NewPassword); err != nil {
+		return "", err
+	}
+
+	return s.tokens.SignToken(user)
+}
+
+// setPassword checks and saves a new password of user and invalidates its tokens.
+func (s *userServiceImpl) setPassword(user *models.User, password string) error {
+	if err := s.options.PasswordPolicy.Check(password); err != nil {
+		return err
+	}
+	hashedPassword, err := HashPassword(password, s.options.PasswordHash)
+	if err != nil {
+		return err
+	}
+
+	user.Password = hashedPassword
+	user.SessionVersion++
+	user.FailedLogins = 0
+	user.LockedUntil = nil
+	return s.repo.UpdateUser(*user)
+}
+
+func (s *userServiceImpl) CheckSession(username string, sessionID string, sessionVersion int, role string) error {
+	user, err := s.repo.GetUser(username)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrInvalidSession
+	}
+	if err != nil {
+		return err
+	}
+	if user.Disabled || user.SessionID != sessionID || user.SessionVersion != sessionVersion || user.Role != role {
+		return ErrInvalidSession
+	}
+	return nil
+}
 
-	return signedToken, nil
+// newSessionID returns the session ID of a new user.
+func newSessionID() (string, error) {
+	return randomHex(16)
 }
@@ -0,0 +1,28 @@
+package ports
+
+import (
+	"time"
+
+	"github.com/WarisLi/Golang-mini-project/internal/core/models"
+)
+
+type WebhookRepository interface {
+	GetWebhooks() ([]models.Webhook, error)
+	GetActiveWebhooks() ([]models.Webhook, error)
+	GetWebhook(id uint) (*models.Webhook, error)
+	CreateWebhook(webhook models.Webhook) (uint, error)
+	UpdateWebhook(webhook models.Webhook) error
+	DeleteWebhook(id uint) error
+	SaveWebhookDelivery(delivery models.WebhookDelivery) error
+	GetWebhookDeliveries(webhookID uint) ([]models.WebhookDelivery, error)
+	// GetDueWebhookDeliveries returns the failed deliveries whose retry is due at now.
+	GetDueWebhookDeliveries(now time.Time) ([]models.WebhookDelivery, error)
+	// ClaimWebhookDelivery clears the retry of a delivery, so that it is retried once. It
+	// returns gorm.ErrRecordNotFound when the delivery has no retry or was already claimed.
+	ClaimWebhookDelivery(id uint) error
+}
+
+// WebhookSender sends a signed webhook request and returns the response status code.
+type WebhookSender interface {
+	Send(url string, body []byte, headers map[string]string) (int, error)
+}
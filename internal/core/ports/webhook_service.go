@@ -0,0 +1,341 @@
+package ports
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	events "github.com/WarisLi/Golang-shared-events"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/WarisLi/Golang-mini-project/internal/adapters/producer"
+	"github.com/WarisLi/Golang-mini-project/internal/core/models"
+)
+
+const (
+	WebhookSignatureHeader = "X-Webhook-Signature"
+	WebhookTimestampHeader = "X-Webhook-Timestamp"
+	WebhookEventHeader     = "X-Webhook-Event"
+	WebhookDeliveryHeader  = "X-Webhook-Delivery"
+)
+
+type WebhookOptions struct {
+	// MaxAttempts is the number of times a delivery is attempted.
+	MaxAttempts int
+	// RetryBackoff is the delay before the first retry, doubled on every retry.
+	RetryBackoff time.Duration
+	// DisableAfter is the number of consecutive failed deliveries after which a webhook is disabled.
+	DisableAfter int
+}
+
+// WebhookPayload is the body of a webhook request.
+type WebhookPayload struct {
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// WebhookService manages webhook subscriptions and is an event producer
+// delivering events to the subscribed webhooks in the background.
+type WebhookService interface {
+	GetWebhooks() ([]models.Webhook, error)
+	GetWebhook(id uint) (*models.Webhook, error)
+	CreateWebhook(input models.WebhookInput) (*models.Webhook, error)
+	UpdateWebhook(id uint, input models.WebhookInput) (*models.Webhook, error)
+	DeleteWebhook(id uint) error
+	GetWebhookDeliveries(id uint) ([]models.WebhookDelivery, error)
+	Produce(event events.Event) error
+	ProduceMessage(topic string, value []byte) error
+	// RetryDeliveries starts the failed deliveries whose retry is due.
+	RetryDeliveries() error
+	// RunRetries retries the due deliveries every interval until ctx is done.
+	RunRetries(ctx context.Context, interval time.Duration)
+	// Wait blocks until the deliveries in progress are finished.
+	Wait()
+}
+
+type webhookServiceImpl struct {
+	repo    WebhookRepository
+	sender  WebhookSender
+	options WebhookOptions
+
+	// mu serializes the updates of the webhook failure counts.
+	mu sync.Mutex
+	wg sync.WaitGroup
+}
+
+func NewWebhookService(repo WebhookRepository, sender WebhookSender, options WebhookOptions) WebhookService {
+	if options.MaxAttempts <= 0 {
+		options.MaxAttempts = 1
+	}
+
+	return &webhookServiceImpl{
+		repo:    repo,
+		sender:  sender,
+		options: options,
+	}
+}
+
+func (s *webhookServiceImpl) GetWebhooks() ([]models.Webhook, error) {
+	return s.repo.GetWebhooks()
+}
+
+func (s *webhookServiceImpl) GetWebhook(id uint) (*models.Webhook, error) {
+	return s.repo.GetWebhook(id)
+}
+
+func (s *webhookServiceImpl) CreateWebhook(input models.WebhookInput) (*models.Webhook, error) {
+	webhook := models.Webhook{
+		URL:        input.URL,
+		EventTypes: strings.Join(input.EventTypes, ","),
+		Secret:     input.Secret,
+		Active:     input.Active == nil || *input.Active,
+	}
+
+	id, err := s.repo.CreateWebhook(webhook)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.repo.GetWebhook(id)
+}
+
+func (s *webhookServiceImpl) UpdateWebhook(id uint, input models.WebhookInput) (*models.Webhook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	webhook, err := s.repo.GetWebhook(id)
+	if err != nil {
+		return nil, err
+	}
+
+	webhook.URL = input.URL
+	webhook.EventTypes = strings.Join(input.EventTypes, ",")
+	webhook.Secret = input.Secret
+	if input.Active != nil {
+		if *input.Active && !webhook.Active {
+			// Enabling a webhook again gives it a fresh failure budget
+			webhook.FailureCount = 0
+			webhook.DisabledAt = nil
+		}
+		webhook.Active = *input.Active
+	}
+
+	if err := s.repo.UpdateWebhook(*webhook); err != nil {
+		return nil, err
+	}
+
+	return webhook, nil
+}
+
+func (s *webhookServiceImpl) DeleteWebhook(id uint) error {
+	return s.repo.DeleteWebhook(id)
+}
+
+func (s *webhookServiceImpl) GetWebhookDeliveries(id uint) ([]models.WebhookDelivery, error) {
+	if _, err := s.repo.GetWebhook(id); err != nil {
+		return nil, err
+	}
+
+	return s.repo.GetWebhookDeliveries(id)
+}
+
+func (s *webhookServiceImpl) Produce(event events.Event) error {
+	value, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	return s.ProduceMessage(producer.TopicOf(event), value)
+}
+
+// ProduceMessage starts delivering the event to every active webhook subscribed to topic.
+// Deliveries never fail the caller, their failed attempts are retried by RetryDeliveries.
+func (s *webhookServiceImpl) ProduceMessage(topic string, value []byte) error {
+	webhooks, err := s.repo.GetActiveWebhooks()
+	if err != nil {
+		log.Printf("Webhook dispatch of %s failed %s\n", topic, err)
+		return nil
+	}
+
+	for _, webhook := range webhooks {
+		if !webhook.Subscribes(topic) {
+			continue
+		}
+
+		payload, err := json.Marshal(WebhookPayload{
+			ID:        uuid.NewString(),
+			Type:      topic,
+			CreatedAt: time.Now().UTC(),
+			Data:      value,
+		})
+		if err != nil {
+			return err
+		}
+
+		s.wg.Add(1)
+		go func(webhook models.Webhook) {
+			defer s.wg.Done()
+			s.deliver(webhook, topic, payload, 1)
+		}(webhook)
+	}
+
+	return nil
+}
+
+// RetryDeliveries starts the retries that are due. The retries are scheduled in the
+// delivery log, so that they survive a restart and are shared by the instances.
+func (s *webhookServiceImpl) RetryDeliveries() error {
+	deliveries, err := s.repo.GetDueWebhookDeliveries(time.Now())
+	if err != nil {
+		return err
+	}
+
+	for _, delivery := range deliveries {
+		webhook, err := s.repo.GetWebhook(delivery.WebhookID)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		if err := s.repo.ClaimWebhookDelivery(delivery.ID); err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				// Retried by another instance
+				continue
+			}
+			return err
+		}
+		// The deliveries of deleted and disabled webhooks are dropped
+		if webhook == nil || !webhook.Active {
+			continue
+		}
+
+		s.wg.Add(1)
+		go func(webhook models.Webhook, delivery models.WebhookDelivery) {
+			defer s.wg.Done()
+			s.deliver(webhook, delivery.EventType, delivery.Payload, delivery.Attempt+1)
+		}(*webhook, delivery)
+	}
+
+	return nil
+}
+
+func (s *webhookServiceImpl) RunRetries(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.RetryDeliveries(); err != nil {
+			log.Printf("Webhook retries failed %s\n", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *webhookServiceImpl) Wait() {
+	s.wg.Wait()
+}
+
+// deliver sends the payload once and logs the attempt. A failed attempt is scheduled
+// for a retry, with a backoff doubled on every retry, until the attempts are exhausted.
+func (s *webhookServiceImpl) deliver(webhook models.Webhook, topic string, payload []byte, attempt int) {
+	var deliveryID struct {
+		ID string `json:"id"`
+	}
+	json.Unmarshal(payload, &deliveryID)
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	headers := map[string]string{
+		"Content-Type":         "application/json",
+		WebhookEventHeader:     topic,
+		WebhookDeliveryHeader:  deliveryID.ID,
+		WebhookTimestampHeader: timestamp,
+		WebhookSignatureHeader: SignWebhook(webhook.Secret, timestamp, payload),
+	}
+
+	start := time.Now()
+	statusCode, err := s.sender.Send(webhook.URL, payload, headers)
+	delivery := models.WebhookDelivery{
+		WebhookID:  webhook.ID,
+		EventType:  topic,
+		Payload:    payload,
+		Attempt:    attempt,
+		StatusCode: statusCode,
+		Success:    err == nil && statusCode >= 200 && statusCode < 300,
+		Duration:   time.Since(start),
+	}
+	if err != nil {
+		delivery.Error = err.Error()
+	}
+	if !delivery.Success && attempt < s.options.MaxAttempts {
+		retryAt := time.Now().Add(s.options.RetryBackoff << (attempt - 1))
+		delivery.RetryAt = &retryAt
+	}
+	if err := s.repo.SaveWebhookDelivery(delivery); err != nil {
+		log.Println(err)
+		// The retry is lost with the attempt
+		delivery.RetryAt = nil
+	}
+
+	if delivery.Success {
+		s.recordResult(webhook.ID, true)
+	} else if delivery.RetryAt == nil {
+		s.recordResult(webhook.ID, false)
+	}
+}
+
+// recordResult resets the failure count of a webhook after a successful delivery,
+// or increments it and disables the webhook when it keeps failing.
+func (s *webhookServiceImpl) recordResult(id uint, success bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	webhook, err := s.repo.GetWebhook(id)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	if success {
+		if webhook.FailureCount == 0 {
+			return
+		}
+		webhook.FailureCount = 0
+	} else {
+		webhook.FailureCount++
+		if s.options.DisableAfter > 0 && webhook.FailureCount >= s.options.DisableAfter && webhook.Active {
+			now := time.Now()
+			webhook.Active = false
+			webhook.DisabledAt = &now
+			log.Printf("Webhook %d disabled after %d failed deliveries\n", webhook.ID, webhook.FailureCount)
+		}
+	}
+
+	if err := s.repo.UpdateWebhook(*webhook); err != nil {
+		log.Println(err)
+	}
+}
+
+// SignWebhook returns the signature header of a webhook request: the hex
+// HMAC-SHA256 of "<timestamp>.<body>" keyed with the webhook secret.
+func SignWebhook(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
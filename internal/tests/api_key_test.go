@@ -0,0 +1,248 @@
+package tests
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/WarisLi/Golang-mini-project/internal/adapters/http/middleware"
+	"github.com/WarisLi/Golang-mini-project/internal/core/models"
+	"github.com/WarisLi/Golang-mini-project/internal/core/ports"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// createAPIKey creates a key at url and returns it.
+func createAPIKey(t *testing.T, app *fiber.App, url string, token string, input models.APIKeyInput) models.APIKeyCreated {
+	var key models.APIKeyCreated
+	status := sendJSONTo(t, app, "POST", url, token, input, &key)
+	require.Equal(t, fiber.StatusCreated, status)
+	require.True(t, strings.HasPrefix(key.Key, models.APIKeyPrefix))
+	return key
+}
+
+// testProduct is a product the tests create with their API keys.
+var testProduct = models.ProductInput{Name: "Book", Quantity: 1}
+
+func TestAPIKey(t *testing.T) {
+	env := setupMemoryAppTest(t, memoryAppOptions{apiKey: ports.APIKeyOptions{RotationGrace: time.Hour}})
+	token := login(t, env.app, "admin")
+
+	key := createAPIKey(t, env.app, "/user/api-keys", token, models.APIKeyInput{
+		Name:   "ERP integration",
+		Scopes: []string{models.ScopeProductRead, models.ScopeProductRead},
+	})
+	assert.Equal(t, []string{models.ScopeProductRead}, key.Scopes)
+	assert.WithinDuration(t, time.Now().Add(365*24*time.Hour), key.ExpiresAt, time.Minute)
+	event := receiveAuditEvent(t, env.auditEvents)
+	assert.Equal(t, models.UserAPIKeyCreated, event.Action)
+	assert.Equal(t, "admin", event.Actor)
+	assert.Equal(t, key.KeyID, event.APIKey)
+
+	// The key in the X-API-Key header
+	req := httptest.NewRequest("GET", "/product", nil)
+	req.Header.Set(middleware.APIKeyHeader, key.Key)
+	resp, err := env.app.Test(req)
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	tests := []struct {
+		description  string
+		method       string
+		url          string
+		token        string
+		body         interface{}
+		expectStatus int
+	}{
+		{description: "Bearer key", method: "GET", url: "/product", token: key.Key, expectStatus: fiber.StatusOK},
+		{description: "Missing scope", method: "POST", url: "/product", token: key.Key, expectStatus: fiber.StatusForbidden},
+		{description: "Missing admin scope", method: "GET", url: "/users/alice", token: key.Key, expectStatus: fiber.StatusForbidden},
+		{description: "Account route", method: "PUT", url: "/user/password", token: key.Key, expectStatus: fiber.StatusForbidden},
+		{description: "Key management", method: "GET", url: "/user/api-keys", token: key.Key, expectStatus: fiber.StatusForbidden},
+		{description: "Wrong secret", method: "GET", url: "/product", token: key.Key[:len(key.Key)-4] + "AAAA", expectStatus: fiber.StatusUnauthorized},
+		{description: "Unknown key", method: "GET", url: "/product", token: models.APIKeyPrefix + "0123456789abcdef_secret", expectStatus: fiber.StatusUnauthorized},
+		{description: "Token", method: "POST", url: "/product", token: token, body: testProduct, expectStatus: fiber.StatusCreated},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			status, _ := sendJSON(t, env.app, test.method, test.url, test.token, test.body)
+			assert.Equal(t, test.expectStatus, status)
+		})
+	}
+
+	var keys []models.APIKeyResponse
+	require.Equal(t, fiber.StatusOK, sendJSONTo(t, env.app, "GET", "/user/api-keys", token, nil, &keys))
+	require.Len(t, keys, 1)
+	assert.Equal(t, key.KeyID, keys[0].KeyID)
+	assert.NotNil(t, keys[0].LastUsedAt)
+
+	// The rotated key works until the end of the grace period
+	var rotated models.APIKeyCreated
+	require.Equal(t, fiber.StatusCreated, sendJSONTo(t, env.app, "POST", "/user/api-keys/1/rotate", token, nil, &rotated))
+	assert.NotEqual(t, key.Key, rotated.Key)
+	assert.Equal(t, key.Name, rotated.Name)
+	assert.Equal(t, key.Scopes, rotated.Scopes)
+	assert.Equal(t, models.UserAPIKeyRotated, receiveAuditEvent(t, env.auditEvents).Action)
+	old, err := env.repos.APIKey.GetAPIKey(key.ID)
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), old.ExpiresAt, time.Minute)
+	for _, apiKey := range []string{key.Key, rotated.Key} {
+		status, _ := sendJSON(t, env.app, "GET", "/product", apiKey, nil)
+		assert.Equal(t, fiber.StatusOK, status)
+	}
+
+	status, _ := sendJSON(t, env.app, "DELETE", "/user/api-keys/1", token, nil)
+	assert.Equal(t, fiber.StatusOK, status)
+	assert.Equal(t, models.UserAPIKeyRevoked, receiveAuditEvent(t, env.auditEvents).Action)
+	status, _ = sendJSON(t, env.app, "GET", "/product", key.Key, nil)
+	assert.Equal(t, fiber.StatusUnauthorized, status)
+	status, _ = sendJSON(t, env.app, "POST", "/user/api-keys/1/rotate", token, nil)
+	assert.Equal(t, fiber.StatusConflict, status)
+
+	// The keys of another user are not found
+	aliceToken := login(t, env.app, "alice")
+	status, _ = sendJSON(t, env.app, "DELETE", "/user/api-keys/2", aliceToken, nil)
+	assert.Equal(t, fiber.StatusNotFound, status)
+	status, _ = sendJSON(t, env.app, "GET", "/product", rotated.Key, nil)
+	assert.Equal(t, fiber.StatusOK, status)
+}
+
+func TestAPIKeyRotationWithoutGrace(t *testing.T) {
+	env := setupMemoryAppTest(t, memoryAppOptions{})
+	token := login(t, env.app, "admin")
+	key := createAPIKey(t, env.app, "/user/api-keys", token, models.APIKeyInput{Name: "ERP", Scopes: []string{models.ScopeProductRead}})
+
+	var rotated models.APIKeyCreated
+	require.Equal(t, fiber.StatusCreated, sendJSONTo(t, env.app, "POST", "/user/api-keys/1/rotate", token, nil, &rotated))
+	status, _ := sendJSON(t, env.app, "GET", "/product", key.Key, nil)
+	assert.Equal(t, fiber.StatusUnauthorized, status)
+	status, _ = sendJSON(t, env.app, "GET", "/product", rotated.Key, nil)
+	assert.Equal(t, fiber.StatusOK, status)
+}
+
+func TestAPIKeyInput(t *testing.T) {
+	env := setupMemoryAppTest(t, memoryAppOptions{apiKey: ports.APIKeyOptions{MaxTTL: 24 * time.Hour}})
+	adminToken := login(t, env.app, "admin")
+	aliceToken := login(t, env.app, "alice")
+	past := time.Now().Add(-time.Minute)
+	tooLate := time.Now().Add(25 * time.Hour)
+	soon := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		description  string
+		token        string
+		input        models.APIKeyInput
+		expectStatus int
+	}{
+		{description: "No name", token: adminToken, input: models.APIKeyInput{Scopes: []string{models.ScopeProductRead}}, expectStatus: fiber.StatusBadRequest},
+		{description: "No scope", token: adminToken, input: models.APIKeyInput{Name: "ERP"}, expectStatus: fiber.StatusBadRequest},
+		{description: "Unknown scope", token: adminToken, input: models.APIKeyInput{Name: "ERP", Scopes: []string{"product:delete"}}, expectStatus: fiber.StatusBadRequest},
+		{description: "Admin scope of a user", token: aliceToken, input: models.APIKeyInput{Name: "ERP", Scopes: []string{models.ScopeAdmin}}, expectStatus: fiber.StatusBadRequest},
+		{description: "Expired", token: adminToken, input: models.APIKeyInput{Name: "ERP", Scopes: []string{models.ScopeAdmin}, ExpiresAt: &past}, expectStatus: fiber.StatusBadRequest},
+		{description: "Over the max TTL", token: adminToken, input: models.APIKeyInput{Name: "ERP", Scopes: []string{models.ScopeAdmin}, ExpiresAt: &tooLate}, expectStatus: fiber.StatusBadRequest},
+		{description: "Admin scope", token: adminToken, input: models.APIKeyInput{Name: "ERP", Scopes: []string{models.ScopeAdmin}, ExpiresAt: &soon}, expectStatus: fiber.StatusCreated},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			status, _ := sendJSON(t, env.app, "POST", "/user/api-keys", test.token, test.input)
+			assert.Equal(t, test.expectStatus, status)
+		})
+	}
+
+	// An expired key is refused
+	key := createAPIKey(t, env.app, "/user/api-keys", adminToken, models.APIKeyInput{Name: "ERP", Scopes: []string{models.ScopeAdmin}})
+	status, _ := sendJSON(t, env.app, "GET", "/users/alice", key.Key, nil)
+	assert.Equal(t, fiber.StatusOK, status)
+	stored, err := env.repos.APIKey.GetAPIKey(key.ID)
+	require.NoError(t, err)
+	stored.ExpiresAt = past
+	require.NoError(t, env.repos.APIKey.UpdateAPIKey(*stored))
+	status, _ = sendJSON(t, env.app, "GET", "/users/alice", key.Key, nil)
+	assert.Equal(t, fiber.StatusUnauthorized, status)
+}
+
+func TestServiceAccount(t *testing.T) {
+	env := setupMemoryAppTest(t, memoryAppOptions{})
+	token := login(t, env.app, "admin")
+
+	account := models.ServiceAccount{Username: "erp", Role: models.RoleAdmin}
+	status, _ := sendJSON(t, env.app, "POST", "/users/service-accounts", token, account)
+	require.Equal(t, fiber.StatusCreated, status)
+	event := receiveAuditEvent(t, env.auditEvents)
+	assert.Equal(t, models.UserServiceAccountCreated, event.Action)
+	assert.Equal(t, "erp", event.Username)
+	status, _ = sendJSON(t, env.app, "POST", "/users/service-accounts", token, account)
+	assert.Equal(t, fiber.StatusConflict, status)
+
+	var user models.UserResponse
+	require.Equal(t, fiber.StatusOK, sendJSONTo(t, env.app, "GET", "/users/erp", token, nil, &user))
+	assert.True(t, user.ServiceAccount)
+
+	// Service accounts cannot log in
+	for _, password := range []string{"", "Pass@12345"} {
+		status, _ = sendJSON(t, env.app, "POST", "/user/login", "", models.UsernamePassword{Username: "erp", Password: password})
+		assert.NotEqual(t, fiber.StatusOK, status)
+	}
+
+	key := createAPIKey(t, env.app, "/users/erp/api-keys", token, models.APIKeyInput{Name: "ERP", Scopes: []string{models.ScopeProductWrite}})
+	event = receiveAuditEvent(t, env.auditEvents)
+	assert.Equal(t, "erp", event.Username)
+	assert.Equal(t, "admin", event.Actor)
+	status, _ = sendJSON(t, env.app, "POST", "/product", key.Key, testProduct)
+	assert.Equal(t, fiber.StatusCreated, status)
+	status, _ = sendJSON(t, env.app, "GET", "/users/unknown/api-keys", token, nil)
+	assert.Equal(t, fiber.StatusNotFound, status)
+
+	// The keys of a disabled user are refused, the keys of a deleted user are deleted
+	require.NoError(t, env.userAdminService.SetUserDisabled("admin", "erp", true))
+	status, _ = sendJSON(t, env.app, "POST", "/product", key.Key, testProduct)
+	assert.Equal(t, fiber.StatusUnauthorized, status)
+	require.NoError(t, env.userAdminService.DeleteUser("admin", "erp"))
+	keys, err := env.repos.APIKey.GetUserAPIKeys("erp")
+	require.NoError(t, err)
+	assert.Empty(t, keys)
+}
+
+func TestAPIKeyRoutes(t *testing.T) {
+	app, mocks := setupAppTestWithMocks()
+	key := models.APIKeyPrefix + "0123456789abcdef_secret"
+	hash := sha256.Sum256([]byte(key))
+	mocks.apiKeyRepo.On("GetAPIKeyByKeyID", "0123456789abcdef").Return(&models.APIKey{
+		Username:   "mock_user",
+		KeyID:      "0123456789abcdef",
+		SecretHash: hex.EncodeToString(hash[:]),
+		Scopes:     models.ScopeProductRead,
+		ExpiresAt:  time.Now().Add(time.Hour),
+	}, nil)
+	mocks.apiKeyRepo.On("TouchAPIKey", uint(0), mock.Anything).Return(nil)
+	mocks.productRepo.On("GetPage", mock.Anything).Return([]models.Product{}, int64(0), nil)
+
+	tests := []struct {
+		description  string
+		method       string
+		url          string
+		expectStatus int
+	}{
+		{description: "Products", method: "GET", url: "/product", expectStatus: fiber.StatusOK},
+		{description: "Product changes", method: "POST", url: "/product", expectStatus: fiber.StatusForbidden},
+		{description: "Users", method: "GET", url: "/users", expectStatus: fiber.StatusForbidden},
+		{description: "Webhooks", method: "GET", url: "/webhook", expectStatus: fiber.StatusForbidden},
+		{description: "Own API keys", method: "GET", url: "/user/api-keys", expectStatus: fiber.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			status, _ := sendJSON(t, app, test.method, test.url, key, nil)
+			assert.Equal(t, test.expectStatus, status)
+		})
+	}
+
+	mocks.apiKeyRepo.AssertCalled(t, "TouchAPIKey", uint(0), mock.Anything)
+}
@@ -0,0 +1,302 @@
+package tests
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/WarisLi/Golang-mini-project/internal/adapters/cache"
+	"github.com/WarisLi/Golang-mini-project/internal/core/models"
+	"github.com/WarisLi/Golang-mini-project/internal/core/ports"
+	"github.com/WarisLi/Golang-mini-project/internal/tests/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestLRUCache(t *testing.T) {
+	lru := cache.NewLRUCache(2)
+
+	assert.NoError(t, lru.Set("a", []byte("1"), 0))
+	assert.NoError(t, lru.Set("b", []byte("2"), 0))
+	value, err := lru.Get("a")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("1"), value)
+
+	// b is the least recently used entry
+	assert.NoError(t, lru.Set("c", []byte("3"), 0))
+	_, err = lru.Get("b")
+	assert.ErrorIs(t, err, ports.ErrCacheMiss)
+	assert.Equal(t, 2, lru.Len())
+
+	assert.NoError(t, lru.Set("d", []byte("4"), time.Millisecond))
+	time.Sleep(5 * time.Millisecond)
+	_, err = lru.Get("d")
+	assert.ErrorIs(t, err, ports.ErrCacheMiss)
+
+	assert.NoError(t, lru.Delete("c", "missing"))
+	_, err = lru.Get("c")
+	assert.ErrorIs(t, err, ports.ErrCacheMiss)
+}
+
+// fakeRedis serves GET, SET with PX and NX, DEL, INCR, PTTL, PEXPIRE, AUTH and SELECT of the RESP protocol.
+type fakeRedis struct {
+	listener net.Listener
+	password string
+
+	mu       sync.Mutex
+	values   map[string]string
+	expires  map[string]time.Time
+	commands []string
+}
+
+func newFakeRedis(t *testing.T, password string) *fakeRedis {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	server := &fakeRedis{listener: listener, password: password, values: map[string]string{}, expires: map[string]time.Time{}}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn)
+		}
+	}()
+	return server
+}
+
+func (s *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	authenticated := s.password == ""
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		count, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+		args := make([]string, count)
+		for i := range args {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			size, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+			arg := make([]byte, size+2)
+			if _, err := io.ReadFull(r, arg); err != nil {
+				return
+			}
+			args[i] = string(arg[:size])
+		}
+
+		s.mu.Lock()
+		s.commands = append(s.commands, args[0])
+		var reply string
+		switch {
+		case args[0] == "AUTH":
+			authenticated = args[len(args)-1] == s.password
+			reply = "+OK\r\n"
+			if !authenticated {
+				reply = "-WRONGPASS invalid password\r\n"
+			}
+		case !authenticated:
+			reply = "-NOAUTH Authentication required.\r\n"
+		case args[0] == "SELECT":
+			reply = "+OK\r\n"
+		case args[0] == "GET":
+			value, ok := s.get(args[1])
+			reply = "$-1\r\n"
+			if ok {
+				reply = fmt.Sprintf("$%d\r\n%s\r\n", len(value), value)
+			}
+		case args[0] == "SET":
+			reply = "+OK\r\n"
+			if _, ok := s.get(args[1]); ok && len(args) > 3 && args[len(args)-1] == "NX" {
+				reply = "$-1\r\n"
+				break
+			}
+			s.values[args[1]] = args[2]
+			delete(s.expires, args[1])
+			if len(args) > 4 && args[3] == "PX" {
+				ms, _ := strconv.Atoi(args[4])
+				s.expires[args[1]] = time.Now().Add(time.Duration(ms) * time.Millisecond)
+			}
+		case args[0] == "INCR":
+			value, _ := s.get(args[1])
+			count, _ := strconv.Atoi(value)
+			s.values[args[1]] = strconv.Itoa(count + 1)
+			reply = fmt.Sprintf(":%d\r\n", count+1)
+		case args[0] == "PTTL":
+			reply = ":-2\r\n"
+			if _, ok := s.get(args[1]); ok {
+				reply = ":-1\r\n"
+				if expiresAt, expires := s.expires[args[1]]; expires {
+					reply = fmt.Sprintf(":%d\r\n", time.Until(expiresAt).Milliseconds())
+				}
+			}
+		case args[0] == "PEXPIRE":
+			ms, _ := strconv.Atoi(args[2])
+			s.expires[args[1]] = time.Now().Add(time.Duration(ms) * time.Millisecond)
+			reply = ":1\r\n"
+		case args[0] == "DEL":
+			deleted := 0
+			for _, key := range args[1:] {
+				if _, ok := s.values[key]; ok {
+					delete(s.values, key)
+					deleted++
+				}
+			}
+			reply = fmt.Sprintf(":%d\r\n", deleted)
+		default:
+			reply = "-ERR unknown command\r\n"
+		}
+		s.mu.Unlock()
+
+		if _, err := conn.Write([]byte(reply)); err != nil {
+			return
+		}
+	}
+}
+
+// get must be called with s.mu held.
+func (s *fakeRedis) get(key string) (string, bool) {
+	if expiresAt, expires := s.expires[key]; expires && time.Now().After(expiresAt) {
+		delete(s.values, key)
+		delete(s.expires, key)
+	}
+	value, ok := s.values[key]
+	return value, ok
+}
+
+func TestRedisCache(t *testing.T) {
+	server := newFakeRedis(t, "secret")
+
+	_, err := cache.NewRedisCache(fmt.Sprintf("redis://:wrong@%s/1", server.listener.Addr()), time.Second)
+	assert.Error(t, err)
+
+	redisCache, err := cache.NewRedisCache(fmt.Sprintf("redis://:secret@%s/1", server.listener.Addr()), time.Second)
+	require.NoError(t, err)
+	defer redisCache.Close()
+
+	_, err = redisCache.Get("product:1")
+	assert.ErrorIs(t, err, ports.ErrCacheMiss)
+
+	assert.NoError(t, redisCache.Set("product:1", []byte("{\"name\":\"Book\"}\r\n"), time.Minute))
+	value, err := redisCache.Get("product:1")
+	assert.NoError(t, err)
+	assert.Equal(t, "{\"name\":\"Book\"}\r\n", string(value))
+
+	assert.NoError(t, redisCache.Set("empty", nil, 0))
+	value, err = redisCache.Get("empty")
+	assert.NoError(t, err)
+	assert.Empty(t, value)
+
+	assert.NoError(t, redisCache.Set("short", []byte("1"), time.Millisecond))
+	time.Sleep(5 * time.Millisecond)
+	_, err = redisCache.Get("short")
+	assert.ErrorIs(t, err, ports.ErrCacheMiss)
+
+	assert.NoError(t, redisCache.Delete("product:1", "empty"))
+	_, err = redisCache.Get("product:1")
+	assert.ErrorIs(t, err, ports.ErrCacheMiss)
+
+	server.mu.Lock()
+	assert.Equal(t, []string{"AUTH", "AUTH", "SELECT"}, server.commands[:3])
+	server.mu.Unlock()
+}
+
+func TestCachedProductRepository(t *testing.T) {
+	mockProductRepo := new(mocks.MockProductRepository)
+	mockStockRepo := new(mocks.MockStockRepository)
+	productCache := cache.NewProductCache(cache.NewLRUCache(100), cache.ProductCacheOptions{TTL: time.Minute})
+	productRepo := productCache.ProductRepository(mockProductRepo)
+	stockRepo := productCache.StockRepository(mockStockRepo)
+
+	book := models.Product{ID: 1, Name: "Book A", Quantity: 10}
+	page := models.PageRequest{Page: 1, PageSize: 20}
+	mockProductRepo.On("GetOne", uint(1)).Return(&book, nil).Once()
+	mockProductRepo.On("GetPage", page).Return([]models.Product{book}, int64(1), nil).Once()
+
+	for i := 0; i < 2; i++ {
+		product, err := productRepo.GetOne(1)
+		require.NoError(t, err)
+		assert.Equal(t, "Book A", product.Name)
+
+		products, total, err := productRepo.GetPage(page)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), total)
+		assert.Len(t, products, 1)
+	}
+	mockProductRepo.AssertExpectations(t)
+
+	// An update invalidates the product and the pages
+	updated := models.Product{ID: 1, Name: "Book A", Quantity: 0}
+	mockProductRepo.On("Update", updated).Return(nil).Once()
+	mockProductRepo.On("GetOne", uint(1)).Return(&updated, nil).Once()
+	mockProductRepo.On("GetPage", page).Return([]models.Product{updated}, int64(1), nil).Once()
+	require.NoError(t, productRepo.Update(updated))
+
+	product, err := productRepo.GetOne(1)
+	require.NoError(t, err)
+	assert.Equal(t, 0, product.Quantity)
+	products, _, err := productRepo.GetPage(page)
+	require.NoError(t, err)
+	assert.Equal(t, 0, products[0].Quantity)
+
+	// So does a stock movement
+	moved := models.Product{ID: 1, Name: "Book A", Quantity: 5}
+	movements := []models.StockMovement{{ProductID: 1, Delta: 5}}
+	mockStockRepo.On("ApplyStockMovements", "event-1", movements).Return([]models.Product{moved}, nil).Once()
+	mockProductRepo.On("GetOne", uint(1)).Return(&moved, nil).Once()
+	_, err = stockRepo.ApplyStockMovements("event-1", movements)
+	require.NoError(t, err)
+	product, err = productRepo.GetOne(1)
+	require.NoError(t, err)
+	assert.Equal(t, 5, product.Quantity)
+
+	// Not found is not cached
+	mockProductRepo.On("GetOne", uint(2)).Return(nil, gorm.ErrRecordNotFound).Twice()
+	_, err = productRepo.GetOne(2)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	_, err = productRepo.GetOne(2)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+	mockProductRepo.AssertExpectations(t)
+	mockStockRepo.AssertExpectations(t)
+}
+
+func TestCachedProductRepositoryStampede(t *testing.T) {
+	mockProductRepo := new(mocks.MockProductRepository)
+	productCache := cache.NewProductCache(cache.NewLRUCache(100), cache.ProductCacheOptions{TTL: time.Minute})
+	productRepo := productCache.ProductRepository(mockProductRepo)
+
+	// Concurrent misses share a single slow read
+	mockProductRepo.On("GetOne", uint(1)).Return(&models.Product{ID: 1, Name: "Book A"}, nil).
+		After(50 * time.Millisecond).Once()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			product, err := productRepo.GetOne(1)
+			if assert.NoError(t, err) {
+				assert.Equal(t, "Book A", product.Name)
+			}
+		}()
+	}
+	wg.Wait()
+
+	mockProductRepo.AssertExpectations(t)
+	mockProductRepo.AssertNumberOfCalls(t, "GetOne", 1)
+}
@@ -0,0 +1,941 @@
+// Package contract is the test suite every repository implementation has to pass,
+// so that the adapters are interchangeable.
+package contract
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/WarisLi/Golang-mini-project/internal/config"
+	"github.com/WarisLi/Golang-mini-project/internal/core/models"
+	"github.com/WarisLi/Golang-mini-project/internal/core/ports"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// NewRepositories returns migrated and empty repositories.
+type NewRepositories func(t *testing.T) *config.Repositories
+
+// RunRepositoryContract runs the contract suite, each test on new repositories.
+func RunRepositoryContract(t *testing.T, newRepositories NewRepositories) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, repos *config.Repositories)
+	}{
+		{"ProductCRUD", testProductCRUD},
+		{"ProductNotFound", testProductNotFound},
+		{"ProductSoftDelete", testProductSoftDelete},
+		{"ProductPage", testProductPage},
+		{"ProductOperations", testProductOperations},
+		{"ProductSearch", testProductSearch},
+		{"ConcurrentProductSaves", testConcurrentProductSaves},
+		{"User", testUser},
+		{"FailedLogins", testFailedLogins},
+		{"TwoFactorState", testTwoFactorState},
+		{"PasswordReset", testPasswordReset},
+		{"UserAdmin", testUserAdmin},
+		{"APIKey", testAPIKey},
+		{"SigningKey", testSigningKey},
+		{"ExternalIdentity", testExternalIdentity},
+		{"OIDCLogin", testOIDCLogin},
+		{"Outbox", testOutbox},
+		{"Stock", testStock},
+		{"Webhook", testWebhook},
+		{"Idempotency", testIdempotency},
+		{"UnitOfWork", testUnitOfWork},
+		{"ConcurrentUnitsOfWork", testConcurrentUnitsOfWork},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.test(t, newRepositories(t))
+		})
+	}
+}
+
+func saveProduct(t *testing.T, repos *config.Repositories, product models.Product) models.Product {
+	id, err := repos.Product.Save(product)
+	require.NoError(t, err)
+	require.NotZero(t, id)
+
+	saved, err := repos.Product.GetOne(id)
+	require.NoError(t, err)
+	return *saved
+}
+
+func testProductCRUD(t *testing.T, repos *config.Repositories) {
+	product := saveProduct(t, repos, models.Product{Name: "Book A", Quantity: 10, Category: "Books", SKU: "BK-1", Description: "Hardcover"})
+	assert.Equal(t, "Book A", product.Name)
+	assert.Equal(t, 10, product.Quantity)
+	assert.Equal(t, "Books", product.Category)
+	assert.Equal(t, "BK-1", product.SKU)
+	assert.Equal(t, "Hardcover", product.Description)
+
+	_, err := repos.Product.GetOne(product.ID + 100)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+	// Zero values are saved by an update
+	product.Name = "Book B"
+	product.Quantity = 0
+	product.Category = ""
+	require.NoError(t, repos.Product.Update(product))
+	updated, err := repos.Product.GetOne(product.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Book B", updated.Name)
+	assert.Equal(t, 0, updated.Quantity)
+	assert.Equal(t, "", updated.Category)
+
+	// Product names are not unique
+	duplicate := saveProduct(t, repos, models.Product{Name: "Book B", Quantity: 1})
+	assert.NotEqual(t, product.ID, duplicate.ID)
+
+	products, err := repos.Product.GetAll()
+	require.NoError(t, err)
+	assert.Len(t, products, 2)
+}
+
+func testProductNotFound(t *testing.T, repos *config.Repositories) {
+	_, err := repos.Product.GetOne(1000)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	assert.ErrorIs(t, repos.Product.Update(models.Product{ID: 1000, Name: "Missing"}), gorm.ErrRecordNotFound)
+	assert.ErrorIs(t, repos.Product.Delete(1000), gorm.ErrRecordNotFound)
+
+	products, err := repos.Product.GetAll()
+	require.NoError(t, err)
+	assert.Empty(t, products, "an update of a missing product must not create it")
+}
+
+func testProductSoftDelete(t *testing.T, repos *config.Repositories) {
+	product := saveProduct(t, repos, models.Product{Name: "Book A", Quantity: 10})
+	kept := saveProduct(t, repos, models.Product{Name: "Book B", Quantity: 10})
+	require.NoError(t, repos.Product.Delete(product.ID))
+
+	// A deleted product is gone for every operation
+	_, err := repos.Product.GetOne(product.ID)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	assert.ErrorIs(t, repos.Product.Delete(product.ID), gorm.ErrRecordNotFound)
+	assert.ErrorIs(t, repos.Product.Update(models.Product{ID: product.ID, Name: "Book A2"}), gorm.ErrRecordNotFound)
+	_, err = repos.Product.ApplyProductOperations([]models.ProductOperation{
+		{Op: models.ProductOperationUpdate, Product: models.Product{ID: product.ID, Name: "Book A2"}},
+	})
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	_, err = repos.Stock.ApplyStockMovements("event-1", []models.StockMovement{{ProductID: product.ID, Delta: 1}})
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+	products, err := repos.Product.GetAll()
+	require.NoError(t, err)
+	if assert.Len(t, products, 1) {
+		assert.Equal(t, kept.ID, products[0].ID)
+	}
+	_, total, err := repos.Product.GetPage(models.PageRequest{Page: 1, PageSize: 10})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), total)
+
+	// IDs of deleted products are not reused
+	created := saveProduct(t, repos, models.Product{Name: "Book C", Quantity: 1})
+	assert.Greater(t, created.ID, kept.ID)
+}
+
+func testProductPage(t *testing.T, repos *config.Repositories) {
+	var ids []uint
+	for i := 1; i <= 5; i++ {
+		ids = append(ids, saveProduct(t, repos, models.Product{Name: fmt.Sprintf("Book %d", i), Quantity: i}).ID)
+	}
+	require.NoError(t, repos.Product.Delete(ids[0]))
+
+	products, total, err := repos.Product.GetPage(models.PageRequest{Page: 1, PageSize: 3})
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), total)
+	if assert.Len(t, products, 3) {
+		assert.Equal(t, []uint{ids[1], ids[2], ids[3]}, []uint{products[0].ID, products[1].ID, products[2].ID})
+	}
+
+	products, total, err = repos.Product.GetPage(models.PageRequest{Page: 2, PageSize: 3})
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), total)
+	if assert.Len(t, products, 1) {
+		assert.Equal(t, ids[4], products[0].ID)
+	}
+
+	products, _, err = repos.Product.GetPage(models.PageRequest{Page: 3, PageSize: 3})
+	require.NoError(t, err)
+	assert.Empty(t, products)
+}
+
+func testProductOperations(t *testing.T, repos *config.Repositories) {
+	existing := saveProduct(t, repos, models.Product{Name: "Book A", Quantity: 10})
+
+	products, err := repos.Product.ApplyProductOperations([]models.ProductOperation{
+		{Op: models.ProductOperationCreate, Product: models.Product{Name: "Book B", Quantity: 5}},
+		{Op: models.ProductOperationUpdate, Product: models.Product{ID: existing.ID, Name: "Book A2", Quantity: 0}},
+	})
+	require.NoError(t, err)
+	require.Len(t, products, 2)
+	created := products[0]
+	assert.NotZero(t, created.ID)
+	assert.Equal(t, "Book B", created.Name)
+
+	updated, err := repos.Product.GetOne(existing.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Book A2", updated.Name)
+	assert.Equal(t, 0, updated.Quantity)
+
+	// A failing operation rolls back the operations before it
+	_, err = repos.Product.ApplyProductOperations([]models.ProductOperation{
+		{Op: models.ProductOperationCreate, Product: models.Product{Name: "Book C", Quantity: 1}},
+		{Op: models.ProductOperationDelete, Product: models.Product{ID: existing.ID}},
+		{Op: models.ProductOperationUpdate, Product: models.Product{ID: created.ID + 100, Name: "Missing"}},
+	})
+	var operationErr *ports.BatchOperationError
+	require.ErrorAs(t, err, &operationErr)
+	assert.Equal(t, 2, operationErr.Index)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+	all, err := repos.Product.GetAll()
+	require.NoError(t, err)
+	assert.Len(t, all, 2)
+	_, err = repos.Product.GetOne(existing.ID)
+	assert.NoError(t, err)
+
+	products, err = repos.Product.ApplyProductOperations([]models.ProductOperation{
+		{Op: models.ProductOperationDelete, Product: models.Product{ID: created.ID}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "Book B", products[0].Name)
+	_, err = repos.Product.GetOne(created.ID)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+	_, err = repos.Product.ApplyProductOperations([]models.ProductOperation{
+		{Op: models.ProductOperationDelete, Product: models.Product{ID: created.ID}},
+	})
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+}
+
+func testProductSearch(t *testing.T, repos *config.Repositories) {
+	book := saveProduct(t, repos, models.Product{Name: "Gopher Book", Quantity: 1, SKU: "BK-1", Description: "Programming in Go"})
+	saveProduct(t, repos, models.Product{Name: "Coffee Mug", Quantity: 1, SKU: "MG-1", Description: "Ceramic"})
+	deleted := saveProduct(t, repos, models.Product{Name: "Gopher Plush", Quantity: 1})
+	require.NoError(t, repos.Product.Delete(deleted.ID))
+
+	results, total, err := repos.ProductSearcher.SearchProducts(models.ProductSearchQuery{
+		Query:       "gopher programming",
+		PageRequest: models.PageRequest{Page: 1, PageSize: 10},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), total)
+	if assert.Len(t, results, 1) {
+		assert.Equal(t, book.ID, results[0].Product.ID)
+	}
+
+	results, total, err = repos.ProductSearcher.SearchProducts(models.ProductSearchQuery{
+		Query:       "nothing",
+		PageRequest: models.PageRequest{Page: 1, PageSize: 10},
+	})
+	require.NoError(t, err)
+	assert.Zero(t, total)
+	assert.Empty(t, results)
+}
+
+func testConcurrentProductSaves(t *testing.T, repos *config.Repositories) {
+	const saves = 20
+
+	var wg sync.WaitGroup
+	ids := make([]uint, saves)
+	errs := make([]error, saves)
+	for i := 0; i < saves; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ids[i], errs[i] = repos.Product.Save(models.Product{Name: fmt.Sprintf("Book %d", i), Quantity: 1})
+		}(i)
+	}
+	wg.Wait()
+
+	unique := map[uint]bool{}
+	for i := range ids {
+		require.NoError(t, errs[i])
+		unique[ids[i]] = true
+	}
+	assert.Len(t, unique, saves)
+
+	products, err := repos.Product.GetAll()
+	require.NoError(t, err)
+	assert.Len(t, products, saves)
+}
+
+func testUser(t *testing.T, repos *config.Repositories) {
+	require.NoError(t, repos.User.Create(models.User{Username: "user_1", Password: "hash", Email: "user_1@example.com"}))
+	assert.ErrorIs(t, repos.User.Create(models.User{Username: "user_1", Password: "other"}), gorm.ErrDuplicatedKey)
+
+	user, err := repos.User.GetUser("user_1")
+	require.NoError(t, err)
+	assert.Equal(t, "hash", user.Password)
+	assert.Equal(t, "user_1@example.com", user.Email)
+	// The users are not administrators unless granted
+	assert.Equal(t, models.RoleUser, user.Role)
+	assert.False(t, user.Disabled)
+
+	_, err = repos.User.GetUser("missing")
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+	user.Role = models.RoleUser
+	user.Disabled = true
+	require.NoError(t, repos.User.UpdateUser(*user))
+	user, err = repos.User.GetUser("user_1")
+	require.NoError(t, err)
+	assert.Equal(t, models.RoleUser, user.Role)
+	assert.True(t, user.Disabled)
+
+	user.Disabled = false
+	require.NoError(t, repos.User.UpdateUser(*user))
+	user, err = repos.User.GetUser("user_1")
+	require.NoError(t, err)
+	assert.False(t, user.Disabled)
+	assert.Equal(t, 0, user.FailedLogins)
+	assert.Nil(t, user.LockedUntil)
+
+	lockedUntil := time.Now().Add(time.Hour).Truncate(time.Millisecond)
+	user.FailedLogins = 5
+	user.LockedUntil = &lockedUntil
+	require.NoError(t, repos.User.UpdateUser(*user))
+	user, err = repos.User.GetUser("user_1")
+	require.NoError(t, err)
+	assert.Equal(t, 5, user.FailedLogins)
+	require.NotNil(t, user.LockedUntil)
+	assert.True(t, lockedUntil.Equal(*user.LockedUntil))
+
+	user.FailedLogins = 0
+	user.LockedUntil = nil
+	user.Password = "rehashed"
+	user.SessionVersion = 1
+	user.TOTPSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	user.TOTPEnabled = true
+	user.TOTPLastStep = 56666666
+	user.RecoveryCodes = "hash_1,hash_2"
+	require.NoError(t, repos.User.UpdateUser(*user))
+	user, err = repos.User.GetUser("user_1")
+	require.NoError(t, err)
+	assert.Equal(t, 0, user.FailedLogins)
+	assert.Nil(t, user.LockedUntil)
+	assert.Equal(t, "rehashed", user.Password)
+	assert.Equal(t, 1, user.SessionVersion)
+	assert.Equal(t, "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ", user.TOTPSecret)
+	assert.True(t, user.TOTPEnabled)
+	assert.Equal(t, int64(56666666), user.TOTPLastStep)
+	assert.Equal(t, "hash_1,hash_2", user.RecoveryCodes)
+
+	user.TOTPSecret = ""
+	user.TOTPEnabled = false
+	user.RecoveryCodes = ""
+	require.NoError(t, repos.User.UpdateUser(*user))
+	user, err = repos.User.GetUser("user_1")
+	require.NoError(t, err)
+	assert.Empty(t, user.TOTPSecret)
+	assert.False(t, user.TOTPEnabled)
+	assert.Empty(t, user.RecoveryCodes)
+}
+
+func testFailedLogins(t *testing.T, repos *config.Repositories) {
+	require.NoError(t, repos.User.Create(models.User{Username: "user_1", Password: "hash", Role: models.RoleAdmin}))
+
+	// The concurrent failures are all counted, each one sees its own count
+	const failures = 20
+	counts := make(chan int, failures)
+	var wg sync.WaitGroup
+	for i := 0; i < failures; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			count, err := repos.User.AddFailedLogin("user_1")
+			assert.NoError(t, err)
+			counts <- count
+		}()
+	}
+	wg.Wait()
+	close(counts)
+	var seen []int
+	for count := range counts {
+		seen = append(seen, count)
+	}
+	slices.Sort(seen)
+	require.Len(t, seen, failures)
+	assert.Equal(t, 1, seen[0])
+	assert.Equal(t, failures, seen[failures-1])
+
+	_, err := repos.User.AddFailedLogin("missing")
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+	now := time.Now().Truncate(time.Second)
+	require.NoError(t, repos.User.LockUser("user_1", now.Add(time.Hour)))
+	require.NoError(t, repos.User.LockUser("user_1", now.Add(time.Minute)))
+	user, err := repos.User.GetUser("user_1")
+	require.NoError(t, err)
+	assert.Equal(t, failures, user.FailedLogins)
+	if assert.NotNil(t, user.LockedUntil) {
+		assert.WithinDuration(t, now.Add(time.Hour), *user.LockedUntil, time.Second, "the longer lock is kept")
+	}
+	// The other columns are left as they are
+	assert.Equal(t, models.RoleAdmin, user.Role)
+
+	require.NoError(t, repos.User.ResetFailedLogins("user_1"))
+	user, err = repos.User.GetUser("user_1")
+	require.NoError(t, err)
+	assert.Equal(t, 0, user.FailedLogins)
+	assert.Nil(t, user.LockedUntil)
+
+	require.NoError(t, repos.User.UpdatePasswordHash("user_1", "hash", "rehash"))
+	assert.ErrorIs(t, repos.User.UpdatePasswordHash("user_1", "hash", "other"), gorm.ErrRecordNotFound, "changed since")
+	user, err = repos.User.GetUser("user_1")
+	require.NoError(t, err)
+	assert.Equal(t, "rehash", user.Password)
+}
+
+func testTwoFactorState(t *testing.T, repos *config.Repositories) {
+	require.NoError(t, repos.User.Create(models.User{Username: "user_1", Password: "hash", Role: models.RoleUser}))
+
+	enabled := models.TwoFactorState{TOTPSecret: "secret", TOTPEnabled: true, TOTPLastStep: 10, RecoveryCodes: "a,b"}
+	require.NoError(t, repos.User.UpdateTwoFactor("user_1", models.TwoFactorState{}, enabled))
+
+	// Concurrent uses of the same code, only one changes the state it was checked against
+	const uses = 20
+	var wg sync.WaitGroup
+	var updated atomic.Int32
+	for i := 0; i < uses; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			used := enabled
+			used.RecoveryCodes = "b"
+			err := repos.User.UpdateTwoFactor("user_1", enabled, used)
+			if err == nil {
+				updated.Add(1)
+			} else {
+				assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), updated.Load())
+
+	user, err := repos.User.GetUser("user_1")
+	require.NoError(t, err)
+	assert.Equal(t, models.TwoFactorState{TOTPSecret: "secret", TOTPEnabled: true, TOTPLastStep: 10, RecoveryCodes: "b"}, user.TwoFactorState())
+	// The other columns are left as they are
+	assert.Equal(t, "hash", user.Password)
+
+	assert.ErrorIs(t, repos.User.UpdateTwoFactor("missing", models.TwoFactorState{}, enabled), gorm.ErrRecordNotFound)
+}
+
+func testUserAdmin(t *testing.T, repos *config.Repositories) {
+	require.NoError(t, repos.User.Create(models.User{Username: "alice", Password: "hash", Email: "alice@example.com", Role: models.RoleAdmin}))
+	require.NoError(t, repos.User.Create(models.User{Username: "bob_1", Password: "hash", Email: "bob@Example.org", Role: models.RoleUser}))
+	require.NoError(t, repos.User.Create(models.User{Username: "bobby", Password: "hash", Role: models.RoleUser}))
+	bobby, err := repos.User.GetUser("bobby")
+	require.NoError(t, err)
+	bobby.Disabled = true
+	require.NoError(t, repos.User.UpdateUser(*bobby))
+
+	disabled, enabled := true, false
+	page := models.PageRequest{Page: 1, PageSize: 10}
+	tests := []struct {
+		description     string
+		query           models.UserQuery
+		expectUsernames []string
+		expectTotal     int64
+	}{
+		{description: "All", query: models.UserQuery{PageRequest: page}, expectUsernames: []string{"alice", "bob_1", "bobby"}, expectTotal: 3},
+		{description: "Username", query: models.UserQuery{Query: "BOB", PageRequest: page}, expectUsernames: []string{"bob_1", "bobby"}, expectTotal: 2},
+		{description: "Email", query: models.UserQuery{Query: "example.ORG", PageRequest: page}, expectUsernames: []string{"bob_1"}, expectTotal: 1},
+		{description: "Wildcard is literal", query: models.UserQuery{Query: "b_b", PageRequest: page}, expectUsernames: []string{}, expectTotal: 0},
+		{description: "Underscore", query: models.UserQuery{Query: "b_1", PageRequest: page}, expectUsernames: []string{"bob_1"}, expectTotal: 1},
+		{description: "Role", query: models.UserQuery{Role: models.RoleUser, PageRequest: page}, expectUsernames: []string{"bob_1", "bobby"}, expectTotal: 2},
+		{description: "Disabled", query: models.UserQuery{Disabled: &disabled, PageRequest: page}, expectUsernames: []string{"bobby"}, expectTotal: 1},
+		{description: "Enabled", query: models.UserQuery{Disabled: &enabled, Role: models.RoleUser, PageRequest: page}, expectUsernames: []string{"bob_1"}, expectTotal: 1},
+		{description: "Second page", query: models.UserQuery{PageRequest: models.PageRequest{Page: 2, PageSize: 2}}, expectUsernames: []string{"bobby"}, expectTotal: 3},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			users, total, err := repos.User.GetUsers(test.query)
+			require.NoError(t, err)
+			usernames := []string{}
+			for _, user := range users {
+				usernames = append(usernames, user.Username)
+			}
+			assert.Equal(t, test.expectUsernames, usernames)
+			assert.Equal(t, test.expectTotal, total)
+		})
+	}
+
+	now := time.Now()
+	for _, token := range []models.PasswordResetToken{
+		{TokenHash: "hash-1", Username: "bob_1", CreatedAt: now, ExpiresAt: now.Add(time.Hour)},
+		{TokenHash: "hash-2", Username: "alice", CreatedAt: now, ExpiresAt: now.Add(time.Hour)},
+	} {
+		require.NoError(t, repos.PasswordReset.CreatePasswordResetToken(token))
+	}
+	require.NoError(t, repos.PasswordReset.DeleteUserPasswordResetTokens("bob_1"))
+	_, err = repos.PasswordReset.GetPasswordResetToken("hash-1")
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	_, err = repos.PasswordReset.GetPasswordResetToken("hash-2")
+	assert.NoError(t, err)
+
+	require.NoError(t, repos.User.DeleteUser("bob_1"))
+	assert.ErrorIs(t, repos.User.DeleteUser("bob_1"), gorm.ErrRecordNotFound)
+	_, err = repos.User.GetUser("bob_1")
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+	// The username of a deleted user is free again
+	assert.NoError(t, repos.User.Create(models.User{Username: "bob_1", Password: "hash"}))
+}
+
+func testPasswordReset(t *testing.T, repos *config.Repositories) {
+	now := time.Now().Truncate(time.Millisecond)
+	require.NoError(t, repos.PasswordReset.CreatePasswordResetToken(models.PasswordResetToken{
+		TokenHash: "hash-1", Username: "user_1", CreatedAt: now, ExpiresAt: now.Add(time.Hour),
+	}))
+	require.NoError(t, repos.PasswordReset.CreatePasswordResetToken(models.PasswordResetToken{
+		TokenHash: "hash-2", Username: "user_1", CreatedAt: now.Add(-time.Hour), ExpiresAt: now.Add(-time.Minute),
+	}))
+
+	token, err := repos.PasswordReset.GetPasswordResetToken("hash-1")
+	require.NoError(t, err)
+	assert.Equal(t, "user_1", token.Username)
+	assert.True(t, now.Add(time.Hour).Equal(token.ExpiresAt))
+	assert.Nil(t, token.UsedAt)
+
+	_, err = repos.PasswordReset.GetPasswordResetToken("missing")
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+	// A token is used once
+	require.NoError(t, repos.PasswordReset.UsePasswordResetToken("hash-1", now))
+	assert.ErrorIs(t, repos.PasswordReset.UsePasswordResetToken("hash-1", now), ports.ErrInvalidResetToken)
+	token, err = repos.PasswordReset.GetPasswordResetToken("hash-1")
+	require.NoError(t, err)
+	require.NotNil(t, token.UsedAt)
+	assert.True(t, now.Equal(*token.UsedAt))
+
+	require.NoError(t, repos.PasswordReset.DeleteExpiredPasswordResetTokens(now))
+	_, err = repos.PasswordReset.GetPasswordResetToken("hash-2")
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	_, err = repos.PasswordReset.GetPasswordResetToken("hash-1")
+	assert.NoError(t, err)
+}
+
+func testAPIKey(t *testing.T, repos *config.Repositories) {
+	expiresAt := time.Now().Add(time.Hour).Truncate(time.Millisecond)
+	id, err := repos.APIKey.CreateAPIKey(models.APIKey{
+		Username: "user_1", Name: "ERP", KeyID: "key-1", SecretHash: "hash-1",
+		Scopes: models.ScopeProductRead + "," + models.ScopeProductWrite, ExpiresAt: expiresAt,
+	})
+	require.NoError(t, err)
+	_, err = repos.APIKey.CreateAPIKey(models.APIKey{Username: "user_1", KeyID: "key-1", SecretHash: "hash-2", ExpiresAt: expiresAt})
+	assert.ErrorIs(t, err, gorm.ErrDuplicatedKey)
+	_, err = repos.APIKey.CreateAPIKey(models.APIKey{Username: "user_2", KeyID: "key-2", SecretHash: "hash-2", ExpiresAt: expiresAt})
+	require.NoError(t, err)
+
+	key, err := repos.APIKey.GetAPIKeyByKeyID("key-1")
+	require.NoError(t, err)
+	assert.Equal(t, id, key.ID)
+	assert.Equal(t, "hash-1", key.SecretHash)
+	assert.Equal(t, []string{models.ScopeProductRead, models.ScopeProductWrite}, key.ScopeList())
+	assert.True(t, expiresAt.Equal(key.ExpiresAt))
+	assert.Nil(t, key.LastUsedAt)
+	_, err = repos.APIKey.GetAPIKeyByKeyID("missing")
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+	usedAt := time.Now().Truncate(time.Millisecond)
+	require.NoError(t, repos.APIKey.TouchAPIKey(id, usedAt))
+	key.RevokedAt = &usedAt
+	require.NoError(t, repos.APIKey.UpdateAPIKey(*key))
+	key, err = repos.APIKey.GetAPIKey(id)
+	require.NoError(t, err)
+	require.NotNil(t, key.LastUsedAt)
+	assert.True(t, usedAt.Equal(*key.LastUsedAt))
+	require.NotNil(t, key.RevokedAt)
+	assert.False(t, key.Active(time.Now()))
+
+	keys, err := repos.APIKey.GetUserAPIKeys("user_1")
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	assert.Equal(t, "key-1", keys[0].KeyID)
+
+	require.NoError(t, repos.APIKey.DeleteUserAPIKeys("user_1"))
+	_, err = repos.APIKey.GetAPIKey(id)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	keys, err = repos.APIKey.GetUserAPIKeys("user_2")
+	require.NoError(t, err)
+	assert.Len(t, keys, 1)
+}
+
+func testSigningKey(t *testing.T, repos *config.Repositories) {
+	now := time.Now().Truncate(time.Millisecond)
+	require.NoError(t, repos.SigningKey.CreateSigningKey(models.SigningKey{
+		KeyID: "key-2", Algorithm: models.AlgorithmEdDSA, PrivateKey: "private-2", ActivatesAt: now.Add(time.Hour),
+	}))
+	require.NoError(t, repos.SigningKey.CreateSigningKey(models.SigningKey{
+		KeyID: "key-1", Algorithm: models.AlgorithmRS256, PrivateKey: "private-1", ActivatesAt: now,
+	}))
+	err := repos.SigningKey.CreateSigningKey(models.SigningKey{KeyID: "key-1", Algorithm: models.AlgorithmRS256, PrivateKey: "private-3", ActivatesAt: now})
+	assert.ErrorIs(t, err, gorm.ErrDuplicatedKey)
+
+	// Ordered by activation
+	keys, err := repos.SigningKey.GetSigningKeys()
+	require.NoError(t, err)
+	require.Len(t, keys, 2)
+	assert.Equal(t, "key-1", keys[0].KeyID)
+	assert.Equal(t, models.AlgorithmRS256, keys[0].Algorithm)
+	assert.Equal(t, "private-1", keys[0].PrivateKey)
+	assert.True(t, now.Equal(keys[0].ActivatesAt))
+	assert.Equal(t, "key-2", keys[1].KeyID)
+
+	require.NoError(t, repos.SigningKey.DeleteSigningKey(keys[0].ID))
+	keys, err = repos.SigningKey.GetSigningKeys()
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	assert.Equal(t, "key-2", keys[0].KeyID)
+}
+
+func testExternalIdentity(t *testing.T, repos *config.Repositories) {
+	subject := "subject-1"
+	require.NoError(t, repos.User.Create(models.User{Username: "user_1", Password: "hash"}))
+	require.NoError(t, repos.User.Create(models.User{Username: "user_2", Role: models.RoleUser, IdentityProvider: "corp", ExternalSubject: &subject}))
+	// Only one user is linked to an identity, the users without one do not conflict
+	assert.ErrorIs(t, repos.User.Create(models.User{Username: "user_3", IdentityProvider: "corp", ExternalSubject: &subject}), gorm.ErrDuplicatedKey)
+	require.NoError(t, repos.User.Create(models.User{Username: "user_4", Password: "hash"}))
+
+	user, err := repos.User.GetUserByIdentity("corp", "subject-1")
+	require.NoError(t, err)
+	assert.Equal(t, "user_2", user.Username)
+	assert.Equal(t, "corp", user.IdentityProvider)
+	_, err = repos.User.GetUserByIdentity("other", "subject-1")
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	_, err = repos.User.GetUserByIdentity("corp", "missing")
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+	// An existing user is linked
+	user, err = repos.User.GetUser("user_1")
+	require.NoError(t, err)
+	other := "subject-2"
+	user.IdentityProvider = "corp"
+	user.ExternalSubject = &other
+	user.Password = ""
+	require.NoError(t, repos.User.UpdateUser(*user))
+	user, err = repos.User.GetUserByIdentity("corp", "subject-2")
+	require.NoError(t, err)
+	assert.Equal(t, "user_1", user.Username)
+	assert.Empty(t, user.Password)
+
+	user, err = repos.User.GetUser("user_4")
+	require.NoError(t, err)
+	user.IdentityProvider = "corp"
+	user.ExternalSubject = &other
+	assert.ErrorIs(t, repos.User.UpdateUser(*user), gorm.ErrDuplicatedKey)
+}
+
+func testOIDCLogin(t *testing.T, repos *config.Repositories) {
+	now := time.Now().Truncate(time.Millisecond)
+	require.NoError(t, repos.OIDCLogin.CreateOIDCLogin(models.OIDCLogin{
+		StateHash: "hash-1", Provider: "corp", Nonce: "nonce-1", CodeVerifier: "verifier-1", CreatedAt: now, ExpiresAt: now.Add(time.Minute),
+	}))
+	require.NoError(t, repos.OIDCLogin.CreateOIDCLogin(models.OIDCLogin{
+		StateHash: "hash-2", Provider: "corp", Nonce: "nonce-2", CodeVerifier: "verifier-2", CreatedAt: now.Add(-time.Hour), ExpiresAt: now.Add(-time.Minute),
+	}))
+
+	// A login is taken once
+	login, err := repos.OIDCLogin.TakeOIDCLogin("hash-1")
+	require.NoError(t, err)
+	assert.Equal(t, "corp", login.Provider)
+	assert.Equal(t, "nonce-1", login.Nonce)
+	assert.Equal(t, "verifier-1", login.CodeVerifier)
+	assert.True(t, now.Add(time.Minute).Equal(login.ExpiresAt))
+	_, err = repos.OIDCLogin.TakeOIDCLogin("hash-1")
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+	require.NoError(t, repos.OIDCLogin.DeleteExpiredOIDCLogins(now))
+	_, err = repos.OIDCLogin.TakeOIDCLogin("hash-2")
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+}
+
+func testOutbox(t *testing.T, repos *config.Repositories) {
+	id, err := repos.Outbox.SaveEvent(models.OutboxEvent{Topic: "A", Payload: []byte(`{}`)})
+	require.NoError(t, err)
+	_, err = repos.Outbox.SaveEvent(models.OutboxEvent{Topic: "B", Payload: []byte(`{}`), Attempts: 1})
+	require.NoError(t, err)
+	// A consumed message is a dead letter but it is never replayed
+	consumedID, err := repos.Outbox.SaveEvent(models.OutboxEvent{Topic: "C", Payload: []byte(`{}`), Attempts: 1, Consumed: true})
+	require.NoError(t, err)
+	consumed, err := repos.Outbox.GetFailedEvent(consumedID)
+	require.NoError(t, err)
+	assert.True(t, consumed.Consumed)
+	require.NoError(t, repos.Outbox.DeleteFailedEvent(consumedID))
+
+	events, err := repos.Outbox.GetPendingEvents()
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	assert.Equal(t, id, events[0].ID)
+	assert.Equal(t, "A", events[0].Topic)
+	assert.Equal(t, "B", events[1].Topic)
+
+	// The event not attempted yet is being published, it is not a dead letter
+	failed, err := repos.Outbox.GetFailedEvents()
+	require.NoError(t, err)
+	require.Len(t, failed, 1)
+	assert.Equal(t, "B", failed[0].Topic)
+	_, err = repos.Outbox.GetFailedEvent(events[0].ID)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	assert.ErrorIs(t, repos.Outbox.DeleteFailedEvent(events[0].ID), gorm.ErrRecordNotFound)
+
+	require.NoError(t, repos.Outbox.RecordEventFailure(events[1].ID, "broker down"))
+	event, err := repos.Outbox.GetFailedEvent(events[1].ID)
+	require.NoError(t, err)
+	assert.Equal(t, 2, event.Attempts)
+	assert.Equal(t, "broker down", event.LastError)
+
+	require.NoError(t, repos.Outbox.RecordEventFailure(events[0].ID, "broker down"))
+	count, err := repos.Outbox.CountFailedEvents()
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+	require.NoError(t, repos.Outbox.MarkEventPublished(events[0].ID))
+	_, err = repos.Outbox.GetFailedEvent(events[0].ID)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	count, err = repos.Outbox.CountFailedEvents()
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+
+	// The published events are not dead letters to discard
+	assert.ErrorIs(t, repos.Outbox.DeleteFailedEvent(events[0].ID), gorm.ErrRecordNotFound)
+	require.NoError(t, repos.Outbox.DeleteFailedEvent(events[1].ID))
+	assert.ErrorIs(t, repos.Outbox.DeleteFailedEvent(events[1].ID), gorm.ErrRecordNotFound)
+	count, err = repos.Outbox.CountFailedEvents()
+	require.NoError(t, err)
+	assert.Zero(t, count)
+}
+
+func testStock(t *testing.T, repos *config.Repositories) {
+	a := saveProduct(t, repos, models.Product{Name: "Book A", Quantity: 10})
+	b := saveProduct(t, repos, models.Product{Name: "Book B", Quantity: 1})
+
+	products, err := repos.Stock.ApplyStockMovements("event-1", []models.StockMovement{{ProductID: a.ID, Delta: -4}, {ProductID: b.ID, Delta: 2}})
+	require.NoError(t, err)
+	require.Len(t, products, 2)
+	assert.Equal(t, 6, products[0].Quantity)
+	assert.Equal(t, 3, products[1].Quantity)
+
+	_, err = repos.Stock.ApplyStockMovements("event-1", []models.StockMovement{{ProductID: a.ID, Delta: -1}})
+	assert.ErrorIs(t, err, ports.ErrEventAlreadyProcessed)
+
+	// The movements and the event are rolled back together
+	_, err = repos.Stock.ApplyStockMovements("event-2", []models.StockMovement{{ProductID: a.ID, Delta: -1}, {ProductID: b.ID, Delta: -4}})
+	assert.ErrorIs(t, err, ports.ErrInsufficientStock)
+	_, err = repos.Stock.ApplyStockMovements("event-3", []models.StockMovement{{ProductID: a.ID, Delta: -1}, {ProductID: b.ID + 100, Delta: 1}})
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+	product, err := repos.Product.GetOne(a.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 6, product.Quantity)
+
+	_, err = repos.Stock.ApplyStockMovements("event-2", []models.StockMovement{{ProductID: a.ID, Delta: -1}})
+	assert.NoError(t, err)
+}
+
+func testWebhook(t *testing.T, repos *config.Repositories) {
+	id, err := repos.Webhook.CreateWebhook(models.Webhook{URL: "https://a.example.com", EventTypes: "*", Secret: "secret", Active: true})
+	require.NoError(t, err)
+	inactiveID, err := repos.Webhook.CreateWebhook(models.Webhook{URL: "https://b.example.com", EventTypes: "*", Secret: "secret", Active: true})
+	require.NoError(t, err)
+
+	inactive, err := repos.Webhook.GetWebhook(inactiveID)
+	require.NoError(t, err)
+	now := time.Now()
+	inactive.Active = false
+	inactive.FailureCount = 3
+	inactive.DisabledAt = &now
+	require.NoError(t, repos.Webhook.UpdateWebhook(*inactive))
+
+	inactive, err = repos.Webhook.GetWebhook(inactiveID)
+	require.NoError(t, err)
+	assert.False(t, inactive.Active)
+	assert.Equal(t, 3, inactive.FailureCount)
+	assert.NotNil(t, inactive.DisabledAt)
+
+	webhooks, err := repos.Webhook.GetWebhooks()
+	require.NoError(t, err)
+	assert.Len(t, webhooks, 2)
+	active, err := repos.Webhook.GetActiveWebhooks()
+	require.NoError(t, err)
+	if assert.Len(t, active, 1) {
+		assert.Equal(t, id, active[0].ID)
+	}
+
+	for attempt := 1; attempt <= 2; attempt++ {
+		require.NoError(t, repos.Webhook.SaveWebhookDelivery(models.WebhookDelivery{WebhookID: id, EventType: "ProductUpdatedEvent", Payload: []byte(`{}`), Attempt: attempt}))
+	}
+	deliveries, err := repos.Webhook.GetWebhookDeliveries(id)
+	require.NoError(t, err)
+	if assert.Len(t, deliveries, 2) {
+		assert.Equal(t, 2, deliveries[0].Attempt, "latest delivery first")
+	}
+
+	due, later := now.Add(-time.Minute), now.Add(time.Hour)
+	require.NoError(t, repos.Webhook.SaveWebhookDelivery(models.WebhookDelivery{WebhookID: id, EventType: "ProductUpdatedEvent", Payload: []byte(`{}`), Attempt: 1, RetryAt: &later}))
+	require.NoError(t, repos.Webhook.SaveWebhookDelivery(models.WebhookDelivery{WebhookID: id, EventType: "ProductUpdatedEvent", Payload: []byte(`{}`), Attempt: 1, RetryAt: &due}))
+	retries, err := repos.Webhook.GetDueWebhookDeliveries(now)
+	require.NoError(t, err)
+	require.Len(t, retries, 1)
+	assert.Equal(t, 1, retries[0].Attempt)
+	require.NoError(t, repos.Webhook.ClaimWebhookDelivery(retries[0].ID))
+	assert.ErrorIs(t, repos.Webhook.ClaimWebhookDelivery(retries[0].ID), gorm.ErrRecordNotFound, "claimed once")
+	retries, err = repos.Webhook.GetDueWebhookDeliveries(now)
+	require.NoError(t, err)
+	assert.Empty(t, retries)
+
+	require.NoError(t, repos.Webhook.DeleteWebhook(id))
+	_, err = repos.Webhook.GetWebhook(id)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	assert.ErrorIs(t, repos.Webhook.DeleteWebhook(id), gorm.ErrRecordNotFound)
+}
+
+func testIdempotency(t *testing.T, repos *config.Repositories) {
+	now := time.Now()
+	key := models.IdempotencyKey{Scope: "user_1", Key: "key-1", RequestHash: "hash", CreatedAt: now, ExpiresAt: now.Add(time.Hour)}
+	require.NoError(t, repos.Idempotency.CreateIdempotencyKey(key))
+	assert.ErrorIs(t, repos.Idempotency.CreateIdempotencyKey(key), ports.ErrIdempotencyKeyExists)
+
+	// Keys are scoped
+	other := key
+	other.Scope = "user_2"
+	other.ExpiresAt = now.Add(-time.Minute)
+	require.NoError(t, repos.Idempotency.CreateIdempotencyKey(other))
+
+	key.StatusCode = 201
+	key.ContentType = "application/json"
+	key.Body = []byte(`{"message":"ok"}`)
+	require.NoError(t, repos.Idempotency.UpdateIdempotencyKey(key))
+	stored, err := repos.Idempotency.GetIdempotencyKey("user_1", "key-1")
+	require.NoError(t, err)
+	assert.True(t, stored.Completed())
+	assert.Equal(t, "hash", stored.RequestHash)
+	assert.Equal(t, "application/json", stored.ContentType)
+	assert.Equal(t, key.Body, stored.Body)
+
+	require.NoError(t, repos.Idempotency.DeleteExpiredIdempotencyKeys(now))
+	_, err = repos.Idempotency.GetIdempotencyKey("user_2", "key-1")
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+	require.NoError(t, repos.Idempotency.DeleteIdempotencyKey("user_1", "key-1"))
+	_, err = repos.Idempotency.GetIdempotencyKey("user_1", "key-1")
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+}
+
+func testUnitOfWork(t *testing.T, repos *config.Repositories) {
+	from := saveProduct(t, repos, models.Product{Name: "Book A", Quantity: 10})
+	to := saveProduct(t, repos, models.Product{Name: "Book B", Quantity: 0})
+
+	// transfer moves stock between the products, renames one and records an outbox event, then returns result
+	transfer := func(eventID string, result error) func(tx ports.TransactionRepositories) error {
+		return func(tx ports.TransactionRepositories) error {
+			if _, err := tx.Stock.ApplyStockMovements(eventID, []models.StockMovement{
+				{ProductID: from.ID, Delta: -4},
+				{ProductID: to.ID, Delta: 4},
+			}); err != nil {
+				return err
+			}
+			product, err := tx.Product.GetOne(to.ID)
+			if err != nil {
+				return err
+			}
+			product.Name = "Book B2"
+			if err := tx.Product.Update(*product); err != nil {
+				return err
+			}
+			if _, err := tx.Outbox.SaveEvent(models.OutboxEvent{Topic: "StockTransferredEvent", Payload: []byte(`{}`)}); err != nil {
+				return err
+			}
+			return result
+		}
+	}
+	assertQuantities := func(fromQuantity int, toQuantity int, toName string, outboxEvents int64) {
+		t.Helper()
+		product, err := repos.Product.GetOne(from.ID)
+		require.NoError(t, err)
+		assert.Equal(t, fromQuantity, product.Quantity)
+		product, err = repos.Product.GetOne(to.ID)
+		require.NoError(t, err)
+		assert.Equal(t, toQuantity, product.Quantity)
+		assert.Equal(t, toName, product.Name)
+		pending, err := repos.Outbox.GetPendingEvents()
+		require.NoError(t, err)
+		assert.Len(t, pending, int(outboxEvents))
+	}
+
+	// Reads before the unit of work are cached by a caching decorator
+	assertQuantities(10, 0, "Book B", 0)
+
+	failure := errors.New("transfer failed")
+	assert.ErrorIs(t, repos.UnitOfWork.Do(transfer("event-1", failure)), failure)
+	assertQuantities(10, 0, "Book B", 0)
+
+	assert.PanicsWithValue(t, "transfer panicked", func() {
+		repos.UnitOfWork.Do(func(tx ports.TransactionRepositories) error {
+			transfer("event-1", nil)(tx)
+			panic("transfer panicked")
+		})
+	})
+	assertQuantities(10, 0, "Book B", 0)
+
+	require.NoError(t, repos.UnitOfWork.Do(transfer("event-1", nil)))
+	assertQuantities(6, 4, "Book B2", 1)
+
+	// The processed event of the committed unit of work is kept
+	err := repos.UnitOfWork.Do(transfer("event-1", nil))
+	assert.ErrorIs(t, err, ports.ErrEventAlreadyProcessed)
+	assertQuantities(6, 4, "Book B2", 1)
+
+	// A failing operation can be handled without failing the unit of work
+	require.NoError(t, repos.UnitOfWork.Do(func(tx ports.TransactionRepositories) error {
+		if err := tx.Product.Delete(from.ID + 100); !errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("expected not found, got %v", err)
+		}
+		return tx.Product.Delete(from.ID)
+	}))
+	_, err = repos.Product.GetOne(from.ID)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+}
+
+func testConcurrentUnitsOfWork(t *testing.T, repos *config.Repositories) {
+	const units = 10
+	product := saveProduct(t, repos, models.Product{Name: "Book", Quantity: 0})
+
+	// Each unit of work reads the product and writes it back, none of the writes is lost
+	var wg sync.WaitGroup
+	errs := make([]error, units)
+	for i := 0; i < units; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = repos.UnitOfWork.Do(func(tx ports.TransactionRepositories) error {
+				current, err := tx.Product.GetOne(product.ID)
+				if err != nil {
+					return err
+				}
+				current.Quantity++
+				return tx.Product.Update(*current)
+			})
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		require.NoError(t, err)
+	}
+	updated, err := repos.Product.GetOne(product.ID)
+	require.NoError(t, err)
+	assert.Equal(t, units, updated.Quantity)
+}
@@ -0,0 +1,146 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/WarisLi/Golang-mini-project/internal/adapters/http/middleware"
+	"github.com/WarisLi/Golang-mini-project/internal/core/models"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// responseCookies returns the cookies set by a response, by name.
+func responseCookies(resp *http.Response) map[string]*http.Cookie {
+	cookies := map[string]*http.Cookie{}
+	for _, cookie := range resp.Cookies() {
+		cookies[cookie.Name] = cookie
+	}
+	return cookies
+}
+
+func TestTokenCookies(t *testing.T) {
+	app, mocks := setupAppTestWithMocks()
+	password, err := bcrypt.GenerateFromPassword([]byte("Pass@12345"), bcrypt.DefaultCost)
+	require.NoError(t, err)
+	mocks.userRepo.On("GetUser", "mock_user_1").Return(&models.User{Username: "mock_user_1", Password: string(password), Role: models.RoleAdmin}, nil)
+	mocks.productRepo.On("GetPage", mock.Anything).Return([]models.Product{}, int64(0), nil)
+	mocks.productRepo.On("Delete", uint(1000)).Return(nil)
+
+	reqBody, _ := json.Marshal(models.UsernamePassword{Username: "mock_user_1", Password: "Pass@12345"})
+	req := httptest.NewRequest("POST", "/user/login", bytes.NewReader(reqBody))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+	var login models.LoginSuccess
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&login))
+
+	// The token is out of reach of the scripts, the CSRF token is not
+	cookies := responseCookies(resp)
+	tokenCookie, csrfCookie := cookies[middleware.TokenCookie], cookies[middleware.CSRFCookie]
+	require.NotNil(t, tokenCookie)
+	require.NotNil(t, csrfCookie)
+	assert.Equal(t, login.Token, tokenCookie.Value)
+	assert.True(t, tokenCookie.HttpOnly)
+	assert.False(t, csrfCookie.HttpOnly)
+	assert.NotEmpty(t, csrfCookie.Value)
+	for _, cookie := range []*http.Cookie{tokenCookie, csrfCookie} {
+		assert.True(t, cookie.Secure)
+		assert.Equal(t, http.SameSiteLaxMode, cookie.SameSite)
+		assert.Equal(t, "/", cookie.Path)
+		assert.Equal(t, 3600, cookie.MaxAge)
+	}
+
+	tests := []struct {
+		description   string
+		method        string
+		url           string
+		authorization string
+		csrfHeader    string
+		expectStatus  int
+	}{
+		{description: "Read", method: "GET", url: "/product", expectStatus: fiber.StatusOK},
+		{description: "Change without CSRF token", method: "DELETE", url: "/product/1000", expectStatus: fiber.StatusForbidden},
+		{description: "Change with another CSRF token", method: "DELETE", url: "/product/1000", csrfHeader: "other", expectStatus: fiber.StatusForbidden},
+		{description: "Change with CSRF token", method: "DELETE", url: "/product/1000", csrfHeader: csrfCookie.Value, expectStatus: fiber.StatusOK},
+		{description: "Change with Authorization header", method: "DELETE", url: "/product/1000", authorization: login.Token, expectStatus: fiber.StatusOK},
+	}
+
+	// Run tests
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			req := httptest.NewRequest(test.method, test.url, nil)
+			req.AddCookie(tokenCookie)
+			req.AddCookie(csrfCookie)
+			if test.authorization != "" {
+				req.Header.Set("Authorization", "Bearer "+test.authorization)
+			}
+			if test.csrfHeader != "" {
+				req.Header.Set(middleware.CSRFHeader, test.csrfHeader)
+			}
+			resp, err := app.Test(req)
+			require.NoError(t, err)
+
+			assert.Equal(t, test.expectStatus, resp.StatusCode)
+		})
+	}
+
+	// The logout expires both cookies
+	req = httptest.NewRequest("POST", "/user/logout", nil)
+	req.AddCookie(tokenCookie)
+	resp, err = app.Test(req)
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+	cookies = responseCookies(resp)
+	for _, name := range []string{middleware.TokenCookie, middleware.CSRFCookie} {
+		require.NotNil(t, cookies[name], name)
+		assert.Empty(t, cookies[name].Value)
+		assert.Negative(t, cookies[name].MaxAge)
+	}
+	mocks.productRepo.AssertExpectations(t)
+}
+
+func TestTokenCookieWebSocket(t *testing.T) {
+	app, _ := setupAppTestWithMocks()
+	tokenCookie := &http.Cookie{Name: middleware.TokenCookie, Value: generateMockJWT()}
+	csrfCookie := &http.Cookie{Name: middleware.CSRFCookie, Value: "csrf"}
+
+	tests := []struct {
+		description  string
+		url          string
+		expectStatus int
+	}{
+		{
+			description:  "Without CSRF token",
+			url:          "/stream/product/ws?product=abc",
+			expectStatus: fiber.StatusForbidden,
+		},
+		{
+			description:  "With CSRF token",
+			url:          "/stream/product/ws?product=abc&csrf_token=csrf",
+			expectStatus: fiber.StatusBadRequest,
+		},
+	}
+
+	// Run tests
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			req := httptest.NewRequest("GET", test.url, nil)
+			req.Header.Set(fiber.HeaderConnection, "Upgrade")
+			req.Header.Set(fiber.HeaderUpgrade, "websocket")
+			req.AddCookie(tokenCookie)
+			req.AddCookie(csrfCookie)
+			resp, err := app.Test(req)
+			require.NoError(t, err)
+
+			assert.Equal(t, test.expectStatus, resp.StatusCode)
+		})
+	}
+}
@@ -0,0 +1,194 @@
+package tests
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/WarisLi/Golang-mini-project/internal/adapters/memory"
+	"github.com/WarisLi/Golang-mini-project/internal/adapters/producer"
+	"github.com/WarisLi/Golang-mini-project/internal/core/models"
+	"github.com/WarisLi/Golang-mini-project/internal/core/ports"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/Shopify/sarama.v1"
+	"gorm.io/gorm"
+)
+
+func TestGetDeadLetters(t *testing.T) {
+	app, testMocks := setupAppTestWithMocks()
+	token := generateMockJWT()
+
+	outboxEvents := []models.OutboxEvent{{
+		Model:     gorm.Model{ID: 1},
+		Topic:     "LowProductQuantityNotificationEvent",
+		Payload:   []byte(`{"Name":"Book A","Quantity":10}`),
+		Attempts:  2,
+		LastError: "kafka: client has run out of available brokers",
+	}}
+	testMocks.outboxRepo.On("GetFailedEvents").Return(outboxEvents, nil)
+
+	req := httptest.NewRequest("GET", "/dead-letter", nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	resp, _ := app.Test(req)
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	body, _ := io.ReadAll(resp.Body)
+	var deadLetters []models.DeadLetter
+	assert.NoError(t, json.Unmarshal(body, &deadLetters))
+	assert.Len(t, deadLetters, 1)
+	assert.Equal(t, 2, deadLetters[0].Attempts)
+	assert.JSONEq(t, `{"Name":"Book A","Quantity":10}`, string(deadLetters[0].Payload))
+	testMocks.outboxRepo.AssertExpectations(t)
+}
+
+func TestRetryDeadLetter(t *testing.T) {
+	app, testMocks := setupAppTestWithMocks()
+	token := generateMockJWT()
+
+	outboxEvent := &models.OutboxEvent{
+		Model:   gorm.Model{ID: 1},
+		Topic:   "LowProductQuantityNotificationEvent",
+		Payload: []byte(`{"Name":"Book A","Quantity":10}`),
+	}
+	testMocks.outboxRepo.On("GetFailedEvent", uint(1)).Return(outboxEvent, nil)
+	testMocks.outboxRepo.On("GetFailedEvent", uint(2)).Return(nil, gorm.ErrRecordNotFound)
+	testMocks.outboxRepo.On("GetFailedEvent", uint(3)).Return(&models.OutboxEvent{
+		Model:    gorm.Model{ID: 3},
+		Topic:    "OrderPlacedEvent",
+		Payload:  []byte(`not json`),
+		Consumed: true,
+	}, nil)
+	testMocks.outboxRepo.On("MarkEventPublished", uint(1)).Return(nil)
+
+	tests := []struct {
+		description  string
+		pathParam    int
+		expectStatus int
+	}{
+		{
+			description:  "Valid input",
+			pathParam:    1,
+			expectStatus: fiber.StatusOK,
+		},
+		{
+			description:  "Not found",
+			pathParam:    2,
+			expectStatus: fiber.StatusNotFound,
+		},
+		{
+			description:  "Consumed message",
+			pathParam:    3,
+			expectStatus: fiber.StatusConflict,
+		},
+	}
+
+	// Run tests
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			req := httptest.NewRequest("POST", fmt.Sprintf("/dead-letter/%d/retry", test.pathParam), nil)
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+			resp, _ := app.Test(req)
+
+			assert.Equal(t, test.expectStatus, resp.StatusCode)
+		})
+	}
+	testMocks.outboxRepo.AssertExpectations(t)
+}
+
+func TestDiscardDeadLetter(t *testing.T) {
+	app, testMocks := setupAppTestWithMocks()
+	token := generateMockJWT()
+
+	testMocks.outboxRepo.On("DeleteFailedEvent", uint(1)).Return(nil)
+	testMocks.outboxRepo.On("DeleteFailedEvent", uint(2)).Return(gorm.ErrRecordNotFound)
+
+	tests := []struct {
+		description  string
+		pathParam    int
+		expectStatus int
+	}{
+		{
+			description:  "Valid input",
+			pathParam:    1,
+			expectStatus: fiber.StatusOK,
+		},
+		{
+			description:  "Not found",
+			pathParam:    2,
+			expectStatus: fiber.StatusNotFound,
+		},
+	}
+
+	// Run tests
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			req := httptest.NewRequest("DELETE", fmt.Sprintf("/dead-letter/%d", test.pathParam), nil)
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+			resp, _ := app.Test(req)
+
+			assert.Equal(t, test.expectStatus, resp.StatusCode)
+		})
+	}
+	testMocks.outboxRepo.AssertExpectations(t)
+}
+
+func TestDeadLetterAsyncDelivery(t *testing.T) {
+	brokerDown := true
+	saramaProducer := newFakeAsyncProducer(func(msg *sarama.ProducerMessage) error {
+		if brokerDown {
+			return errors.New("broker unavailable")
+		}
+		return nil
+	})
+	asyncProducer := producer.NewAsyncEventProducer(saramaProducer, func(topic string, value []byte, err error) {
+		t.Errorf("the failed retry of %s was reported to the error handler", topic)
+	})
+	defer asyncProducer.Close()
+	outboxRepo := memory.NewMemoryOutboxRepository(memory.NewMemoryRepository())
+	outboxService := ports.NewOutboxService(outboxRepo, asyncProducer)
+	id, err := outboxRepo.SaveEvent(models.OutboxEvent{Topic: "ProductUpdatedEvent", Payload: []byte(`{}`), Attempts: 1})
+	require.NoError(t, err)
+
+	// A retry which is not delivered fails and the dead letter stays
+	assert.Error(t, outboxService.RetryDeadLetter(id))
+	deadLetter, err := outboxService.GetDeadLetter(id)
+	require.NoError(t, err)
+	assert.Equal(t, 2, deadLetter.Attempts)
+	assert.Equal(t, "broker unavailable", deadLetter.LastError)
+
+	brokerDown = false
+	require.NoError(t, outboxService.RetryDeadLetter(id))
+	_, err = outboxService.GetDeadLetter(id)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+	// A published event is no dead letter to discard
+	assert.ErrorIs(t, outboxService.DiscardDeadLetter(id), gorm.ErrRecordNotFound)
+}
+
+func TestDeadLettersExcludeEventsBeingPublished(t *testing.T) {
+	outboxRepo := memory.NewMemoryOutboxRepository(memory.NewMemoryRepository())
+	outboxService := ports.NewOutboxService(outboxRepo, producer.NewChannelBus(10))
+	// An event saved by a unit of work is pending until its first publish
+	inFlight, err := outboxRepo.SaveEvent(models.OutboxEvent{Topic: "ProductUpdatedEvent", Payload: []byte(`{}`)})
+	require.NoError(t, err)
+	failed, err := outboxRepo.SaveEvent(models.OutboxEvent{Topic: "ProductUpdatedEvent", Payload: []byte(`{}`), Attempts: 1})
+	require.NoError(t, err)
+
+	deadLetters, err := outboxService.GetDeadLetters()
+	require.NoError(t, err)
+	require.Len(t, deadLetters, 1)
+	assert.Equal(t, failed, deadLetters[0].ID)
+	count, err := outboxService.CountDeadLetters()
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+
+	_, err = outboxService.GetDeadLetter(inFlight)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	assert.ErrorIs(t, outboxService.RetryDeadLetter(inFlight), gorm.ErrRecordNotFound)
+	assert.ErrorIs(t, outboxService.DiscardDeadLetter(inFlight), gorm.ErrRecordNotFound)
+}
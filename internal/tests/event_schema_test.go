@@ -0,0 +1,153 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/WarisLi/Golang-mini-project/internal/adapters/producer"
+	events "github.com/WarisLi/Golang-shared-events"
+	"github.com/stretchr/testify/assert"
+)
+
+// jsonFields returns the JSON type of every field of an event payload.
+func jsonFields(t reflect.Type) map[string]string {
+	fields := map[string]string{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name := field.Name
+		if tag := strings.Split(field.Tag.Get("json"), ",")[0]; tag == "-" {
+			continue
+		} else if tag != "" {
+			name = tag
+		}
+		fields[name] = jsonType(field.Type)
+	}
+	return fields
+}
+
+func jsonType(t reflect.Type) string {
+	if t == reflect.TypeOf(time.Time{}) {
+		return "string"
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return jsonType(t.Elem())
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.String:
+		return "string"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	}
+	return "object"
+}
+
+// TestEventSchemaCompatibility checks that every published event is still
+// compatible with the schema recorded for its version in testdata/schemas.
+// Removing or retyping a field requires a new schema version.
+func TestEventSchemaCompatibility(t *testing.T) {
+	for topic, schema := range producer.Schemas() {
+		t.Run(topic, func(t *testing.T) {
+			path := filepath.Join("testdata", "schemas", fmt.Sprintf("%s.v%d.json", topic, schema.Version))
+			data, err := os.ReadFile(path)
+			if !assert.NoError(t, err, "record the schema of version %d in %s", schema.Version, path) {
+				return
+			}
+
+			var recorded map[string]string
+			assert.NoError(t, json.Unmarshal(data, &recorded))
+
+			current := jsonFields(schema.Type)
+			for field, recordedType := range recorded {
+				currentType, ok := current[field]
+				assert.True(t, ok, "field %s was removed", field)
+				if ok {
+					assert.Equal(t, recordedType, currentType, "field %s changed type", field)
+				}
+			}
+		})
+	}
+}
+
+// headerRecorder records the last message it produced.
+type headerRecorder struct {
+	topic   string
+	value   []byte
+	headers map[string]string
+}
+
+func (r *headerRecorder) Produce(event events.Event) error { return nil }
+
+func (r *headerRecorder) ProduceMessage(topic string, value []byte) error {
+	return r.ProduceMessageWithHeaders(topic, value, nil)
+}
+
+func (r *headerRecorder) ProduceMessageWithHeaders(topic string, value []byte, headers map[string]string) error {
+	r.topic, r.value, r.headers = topic, value, headers
+	return nil
+}
+
+func TestEnvelopeProducer(t *testing.T) {
+	event := events.LowProductQuantityNotificationEvent{Name: "Book A", Quantity: 10}
+	eventJSON := `{"Name":"Book A","Quantity":10}`
+
+	t.Run("Structured", func(t *testing.T) {
+		recorder := &headerRecorder{}
+		options := producer.EnvelopeOptions{Format: producer.FormatStructured, Source: "/test", TopicPrefix: "dev."}
+		eventProducer, err := producer.NewEnvelopeProducer(recorder, options)
+		assert.NoError(t, err)
+		assert.NoError(t, eventProducer.Produce(event))
+
+		assert.Equal(t, "dev.LowProductQuantityNotificationEvent", recorder.topic)
+		var cloudEvent producer.CloudEvent
+		assert.NoError(t, json.Unmarshal(recorder.value, &cloudEvent))
+		assert.Equal(t, "1.0", cloudEvent.SpecVersion)
+		assert.Equal(t, "/test", cloudEvent.Source)
+		assert.Equal(t, "LowProductQuantityNotificationEvent", cloudEvent.Type)
+		assert.Equal(t, "1", cloudEvent.SchemaVersion)
+		assert.NotEmpty(t, cloudEvent.ID)
+		assert.JSONEq(t, eventJSON, string(cloudEvent.Data))
+
+		topic, value := options.Unwrap(recorder.topic, recorder.value)
+		assert.Equal(t, "LowProductQuantityNotificationEvent", topic)
+		assert.JSONEq(t, eventJSON, string(value))
+	})
+
+	t.Run("Binary", func(t *testing.T) {
+		recorder := &headerRecorder{}
+		eventProducer, err := producer.NewEnvelopeProducer(recorder, producer.EnvelopeOptions{Format: producer.FormatBinary, Source: "/test"})
+		assert.NoError(t, err)
+		assert.NoError(t, eventProducer.Produce(event))
+
+		assert.Equal(t, "LowProductQuantityNotificationEvent", recorder.topic)
+		assert.JSONEq(t, eventJSON, string(recorder.value))
+		assert.Equal(t, "LowProductQuantityNotificationEvent", recorder.headers["ce_type"])
+		assert.Equal(t, "1", recorder.headers["ce_schemaversion"])
+		assert.NotEmpty(t, recorder.headers["ce_id"])
+	})
+
+	t.Run("Binary requires headers", func(t *testing.T) {
+		_, err := producer.NewEnvelopeProducer(producer.NewChannelBus(1), producer.EnvelopeOptions{Format: producer.FormatBinary})
+		assert.Error(t, err)
+	})
+
+	t.Run("Unregistered schema", func(t *testing.T) {
+		eventProducer, _ := producer.NewEnvelopeProducer(&headerRecorder{}, producer.EnvelopeOptions{Format: producer.FormatStructured})
+		assert.Error(t, eventProducer.ProduceMessage("UnknownEvent", []byte("{}")))
+	})
+}
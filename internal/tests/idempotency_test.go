@@ -0,0 +1,207 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/WarisLi/Golang-mini-project/internal/adapters/http/middleware"
+	"github.com/WarisLi/Golang-mini-project/internal/config"
+	"github.com/WarisLi/Golang-mini-project/internal/core/models"
+	"github.com/WarisLi/Golang-mini-project/internal/core/ports"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestIdempotentCreateProduct(t *testing.T) {
+	app, testMocks := setupAppTestWithMocks()
+	token := generateMockJWT()
+
+	// stored plays the idempotency key table
+	var stored models.IdempotencyKey
+	testMocks.idempotencyRepo.On("CreateIdempotencyKey", mock.MatchedBy(func(key models.IdempotencyKey) bool {
+		return key.Scope == "user:mock_user" && key.Key == "order-1"
+	})).Run(func(args mock.Arguments) {
+		stored = args.Get(0).(models.IdempotencyKey)
+	}).Return(nil).Once()
+	testMocks.idempotencyRepo.On("CreateIdempotencyKey", mock.Anything).Return(ports.ErrIdempotencyKeyExists)
+	testMocks.idempotencyRepo.On("GetIdempotencyKey", "user:mock_user", "order-1").Return(&stored, nil)
+	testMocks.idempotencyRepo.On("UpdateIdempotencyKey", mock.Anything).Run(func(args mock.Arguments) {
+		stored = args.Get(0).(models.IdempotencyKey)
+	}).Return(nil)
+	testMocks.productRepo.On("Save", mock.Anything).Return(uint(1), nil).Once()
+
+	post := func(product models.ProductInput) (int, string, string) {
+		reqBody, _ := json.Marshal(product)
+		req := httptest.NewRequest("POST", "/product", bytes.NewReader(reqBody))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		req.Header.Set(middleware.IdempotencyKeyHeader, "order-1")
+		resp, _ := app.Test(req)
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, resp.Header.Get(middleware.IdempotentReplayedHeader), string(body)
+	}
+
+	product := models.ProductInput{Name: "Book", Quantity: 10}
+
+	status, replayed, body := post(product)
+	assert.Equal(t, fiber.StatusCreated, status)
+	assert.Empty(t, replayed)
+	assert.Equal(t, fiber.StatusCreated, stored.StatusCode)
+
+	t.Run("Retry replays the response", func(t *testing.T) {
+		status, replayed, replayedBody := post(product)
+		assert.Equal(t, fiber.StatusCreated, status)
+		assert.Equal(t, "true", replayed)
+		assert.Equal(t, body, replayedBody)
+		testMocks.productRepo.AssertNumberOfCalls(t, "Save", 1)
+	})
+
+	t.Run("Different payload is rejected", func(t *testing.T) {
+		status, _, _ := post(models.ProductInput{Name: "Book", Quantity: 20})
+		assert.Equal(t, fiber.StatusUnprocessableEntity, status)
+	})
+
+	t.Run("Concurrent duplicate is blocked", func(t *testing.T) {
+		stored.StatusCode = 0
+		status, _, _ := post(product)
+		assert.Equal(t, fiber.StatusConflict, status)
+	})
+
+	testMocks.productRepo.AssertExpectations(t)
+}
+
+func TestIdempotencyKeyReleasedOnServerError(t *testing.T) {
+	app, testMocks := setupAppTestWithMocks()
+	token := generateMockJWT()
+
+	testMocks.idempotencyRepo.On("CreateIdempotencyKey", mock.Anything).Return(nil)
+	testMocks.idempotencyRepo.On("DeleteIdempotencyKey", "user:mock_user", "order-2").Return(nil).Once()
+	testMocks.productRepo.On("Save", mock.Anything).Return(uint(0), errors.New("database is down"))
+
+	reqBody, _ := json.Marshal(models.ProductInput{Name: "Book", Quantity: 10})
+	req := httptest.NewRequest("POST", "/product", bytes.NewReader(reqBody))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	req.Header.Set(middleware.IdempotencyKeyHeader, "order-2")
+	resp, _ := app.Test(req)
+
+	assert.Equal(t, fiber.StatusInternalServerError, resp.StatusCode)
+	testMocks.idempotencyRepo.AssertExpectations(t)
+}
+
+func TestIdempotencyAnonymousRequestsScopedByIP(t *testing.T) {
+	repos := config.NewMemoryRepositories()
+	idempotencyService := ports.NewIdempotencyService(repos.Idempotency, ports.IdempotencyOptions{TTL: time.Hour, LockTimeout: time.Minute})
+
+	calls := 0
+	app := fiber.New(fiber.Config{ProxyHeader: fiber.HeaderXForwardedFor})
+	app.Post("/user", middleware.Idempotency(idempotencyService), func(c *fiber.Ctx) error {
+		calls++
+		return c.SendStatus(fiber.StatusCreated)
+	})
+
+	tests := []struct {
+		description    string
+		ip             string
+		expectReplayed string
+		expectCalls    int
+	}{
+		{description: "First sign-up", ip: "192.0.2.1", expectCalls: 1},
+		{description: "Retry replays the response", ip: "192.0.2.1", expectReplayed: "true", expectCalls: 1},
+		{description: "Same key of another client", ip: "192.0.2.2", expectCalls: 2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/user", nil)
+			req.Header.Set(middleware.IdempotencyKeyHeader, "signup-1")
+			req.Header.Set(fiber.HeaderXForwardedFor, test.ip)
+			resp, _ := app.Test(req)
+			assert.Equal(t, fiber.StatusCreated, resp.StatusCode)
+			assert.Equal(t, test.expectReplayed, resp.Header.Get(middleware.IdempotentReplayedHeader))
+			assert.Equal(t, test.expectCalls, calls)
+		})
+	}
+
+	_, err := repos.Idempotency.GetIdempotencyKey("ip:192.0.2.1", "signup-1")
+	assert.NoError(t, err)
+}
+
+func TestIdempotentUserRoutes(t *testing.T) {
+	app := setupMemoryAppTest(t, memoryAppOptions{}).app
+	token := login(t, app, "admin")
+
+	send := func(method string, url string, token string, key string, body interface{}) (int, string, string) {
+		reqBody, _ := json.Marshal(body)
+		req := httptest.NewRequest(method, url, bytes.NewReader(reqBody))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		req.Header.Set(middleware.IdempotencyKeyHeader, key)
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		respBody, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, resp.Header.Get(middleware.IdempotentReplayedHeader), string(respBody)
+	}
+
+	tests := []struct {
+		description  string
+		method       string
+		url          string
+		token        string
+		body         interface{}
+		expectStatus int
+	}{
+		{description: "Sign-up", method: "POST", url: "/user", body: models.UsernamePassword{Username: "carol", Password: "Pass@12345"}, expectStatus: fiber.StatusCreated},
+		{description: "API key", method: "POST", url: "/user/api-keys", token: token, body: models.APIKeyInput{Name: "ci", Scopes: []string{models.ScopeProductRead}}, expectStatus: fiber.StatusCreated},
+		{description: "User administration", method: "PUT", url: "/users/alice/role", token: token, body: models.UserRole{Role: models.RoleUser}, expectStatus: fiber.StatusOK},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			status, replayed, body := send(test.method, test.url, test.token, test.description, test.body)
+			require.Equal(t, test.expectStatus, status, body)
+			assert.Empty(t, replayed)
+
+			status, replayed, retryBody := send(test.method, test.url, test.token, test.description, test.body)
+			assert.Equal(t, test.expectStatus, status)
+			assert.Equal(t, "true", replayed)
+			assert.Equal(t, body, retryBody)
+		})
+	}
+
+	// The retried API key creation did not create a second key
+	var keys []models.APIKeyResponse
+	require.Equal(t, fiber.StatusOK, sendJSONTo(t, app, "GET", "/user/api-keys", token, nil, &keys))
+	assert.Len(t, keys, 1)
+}
+
+func TestIdempotencyKeySweep(t *testing.T) {
+	repos := config.NewMemoryRepositories()
+	idempotencyService := ports.NewIdempotencyService(repos.Idempotency, ports.IdempotencyOptions{TTL: time.Hour, LockTimeout: time.Minute})
+
+	now := time.Now()
+	require.NoError(t, repos.Idempotency.CreateIdempotencyKey(models.IdempotencyKey{Scope: "alice", Key: "expired", CreatedAt: now.Add(-2 * time.Hour), ExpiresAt: now.Add(-time.Hour)}))
+	_, err := idempotencyService.Begin("alice", "order-1", "hash")
+	require.NoError(t, err)
+
+	// Begin leaves the expired keys to the sweep
+	_, err = repos.Idempotency.GetIdempotencyKey("alice", "expired")
+	assert.NoError(t, err)
+
+	require.NoError(t, idempotencyService.DeleteExpiredKeys())
+	_, err = repos.Idempotency.GetIdempotencyKey("alice", "expired")
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	_, err = repos.Idempotency.GetIdempotencyKey("alice", "order-1")
+	assert.NoError(t, err)
+}
@@ -0,0 +1,133 @@
+package tests
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/WarisLi/Golang-mini-project/internal/adapters/producer"
+	"github.com/WarisLi/Golang-mini-project/internal/config"
+	events "github.com/WarisLi/Golang-shared-events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/Shopify/sarama.v1"
+)
+
+func TestLoadKafkaConfig(t *testing.T) {
+	t.Setenv("KAFKA_SERVERS", "broker-1:9092, broker-2:9092")
+	t.Setenv("KAFKA_REQUIRED_ACKS", "local")
+	t.Setenv("KAFKA_IDEMPOTENT", "true")
+	t.Setenv("KAFKA_COMPRESSION", "snappy")
+	t.Setenv("KAFKA_ASYNC", "true")
+
+	kafkaConfig, err := config.LoadKafkaConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"broker-1:9092", "broker-2:9092"}, kafkaConfig.Servers)
+	assert.True(t, kafkaConfig.Async)
+	assert.True(t, kafkaConfig.Sarama.Producer.Idempotent)
+	assert.Equal(t, sarama.WaitForAll, kafkaConfig.Sarama.Producer.RequiredAcks)
+	assert.Equal(t, 1, kafkaConfig.Sarama.Net.MaxOpenRequests)
+	assert.Equal(t, sarama.CompressionSnappy, kafkaConfig.Sarama.Producer.Compression)
+
+	t.Setenv("KAFKA_COMPRESSION", "brotli")
+	_, err = config.LoadKafkaConfig()
+	assert.Error(t, err)
+}
+
+func TestAsyncEventProducer(t *testing.T) {
+	saramaProducer := newFakeAsyncProducer(func(msg *sarama.ProducerMessage) error {
+		if msg.Topic == "failing" {
+			return errors.New("broker unavailable")
+		}
+		return nil
+	})
+
+	var failedTopic string
+	var failedValue []byte
+	asyncProducer := producer.NewAsyncEventProducer(saramaProducer, func(topic string, value []byte, err error) {
+		failedTopic = topic
+		failedValue = value
+	})
+
+	assert.NoError(t, asyncProducer.Produce(events.LowProductQuantityNotificationEvent{Name: "Book A", Quantity: 10}))
+	assert.NoError(t, asyncProducer.ProduceMessage("failing", []byte(`{"Name":"Book B"}`)))
+
+	// A delivered message reports its failure to the caller only
+	assert.NoError(t, asyncProducer.DeliverMessage("delivered", []byte(`{"Name":"Book C"}`)))
+	assert.EqualError(t, asyncProducer.DeliverMessage("failing", []byte(`{"Name":"Book D"}`)), "broker unavailable")
+	assert.NoError(t, asyncProducer.Close())
+
+	assert.Equal(t, "failing", failedTopic)
+	assert.JSONEq(t, `{"Name":"Book B"}`, string(failedValue))
+	assert.Error(t, asyncProducer.ProduceMessage("closed", []byte("{}")))
+	assert.Error(t, asyncProducer.DeliverMessage("closed", []byte("{}")))
+}
+
+func TestEnvelopeDeliverMessage(t *testing.T) {
+	var delivered []*sarama.ProducerMessage
+	brokerDown := false
+	saramaProducer := newFakeAsyncProducer(func(msg *sarama.ProducerMessage) error {
+		if brokerDown {
+			return errors.New("broker unavailable")
+		}
+		delivered = append(delivered, msg)
+		return nil
+	})
+	asyncProducer := producer.NewAsyncEventProducer(saramaProducer, nil)
+	defer asyncProducer.Close()
+
+	eventProducer, err := producer.NewEnvelopeProducer(asyncProducer, producer.EnvelopeOptions{
+		Format:      producer.FormatBinary,
+		Source:      "/test",
+		TopicPrefix: "dev.",
+	})
+	require.NoError(t, err)
+	deliveryProducer, ok := eventProducer.(producer.DeliveryProducer)
+	require.True(t, ok)
+
+	require.NoError(t, deliveryProducer.DeliverMessage("LowProductQuantityNotificationEvent", []byte(`{"Name":"Book A","Quantity":10}`)))
+	require.Len(t, delivered, 1)
+	assert.Equal(t, "dev.LowProductQuantityNotificationEvent", delivered[0].Topic)
+	headers := map[string]string{}
+	for _, header := range delivered[0].Headers {
+		headers[string(header.Key)] = string(header.Value)
+	}
+	assert.Equal(t, "LowProductQuantityNotificationEvent", headers["ce_type"])
+
+	brokerDown = true
+	err = deliveryProducer.DeliverMessage("LowProductQuantityNotificationEvent", []byte(`{"Name":"Book A","Quantity":10}`))
+	assert.EqualError(t, err, "broker unavailable")
+}
+
+// fakeAsyncProducer delivers every input message synchronously, failing the
+// messages rejected by deliver.
+type fakeAsyncProducer struct {
+	input     chan *sarama.ProducerMessage
+	successes chan *sarama.ProducerMessage
+	errors    chan *sarama.ProducerError
+}
+
+func newFakeAsyncProducer(deliver func(msg *sarama.ProducerMessage) error) *fakeAsyncProducer {
+	p := &fakeAsyncProducer{
+		input:     make(chan *sarama.ProducerMessage),
+		successes: make(chan *sarama.ProducerMessage, 10),
+		errors:    make(chan *sarama.ProducerError, 10),
+	}
+	go func() {
+		for msg := range p.input {
+			if err := deliver(msg); err != nil {
+				p.errors <- &sarama.ProducerError{Msg: msg, Err: err}
+			} else {
+				p.successes <- msg
+			}
+		}
+		close(p.successes)
+		close(p.errors)
+	}()
+	return p
+}
+
+func (p *fakeAsyncProducer) AsyncClose()                               { close(p.input) }
+func (p *fakeAsyncProducer) Close() error                              { p.AsyncClose(); return nil }
+func (p *fakeAsyncProducer) Input() chan<- *sarama.ProducerMessage     { return p.input }
+func (p *fakeAsyncProducer) Successes() <-chan *sarama.ProducerMessage { return p.successes }
+func (p *fakeAsyncProducer) Errors() <-chan *sarama.ProducerError      { return p.errors }
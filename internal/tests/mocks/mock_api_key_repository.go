@@ -0,0 +1,60 @@
+package mocks
+
+import (
+	"time"
+
+	"github.com/WarisLi/Golang-mini-project/internal/core/models"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockAPIKeyRepository struct {
+	mock.Mock
+}
+
+func (m *MockAPIKeyRepository) CreateAPIKey(key models.APIKey) (uint, error) {
+	args := m.Called(key)
+
+	return args.Get(0).(uint), args.Error(1)
+}
+
+func (m *MockAPIKeyRepository) GetAPIKey(id uint) (*models.APIKey, error) {
+	args := m.Called(id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.APIKey), args.Error(1)
+}
+
+func (m *MockAPIKeyRepository) GetAPIKeyByKeyID(keyID string) (*models.APIKey, error) {
+	args := m.Called(keyID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.APIKey), args.Error(1)
+}
+
+func (m *MockAPIKeyRepository) GetUserAPIKeys(username string) ([]models.APIKey, error) {
+	args := m.Called(username)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.APIKey), args.Error(1)
+}
+
+func (m *MockAPIKeyRepository) UpdateAPIKey(key models.APIKey) error {
+	args := m.Called(key)
+
+	return args.Error(0)
+}
+
+func (m *MockAPIKeyRepository) TouchAPIKey(id uint, usedAt time.Time) error {
+	args := m.Called(id, usedAt)
+
+	return args.Error(0)
+}
+
+func (m *MockAPIKeyRepository) DeleteUserAPIKeys(username string) error {
+	args := m.Called(username)
+
+	return args.Error(0)
+}
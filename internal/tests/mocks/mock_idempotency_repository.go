@@ -0,0 +1,40 @@
+package mocks
+
+import (
+	"time"
+
+	"github.com/WarisLi/Golang-mini-project/internal/core/models"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockIdempotencyRepository struct {
+	mock.Mock
+}
+
+func (m *MockIdempotencyRepository) CreateIdempotencyKey(key models.IdempotencyKey) error {
+	args := m.Called(key)
+	return args.Error(0)
+}
+
+func (m *MockIdempotencyRepository) GetIdempotencyKey(scope string, key string) (*models.IdempotencyKey, error) {
+	args := m.Called(scope, key)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.IdempotencyKey), args.Error(1)
+}
+
+func (m *MockIdempotencyRepository) UpdateIdempotencyKey(key models.IdempotencyKey) error {
+	args := m.Called(key)
+	return args.Error(0)
+}
+
+func (m *MockIdempotencyRepository) DeleteIdempotencyKey(scope string, key string) error {
+	args := m.Called(scope, key)
+	return args.Error(0)
+}
+
+func (m *MockIdempotencyRepository) DeleteExpiredIdempotencyKeys(now time.Time) error {
+	args := m.Called(now)
+	return args.Error(0)
+}
@@ -0,0 +1,16 @@
+package mocks
+
+import (
+	"github.com/WarisLi/Golang-mini-project/internal/core/models"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockNotifier struct {
+	mock.Mock
+}
+
+func (m *MockNotifier) Notify(notification models.Notification) error {
+	args := m.Called(notification)
+
+	return args.Error(0)
+}
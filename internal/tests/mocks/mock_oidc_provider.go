@@ -0,0 +1,181 @@
+package mocks
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"maps"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/WarisLi/Golang-mini-project/internal/core/models"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// mockOIDCKeyID is the kid of the key of MockOIDCProvider.
+const mockOIDCKeyID = "mock-key"
+
+// MockOIDCProvider is a local OpenID Connect provider for the tests of the logins. Its
+// authorization endpoint logs the identity of the claims in at once and redirects back
+// with a code, its token endpoint checks the client and the PKCE code verifier.
+type MockOIDCProvider struct {
+	Server       *httptest.Server
+	ClientID     string
+	ClientSecret string
+
+	key    *rsa.PrivateKey
+	mu     sync.Mutex
+	claims jwt.MapClaims
+	codes  map[string]mockAuthorization
+}
+
+type mockAuthorization struct {
+	redirectURI   string
+	codeChallenge string
+	nonce         string
+	claims        jwt.MapClaims
+}
+
+func NewMockOIDCProvider(clientID string, clientSecret string) *MockOIDCProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+
+	p := &MockOIDCProvider{ClientID: clientID, ClientSecret: clientSecret, key: key, codes: map[string]mockAuthorization{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", p.configuration)
+	mux.HandleFunc("GET /authorize", p.authorize)
+	mux.HandleFunc("POST /token", p.token)
+	mux.HandleFunc("GET /jwks", p.jwks)
+	p.Server = httptest.NewServer(mux)
+	return p
+}
+
+// Issuer is the issuer URL of the provider.
+func (p *MockOIDCProvider) Issuer() string {
+	return p.Server.URL
+}
+
+// SetClaims sets the claims of the ID tokens of the next logins. They are added to
+// iss, aud, iat, exp and nonce, and replace them when they have the same name.
+func (p *MockOIDCProvider) SetClaims(claims jwt.MapClaims) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.claims = maps.Clone(claims)
+}
+
+func (p *MockOIDCProvider) Close() {
+	p.Server.Close()
+}
+
+func (p *MockOIDCProvider) configuration(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{
+		"issuer":                 p.Issuer(),
+		"authorization_endpoint": p.Issuer() + "/authorize",
+		"token_endpoint":         p.Issuer() + "/token",
+		"jwks_uri":               p.Issuer() + "/jwks",
+	})
+}
+
+func (p *MockOIDCProvider) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("response_type") != "code" || query.Get("client_id") != p.ClientID ||
+		query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		http.Error(w, "invalid authorization request", http.StatusBadRequest)
+		return
+	}
+	redirect, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	code := base64.RawURLEncoding.EncodeToString(random)
+	p.mu.Lock()
+	p.codes[code] = mockAuthorization{
+		redirectURI:   query.Get("redirect_uri"),
+		codeChallenge: query.Get("code_challenge"),
+		nonce:         query.Get("nonce"),
+		claims:        maps.Clone(p.claims),
+	}
+	p.mu.Unlock()
+
+	callback := redirect.Query()
+	callback.Set("code", code)
+	callback.Set("state", query.Get("state"))
+	redirect.RawQuery = callback.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+func (p *MockOIDCProvider) token(w http.ResponseWriter, r *http.Request) {
+	// Confidential clients authenticate with client_secret_basic, public clients send their ID
+	clientID, clientSecret, ok := r.BasicAuth()
+	clientID, _ = url.QueryUnescape(clientID)
+	clientSecret, _ = url.QueryUnescape(clientSecret)
+	if !ok {
+		clientID = r.PostFormValue("client_id")
+	}
+	if clientID != p.ClientID || clientSecret != p.ClientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	// A code is redeemed once, by the client holding the code verifier
+	p.mu.Lock()
+	authorization, ok := p.codes[r.PostFormValue("code")]
+	delete(p.codes, r.PostFormValue("code"))
+	p.mu.Unlock()
+	challenge := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	if !ok || r.PostFormValue("grant_type") != "authorization_code" || r.PostFormValue("redirect_uri") != authorization.redirectURI ||
+		base64.RawURLEncoding.EncodeToString(challenge[:]) != authorization.codeChallenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "invalid code"})
+		return
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":   p.Issuer(),
+		"aud":   p.ClientID,
+		"iat":   now.Unix(),
+		"exp":   now.Add(5 * time.Minute).Unix(),
+		"nonce": authorization.nonce,
+	}
+	maps.Copy(claims, authorization.claims)
+	idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	idToken.Header["kid"] = mockOIDCKeyID
+	signed, err := idToken.SignedString(p.key)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"access_token": "mock-access-token", "token_type": "Bearer", "id_token": signed})
+}
+
+func (p *MockOIDCProvider) jwks(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, models.JWKS{Keys: []models.JWK{{
+		Kty: "RSA",
+		Kid: mockOIDCKeyID,
+		Use: "sig",
+		Alg: "RS256",
+		N:   base64.RawURLEncoding.EncodeToString(p.key.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(p.key.E)).Bytes()),
+	}}})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,59 @@
+package mocks
+
+import (
+	"github.com/WarisLi/Golang-mini-project/internal/core/models"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockOutboxRepository struct {
+	mock.Mock
+}
+
+func (m *MockOutboxRepository) SaveEvent(event models.OutboxEvent) (uint, error) {
+	args := m.Called(event)
+	return args.Get(0).(uint), args.Error(1)
+}
+
+func (m *MockOutboxRepository) GetPendingEvents() ([]models.OutboxEvent, error) {
+	args := m.Called()
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.OutboxEvent), args.Error(1)
+}
+
+func (m *MockOutboxRepository) MarkEventPublished(id uint) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+
+func (m *MockOutboxRepository) GetFailedEvents() ([]models.OutboxEvent, error) {
+	args := m.Called()
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.OutboxEvent), args.Error(1)
+}
+
+func (m *MockOutboxRepository) GetFailedEvent(id uint) (*models.OutboxEvent, error) {
+	args := m.Called(id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.OutboxEvent), args.Error(1)
+}
+
+func (m *MockOutboxRepository) CountFailedEvents() (int64, error) {
+	args := m.Called()
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockOutboxRepository) RecordEventFailure(id uint, lastError string) error {
+	args := m.Called(id, lastError)
+	return args.Error(0)
+}
+
+func (m *MockOutboxRepository) DeleteFailedEvent(id uint) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
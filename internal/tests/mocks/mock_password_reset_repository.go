@@ -0,0 +1,44 @@
+package mocks
+
+import (
+	"time"
+
+	"github.com/WarisLi/Golang-mini-project/internal/core/models"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockPasswordResetRepository struct {
+	mock.Mock
+}
+
+func (m *MockPasswordResetRepository) CreatePasswordResetToken(token models.PasswordResetToken) error {
+	args := m.Called(token)
+
+	return args.Error(0)
+}
+
+func (m *MockPasswordResetRepository) GetPasswordResetToken(tokenHash string) (*models.PasswordResetToken, error) {
+	args := m.Called(tokenHash)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.PasswordResetToken), args.Error(1)
+}
+
+func (m *MockPasswordResetRepository) UsePasswordResetToken(tokenHash string, usedAt time.Time) error {
+	args := m.Called(tokenHash, usedAt)
+
+	return args.Error(0)
+}
+
+func (m *MockPasswordResetRepository) DeleteExpiredPasswordResetTokens(now time.Time) error {
+	args := m.Called(now)
+
+	return args.Error(0)
+}
+
+func (m *MockPasswordResetRepository) DeleteUserPasswordResetTokens(username string) error {
+	args := m.Called(username)
+
+	return args.Error(0)
+}
@@ -17,6 +17,14 @@ func (m *MockProductRepository) GetAll() ([]models.Product, error) {
 	return args.Get(0).([]models.Product), args.Error(1)
 }
 
+func (m *MockProductRepository) GetPage(request models.PageRequest) ([]models.Product, int64, error) {
+	args := m.Called(request)
+	if args.Get(0) == nil {
+		return nil, 0, args.Error(2)
+	}
+	return args.Get(0).([]models.Product), args.Get(1).(int64), args.Error(2)
+}
+
 func (m *MockProductRepository) GetOne(id uint) (*models.Product, error) {
 	args := m.Called(id)
 	if args.Get(0) == nil {
@@ -25,9 +33,9 @@ func (m *MockProductRepository) GetOne(id uint) (*models.Product, error) {
 	return args.Get(0).(*models.Product), args.Error(1)
 }
 
-func (m *MockProductRepository) Save(product models.Product) error {
+func (m *MockProductRepository) Save(product models.Product) (uint, error) {
 	args := m.Called(product)
-	return args.Error(0)
+	return args.Get(0).(uint), args.Error(1)
 }
 
 func (m *MockProductRepository) Update(product models.Product) error {
@@ -39,3 +47,11 @@ func (m *MockProductRepository) Delete(id uint) error {
 	args := m.Called(id)
 	return args.Error(0)
 }
+
+func (m *MockProductRepository) ApplyProductOperations(operations []models.ProductOperation) ([]models.Product, error) {
+	args := m.Called(operations)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.Product), args.Error(1)
+}
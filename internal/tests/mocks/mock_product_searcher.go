@@ -0,0 +1,18 @@
+package mocks
+
+import (
+	"github.com/WarisLi/Golang-mini-project/internal/core/models"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockProductSearcher struct {
+	mock.Mock
+}
+
+func (m *MockProductSearcher) SearchProducts(query models.ProductSearchQuery) ([]models.ProductSearchResult, int64, error) {
+	args := m.Called(query)
+	if args.Get(0) == nil {
+		return nil, 0, args.Error(2)
+	}
+	return args.Get(0).([]models.ProductSearchResult), args.Get(1).(int64), args.Error(2)
+}
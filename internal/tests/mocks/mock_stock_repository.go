@@ -0,0 +1,18 @@
+package mocks
+
+import (
+	"github.com/WarisLi/Golang-mini-project/internal/core/models"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockStockRepository struct {
+	mock.Mock
+}
+
+func (m *MockStockRepository) ApplyStockMovements(eventID string, movements []models.StockMovement) ([]models.Product, error) {
+	args := m.Called(eventID, movements)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.Product), args.Error(1)
+}
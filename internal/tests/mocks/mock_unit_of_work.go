@@ -0,0 +1,14 @@
+package mocks
+
+import (
+	"github.com/WarisLi/Golang-mini-project/internal/core/ports"
+)
+
+// MockUnitOfWork calls the units of work with its repositories, without a transaction.
+type MockUnitOfWork struct {
+	Repositories ports.TransactionRepositories
+}
+
+func (u *MockUnitOfWork) Do(fn func(repos ports.TransactionRepositories) error) error {
+	return fn(u.Repositories)
+}
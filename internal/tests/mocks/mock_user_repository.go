@@ -1,6 +1,8 @@
 package mocks
 
 import (
+	"time"
+
 	"github.com/WarisLi/Golang-mini-project/internal/core/models"
 	"github.com/stretchr/testify/mock"
 )
@@ -17,8 +19,61 @@ func (m *MockUserRepository) GetUser(username string) (*models.User, error) {
 	return args.Get(0).(*models.User), args.Error(1)
 }
 
+func (m *MockUserRepository) GetUserByIdentity(provider string, subject string) (*models.User, error) {
+	args := m.Called(provider, subject)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.User), args.Error(1)
+}
+
 func (m *MockUserRepository) Create(user models.User) error {
 	args := m.Called(user)
 
 	return args.Error(0)
 }
+
+func (m *MockUserRepository) UpdateUser(user models.User) error {
+	args := m.Called(user)
+
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) GetUsers(query models.UserQuery) ([]models.User, int64, error) {
+	args := m.Called(query)
+	if args.Get(0) == nil {
+		return nil, 0, args.Error(2)
+	}
+	return args.Get(0).([]models.User), args.Get(1).(int64), args.Error(2)
+}
+
+func (m *MockUserRepository) DeleteUser(username string) error {
+	args := m.Called(username)
+
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) AddFailedLogin(username string) (int, error) {
+	args := m.Called(username)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockUserRepository) LockUser(username string, lockedUntil time.Time) error {
+	args := m.Called(username, lockedUntil)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) ResetFailedLogins(username string) error {
+	args := m.Called(username)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) UpdatePasswordHash(username string, oldHash string, newHash string) error {
+	args := m.Called(username, oldHash, newHash)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) UpdateTwoFactor(username string, from models.TwoFactorState, state models.TwoFactorState) error {
+	args := m.Called(username, from, state)
+	return args.Error(0)
+}
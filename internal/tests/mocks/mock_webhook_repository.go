@@ -0,0 +1,77 @@
+package mocks
+
+import (
+	"time"
+
+	"github.com/WarisLi/Golang-mini-project/internal/core/models"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockWebhookRepository struct {
+	mock.Mock
+}
+
+func (m *MockWebhookRepository) GetWebhooks() ([]models.Webhook, error) {
+	args := m.Called()
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.Webhook), args.Error(1)
+}
+
+func (m *MockWebhookRepository) GetActiveWebhooks() ([]models.Webhook, error) {
+	args := m.Called()
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.Webhook), args.Error(1)
+}
+
+func (m *MockWebhookRepository) GetWebhook(id uint) (*models.Webhook, error) {
+	args := m.Called(id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Webhook), args.Error(1)
+}
+
+func (m *MockWebhookRepository) CreateWebhook(webhook models.Webhook) (uint, error) {
+	args := m.Called(webhook)
+	return args.Get(0).(uint), args.Error(1)
+}
+
+func (m *MockWebhookRepository) UpdateWebhook(webhook models.Webhook) error {
+	args := m.Called(webhook)
+	return args.Error(0)
+}
+
+func (m *MockWebhookRepository) DeleteWebhook(id uint) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+
+func (m *MockWebhookRepository) SaveWebhookDelivery(delivery models.WebhookDelivery) error {
+	args := m.Called(delivery)
+	return args.Error(0)
+}
+
+func (m *MockWebhookRepository) GetWebhookDeliveries(webhookID uint) ([]models.WebhookDelivery, error) {
+	args := m.Called(webhookID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.WebhookDelivery), args.Error(1)
+}
+
+func (m *MockWebhookRepository) GetDueWebhookDeliveries(now time.Time) ([]models.WebhookDelivery, error) {
+	args := m.Called(now)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.WebhookDelivery), args.Error(1)
+}
+
+func (m *MockWebhookRepository) ClaimWebhookDelivery(id uint) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
@@ -0,0 +1,347 @@
+package tests
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/WarisLi/Golang-mini-project/internal/adapters/producer"
+	"github.com/WarisLi/Golang-mini-project/internal/core/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// natsPub is a message published to the fake NATS server.
+type natsPub struct {
+	subject string
+	payload []byte
+}
+
+// fakeNatsServer accepts NATS clients on a random local port and serves each
+// connection with serve, r reads the client protocol.
+func fakeNatsServer(t *testing.T, serve func(conn net.Conn, r *bufio.Reader)) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				conn.SetDeadline(time.Now().Add(5 * time.Second))
+				serve(conn, bufio.NewReader(conn))
+			}()
+		}
+	}()
+
+	return ln.Addr().String()
+}
+
+// readNatsLine reads a protocol line, which must end with CRLF.
+func readNatsLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	if !strings.HasSuffix(line, "\r\n") {
+		return "", fmt.Errorf("line %q not ended with CRLF", line)
+	}
+	return strings.TrimSuffix(line, "\r\n"), nil
+}
+
+// natsHandshake greets the client and answers its CONNECT and PING with reply,
+// it returns the CONNECT options.
+func natsHandshake(conn net.Conn, r *bufio.Reader, reply string) (string, error) {
+	fmt.Fprint(conn, "INFO {\"server_id\":\"fake\",\"max_payload\":1048576}\r\n")
+
+	connect, err := readNatsLine(r)
+	if err != nil {
+		return "", err
+	}
+	if !strings.HasPrefix(connect, "CONNECT ") {
+		return "", fmt.Errorf("expected CONNECT, got %q", connect)
+	}
+	if ping, err := readNatsLine(r); err != nil || ping != "PING" {
+		return "", fmt.Errorf("expected PING, got %q %v", ping, err)
+	}
+
+	fmt.Fprint(conn, reply+"\r\n")
+	return strings.TrimPrefix(connect, "CONNECT "), nil
+}
+
+// readNatsPub reads a PUB line and its payload.
+func readNatsPub(line string, r *bufio.Reader) (natsPub, error) {
+	fields := strings.Fields(line)
+	if len(fields) != 3 || fields[0] != "PUB" {
+		return natsPub{}, fmt.Errorf("expected PUB <subject> <size>, got %q", line)
+	}
+	size, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return natsPub{}, err
+	}
+
+	payload := make([]byte, size+2)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return natsPub{}, err
+	}
+	if string(payload[size:]) != "\r\n" {
+		return natsPub{}, fmt.Errorf("payload not ended with CRLF")
+	}
+	return natsPub{subject: fields[1], payload: payload[:size]}, nil
+}
+
+// serveNatsClient reads the messages of a connected client until it goes away and
+// answers its PINGs, the first message is answered with reply and ends the
+// connection when reply is not empty.
+func serveNatsClient(r *bufio.Reader, conn net.Conn, pubs chan<- natsPub, pongs chan<- struct{}, errs chan<- error, reply string) {
+	for {
+		line, err := readNatsLine(r)
+		if err != nil {
+			if err != io.EOF && !strings.Contains(err.Error(), "closed") {
+				errs <- err
+			}
+			return
+		}
+
+		switch {
+		case line == "PING":
+			fmt.Fprint(conn, "PONG\r\n")
+		case line == "PONG":
+			pongs <- struct{}{}
+		case strings.HasPrefix(line, "PUB "):
+			pub, err := readNatsPub(line, r)
+			if err != nil {
+				errs <- err
+				return
+			}
+			if reply != "" {
+				fmt.Fprint(conn, reply+"\r\n")
+				return
+			}
+			pubs <- pub
+		default:
+			errs <- fmt.Errorf("unexpected line %q", line)
+		}
+	}
+}
+
+func TestNatsProducer(t *testing.T) {
+	connects := make(chan string, 1)
+	pubs := make(chan natsPub, 10)
+	pongs := make(chan struct{}, 1)
+	errs := make(chan error, 10)
+	addr := fakeNatsServer(t, func(conn net.Conn, r *bufio.Reader) {
+		connect, err := natsHandshake(conn, r, "PONG")
+		if err != nil {
+			errs <- err
+			return
+		}
+		connects <- connect
+		// The client answers the pings of the server
+		fmt.Fprint(conn, "PING\r\n")
+		serveNatsClient(r, conn, pubs, pongs, errs, "")
+	})
+
+	natsProducer, err := producer.NewNatsProducer("nats://svc:secret@"+addr, time.Second)
+	require.NoError(t, err)
+	defer natsProducer.Close()
+
+	var options map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(<-connects), &options))
+	assert.Equal(t, false, options["verbose"])
+	assert.Equal(t, "go", options["lang"])
+	assert.Equal(t, "svc", options["user"])
+	assert.Equal(t, "secret", options["pass"])
+
+	event := models.ProductDeletedEvent{ID: 1}
+	require.NoError(t, natsProducer.Produce(event))
+	require.NoError(t, natsProducer.ProduceMessage("orders.created", []byte("line 1\r\nline 2")))
+
+	select {
+	case pub := <-pubs:
+		assert.Equal(t, producer.TopicOf(event), pub.subject)
+		assert.JSONEq(t, `{"id":1}`, string(pub.payload))
+	case err := <-errs:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "no message published")
+	}
+	select {
+	case pub := <-pubs:
+		assert.Equal(t, "orders.created", pub.subject)
+		assert.Equal(t, "line 1\r\nline 2", string(pub.payload), "payload sent as is")
+	case err := <-errs:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "no message published")
+	}
+	select {
+	case <-pongs:
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "no PONG to the server PING")
+	}
+
+	t.Run("Invalid subject", func(t *testing.T) {
+		assert.Error(t, natsProducer.ProduceMessage("orders created", []byte("{}")))
+		assert.Error(t, natsProducer.ProduceMessage("", []byte("{}")))
+	})
+	assert.Empty(t, errs)
+}
+
+func TestNatsProducerIdle(t *testing.T) {
+	// The deadline of a publish does not fail the PONG to a PING after an idle period
+	const timeout = 100 * time.Millisecond
+	pubs := make(chan natsPub, 10)
+	pongs := make(chan struct{}, 1)
+	errs := make(chan error, 10)
+	ping := make(chan struct{})
+	addr := fakeNatsServer(t, func(conn net.Conn, r *bufio.Reader) {
+		if _, err := natsHandshake(conn, r, "PONG"); err != nil {
+			errs <- err
+			return
+		}
+		go func() {
+			<-ping
+			fmt.Fprint(conn, "PING\r\n")
+		}()
+		serveNatsClient(r, conn, pubs, pongs, errs, "")
+	})
+
+	natsProducer, err := producer.NewNatsProducer("nats://"+addr, timeout)
+	require.NoError(t, err)
+	defer natsProducer.Close()
+
+	require.NoError(t, natsProducer.ProduceMessage("orders.created", []byte("{}")))
+	time.Sleep(3 * timeout)
+	close(ping)
+	select {
+	case <-pongs:
+	case err := <-errs:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "no PONG to the server PING")
+	}
+
+	require.NoError(t, natsProducer.ProduceMessage("orders.created", []byte("{}")))
+	assert.Len(t, pubs, 2)
+	assert.Empty(t, errs)
+}
+
+func TestNatsProducerErrors(t *testing.T) {
+	t.Run("CONNECT refused", func(t *testing.T) {
+		addr := fakeNatsServer(t, func(conn net.Conn, r *bufio.Reader) {
+			natsHandshake(conn, r, "-ERR 'Authorization Violation'")
+		})
+
+		_, err := producer.NewNatsProducer("nats://svc:wrong@"+addr, time.Second)
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "Authorization Violation")
+		}
+	})
+
+	t.Run("PUB refused, connection kept", func(t *testing.T) {
+		// NATS keeps the connection after refusing a message, the PONG follows the -ERR
+		errs := make(chan error, 10)
+		addr := fakeNatsServer(t, func(conn net.Conn, r *bufio.Reader) {
+			if _, err := natsHandshake(conn, r, "PONG"); err != nil {
+				errs <- err
+				return
+			}
+			for {
+				line, err := readNatsLine(r)
+				if err != nil {
+					return
+				}
+				switch {
+				case strings.HasPrefix(line, "PUB "):
+					pub, err := readNatsPub(line, r)
+					if err != nil {
+						errs <- err
+						return
+					}
+					if pub.subject == "orders.created" {
+						fmt.Fprint(conn, "-ERR 'Permissions Violation for Publish to \"orders.created\"'\r\n")
+					}
+				case line == "PING":
+					fmt.Fprint(conn, "PONG\r\n")
+				}
+			}
+		})
+
+		natsProducer, err := producer.NewNatsProducer("nats://"+addr, time.Second)
+		require.NoError(t, err)
+		defer natsProducer.Close()
+
+		assert.Error(t, natsProducer.ProduceMessage("orders.created", []byte("{}")))
+		assert.NoError(t, natsProducer.ProduceMessage("products.deleted", []byte("{}")))
+		assert.Error(t, natsProducer.ProduceMessage("orders.created", []byte("{}")))
+		assert.Empty(t, errs)
+	})
+
+	t.Run("No reply", func(t *testing.T) {
+		addr := fakeNatsServer(t, func(conn net.Conn, r *bufio.Reader) {
+			natsHandshake(conn, r, "PONG")
+			io.Copy(io.Discard, r)
+		})
+
+		natsProducer, err := producer.NewNatsProducer("nats://"+addr, 200*time.Millisecond)
+		require.NoError(t, err)
+		defer natsProducer.Close()
+
+		assert.Error(t, natsProducer.ProduceMessage("orders.created", []byte("{}")))
+	})
+
+	t.Run("Not a NATS server", func(t *testing.T) {
+		addr := fakeNatsServer(t, func(conn net.Conn, r *bufio.Reader) {
+			fmt.Fprint(conn, "HTTP/1.1 400 Bad Request\r\n")
+		})
+
+		_, err := producer.NewNatsProducer("nats://"+addr, time.Second)
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "unexpected greeting")
+		}
+	})
+
+	t.Run("PUB refused", func(t *testing.T) {
+		// The first connection refuses the message and is closed, as NATS does
+		// on a permissions violation, the producer connects again
+		var connections atomic.Int32
+		pubs := make(chan natsPub, 10)
+		errs := make(chan error, 10)
+		addr := fakeNatsServer(t, func(conn net.Conn, r *bufio.Reader) {
+			if _, err := natsHandshake(conn, r, "PONG"); err != nil {
+				errs <- err
+				return
+			}
+			reply := ""
+			if connections.Add(1) == 1 {
+				reply = "-ERR 'Permissions Violation for Publish to \"orders.created\"'"
+			}
+			serveNatsClient(r, conn, pubs, make(chan struct{}, 10), errs, reply)
+		})
+
+		natsProducer, err := producer.NewNatsProducer("nats://"+addr, time.Second)
+		require.NoError(t, err)
+		defer natsProducer.Close()
+
+		err = natsProducer.ProduceMessage("orders.created", []byte("{}"))
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "Permissions Violation")
+		}
+		require.NoError(t, natsProducer.ProduceMessage("orders.created", []byte("{}")))
+		assert.Len(t, pubs, 1)
+		assert.Equal(t, int32(2), connections.Load())
+		assert.Empty(t, errs)
+	})
+}
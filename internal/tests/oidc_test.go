@@ -0,0 +1,322 @@
+package tests
+
+import (
+	"encoding/json"
+	nethttp "net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/WarisLi/Golang-mini-project/internal/adapters/oidc"
+	"github.com/WarisLi/Golang-mini-project/internal/core/models"
+	"github.com/WarisLi/Golang-mini-project/internal/core/ports"
+	"github.com/WarisLi/Golang-mini-project/internal/tests/mocks"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testOIDCRedirectURL = "http://localhost/user/oidc/mock/callback"
+
+// oidcAppTest is the memory app with the provider "mock", logging in at a local
+// MockOIDCProvider.
+type oidcAppTest struct {
+	*memoryAppTest
+	provider *mocks.MockOIDCProvider
+}
+
+func setupOIDCAppTest(t *testing.T, configure func(provider *ports.OIDCProvider)) *oidcAppTest {
+	mockProvider := mocks.NewMockOIDCProvider("test-client", "test-secret")
+	t.Cleanup(mockProvider.Close)
+	provider := ports.OIDCProvider{
+		IdentityProvider: oidc.NewHttpIdentityProvider(oidc.ProviderOptions{
+			Issuer:       mockProvider.Issuer(),
+			ClientID:     "test-client",
+			ClientSecret: "test-secret",
+			RedirectURL:  testOIDCRedirectURL,
+			Scopes:       []string{"openid", "profile", "email"},
+			Timeout:      5 * time.Second,
+		}),
+		AdminGroups: []string{"admins"},
+		Provision:   true,
+	}
+	if configure != nil {
+		configure(&provider)
+	}
+
+	return &oidcAppTest{
+		memoryAppTest: setupMemoryAppTest(t, memoryAppOptions{oidcProviders: map[string]ports.OIDCProvider{"mock": provider}}),
+		provider:      mockProvider,
+	}
+}
+
+// beginLogin starts a login at the provider and returns the state cookie and the callback
+// the provider redirects the browser to.
+func (env *oidcAppTest) beginLogin(t *testing.T) (*nethttp.Cookie, *url.URL) {
+	resp, err := env.app.Test(httptest.NewRequest("GET", "/user/oidc/mock/login", nil))
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusFound, resp.StatusCode)
+	stateCookie := responseCookies(resp)["oidc_state"]
+	require.NotNil(t, stateCookie)
+	assert.True(t, stateCookie.HttpOnly)
+
+	authorization, err := url.Parse(resp.Header.Get("Location"))
+	require.NoError(t, err)
+	assert.Equal(t, env.provider.Issuer()+"/authorize", authorization.Scheme+"://"+authorization.Host+authorization.Path)
+	assert.Equal(t, "S256", authorization.Query().Get("code_challenge_method"))
+	assert.Equal(t, stateCookie.Value, authorization.Query().Get("state"))
+
+	client := &nethttp.Client{CheckRedirect: func(*nethttp.Request, []*nethttp.Request) error { return nethttp.ErrUseLastResponse }}
+	providerResp, err := client.Get(authorization.String())
+	require.NoError(t, err)
+	providerResp.Body.Close()
+	require.Equal(t, nethttp.StatusFound, providerResp.StatusCode)
+	callback, err := url.Parse(providerResp.Header.Get("Location"))
+	require.NoError(t, err)
+	return stateCookie, callback
+}
+
+// callback sends the callback of the provider to the app, with the state cookie when set.
+func (env *oidcAppTest) callback(t *testing.T, stateCookie *nethttp.Cookie, callback *url.URL) (int, map[string]string) {
+	req := httptest.NewRequest("GET", callback.RequestURI(), nil)
+	if stateCookie != nil {
+		req.AddCookie(stateCookie)
+	}
+	resp, err := env.app.Test(req)
+	require.NoError(t, err)
+
+	var response map[string]string
+	json.NewDecoder(resp.Body).Decode(&response)
+	return resp.StatusCode, response
+}
+
+// login logs the identity of claims in and returns the status and response of the callback.
+func (env *oidcAppTest) login(t *testing.T, claims jwt.MapClaims) (int, map[string]string) {
+	env.provider.SetClaims(claims)
+	stateCookie, callback := env.beginLogin(t)
+	return env.callback(t, stateCookie, callback)
+}
+
+func TestOIDCLogin(t *testing.T) {
+	env := setupOIDCAppTest(t, nil)
+
+	var providers []models.OIDCProviderResponse
+	status := sendJSONTo(t, env.app, "GET", "/user/oidc", "", nil, &providers)
+	assert.Equal(t, fiber.StatusOK, status)
+	assert.Equal(t, []models.OIDCProviderResponse{{Name: "mock", LoginURL: "/user/oidc/mock/login"}}, providers)
+
+	t.Run("provisions the user on its first login", func(t *testing.T) {
+		status, response := env.login(t, jwt.MapClaims{"sub": "dave-sub", "preferred_username": "dave", "email": "dave@example.com"})
+		require.Equal(t, fiber.StatusOK, status)
+
+		token, err := jwt.Parse(response["token"], testTokenService.Keyfunc)
+		require.NoError(t, err)
+		claims := token.Claims.(jwt.MapClaims)
+		assert.Equal(t, "dave", claims["sub"])
+		assert.Equal(t, models.RoleUser, claims["role"])
+
+		user, err := env.repos.User.GetUser("dave")
+		require.NoError(t, err)
+		assert.Equal(t, "mock", user.IdentityProvider)
+		assert.Equal(t, "dave-sub", *user.ExternalSubject)
+		assert.Equal(t, "dave@example.com", user.Email)
+		assert.Empty(t, user.Password)
+
+		event := receiveAuditEvent(t, env.auditEvents)
+		assert.Equal(t, models.UserProvisioned, event.Action)
+		assert.Equal(t, "dave", event.Username)
+		assert.Equal(t, "oidc:mock", event.Actor)
+	})
+
+	t.Run("the groups give the role on every login", func(t *testing.T) {
+		status, response := env.login(t, jwt.MapClaims{"sub": "dave-sub", "preferred_username": "renamed", "groups": []string{"admins"}})
+		require.Equal(t, fiber.StatusOK, status)
+
+		// The identity keeps its user, whatever its username at the provider
+		token, err := jwt.Parse(response["token"], testTokenService.Keyfunc)
+		require.NoError(t, err)
+		assert.Equal(t, "dave", token.Claims.(jwt.MapClaims)["sub"])
+		assert.Equal(t, models.RoleAdmin, token.Claims.(jwt.MapClaims)["role"])
+
+		event := receiveAuditEvent(t, env.auditEvents)
+		assert.Equal(t, models.UserRoleChanged, event.Action)
+		assert.Equal(t, models.RoleAdmin, event.Role)
+
+		// Out of the admin groups the admin tokens are signed out
+		status, _ = env.login(t, jwt.MapClaims{"sub": "dave-sub", "preferred_username": "dave"})
+		require.Equal(t, fiber.StatusOK, status)
+		assert.Equal(t, models.RoleUser, receiveAuditEvent(t, env.auditEvents).Role)
+		claims := token.Claims.(jwt.MapClaims)
+		assert.ErrorIs(t, env.userService.CheckSession("dave", claims["sid"].(string), int(claims["ver"].(float64)), models.RoleUser), ports.ErrInvalidSession)
+	})
+
+	t.Run("the users of the provider have no password", func(t *testing.T) {
+		status, _ := sendJSON(t, env.app, "POST", "/user/login", "", models.UsernamePassword{Username: "dave", Password: "Pass@12345"})
+		assert.Equal(t, fiber.StatusUnauthorized, status)
+	})
+
+	t.Run("the username of a local user is not taken over", func(t *testing.T) {
+		require.NoError(t, env.userService.RegisterUser(models.UsernamePassword{Username: "bob", Password: "Pass@12345"}))
+
+		status, _ := env.login(t, jwt.MapClaims{"sub": "bob-sub", "preferred_username": "bob"})
+		assert.Equal(t, fiber.StatusConflict, status)
+
+		user, err := env.repos.User.GetUser("bob")
+		require.NoError(t, err)
+		assert.Empty(t, user.IdentityProvider)
+		assert.NotEmpty(t, user.Password)
+	})
+
+	t.Run("the email is the username without username claim", func(t *testing.T) {
+		status, _ := env.login(t, jwt.MapClaims{"sub": "carol-sub", "email": "carol@example.com"})
+		assert.Equal(t, fiber.StatusOK, status)
+		_, err := env.repos.User.GetUser("carol@example.com")
+		assert.NoError(t, err)
+		receiveAuditEvent(t, env.auditEvents)
+	})
+}
+
+func TestOIDCLoginRefused(t *testing.T) {
+	t.Run("identity out of the allowed groups", func(t *testing.T) {
+		env := setupOIDCAppTest(t, func(provider *ports.OIDCProvider) {
+			provider.AllowedGroups = []string{"staff"}
+		})
+
+		status, _ := env.login(t, jwt.MapClaims{"sub": "dave-sub", "preferred_username": "dave", "groups": []string{"guests"}})
+		assert.Equal(t, fiber.StatusForbidden, status)
+		status, _ = env.login(t, jwt.MapClaims{"sub": "dave-sub", "preferred_username": "dave", "groups": []string{"staff"}})
+		assert.Equal(t, fiber.StatusOK, status)
+	})
+
+	t.Run("replayed callback", func(t *testing.T) {
+		env := setupOIDCAppTest(t, nil)
+		env.provider.SetClaims(jwt.MapClaims{"sub": "dave-sub", "preferred_username": "dave"})
+		stateCookie, callback := env.beginLogin(t)
+
+		status, _ := env.callback(t, stateCookie, callback)
+		assert.Equal(t, fiber.StatusOK, status)
+		status, _ = env.callback(t, stateCookie, callback)
+		assert.Equal(t, fiber.StatusUnauthorized, status)
+	})
+
+	t.Run("callback in another browser", func(t *testing.T) {
+		env := setupOIDCAppTest(t, nil)
+		env.provider.SetClaims(jwt.MapClaims{"sub": "dave-sub", "preferred_username": "dave"})
+		_, callback := env.beginLogin(t)
+
+		status, _ := env.callback(t, nil, callback)
+		assert.Equal(t, fiber.StatusUnauthorized, status)
+		otherCookie, _ := env.beginLogin(t)
+		status, _ = env.callback(t, otherCookie, callback)
+		assert.Equal(t, fiber.StatusUnauthorized, status)
+	})
+
+	t.Run("ID token of another client", func(t *testing.T) {
+		env := setupOIDCAppTest(t, nil)
+		status, _ := env.login(t, jwt.MapClaims{"sub": "dave-sub", "preferred_username": "dave", "aud": "other-client"})
+		assert.Equal(t, fiber.StatusUnauthorized, status)
+	})
+
+	t.Run("ID token of another login", func(t *testing.T) {
+		env := setupOIDCAppTest(t, nil)
+		status, _ := env.login(t, jwt.MapClaims{"sub": "dave-sub", "preferred_username": "dave", "nonce": "other-nonce"})
+		assert.Equal(t, fiber.StatusUnauthorized, status)
+	})
+
+	t.Run("expired ID token", func(t *testing.T) {
+		env := setupOIDCAppTest(t, nil)
+		status, _ := env.login(t, jwt.MapClaims{"sub": "dave-sub", "preferred_username": "dave", "exp": time.Now().Add(-time.Hour).Unix()})
+		assert.Equal(t, fiber.StatusUnauthorized, status)
+	})
+
+	t.Run("login refused by the provider", func(t *testing.T) {
+		env := setupOIDCAppTest(t, nil)
+		status, response := env.callback(t, nil, &url.URL{Path: "/user/oidc/mock/callback", RawQuery: "error=access_denied&state=state"})
+		assert.Equal(t, fiber.StatusUnauthorized, status)
+		assert.Contains(t, response["message"], "access_denied")
+	})
+
+	t.Run("unknown provider", func(t *testing.T) {
+		env := setupOIDCAppTest(t, nil)
+		resp, err := env.app.Test(httptest.NewRequest("GET", "/user/oidc/other/login", nil))
+		require.NoError(t, err)
+		assert.Equal(t, fiber.StatusNotFound, resp.StatusCode)
+	})
+
+	t.Run("unavailable provider", func(t *testing.T) {
+		env := setupOIDCAppTest(t, nil)
+		env.provider.Close()
+		resp, err := env.app.Test(httptest.NewRequest("GET", "/user/oidc/mock/login", nil), 10000)
+		require.NoError(t, err)
+		assert.Equal(t, fiber.StatusBadGateway, resp.StatusCode)
+	})
+
+	t.Run("disabled user", func(t *testing.T) {
+		env := setupOIDCAppTest(t, nil)
+		status, _ := env.login(t, jwt.MapClaims{"sub": "dave-sub", "preferred_username": "dave"})
+		require.Equal(t, fiber.StatusOK, status)
+		user, err := env.repos.User.GetUser("dave")
+		require.NoError(t, err)
+		user.Disabled = true
+		require.NoError(t, env.repos.User.UpdateUser(*user))
+
+		status, _ = env.login(t, jwt.MapClaims{"sub": "dave-sub", "preferred_username": "dave"})
+		assert.Equal(t, fiber.StatusForbidden, status)
+	})
+}
+
+func TestOIDCLinkUsers(t *testing.T) {
+	env := setupOIDCAppTest(t, func(provider *ports.OIDCProvider) {
+		provider.Provision = false
+		provider.LinkUsers = true
+	})
+	require.NoError(t, env.userService.RegisterUser(models.UsernamePassword{Username: "bob", Password: "Pass@12345"}))
+
+	status, _ := env.login(t, jwt.MapClaims{"sub": "bob-sub", "preferred_username": "bob"})
+	require.Equal(t, fiber.StatusOK, status)
+	user, err := env.repos.User.GetUser("bob")
+	require.NoError(t, err)
+	assert.Equal(t, "mock", user.IdentityProvider)
+	assert.Empty(t, user.Password)
+	assert.Equal(t, models.UserIdentityLinked, receiveAuditEvent(t, env.auditEvents).Action)
+
+	// The password of bob no longer logs in
+	status, _ = sendJSON(t, env.app, "POST", "/user/login", "", models.UsernamePassword{Username: "bob", Password: "Pass@12345"})
+	assert.Equal(t, fiber.StatusUnauthorized, status)
+
+	// Another identity with the username of bob is not linked over it
+	status, _ = env.login(t, jwt.MapClaims{"sub": "other-sub", "preferred_username": "bob"})
+	assert.Equal(t, fiber.StatusConflict, status)
+
+	// Without provisioning the unknown users cannot log in
+	status, _ = env.login(t, jwt.MapClaims{"sub": "carol-sub", "preferred_username": "carol"})
+	assert.Equal(t, fiber.StatusForbidden, status)
+}
+
+func TestOIDCCodeVerifier(t *testing.T) {
+	mockProvider := mocks.NewMockOIDCProvider("test-client", "")
+	defer mockProvider.Close()
+	mockProvider.SetClaims(jwt.MapClaims{"sub": "dave-sub"})
+	provider := oidc.NewHttpIdentityProvider(oidc.ProviderOptions{
+		Issuer:      mockProvider.Issuer(),
+		ClientID:    "test-client",
+		RedirectURL: testOIDCRedirectURL,
+		Scopes:      []string{"openid"},
+	})
+
+	// The challenge of the verifier "verifier"
+	authorizationURL, err := provider.AuthorizationURL("state", "nonce", "iMnq5o6zALKXGivsnlom_0F5_WYda32GHkxlV7mq7hQ")
+	require.NoError(t, err)
+	client := &nethttp.Client{CheckRedirect: func(*nethttp.Request, []*nethttp.Request) error { return nethttp.ErrUseLastResponse }}
+	resp, err := client.Get(authorizationURL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	callback, err := url.Parse(resp.Header.Get("Location"))
+	require.NoError(t, err)
+
+	// A stolen code is useless without the verifier
+	_, err = provider.Exchange(callback.Query().Get("code"), "other-verifier")
+	assert.ErrorIs(t, err, ports.ErrInvalidOIDCLogin)
+}
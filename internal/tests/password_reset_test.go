@@ -0,0 +1,302 @@
+package tests
+
+import (
+	"bufio"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/WarisLi/Golang-mini-project/internal/adapters/notifier"
+	"github.com/WarisLi/Golang-mini-project/internal/core/models"
+	"github.com/WarisLi/Golang-mini-project/internal/core/ports"
+	"github.com/WarisLi/Golang-mini-project/internal/tests/mocks"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestPasswordReset(t *testing.T) {
+	mockNotifier := new(mocks.MockNotifier)
+	env := setupMemoryAppTest(t, memoryAppOptions{user: ports.UserServiceOptions{PasswordResetTTL: time.Hour}, notifier: mockNotifier})
+	app, userService := env.app, env.userService
+	require.NoError(t, userService.RegisterUser(models.UsernamePassword{Username: "user_1", Password: "Pass@12345", Email: "user_1@example.com"}))
+
+	var notification models.Notification
+	mockNotifier.On("Notify", mock.Anything).Run(func(args mock.Arguments) {
+		notification = args.Get(0).(models.Notification)
+	}).Return(nil).Once()
+
+	status, response := sendJSON(t, app, "POST", "/user/login", "", models.UsernamePassword{Username: "user_1", Password: "Pass@12345"})
+	require.Equal(t, fiber.StatusOK, status)
+	sessionToken := response["token"]
+
+	status, _ = sendJSON(t, app, "POST", "/user/password/forgot", "", models.ForgotPassword{Username: "user_1"})
+	assert.Equal(t, fiber.StatusAccepted, status)
+	userService.Wait()
+	assert.Equal(t, "user_1@example.com", notification.To)
+	resetToken := strings.Split(notification.Body, "\n\n")[1]
+	assert.NotEmpty(t, resetToken)
+
+	// Unknown users get the same response and no notification
+	status, _ = sendJSON(t, app, "POST", "/user/password/forgot", "", models.ForgotPassword{Username: "missing"})
+	assert.Equal(t, fiber.StatusAccepted, status)
+	userService.Wait()
+	mockNotifier.AssertNumberOfCalls(t, "Notify", 1)
+
+	tests := []struct {
+		description  string
+		reset        models.ResetPassword
+		expectStatus int
+	}{
+		{description: "Wrong token", reset: models.ResetPassword{Token: "wrong", NewPassword: "NewPass@12345"}, expectStatus: fiber.StatusBadRequest},
+		{description: "Missing password", reset: models.ResetPassword{Token: resetToken}, expectStatus: fiber.StatusBadRequest},
+		{description: "Valid token", reset: models.ResetPassword{Token: resetToken, NewPassword: "NewPass@12345"}, expectStatus: fiber.StatusOK},
+		{description: "Used token", reset: models.ResetPassword{Token: resetToken, NewPassword: "OtherPass@12345"}, expectStatus: fiber.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			status, _ := sendJSON(t, app, "POST", "/user/password/reset", "", test.reset)
+			assert.Equal(t, test.expectStatus, status)
+		})
+	}
+
+	// The tokens issued before the reset are invalidated
+	status, response = sendJSON(t, app, "GET", sessionURL, sessionToken, nil)
+	assert.Equal(t, fiber.StatusUnauthorized, status)
+	assert.Equal(t, ports.ErrInvalidSession.Error(), response["message"])
+
+	status, _ = sendJSON(t, app, "POST", "/user/login", "", models.UsernamePassword{Username: "user_1", Password: "Pass@12345"})
+	assert.Equal(t, fiber.StatusUnauthorized, status)
+	status, response = sendJSON(t, app, "POST", "/user/login", "", models.UsernamePassword{Username: "user_1", Password: "NewPass@12345"})
+	assert.Equal(t, fiber.StatusOK, status)
+	status, _ = sendJSON(t, app, "GET", sessionURL, response["token"], nil)
+	assert.Equal(t, fiber.StatusOK, status)
+}
+
+func TestPasswordResetExpired(t *testing.T) {
+	mockNotifier := new(mocks.MockNotifier)
+	env := setupMemoryAppTest(t, memoryAppOptions{user: ports.UserServiceOptions{PasswordResetTTL: time.Millisecond}, notifier: mockNotifier})
+	app, userService := env.app, env.userService
+	require.NoError(t, userService.RegisterUser(models.UsernamePassword{Username: "user_1", Password: "Pass@12345"}))
+
+	var notification models.Notification
+	mockNotifier.On("Notify", mock.Anything).Run(func(args mock.Arguments) {
+		notification = args.Get(0).(models.Notification)
+	}).Return(nil)
+
+	require.NoError(t, userService.RequestPasswordReset("user_1"))
+	userService.Wait()
+	time.Sleep(5 * time.Millisecond)
+
+	status, response := sendJSON(t, app, "POST", "/user/password/reset", "", models.ResetPassword{
+		Token:       strings.Split(notification.Body, "\n\n")[1],
+		NewPassword: "NewPass@12345",
+	})
+	assert.Equal(t, fiber.StatusBadRequest, status)
+	assert.Equal(t, ports.ErrInvalidResetToken.Error(), response["message"])
+}
+
+func TestChangePassword(t *testing.T) {
+	env := setupMemoryAppTest(t, memoryAppOptions{user: ports.UserServiceOptions{
+		PasswordPolicy: ports.PasswordPolicy{MinLength: 8},
+	}})
+	app, userService := env.app, env.userService
+	require.NoError(t, userService.RegisterUser(models.UsernamePassword{Username: "user_1", Password: "Pass@12345"}))
+
+	status, response := sendJSON(t, app, "POST", "/user/login", "", models.UsernamePassword{Username: "user_1", Password: "Pass@12345"})
+	require.Equal(t, fiber.StatusOK, status)
+	oldToken := response["token"]
+
+	tests := []struct {
+		description  string
+		change       models.ChangePassword
+		expectStatus int
+	}{
+		{description: "Wrong current password", change: models.ChangePassword{CurrentPassword: "WrongPass", NewPassword: "NewPass@12345"}, expectStatus: fiber.StatusUnauthorized},
+		{description: "Weak password", change: models.ChangePassword{CurrentPassword: "Pass@12345", NewPassword: "short"}, expectStatus: fiber.StatusBadRequest},
+		{description: "Missing param", change: models.ChangePassword{CurrentPassword: "Pass@12345"}, expectStatus: fiber.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			status, _ := sendJSON(t, app, "PUT", "/user/password", oldToken, test.change)
+			assert.Equal(t, test.expectStatus, status)
+		})
+	}
+
+	status, response = sendJSON(t, app, "PUT", "/user/password", oldToken, models.ChangePassword{CurrentPassword: "Pass@12345", NewPassword: "NewPass@12345"})
+	require.Equal(t, fiber.StatusOK, status)
+	newToken := response["token"]
+
+	status, _ = sendJSON(t, app, "GET", sessionURL, oldToken, nil)
+	assert.Equal(t, fiber.StatusUnauthorized, status)
+	status, _ = sendJSON(t, app, "GET", sessionURL, newToken, nil)
+	assert.Equal(t, fiber.StatusOK, status)
+	status, _ = sendJSON(t, app, "POST", "/user/login", "", models.UsernamePassword{Username: "user_1", Password: "NewPass@12345"})
+	assert.Equal(t, fiber.StatusOK, status)
+}
+
+func TestCheckSession(t *testing.T) {
+	app, mocks := setupAppTestWithMocks()
+	mocks.userRepo.On("GetUser", "disabled_user").Return(&models.User{Username: "disabled_user", Disabled: true}, nil)
+	mocks.userRepo.On("GetUser", "deleted_user").Return(nil, gorm.ErrRecordNotFound)
+	mocks.userRepo.On("GetUser", "recreated_user").Return(&models.User{Username: "recreated_user", Role: models.RoleAdmin, SessionID: "new"}, nil)
+	mocks.userRepo.On("GetUser", "demoted_user").Return(&models.User{Username: "demoted_user", Role: models.RoleUser}, nil)
+	mocks.productRepo.On("GetPage", mock.Anything).Return([]models.Product{}, int64(0), nil)
+
+	tests := []struct {
+		description  string
+		username     string
+		version      int
+		expectStatus int
+	}{
+		{description: "Current session", username: "mock_user", version: 0, expectStatus: fiber.StatusOK},
+		{description: "Invalidated session", username: "mock_user", version: 1, expectStatus: fiber.StatusUnauthorized},
+		{description: "Disabled user", username: "disabled_user", version: 0, expectStatus: fiber.StatusUnauthorized},
+		{description: "Deleted user", username: "deleted_user", version: 0, expectStatus: fiber.StatusUnauthorized},
+		{description: "User deleted and created again", username: "recreated_user", version: 0, expectStatus: fiber.StatusUnauthorized},
+		{description: "Role changed", username: "demoted_user", version: 0, expectStatus: fiber.StatusUnauthorized},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			signedToken := signTestToken(models.User{Username: test.username, Role: models.RoleAdmin, SessionVersion: test.version})
+
+			req := httptest.NewRequest("GET", "/product", nil)
+			req.Header.Set("Authorization", "Bearer "+signedToken)
+			resp, _ := app.Test(req)
+
+			assert.Equal(t, test.expectStatus, resp.StatusCode)
+		})
+	}
+}
+
+func TestForgotPasswordUnknownUser(t *testing.T) {
+	app, mocks := setupAppTestWithMocks()
+	mocks.userRepo.On("GetUser", "missing").Return(nil, gorm.ErrRecordNotFound)
+
+	status, _ := sendJSON(t, app, "POST", "/user/password/forgot", "", models.ForgotPassword{Username: "missing"})
+	assert.Equal(t, fiber.StatusAccepted, status)
+	mocks.notifier.AssertNotCalled(t, "Notify", mock.Anything)
+	mocks.passwordReset.AssertNotCalled(t, "CreatePasswordResetToken", mock.Anything)
+}
+
+func TestPasswordResetSentInBackground(t *testing.T) {
+	mockNotifier := new(mocks.MockNotifier)
+	env := setupMemoryAppTest(t, memoryAppOptions{user: ports.UserServiceOptions{PasswordResetTTL: time.Hour}, notifier: mockNotifier})
+	app, userService := env.app, env.userService
+
+	// The response of a user does not wait for a slow mail server
+	release := make(chan struct{})
+	mockNotifier.On("Notify", mock.Anything).Run(func(mock.Arguments) { <-release }).Return(nil).Once()
+
+	status, _ := sendJSON(t, app, "POST", "/user/password/forgot", "", models.ForgotPassword{Username: "alice"})
+	assert.Equal(t, fiber.StatusAccepted, status)
+	close(release)
+	userService.Wait()
+	mockNotifier.AssertExpectations(t)
+}
+
+// fakeSmtp accepts the messages of an SMTP client without authentication nor TLS.
+type fakeSmtp struct {
+	listener net.Listener
+
+	mu       sync.Mutex
+	from     string
+	to       []string
+	messages []string
+}
+
+func newFakeSmtp(t *testing.T) *fakeSmtp {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	server := &fakeSmtp{listener: listener}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn)
+		}
+	}()
+	return server
+}
+
+func (s *fakeSmtp) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	conn.Write([]byte("220 localhost ESMTP\r\n"))
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		command := strings.ToUpper(strings.Fields(line)[0])
+
+		s.mu.Lock()
+		reply := "250 OK\r\n"
+		switch command {
+		case "EHLO", "HELO":
+			reply = "250 localhost\r\n"
+		case "MAIL":
+			s.from = strings.TrimSpace(line)
+		case "RCPT":
+			s.to = append(s.to, strings.TrimSpace(line))
+		case "DATA":
+			conn.Write([]byte("354 End data with <CR><LF>.<CR><LF>\r\n"))
+			var message strings.Builder
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil || line == ".\r\n" {
+					break
+				}
+				message.WriteString(line)
+			}
+			s.messages = append(s.messages, message.String())
+		case "QUIT":
+			reply = "221 Bye\r\n"
+		}
+		s.mu.Unlock()
+
+		conn.Write([]byte(reply))
+		if command == "QUIT" {
+			return
+		}
+	}
+}
+
+func TestSmtpNotifier(t *testing.T) {
+	server := newFakeSmtp(t)
+	addr := server.listener.Addr().(*net.TCPAddr)
+
+	smtpNotifier := notifier.NewSmtpNotifier(notifier.SmtpOptions{
+		Host:    addr.IP.String(),
+		Port:    addr.Port,
+		From:    "no-reply@example.com",
+		Timeout: time.Second,
+	})
+
+	err := smtpNotifier.Notify(models.Notification{To: "user_1@example.com", Subject: "Reset your password", Body: "Token:\n\nabc"})
+	require.NoError(t, err)
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	assert.Equal(t, "MAIL FROM:<no-reply@example.com>", server.from)
+	assert.Equal(t, []string{"RCPT TO:<user_1@example.com>"}, server.to)
+	require.Len(t, server.messages, 1)
+	assert.Contains(t, server.messages[0], "Subject: Reset your password\r\n")
+	assert.Contains(t, server.messages[0], "To: user_1@example.com\r\n")
+	assert.True(t, strings.HasSuffix(server.messages[0], "\r\n\r\nToken:\r\n\r\nabc\r\n"), server.messages[0])
+
+	assert.Error(t, smtpNotifier.Notify(models.Notification{Subject: "No address"}))
+}
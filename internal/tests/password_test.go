@@ -0,0 +1,217 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/WarisLi/Golang-mini-project/internal/adapters/http"
+	"github.com/WarisLi/Golang-mini-project/internal/adapters/memory"
+	"github.com/WarisLi/Golang-mini-project/internal/adapters/notifier"
+	"github.com/WarisLi/Golang-mini-project/internal/config"
+	"github.com/WarisLi/Golang-mini-project/internal/core/models"
+	"github.com/WarisLi/Golang-mini-project/internal/core/ports"
+	"github.com/gofiber/fiber/v2"
+	"github.com/joho/godotenv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestPasswordPolicy(t *testing.T) {
+	policy := ports.PasswordPolicy{
+		MinLength:     8,
+		RequireUpper:  true,
+		RequireLower:  true,
+		RequireDigit:  true,
+		RequireSymbol: true,
+		Breached:      map[string]struct{}{ports.BreachedPasswordKey("Passw0rd!"): {}},
+	}
+
+	tests := []struct {
+		description      string
+		password         string
+		expectViolations []string
+	}{
+		{description: "Valid", password: "Corr3ct-Horse"},
+		{description: "Too short", password: "Ab1!", expectViolations: []string{"at least 8 characters"}},
+		{description: "Missing classes", password: "correcthorse", expectViolations: []string{"an upper case letter", "a digit", "a symbol"}},
+		{description: "Breached", password: "Passw0rd!", expectViolations: []string{"not found in a data breach"}},
+		{description: "Empty", password: "", expectViolations: []string{
+			"at least 8 characters", "an upper case letter", "a lower case letter", "a digit", "a symbol",
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			err := policy.Check(test.password)
+			if test.expectViolations == nil {
+				assert.NoError(t, err)
+				return
+			}
+
+			var policyErr *ports.PasswordPolicyError
+			require.ErrorAs(t, err, &policyErr)
+			assert.ErrorIs(t, err, ports.ErrWeakPassword)
+			assert.Equal(t, test.expectViolations, policyErr.Violations)
+		})
+	}
+}
+
+func TestLoadBreachedPasswords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	hibpLine := strings.ToLower(ports.BreachedPasswordKey("Hunter22")) + ":1234"
+	require.NoError(t, os.WriteFile(path, []byte("Passw0rd!\n\n"+hibpLine+"\n"), 0o600))
+
+	breached, err := config.LoadBreachedPasswords(path)
+	require.NoError(t, err)
+	assert.Len(t, breached, 2)
+	assert.Contains(t, breached, ports.BreachedPasswordKey("Passw0rd!"))
+	assert.Contains(t, breached, ports.BreachedPasswordKey("Hunter22"))
+
+	breached, err = config.LoadBreachedPasswords("")
+	require.NoError(t, err)
+	assert.Empty(t, breached)
+
+	_, err = config.LoadBreachedPasswords(filepath.Join(t.TempDir(), "missing.txt"))
+	assert.Error(t, err)
+}
+
+func TestPasswordHash(t *testing.T) {
+	bcryptOptions := ports.PasswordHashOptions{Algorithm: ports.PasswordBcrypt, BcryptCost: bcrypt.MinCost}
+	argon2Options := ports.PasswordHashOptions{Algorithm: ports.PasswordArgon2id, Argon2Time: 1, Argon2Memory: 1024, Argon2Threads: 1}
+
+	tests := []struct {
+		description  string
+		options      ports.PasswordHashOptions
+		expectPrefix string
+		otherOptions ports.PasswordHashOptions
+	}{
+		{
+			description:  "bcrypt",
+			options:      bcryptOptions,
+			expectPrefix: "$2a$04$",
+			otherOptions: ports.PasswordHashOptions{Algorithm: ports.PasswordBcrypt, BcryptCost: bcrypt.MinCost + 1},
+		},
+		{
+			description:  "argon2id",
+			options:      argon2Options,
+			expectPrefix: "$argon2id$v=19$m=1024,t=1,p=1$",
+			otherOptions: ports.PasswordHashOptions{Algorithm: ports.PasswordArgon2id, Argon2Time: 2, Argon2Memory: 1024, Argon2Threads: 1},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			hash, err := ports.HashPassword("Pass@12345", test.options)
+			require.NoError(t, err)
+			assert.True(t, strings.HasPrefix(hash, test.expectPrefix), hash)
+
+			other, err := ports.HashPassword("Pass@12345", test.options)
+			require.NoError(t, err)
+			assert.NotEqual(t, hash, other, "hashes are salted")
+
+			assert.NoError(t, ports.VerifyPassword(hash, "Pass@12345"))
+			assert.Error(t, ports.VerifyPassword(hash, "WrongPass"))
+
+			assert.False(t, ports.PasswordNeedsRehash(hash, test.options))
+			assert.True(t, ports.PasswordNeedsRehash(hash, test.otherOptions))
+		})
+	}
+
+	bcryptHash, err := ports.HashPassword("Pass@12345", bcryptOptions)
+	require.NoError(t, err)
+	assert.True(t, ports.PasswordNeedsRehash(bcryptHash, argon2Options))
+
+	assert.Error(t, ports.VerifyPassword("$argon2id$v=19$m=1024$invalid", "Pass@12345"))
+	_, err = ports.HashPassword("Pass@12345", ports.PasswordHashOptions{Algorithm: "md5"})
+	assert.Error(t, err)
+}
+
+func TestLoginRehashesPassword(t *testing.T) {
+	require.NoError(t, godotenv.Load("../../.env"))
+
+	repo := memory.NewMemoryRepository()
+	userRepo := memory.NewMemoryUserRepository(repo)
+	bcryptService := ports.NewUserService(userRepo, memory.NewMemoryPasswordResetRepository(repo), notifier.NewLogNotifier(), testTokenService, ports.UserServiceOptions{
+		PasswordHash: ports.PasswordHashOptions{Algorithm: ports.PasswordBcrypt, BcryptCost: bcrypt.MinCost},
+	})
+	require.NoError(t, bcryptService.RegisterUser(models.UsernamePassword{Username: "user_1", Password: "Pass@12345"}))
+
+	argon2Service := ports.NewUserService(userRepo, memory.NewMemoryPasswordResetRepository(repo), notifier.NewLogNotifier(), testTokenService, ports.UserServiceOptions{
+		PasswordHash: ports.PasswordHashOptions{Algorithm: ports.PasswordArgon2id, Argon2Time: 1, Argon2Memory: 1024, Argon2Threads: 1},
+	})
+
+	// A failed login keeps the hash
+	_, err := argon2Service.LoginUser(models.UsernamePassword{Username: "user_1", Password: "WrongPass"})
+	require.Error(t, err)
+	user, err := userRepo.GetUser("user_1")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(user.Password, "$2a$"), user.Password)
+
+	_, err = argon2Service.LoginUser(models.UsernamePassword{Username: "user_1", Password: "Pass@12345"})
+	require.NoError(t, err)
+	user, err = userRepo.GetUser("user_1")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(user.Password, "$argon2id$"), user.Password)
+
+	// Both services verify the new hash
+	_, err = argon2Service.LoginUser(models.UsernamePassword{Username: "user_1", Password: "Pass@12345"})
+	assert.NoError(t, err)
+	_, err = bcryptService.LoginUser(models.UsernamePassword{Username: "user_1", Password: "Pass@12345"})
+	assert.NoError(t, err)
+}
+
+func TestCreateUserPasswordPolicy(t *testing.T) {
+	repo := memory.NewMemoryRepository()
+	userRepo := memory.NewMemoryUserRepository(repo)
+	userService := ports.NewUserService(userRepo, memory.NewMemoryPasswordResetRepository(repo), notifier.NewLogNotifier(), testTokenService, ports.UserServiceOptions{
+		PasswordPolicy: ports.PasswordPolicy{MinLength: 8, RequireUpper: true, RequireLower: true, RequireDigit: true},
+		PasswordHash:   ports.PasswordHashOptions{BcryptCost: bcrypt.MinCost},
+	})
+
+	app := fiber.New()
+	app.Post("/user", http.NewHttpUserHandler(userService, testCookieOptions).CreateUser)
+
+	tests := []struct {
+		description   string
+		requestBody   models.UsernamePassword
+		expectStatus  int
+		expectMessage string
+	}{
+		{
+			description:  "Valid password",
+			requestBody:  models.UsernamePassword{Username: "user_1", Password: "Pass@12345"},
+			expectStatus: fiber.StatusCreated,
+		},
+		{
+			description:   "Weak password",
+			requestBody:   models.UsernamePassword{Username: "user_2", Password: "1234"},
+			expectStatus:  fiber.StatusBadRequest,
+			expectMessage: "password does not meet the policy: at least 8 characters, an upper case letter, a lower case letter",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			reqBody, _ := json.Marshal(test.requestBody)
+			req := httptest.NewRequest("POST", "/user", bytes.NewReader(reqBody))
+			req.Header.Set("Content-Type", "application/json")
+			resp, _ := app.Test(req)
+
+			assert.Equal(t, test.expectStatus, resp.StatusCode)
+			if test.expectMessage != "" {
+				var body models.MessageResponse
+				require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+				assert.Equal(t, test.expectMessage, body.Message)
+			}
+		})
+	}
+
+	_, err := userRepo.GetUser("user_2")
+	assert.Error(t, err)
+}
@@ -0,0 +1,75 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/WarisLi/Golang-mini-project/internal/adapters/producer"
+	events "github.com/WarisLi/Golang-shared-events"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChannelBus(t *testing.T) {
+	bus := producer.NewChannelBus(10)
+	topicSubscriber := bus.Subscribe("LowProductQuantityNotificationEvent")
+	allSubscriber := bus.Subscribe("")
+	otherSubscriber := bus.Subscribe("OtherEvent")
+
+	event := events.LowProductQuantityNotificationEvent{Name: "Book A", Quantity: 10}
+	assert.NoError(t, bus.Produce(event))
+
+	expectValue, _ := json.Marshal(event)
+	for _, subscriber := range []<-chan producer.Message{topicSubscriber, allSubscriber} {
+		msg := <-subscriber
+		assert.Equal(t, "LowProductQuantityNotificationEvent", msg.Topic)
+		assert.JSONEq(t, string(expectValue), string(msg.Value))
+	}
+	assert.Len(t, otherSubscriber, 0)
+
+	bus.Unsubscribe(topicSubscriber)
+	_, open := <-topicSubscriber
+	assert.False(t, open)
+}
+
+func TestFileProducer(t *testing.T) {
+	var buf bytes.Buffer
+	fileProducer := producer.NewFileProducer(&buf)
+
+	assert.NoError(t, fileProducer.Produce(events.LowProductQuantityNotificationEvent{Name: "Book A", Quantity: 10}))
+
+	var record struct {
+		Topic string
+		Value events.LowProductQuantityNotificationEvent
+	}
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	assert.Equal(t, "LowProductQuantityNotificationEvent", record.Topic)
+	assert.Equal(t, 10, record.Value.Quantity)
+}
+
+func TestHttpProducer(t *testing.T) {
+	var topic string
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		topic = r.Header.Get(producer.TopicHeader)
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	httpProducer := producer.NewHttpProducer(server.URL, time.Second)
+	assert.NoError(t, httpProducer.Produce(events.LowProductQuantityNotificationEvent{Name: "Book A", Quantity: 10}))
+	assert.Equal(t, "LowProductQuantityNotificationEvent", topic)
+	assert.JSONEq(t, `{"Name":"Book A","Quantity":10}`, string(body))
+
+	failingServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failingServer.Close()
+
+	assert.Error(t, producer.NewHttpProducer(failingServer.URL, time.Second).ProduceMessage("topic", []byte("{}")))
+}
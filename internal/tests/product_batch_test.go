@@ -0,0 +1,141 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/WarisLi/Golang-mini-project/internal/core/models"
+	"github.com/WarisLi/Golang-mini-project/internal/core/ports"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func postProductBatch(t *testing.T, app *fiber.App, request models.ProductBatchRequest) (int, models.ProductBatchResponse) {
+	reqBody, _ := json.Marshal(request)
+	req := httptest.NewRequest("POST", "/product/batch", bytes.NewReader(reqBody))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", generateMockJWT()))
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var response models.ProductBatchResponse
+	json.NewDecoder(resp.Body).Decode(&response)
+	return resp.StatusCode, response
+}
+
+func TestAtomicProductBatch(t *testing.T) {
+	app, testMocks := setupAppTestWithMocks()
+	subscription, _ := testMocks.productStream.Subscribe(models.ProductStreamFilter{}, 0)
+
+	operations := []models.ProductBatchOperation{
+		{Op: models.ProductOperationCreate, Product: &models.ProductInput{Name: "Book C", Quantity: 300}},
+		{Op: models.ProductOperationUpdate, ID: 1, Product: &models.ProductInput{Name: "Book A", Quantity: 50}},
+		{Op: models.ProductOperationDelete, ID: 2},
+	}
+	testMocks.productRepo.On("ApplyProductOperations", []models.ProductOperation{
+		{Op: models.ProductOperationCreate, Product: models.Product{Name: "Book C", Quantity: 300}},
+		{Op: models.ProductOperationUpdate, Product: models.Product{ID: 1, Name: "Book A", Quantity: 50}},
+		{Op: models.ProductOperationDelete, Product: models.Product{ID: 2}},
+	}).Return([]models.Product{
+		{ID: 3, Name: "Book C", Quantity: 300},
+		{ID: 1, Name: "Book A", Quantity: 50},
+		{ID: 2, Name: "Book B", Quantity: 200},
+	}, nil).Once()
+
+	status, response := postProductBatch(t, app, models.ProductBatchRequest{Atomic: true, Operations: operations})
+	assert.Equal(t, fiber.StatusOK, status)
+	assert.Equal(t, 3, response.Succeeded)
+	assert.Equal(t, uint(3), response.Results[0].ID)
+
+	// One event per affected product and the low quantity notification
+	var types []string
+	for len(subscription.Events) > 0 {
+		types = append(types, (<-subscription.Events).Type)
+	}
+	assert.Equal(t, []string{"ProductCreatedEvent", "ProductUpdatedEvent", "LowProductQuantityNotificationEvent", "ProductDeletedEvent"}, types)
+
+	t.Run("Failed operation rolls back the batch", func(t *testing.T) {
+		testMocks.productRepo.On("ApplyProductOperations", []models.ProductOperation{
+			{Op: models.ProductOperationDelete, Product: models.Product{ID: 5}},
+			{Op: models.ProductOperationDelete, Product: models.Product{ID: 9999}},
+		}).Return(nil, &ports.BatchOperationError{Index: 1, Err: gorm.ErrRecordNotFound}).Once()
+
+		status, response := postProductBatch(t, app, models.ProductBatchRequest{Atomic: true, Operations: []models.ProductBatchOperation{
+			{Op: models.ProductOperationDelete, ID: 5},
+			{Op: models.ProductOperationDelete, ID: 9999},
+		}})
+		assert.Equal(t, fiber.StatusUnprocessableEntity, status)
+		assert.Equal(t, 0, response.Succeeded)
+		assert.Equal(t, "record not found", response.Results[1].Error)
+		assert.Empty(t, subscription.Events)
+	})
+
+	t.Run("Invalid operation rejects the batch", func(t *testing.T) {
+		status, response := postProductBatch(t, app, models.ProductBatchRequest{Atomic: true, Operations: []models.ProductBatchOperation{
+			{Op: models.ProductOperationDelete, ID: 5},
+			{Op: models.ProductOperationUpdate, Product: &models.ProductInput{Name: "Book A", Quantity: 1}},
+		}})
+		assert.Equal(t, fiber.StatusUnprocessableEntity, status)
+		assert.Equal(t, "id is required", response.Results[1].Error)
+	})
+
+	testMocks.productRepo.AssertExpectations(t)
+}
+
+func TestBestEffortProductBatch(t *testing.T) {
+	app, testMocks := setupAppTestWithMocks()
+
+	testMocks.productRepo.On("ApplyProductOperations", []models.ProductOperation{
+		{Op: models.ProductOperationCreate, Product: models.Product{Name: "Book C", Quantity: 300}},
+	}).Return([]models.Product{{ID: 3, Name: "Book C", Quantity: 300}}, nil).Once()
+	testMocks.productRepo.On("ApplyProductOperations", []models.ProductOperation{
+		{Op: models.ProductOperationDelete, Product: models.Product{ID: 9999}},
+	}).Return(nil, &ports.BatchOperationError{Index: 0, Err: gorm.ErrRecordNotFound}).Once()
+
+	status, response := postProductBatch(t, app, models.ProductBatchRequest{Operations: []models.ProductBatchOperation{
+		{Op: models.ProductOperationCreate, Product: &models.ProductInput{Name: "Book C", Quantity: 300}},
+		{Op: models.ProductOperationDelete, ID: 9999},
+		{Op: "rename", ID: 1},
+	}})
+	assert.Equal(t, fiber.StatusMultiStatus, status)
+	assert.Equal(t, 1, response.Succeeded)
+	assert.Equal(t, 2, response.Failed)
+	assert.True(t, response.Results[0].Success)
+	assert.Equal(t, "record not found", response.Results[1].Error)
+	assert.Equal(t, `unknown operation "rename"`, response.Results[2].Error)
+	testMocks.productRepo.AssertExpectations(t)
+}
+
+func TestProductBatchLimits(t *testing.T) {
+	app, _ := setupAppTestWithMocks()
+
+	tests := []struct {
+		description  string
+		operations   []models.ProductBatchOperation
+		expectStatus int
+	}{
+		{
+			description:  "Empty batch",
+			expectStatus: fiber.StatusBadRequest,
+		},
+		{
+			description:  "Batch too large",
+			operations:   make([]models.ProductBatchOperation, 4),
+			expectStatus: fiber.StatusRequestEntityTooLarge,
+		},
+	}
+
+	// Run tests
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			status, _ := postProductBatch(t, app, models.ProductBatchRequest{Operations: test.operations})
+			assert.Equal(t, test.expectStatus, status)
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/WarisLi/Golang-mini-project/internal/adapters/database"
+	"github.com/WarisLi/Golang-mini-project/internal/core/models"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSearchProducts(t *testing.T) {
+	app, testMocks := setupAppTestWithMocks()
+	token := generateMockJWT()
+
+	results := []models.ProductSearchResult{
+		{
+			Product:    models.Product{ID: 1, Name: "Book A", Quantity: 200, SKU: "BK-0001"},
+			Rank:       0.6,
+			Highlights: map[string]string{"name": "<mark>Book</mark> A"},
+		},
+	}
+	testMocks.productSearcher.On("SearchProducts", models.ProductSearchQuery{
+		Query:       "book",
+		PageRequest: models.PageRequest{Page: 1, PageSize: models.DefaultPageSize},
+	}).Return(results, int64(1), nil)
+	testMocks.productSearcher.On("SearchProducts", models.ProductSearchQuery{
+		Query:       "bok",
+		PageRequest: models.PageRequest{Page: 2, PageSize: 5},
+	}).Return([]models.ProductSearchResult{}, int64(1), nil)
+
+	tests := []struct {
+		description  string
+		query        string
+		expectStatus int
+		expectItems  int
+	}{
+		{
+			description:  "Valid query",
+			query:        "q=+book+",
+			expectStatus: fiber.StatusOK,
+			expectItems:  1,
+		},
+		{
+			description:  "Page",
+			query:        "q=bok&page=2&page_size=5",
+			expectStatus: fiber.StatusOK,
+		},
+		{
+			description:  "Missing query",
+			expectStatus: fiber.StatusBadRequest,
+		},
+		{
+			description:  "Query too long",
+			query:        "q=" + url.QueryEscape(strings.Repeat("book ", 50)),
+			expectStatus: fiber.StatusBadRequest,
+		},
+	}
+
+	// Run tests
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/product/search?"+test.query, nil)
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+			resp, _ := app.Test(req)
+
+			assert.Equal(t, test.expectStatus, resp.StatusCode)
+			if test.expectStatus == fiber.StatusOK {
+				var page models.Page[models.ProductSearchResult]
+				assert.NoError(t, json.NewDecoder(resp.Body).Decode(&page))
+				assert.Equal(t, int64(1), page.Total)
+				assert.Len(t, page.Items, test.expectItems)
+			}
+		})
+	}
+	testMocks.productSearcher.AssertExpectations(t)
+}
+
+func TestPostgresProductSearch(t *testing.T) {
+	repos := postgresRepositories(t)
+	save := func(product models.Product) models.Product {
+		id, err := repos.Product.Save(product)
+		require.NoError(t, err)
+		product.ID = id
+		return product
+	}
+	book := save(models.Product{Name: "Gopher Book", Quantity: 1, SKU: "BK-1", Description: "Programming in Go with gophers"})
+	mug := save(models.Product{Name: "Gopher <b>Mug</b>", Quantity: 1, SKU: "MG-1", Description: "Ceramic & glazed"})
+	table := save(models.Product{Name: "Coffee Table", Quantity: 1, SKU: "TB-1", Description: "Oak"})
+	search := func(query string, page models.PageRequest) ([]models.ProductSearchResult, int64) {
+		results, total, err := repos.ProductSearcher.SearchProducts(models.ProductSearchQuery{Query: query, PageRequest: page})
+		require.NoError(t, err)
+		return results, total
+	}
+	firstPage := models.PageRequest{Page: 1, PageSize: 10}
+
+	t.Run("Prefixes ranked by matches", func(t *testing.T) {
+		results, total := search("goph", firstPage)
+		assert.Equal(t, int64(2), total)
+		require.Len(t, results, 2)
+		assert.Equal(t, book.ID, results[0].Product.ID)
+		assert.Equal(t, mug.ID, results[1].Product.ID)
+		assert.Greater(t, results[0].Rank, results[1].Rank)
+		assert.False(t, results[0].Fuzzy)
+		assert.Equal(t, "<mark>Gopher</mark> Book", results[0].Highlights["name"])
+		assert.Contains(t, results[0].Highlights["description"], "<mark>gophers</mark>")
+		assert.NotContains(t, results[0].Highlights, "sku")
+
+		// The text of the products is escaped around the marks
+		assert.Contains(t, results[1].Highlights["name"], "<mark>Gopher</mark>")
+		assert.NotContains(t, results[1].Highlights["name"], "<b>")
+	})
+
+	t.Run("Every term", func(t *testing.T) {
+		results, total := search("mug gopher", firstPage)
+		assert.Equal(t, int64(1), total)
+		require.Len(t, results, 1)
+		assert.Equal(t, mug.ID, results[0].Product.ID)
+	})
+
+	t.Run("SKU", func(t *testing.T) {
+		results, total := search("tb-1", firstPage)
+		assert.Equal(t, int64(1), total)
+		require.Len(t, results, 1)
+		assert.Equal(t, table.ID, results[0].Product.ID)
+	})
+
+	t.Run("Second page", func(t *testing.T) {
+		results, total := search("goph", models.PageRequest{Page: 2, PageSize: 1})
+		assert.Equal(t, int64(2), total)
+		require.Len(t, results, 1)
+		assert.Equal(t, mug.ID, results[0].Product.ID)
+	})
+
+	t.Run("Typo falls back to trigrams", func(t *testing.T) {
+		results, total := search("cofee", firstPage)
+		assert.Equal(t, int64(1), total)
+		require.Len(t, results, 1)
+		assert.Equal(t, table.ID, results[0].Product.ID)
+		assert.True(t, results[0].Fuzzy)
+		assert.Empty(t, results[0].Highlights)
+	})
+
+	t.Run("No terms", func(t *testing.T) {
+		results, total := search("!!!", firstPage)
+		assert.Zero(t, total)
+		assert.Empty(t, results)
+	})
+}
+
+func TestMarkHighlight(t *testing.T) {
+	tests := []struct {
+		description string
+		highlight   string
+		expect      string
+	}{
+		{description: "Marks", highlight: "{{mark}}Gopher{{/mark}} Book", expect: "<mark>Gopher</mark> Book"},
+		{description: "HTML", highlight: `{{mark}}Gopher{{/mark}} <script>alert("x")</script>`, expect: "<mark>Gopher</mark> &lt;script&gt;alert(&#34;x&#34;)&lt;/script&gt;"},
+		{description: "Entities", highlight: "Salt & {{mark}}Pepper{{/mark}}", expect: "Salt &amp; <mark>Pepper</mark>"},
+		{description: "Marked HTML", highlight: "{{mark}}<b>{{/mark}}", expect: "<mark>&lt;b&gt;</mark>"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			assert.Equal(t, test.expect, database.MarkHighlight(test.highlight))
+		})
+	}
+}
@@ -0,0 +1,255 @@
+package tests
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/WarisLi/Golang-mini-project/internal/adapters/http/middleware"
+	"github.com/WarisLi/Golang-mini-project/internal/core/models"
+	"github.com/WarisLi/Golang-mini-project/internal/core/ports"
+	events "github.com/WarisLi/Golang-shared-events"
+	"github.com/fasthttp/websocket"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProductStreamService(t *testing.T) {
+	streamService := ports.NewProductStreamService(ports.ProductStreamOptions{HistorySize: 3, BufferSize: 10})
+
+	books, _ := streamService.Subscribe(models.ProductStreamFilter{Categories: []string{"Books"}}, 0)
+	product, _ := streamService.Subscribe(models.ProductStreamFilter{ProductIDs: []uint{2}}, 0)
+
+	assert.NoError(t, streamService.Produce(models.ProductCreatedEvent{ID: 1, Name: "Book A", Quantity: 200, Category: "Books"}))
+	assert.NoError(t, streamService.Produce(models.ProductCreatedEvent{ID: 2, Name: "Pen", Quantity: 200, Category: "Stationery"}))
+	assert.NoError(t, streamService.Produce(events.LowProductQuantityNotificationEvent{Name: "Book A", Quantity: 10}))
+	assert.NoError(t, streamService.Produce(models.ProductDeletedEvent{ID: 2}))
+	assert.NoError(t, streamService.Produce(events.NewOrderNotificationEvent{OrderId: 1}))
+
+	assert.Len(t, books.Events, 2)
+	event := <-books.Events
+	assert.Equal(t, "ProductCreatedEvent", event.Type)
+	assert.Equal(t, uint(1), event.ProductID)
+	event = <-books.Events
+	assert.Equal(t, "LowProductQuantityNotificationEvent", event.Type)
+	assert.Equal(t, uint(1), event.ProductID)
+	assert.Equal(t, "Books", event.Category)
+
+	assert.Len(t, product.Events, 2)
+	<-product.Events
+	event = <-product.Events
+	assert.Equal(t, "ProductDeletedEvent", event.Type)
+	assert.Equal(t, "Stationery", event.Category)
+
+	t.Run("Resume from the last event ID", func(t *testing.T) {
+		_, replay := streamService.Subscribe(models.ProductStreamFilter{}, 2)
+		assert.Len(t, replay, 2)
+		assert.Equal(t, uint64(3), replay[0].ID)
+		assert.Equal(t, uint64(4), replay[1].ID)
+
+		_, replay = streamService.Subscribe(models.ProductStreamFilter{}, 0)
+		assert.Empty(t, replay)
+
+		// Only the last HistorySize events are kept
+		_, replay = streamService.Subscribe(models.ProductStreamFilter{}, 1)
+		assert.Len(t, replay, 3)
+		assert.Equal(t, uint64(2), replay[0].ID)
+
+		// An ID from before a restart replays the whole history
+		_, replay = streamService.Subscribe(models.ProductStreamFilter{}, 100)
+		assert.Len(t, replay, 3)
+	})
+
+	t.Run("Lagging client is disconnected", func(t *testing.T) {
+		streamService := ports.NewProductStreamService(ports.ProductStreamOptions{HistorySize: 10, BufferSize: 1})
+		subscription, _ := streamService.Subscribe(models.ProductStreamFilter{}, 0)
+
+		assert.NoError(t, streamService.Produce(models.ProductDeletedEvent{ID: 1}))
+		assert.NoError(t, streamService.Produce(models.ProductDeletedEvent{ID: 2}))
+
+		event, ok := <-subscription.Events
+		assert.True(t, ok)
+		assert.Equal(t, uint64(1), event.ID)
+		_, ok = <-subscription.Events
+		assert.False(t, ok)
+		streamService.Unsubscribe(subscription)
+	})
+}
+
+// listenAppTest serves app on a random local port for the streaming tests.
+func listenAppTest(t *testing.T, app *fiber.App) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go app.Listener(ln)
+	// Streams only notice a closed client on their next heartbeat, so their connections are not waited for
+	t.Cleanup(func() { app.ShutdownWithTimeout(100 * time.Millisecond) })
+
+	return ln.Addr().String()
+}
+
+func TestStreamProductsSSE(t *testing.T) {
+	app, testMocks := setupAppTestWithMocks()
+	token := generateMockJWT()
+	addr := listenAppTest(t, app)
+
+	testMocks.productRepo.On("Save", mock.Anything).Return(uint(1), nil)
+
+	resp, err := http.Get(fmt.Sprintf("http://%s/stream/product?category=Books&access_token=%s", addr, token))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer resp.Body.Close()
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	reader := bufio.NewReader(resp.Body)
+	// The retry line is sent once the client is subscribed
+	line, err := reader.ReadString('\n')
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(line, "retry:"))
+
+	for _, product := range []models.ProductInput{
+		{Name: "Pen", Quantity: 200, Category: "Stationery"},
+		{Name: "Book A", Quantity: 200, Category: "Books"},
+	} {
+		reqBody, _ := json.Marshal(product)
+		req := httptest.NewRequest("POST", "/product", bytes.NewReader(reqBody))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		resp, _ := app.Test(req)
+		assert.Equal(t, fiber.StatusCreated, resp.StatusCode)
+	}
+
+	var lines []string
+	for len(lines) < 3 {
+		line, err := reader.ReadString('\n')
+		if !assert.NoError(t, err) {
+			return
+		}
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	assert.Equal(t, "id: 2", lines[0])
+	assert.Equal(t, "event: ProductCreatedEvent", lines[1])
+
+	var event models.ProductStreamEvent
+	assert.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(lines[2], "data: ")), &event))
+	assert.Equal(t, "Books", event.Category)
+	assert.JSONEq(t, `{"id":1,"name":"Book A","quantity":200,"category":"Books"}`, string(event.Data))
+}
+
+func TestStreamProductsWebSocket(t *testing.T) {
+	app, testMocks := setupAppTestWithMocks()
+	token := generateMockJWT()
+	addr := listenAppTest(t, app)
+
+	assert.NoError(t, testMocks.productStream.Produce(models.ProductCreatedEvent{ID: 1, Name: "Book A", Quantity: 200}))
+	assert.NoError(t, testMocks.productStream.Produce(models.ProductCreatedEvent{ID: 2, Name: "Book B", Quantity: 200}))
+
+	url := fmt.Sprintf("ws://%s/stream/product/ws?product=2&last_event_id=1&access_token=%s", addr, token)
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	var event models.ProductStreamEvent
+	assert.NoError(t, conn.ReadJSON(&event))
+	assert.Equal(t, uint64(2), event.ID)
+	assert.Equal(t, uint(2), event.ProductID)
+
+	assert.NoError(t, testMocks.productStream.Produce(models.ProductDeletedEvent{ID: 1}))
+	assert.NoError(t, testMocks.productStream.Produce(models.ProductDeletedEvent{ID: 2}))
+	assert.NoError(t, conn.ReadJSON(&event))
+	assert.Equal(t, uint64(4), event.ID)
+	assert.Equal(t, "ProductDeletedEvent", event.Type)
+}
+
+func TestStreamProductsAuthentication(t *testing.T) {
+	app, _ := setupAppTestWithMocks()
+
+	tests := []struct {
+		description  string
+		url          string
+		expectStatus int
+	}{
+		{
+			description:  "Invalid token",
+			url:          "/stream/product?access_token=invalid",
+			expectStatus: fiber.StatusUnauthorized,
+		},
+		{
+			description:  "Invalid product filter",
+			url:          "/stream/product?product=abc&access_token=" + generateMockJWT(),
+			expectStatus: fiber.StatusBadRequest,
+		},
+		{
+			description:  "WebSocket without upgrade",
+			url:          "/stream/product/ws?access_token=" + generateMockJWT(),
+			expectStatus: fiber.StatusUpgradeRequired,
+		},
+	}
+
+	// Run tests
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			req := httptest.NewRequest("GET", test.url, nil)
+			resp, _ := app.Test(req)
+
+			assert.Equal(t, test.expectStatus, resp.StatusCode)
+		})
+	}
+}
+
+func TestStreamClosedWithTheSession(t *testing.T) {
+	env := setupMemoryAppTest(t, memoryAppOptions{})
+	addr := listenAppTest(t, env.app)
+
+	t.Run("SSE of a disabled user", func(t *testing.T) {
+		client := http.Client{Timeout: 5 * time.Second}
+		resp, err := client.Get(fmt.Sprintf("http://%s/stream/product?access_token=%s", addr, login(t, env.app, "alice")))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, fiber.StatusOK, resp.StatusCode)
+		reader := bufio.NewReader(resp.Body)
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		require.True(t, strings.HasPrefix(line, "retry:"))
+
+		require.NoError(t, env.userAdminService.SetUserDisabled("admin", "alice", true))
+		_, err = io.ReadAll(reader)
+		assert.NoError(t, err, "stream ended by the server")
+	})
+
+	t.Run("WebSocket of a revoked API key", func(t *testing.T) {
+		token := login(t, env.app, "admin")
+		key := createAPIKey(t, env.app, "/user/api-keys", token, models.APIKeyInput{Name: "dashboard", Scopes: []string{models.ScopeProductRead}})
+
+		conn, _, err := websocket.DefaultDialer.Dial(fmt.Sprintf("ws://%s/stream/product/ws", addr), http.Header{middleware.APIKeyHeader: {key.Key}})
+		require.NoError(t, err)
+		defer conn.Close()
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+		status, _ := sendJSON(t, env.app, "DELETE", fmt.Sprintf("/user/api-keys/%d", key.ID), token, nil)
+		require.Equal(t, fiber.StatusOK, status)
+		_, _, err = conn.ReadMessage()
+		var closeErr *websocket.CloseError
+		if assert.ErrorAs(t, err, &closeErr) {
+			assert.Equal(t, websocket.ClosePolicyViolation, closeErr.Code)
+		}
+	})
+}
@@ -5,12 +5,19 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/http/httptest"
 	"testing"
 
+	"github.com/WarisLi/Golang-mini-project/internal/adapters/producer"
+	"github.com/WarisLi/Golang-mini-project/internal/config"
 	"github.com/WarisLi/Golang-mini-project/internal/core/models"
+	"github.com/WarisLi/Golang-mini-project/internal/core/ports"
 	"github.com/gofiber/fiber/v2"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
 )
 
 func TestGetProducts(t *testing.T) {
@@ -21,27 +28,51 @@ func TestGetProducts(t *testing.T) {
 		{Name: "Mock product 1", Quantity: 200},
 		{Name: "Mock product 2", Quantity: 100},
 	}
-	mockProductRepo.On("GetAll").Return(mockProduct, nil)
+	mockProductRepo.On("GetPage", models.PageRequest{Page: 1, PageSize: models.DefaultPageSize}).Return(mockProduct, int64(2), nil)
+	mockProductRepo.On("GetPage", models.PageRequest{Page: 2, PageSize: models.MaxPageSize}).Return([]models.Product{}, int64(2), nil)
 
 	tests := []struct {
 		description  string
+		query        string
 		expectStatus int
+		expectPage   int
+		expectItems  int
 	}{
 		{
 			description:  "Valid case",
 			expectStatus: fiber.StatusOK,
+			expectPage:   1,
+			expectItems:  2,
+		},
+		{
+			description:  "Page size is capped",
+			query:        "?page=2&page_size=1000",
+			expectStatus: fiber.StatusOK,
+			expectPage:   2,
+		},
+		{
+			description:  "Invalid page",
+			query:        "?page=first",
+			expectStatus: fiber.StatusBadRequest,
 		},
 	}
 
 	// Run tests
 	for _, test := range tests {
 		t.Run(test.description, func(t *testing.T) {
-			req := httptest.NewRequest("GET", "/product", nil)
+			req := httptest.NewRequest("GET", "/product"+test.query, nil)
 			req.Header.Set("Content-Type", "application/json")
 			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
 			resp, _ := app.Test(req)
 
 			assert.Equal(t, test.expectStatus, resp.StatusCode)
+			if test.expectStatus == fiber.StatusOK {
+				var page models.Page[models.Product]
+				assert.NoError(t, json.NewDecoder(resp.Body).Decode(&page))
+				assert.Equal(t, test.expectPage, page.Page)
+				assert.Equal(t, int64(2), page.Total)
+				assert.Len(t, page.Items, test.expectItems)
+			}
 		})
 	}
 	mockProductRepo.AssertExpectations(t)
@@ -86,12 +117,45 @@ func TestGetProduct(t *testing.T) {
 	mockProductRepo.AssertExpectations(t)
 }
 
+func TestGetProductNotModified(t *testing.T) {
+	app, mockProductRepo, _ := setupAppTest()
+	token := generateMockJWT()
+
+	mockProduct := &models.Product{ID: 1000, Name: "Mock product 1", Quantity: 200}
+	mockProductRepo.On("GetOne", uint(1000)).Return(mockProduct, nil)
+
+	req := httptest.NewRequest("GET", "/product/1000", nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	resp, _ := app.Test(req)
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+	assert.Equal(t, "private, no-cache", resp.Header.Get(fiber.HeaderCacheControl))
+	etag := resp.Header.Get(fiber.HeaderETag)
+	assert.NotEmpty(t, etag)
+
+	req = httptest.NewRequest("GET", "/product/1000", nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	req.Header.Set(fiber.HeaderIfNoneMatch, etag)
+	resp, _ = app.Test(req)
+	assert.Equal(t, fiber.StatusNotModified, resp.StatusCode)
+	body, _ := io.ReadAll(resp.Body)
+	assert.Empty(t, body)
+
+	// A changed product has another tag
+	mockProduct.Quantity = 100
+	req = httptest.NewRequest("GET", "/product/1000", nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	req.Header.Set(fiber.HeaderIfNoneMatch, etag)
+	resp, _ = app.Test(req)
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+	assert.NotEqual(t, etag, resp.Header.Get(fiber.HeaderETag))
+}
+
 func TestCreateProduct(t *testing.T) {
 	app, mockProductRepo, _ := setupAppTest()
 	token := generateMockJWT()
 
 	validInput := models.Product{Name: "Book A", Quantity: 1000}
-	mockProductRepo.On("Save", validInput).Return(nil)
+	mockProductRepo.On("Save", validInput).Return(uint(1), nil)
 
 	tests := []struct {
 		description  string
@@ -136,6 +200,7 @@ func TestUpdateProducts(t *testing.T) {
 
 	validInput := models.Product{ID: 1000, Name: "Book A", Quantity: 200}
 	mockProductRepo.On("Update", validInput).Return(nil)
+	mockProductRepo.On("Update", models.Product{ID: 9999, Name: "Book A", Quantity: 200}).Return(gorm.ErrRecordNotFound)
 
 	tests := []struct {
 		description  string
@@ -149,6 +214,12 @@ func TestUpdateProducts(t *testing.T) {
 			pathParam:    1000,
 			expectStatus: fiber.StatusOK,
 		},
+		{
+			description:  "Not found",
+			requestBody:  models.ProductInput{Name: "Book A", Quantity: 200},
+			pathParam:    9999,
+			expectStatus: fiber.StatusNotFound,
+		},
 		{
 			description:  "Missing param",
 			requestBody:  models.ProductInput{Name: "Book A"},
@@ -183,7 +254,8 @@ func TestDeleteProducts(t *testing.T) {
 	token := generateMockJWT()
 
 	mockProductRepo.On("Delete", uint(1000)).Return(nil)
-	mockProductRepo.On("Delete", uint(9999)).Return(errors.New("Not found"))
+	mockProductRepo.On("Delete", uint(9999)).Return(errors.New("Delete failed"))
+	mockProductRepo.On("Delete", uint(404)).Return(gorm.ErrRecordNotFound)
 
 	tests := []struct {
 		description  string
@@ -200,6 +272,11 @@ func TestDeleteProducts(t *testing.T) {
 			pathParam:    9999,
 			expectStatus: fiber.StatusBadRequest,
 		},
+		{
+			description:  "Not found",
+			pathParam:    404,
+			expectStatus: fiber.StatusNotFound,
+		},
 	}
 
 	// Run tests
@@ -215,3 +292,209 @@ func TestDeleteProducts(t *testing.T) {
 	}
 	mockProductRepo.AssertExpectations(t)
 }
+
+func TestPatchProduct(t *testing.T) {
+	token := generateMockJWT()
+
+	tests := []struct {
+		description  string
+		contentType  string
+		patch        string
+		expectUpdate *models.Product
+		expectStatus int
+	}{
+		{
+			description:  "Merge patch sets zero values",
+			contentType:  "application/merge-patch+json",
+			patch:        `{"quantity":0,"category":null}`,
+			expectUpdate: &models.Product{ID: 1000, Name: "Book A", Quantity: 0},
+			expectStatus: fiber.StatusOK,
+		},
+		{
+			description:  "JSON patch",
+			contentType:  "application/json-patch+json",
+			patch:        `[{"op":"test","path":"/quantity","value":200},{"op":"replace","path":"/name","value":"Book B"}]`,
+			expectUpdate: &models.Product{ID: 1000, Name: "Book B", Quantity: 200, Category: "Books"},
+			expectStatus: fiber.StatusOK,
+		},
+		{
+			description:  "JSON patch test failed",
+			contentType:  "application/json-patch+json",
+			patch:        `[{"op":"test","path":"/quantity","value":1},{"op":"replace","path":"/quantity","value":0}]`,
+			expectStatus: fiber.StatusConflict,
+		},
+		{
+			description:  "Invalid JSON patch",
+			contentType:  "application/json-patch+json",
+			patch:        `{"quantity":0}`,
+			expectStatus: fiber.StatusBadRequest,
+		},
+		{
+			description:  "Removed required field",
+			contentType:  "application/merge-patch+json",
+			patch:        `{"name":null}`,
+			expectStatus: fiber.StatusUnprocessableEntity,
+		},
+		{
+			description:  "Negative quantity",
+			contentType:  "application/json-patch+json",
+			patch:        `[{"op":"replace","path":"/quantity","value":-1}]`,
+			expectStatus: fiber.StatusUnprocessableEntity,
+		},
+		{
+			description:  "Unknown field",
+			contentType:  "application/merge-patch+json",
+			patch:        `{"id":5}`,
+			expectStatus: fiber.StatusUnprocessableEntity,
+		},
+		{
+			description:  "Unsupported content type",
+			contentType:  "text/plain",
+			patch:        `{"quantity":0}`,
+			expectStatus: fiber.StatusUnsupportedMediaType,
+		},
+	}
+
+	// Run tests
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			app, mockProductRepo, _ := setupAppTest()
+			mockProductRepo.On("GetOne", uint(1000)).Return(&models.Product{ID: 1000, Name: "Book A", Quantity: 200, Category: "Books"}, nil).Maybe()
+			if test.expectUpdate != nil {
+				mockProductRepo.On("Update", *test.expectUpdate).Return(nil)
+			}
+
+			req := httptest.NewRequest("PATCH", "/product/1000", bytes.NewReader([]byte(test.patch)))
+			req.Header.Set("Content-Type", test.contentType)
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+			resp, _ := app.Test(req)
+
+			assert.Equal(t, test.expectStatus, resp.StatusCode)
+			mockProductRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestPatchProductNotFound(t *testing.T) {
+	app, mockProductRepo, _ := setupAppTest()
+	token := generateMockJWT()
+
+	mockProductRepo.On("GetOne", uint(999999)).Return(nil, gorm.ErrRecordNotFound)
+
+	req := httptest.NewRequest("PATCH", "/product/999999", bytes.NewReader([]byte(`{"quantity":0}`)))
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	resp, _ := app.Test(req)
+
+	assert.Equal(t, fiber.StatusNotFound, resp.StatusCode)
+}
+
+func TestPatchProductOutbox(t *testing.T) {
+	token := generateMockJWT()
+	isUpdatedEvent := mock.MatchedBy(func(event models.OutboxEvent) bool {
+		return event.Topic == "ProductUpdatedEvent" && event.Attempts == 0
+	})
+
+	tests := []struct {
+		description string
+		updateErr   error
+		expectSaved bool
+	}{
+		{description: "Saved with the update and published", expectSaved: true},
+		{description: "Not saved when the update fails", updateErr: errors.New("database down")},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			app, mocks := setupAppTestWithMocks()
+			mocks.productRepo.On("GetOne", uint(1000)).Return(&models.Product{ID: 1000, Name: "Book A", Quantity: 200}, nil)
+			mocks.productRepo.On("Update", mock.Anything).Return(test.updateErr)
+
+			req := httptest.NewRequest("PATCH", "/product/1000", bytes.NewReader([]byte(`{"name":"Book B"}`)))
+			req.Header.Set("Content-Type", "application/merge-patch+json")
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+			_, err := app.Test(req)
+			assert.NoError(t, err)
+
+			if test.expectSaved {
+				mocks.outboxRepo.AssertCalled(t, "SaveEvent", isUpdatedEvent)
+				mocks.outboxRepo.AssertCalled(t, "MarkEventPublished", uint(1))
+			} else {
+				mocks.outboxRepo.AssertNotCalled(t, "SaveEvent", isUpdatedEvent)
+			}
+		})
+	}
+}
+
+func TestProductWritesRolledBackWithTheirEvents(t *testing.T) {
+	repos := config.NewMemoryRepositories()
+	id, err := repos.Product.Save(models.Product{Name: "Book A", Quantity: 10})
+	require.NoError(t, err)
+	productService := ports.NewProductService(repos.Product, failingOutboxUnitOfWork{repos.UnitOfWork}, producer.NewChannelBus(10),
+		repos.Outbox, ports.ProductServiceOptions{})
+	create := models.ProductBatchOperation{Op: models.ProductOperationCreate, Product: &models.ProductInput{Name: "Book B", Quantity: 1}}
+
+	tests := []struct {
+		description string
+		write       func() error
+	}{
+		{description: "Create", write: func() error {
+			return productService.CreateProduct(models.ProductInput{Name: "Book B", Quantity: 1})
+		}},
+		{description: "Update", write: func() error {
+			return productService.UpdateProduct(id, models.ProductInput{Name: "Book B", Quantity: 1})
+		}},
+		{description: "Delete", write: func() error {
+			return productService.DeleteProduct(id)
+		}},
+		{description: "Atomic batch", write: func() error {
+			_, err := productService.BatchProducts(models.ProductBatchRequest{Atomic: true, Operations: []models.ProductBatchOperation{create}})
+			return err
+		}},
+		{description: "Best effort batch", write: func() error {
+			_, err := productService.BatchProducts(models.ProductBatchRequest{Operations: []models.ProductBatchOperation{create}})
+			return err
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			assert.Error(t, test.write())
+
+			products, err := repos.Product.GetAll()
+			require.NoError(t, err)
+			require.Len(t, products, 1)
+			assert.Equal(t, "Book A", products[0].Name)
+			assert.Equal(t, 10, products[0].Quantity)
+		})
+	}
+}
+
+func TestImportProducts(t *testing.T) {
+	repos := config.NewMemoryRepositories()
+	eventBus := producer.NewChannelBus(10)
+	createdEvents := eventBus.Subscribe(producer.TopicOf(models.ProductCreatedEvent{}))
+	productService := ports.NewProductService(repos.Product, repos.UnitOfWork, eventBus, repos.Outbox, ports.ProductServiceOptions{})
+
+	// A product out of stock is imported, an invalid product fails the whole import
+	var operationErr *ports.BatchOperationError
+	err := productService.ImportProducts([]models.ProductFields{{Name: "Book A", Quantity: 1}, {Name: "", Quantity: 1}})
+	require.ErrorAs(t, err, &operationErr)
+	assert.Equal(t, 1, operationErr.Index)
+	assert.ErrorIs(t, err, ports.ErrInvalidProduct)
+	products, err := repos.Product.GetAll()
+	require.NoError(t, err)
+	assert.Empty(t, products)
+
+	require.NoError(t, productService.ImportProducts([]models.ProductFields{
+		{Name: "Book A", Quantity: 0, Category: "Books", SKU: "BK-0001", Description: "Hardcover"},
+		{Name: "Book B", Quantity: 5},
+	}))
+	products, err = repos.Product.GetAll()
+	require.NoError(t, err)
+	require.Len(t, products, 2)
+	assert.Equal(t, 0, products[0].Quantity)
+	assert.Equal(t, "BK-0001", products[0].SKU)
+	assert.Equal(t, "Hardcover", products[0].Description)
+	assert.Len(t, createdEvents, 2)
+}
@@ -0,0 +1,301 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/WarisLi/Golang-mini-project/internal/adapters/cache"
+	"github.com/WarisLi/Golang-mini-project/internal/adapters/http"
+	"github.com/WarisLi/Golang-mini-project/internal/adapters/http/middleware"
+	"github.com/WarisLi/Golang-mini-project/internal/adapters/memory"
+	"github.com/WarisLi/Golang-mini-project/internal/adapters/notifier"
+	"github.com/WarisLi/Golang-mini-project/internal/core/models"
+	"github.com/WarisLi/Golang-mini-project/internal/core/ports"
+	"github.com/gofiber/fiber/v2"
+	"github.com/joho/godotenv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestRateLimiter(t *testing.T) {
+	server := newFakeRedis(t, "")
+	redisCache, err := cache.NewRedisCache(fmt.Sprintf("redis://%s", server.listener.Addr()), time.Second)
+	require.NoError(t, err)
+	defer redisCache.Close()
+
+	limiters := []struct {
+		description string
+		limiter     ports.RateLimiter
+	}{
+		{description: "Memory", limiter: cache.NewMemoryRateLimiter()},
+		{description: "Redis", limiter: cache.NewRedisRateLimiter(redisCache)},
+	}
+
+	for _, test := range limiters {
+		t.Run(test.description, func(t *testing.T) {
+			window := 200 * time.Millisecond
+
+			for remaining := 1; remaining >= 0; remaining-- {
+				limit, err := test.limiter.Allow("client-1", 2, window)
+				require.NoError(t, err)
+				assert.True(t, limit.Allowed)
+				assert.Equal(t, remaining, limit.Remaining)
+			}
+
+			limit, err := test.limiter.Allow("client-1", 2, window)
+			require.NoError(t, err)
+			assert.False(t, limit.Allowed)
+			assert.Equal(t, 0, limit.Remaining)
+			assert.Greater(t, limit.RetryAfter, time.Duration(0))
+			assert.LessOrEqual(t, limit.RetryAfter, window)
+
+			// Other keys have their own window
+			limit, err = test.limiter.Allow("client-2", 2, window)
+			require.NoError(t, err)
+			assert.True(t, limit.Allowed)
+
+			time.Sleep(window + 50*time.Millisecond)
+			limit, err = test.limiter.Allow("client-1", 2, window)
+			require.NoError(t, err)
+			assert.True(t, limit.Allowed)
+			assert.Equal(t, 1, limit.Remaining)
+		})
+	}
+}
+
+func TestLoginRateLimit(t *testing.T) {
+	app := fiber.New()
+	app.Post("/user/login", middleware.RateLimit(cache.NewMemoryRateLimiter(),
+		middleware.RateLimitRule{Name: "login-ip", Limit: 4, Window: time.Minute, Key: middleware.ClientIP},
+		middleware.RateLimitRule{Name: "login-username", Limit: 2, Window: time.Minute, Key: middleware.LoginUsername},
+	), func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusOK)
+	})
+
+	tests := []struct {
+		description      string
+		username         string
+		expectStatus     int
+		expectRetryAfter string
+	}{
+		{description: "First login of user_1", username: "user_1", expectStatus: fiber.StatusOK},
+		{description: "Second login of user_1", username: "user_1", expectStatus: fiber.StatusOK},
+		{description: "Username limit", username: "user_1", expectStatus: fiber.StatusTooManyRequests, expectRetryAfter: "60"},
+		{description: "Other username", username: "user_2", expectStatus: fiber.StatusOK},
+		{description: "IP limit", username: "user_3", expectStatus: fiber.StatusTooManyRequests, expectRetryAfter: "60"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			reqBody, _ := json.Marshal(models.UsernamePassword{Username: test.username, Password: "Pass@12345"})
+			req := httptest.NewRequest("POST", "/user/login", bytes.NewReader(reqBody))
+			req.Header.Set("Content-Type", "application/json")
+			resp, _ := app.Test(req)
+
+			assert.Equal(t, test.expectStatus, resp.StatusCode)
+			assert.Equal(t, test.expectRetryAfter, resp.Header.Get(fiber.HeaderRetryAfter))
+		})
+	}
+}
+
+func TestTwoFactorLoginRateLimit(t *testing.T) {
+	app := fiber.New()
+	app.Post("/user/login/2fa", middleware.RateLimit(cache.NewMemoryRateLimiter(),
+		middleware.RateLimitRule{Name: "login-username", Limit: 2, Window: time.Minute, Key: middleware.LoginUsername},
+	), func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusOK)
+	})
+
+	// Each login of the same user brings a new challenge token
+	challengeToken := func(username string) string {
+		token, err := testTokenService.SignChallenge(&models.User{Username: username}, time.Minute)
+		require.NoError(t, err)
+		return token
+	}
+
+	tests := []struct {
+		description  string
+		username     string
+		expectStatus int
+	}{
+		{description: "First code of user_1", username: "user_1", expectStatus: fiber.StatusOK},
+		{description: "Second code of user_1", username: "user_1", expectStatus: fiber.StatusOK},
+		{description: "Username limit", username: "user_1", expectStatus: fiber.StatusTooManyRequests},
+		{description: "Other username", username: "user_2", expectStatus: fiber.StatusOK},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			reqBody, _ := json.Marshal(models.TwoFactorLogin{ChallengeToken: challengeToken(test.username), Code: "000000"})
+			req := httptest.NewRequest("POST", "/user/login/2fa", bytes.NewReader(reqBody))
+			req.Header.Set("Content-Type", "application/json")
+			resp, _ := app.Test(req)
+
+			assert.Equal(t, test.expectStatus, resp.StatusCode)
+		})
+	}
+}
+
+func TestAPIRateLimit(t *testing.T) {
+	app := fiber.New()
+	app.Get("/product", middleware.RateLimit(cache.NewMemoryRateLimiter(),
+		middleware.RateLimitRule{Name: "api", Limit: 2, Window: time.Minute, Key: middleware.AccessToken},
+	), func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusOK)
+	})
+
+	tests := []struct {
+		description  string
+		url          string
+		token        string
+		expectStatus int
+	}{
+		{description: "Header token", url: "/product", token: "token-1", expectStatus: fiber.StatusOK},
+		{description: "Query token", url: "/product?access_token=token-1", expectStatus: fiber.StatusOK},
+		{description: "Token limit", url: "/product", token: "token-1", expectStatus: fiber.StatusTooManyRequests},
+		{description: "Other token", url: "/product", token: "token-2", expectStatus: fiber.StatusOK},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			req := httptest.NewRequest("GET", test.url, nil)
+			if test.token != "" {
+				req.Header.Set("Authorization", "Bearer "+test.token)
+			}
+			resp, _ := app.Test(req)
+
+			assert.Equal(t, test.expectStatus, resp.StatusCode)
+		})
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	require.NoError(t, godotenv.Load("../../.env"))
+
+	repo := memory.NewMemoryRepository()
+	userRepo := memory.NewMemoryUserRepository(repo)
+	userService := ports.NewUserService(userRepo, memory.NewMemoryPasswordResetRepository(repo), notifier.NewLogNotifier(), testTokenService, ports.UserServiceOptions{MaxFailedLogins: 3, LockoutDuration: time.Hour})
+	require.NoError(t, userService.RegisterUser(models.UsernamePassword{Username: "user_1", Password: "Pass@12345"}))
+
+	app := fiber.New()
+	app.Post("/user/login", http.NewHttpUserHandler(userService, testCookieOptions).LoginUser)
+
+	tests := []struct {
+		description      string
+		password         string
+		expectStatus     int
+		expectRetryAfter string
+	}{
+		{description: "First failure", password: "WrongPass", expectStatus: fiber.StatusUnauthorized},
+		{description: "Second failure", password: "WrongPass", expectStatus: fiber.StatusUnauthorized},
+		{description: "Failure locking the user", password: "WrongPass", expectStatus: fiber.StatusUnauthorized},
+		{description: "Valid password while locked", password: "Pass@12345", expectStatus: fiber.StatusTooManyRequests, expectRetryAfter: "3600"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			reqBody, _ := json.Marshal(models.UsernamePassword{Username: "user_1", Password: test.password})
+			req := httptest.NewRequest("POST", "/user/login", bytes.NewReader(reqBody))
+			req.Header.Set("Content-Type", "application/json")
+			resp, _ := app.Test(req)
+
+			assert.Equal(t, test.expectStatus, resp.StatusCode)
+			assert.Equal(t, test.expectRetryAfter, resp.Header.Get(fiber.HeaderRetryAfter))
+		})
+	}
+
+	// The lockout expires
+	user, err := userRepo.GetUser("user_1")
+	require.NoError(t, err)
+	assert.Equal(t, 3, user.FailedLogins)
+	past := time.Now().Add(-time.Second)
+	user.LockedUntil = &past
+	require.NoError(t, userRepo.UpdateUser(*user))
+
+	_, err = userService.LoginUser(models.UsernamePassword{Username: "user_1", Password: "Pass@12345"})
+	require.NoError(t, err)
+	user, err = userRepo.GetUser("user_1")
+	require.NoError(t, err)
+	assert.Equal(t, 0, user.FailedLogins)
+	assert.Nil(t, user.LockedUntil)
+}
+
+func TestConcurrentLoginFailures(t *testing.T) {
+	require.NoError(t, godotenv.Load("../../.env"))
+
+	repo := memory.NewMemoryRepository()
+	userRepo := memory.NewMemoryUserRepository(repo)
+	userService := ports.NewUserService(userRepo, memory.NewMemoryPasswordResetRepository(repo), notifier.NewLogNotifier(), testTokenService, ports.UserServiceOptions{
+		MaxFailedLogins: 5,
+		LockoutDuration: time.Hour,
+		PasswordHash:    ports.PasswordHashOptions{BcryptCost: bcrypt.MinCost},
+	})
+	require.NoError(t, userService.RegisterUser(models.UsernamePassword{Username: "user_1", Password: "Pass@12345"}))
+
+	// Parallel guesses all read the user before any failure is recorded
+	const guesses = 40
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	for i := 0; i < guesses; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			_, err := userService.LoginUser(models.UsernamePassword{Username: "user_1", Password: "WrongPass"})
+			assert.Error(t, err)
+		}()
+	}
+	close(start)
+	// An administrator disables the user during the guesses
+	user, err := userRepo.GetUser("user_1")
+	require.NoError(t, err)
+	user.Disabled = true
+	require.NoError(t, userRepo.UpdateUser(*user))
+	wg.Wait()
+
+	user, err = userRepo.GetUser("user_1")
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, user.FailedLogins, 5)
+	assert.NotNil(t, user.LockedUntil)
+	assert.True(t, user.Disabled, "the failed logins do not write the other columns")
+}
+
+func TestLoginFailureDelay(t *testing.T) {
+	require.NoError(t, godotenv.Load("../../.env"))
+
+	repo := memory.NewMemoryRepository()
+	userRepo := memory.NewMemoryUserRepository(repo)
+	userService := ports.NewUserService(userRepo, memory.NewMemoryPasswordResetRepository(repo), notifier.NewLogNotifier(), testTokenService, ports.UserServiceOptions{
+		FailedLoginDelay:    time.Second,
+		MaxFailedLoginDelay: 4 * time.Second,
+	})
+	require.NoError(t, userService.RegisterUser(models.UsernamePassword{Username: "user_1", Password: "Pass@12345"}))
+	wrongLogin := models.UsernamePassword{Username: "user_1", Password: "WrongPass"}
+
+	for _, expectDelay := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 4 * time.Second} {
+		failedAt := time.Now()
+		_, err := userService.LoginUser(wrongLogin)
+		require.Error(t, err)
+
+		user, err := userRepo.GetUser("user_1")
+		require.NoError(t, err)
+		require.NotNil(t, user.LockedUntil)
+		assert.WithinDuration(t, failedAt.Add(expectDelay), *user.LockedUntil, 500*time.Millisecond)
+
+		// Refused without checking the password until the delay has passed
+		_, err = userService.LoginUser(wrongLogin)
+		var lockedErr *ports.UserLockedError
+		require.ErrorAs(t, err, &lockedErr)
+		assert.InDelta(t, expectDelay, lockedErr.RetryAfter, float64(500*time.Millisecond))
+
+		past := time.Now().Add(-time.Second)
+		user.LockedUntil = &past
+		require.NoError(t, userRepo.UpdateUser(*user))
+	}
+}
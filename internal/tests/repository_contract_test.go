@@ -0,0 +1,74 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/WarisLi/Golang-mini-project/internal/adapters/cache"
+	"github.com/WarisLi/Golang-mini-project/internal/config"
+	"github.com/WarisLi/Golang-mini-project/internal/tests/contract"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryRepositoryContract(t *testing.T) {
+	contract.RunRepositoryContract(t, func(t *testing.T) *config.Repositories {
+		return config.NewMemoryRepositories()
+	})
+}
+
+func TestCachedRepositoryContract(t *testing.T) {
+	contract.RunRepositoryContract(t, func(t *testing.T) *config.Repositories {
+		repos := config.NewMemoryRepositories()
+		productCache := cache.NewProductCache(cache.NewLRUCache(100), cache.ProductCacheOptions{TTL: time.Minute})
+		repos.Product = productCache.ProductRepository(repos.Product)
+		repos.Stock = productCache.StockRepository(repos.Stock)
+		repos.UnitOfWork = productCache.UnitOfWork(repos.UnitOfWork)
+		return repos
+	})
+}
+
+func TestSQLiteRepositoryContract(t *testing.T) {
+	contract.RunRepositoryContract(t, func(t *testing.T) *config.Repositories {
+		db, err := config.ConnectSQLite(filepath.Join(t.TempDir(), "test.db"))
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			sqlDB, _ := db.DB()
+			sqlDB.Close()
+		})
+
+		repos := config.NewGormRepositories(db)
+		require.NoError(t, repos.Migrate())
+		return repos
+	})
+}
+
+// TestPostgresRepositoryContract runs against the Postgres database of TEST_POSTGRES_DSN.
+func TestPostgresRepositoryContract(t *testing.T) {
+	repos := postgresRepositories(t)
+	contract.RunRepositoryContract(t, func(t *testing.T) *config.Repositories {
+		repos.Reset()
+		return repos
+	})
+}
+
+// postgresRepositories returns the repositories of the Postgres database of TEST_POSTGRES_DSN,
+// e.g. the one of docker-compose or the service of the CI workflow. All its data is deleted.
+// The test fails in CI without TEST_POSTGRES_DSN, so that the Postgres tests cannot be skipped there.
+func postgresRepositories(t *testing.T) *config.Repositories {
+	dsn := os.Getenv("TEST_POSTGRES_DSN")
+	if dsn == "" {
+		if os.Getenv("CI") != "" {
+			t.Fatal("TEST_POSTGRES_DSN is required in CI")
+		}
+		t.Skip("TEST_POSTGRES_DSN is not set")
+	}
+
+	db, err := config.OpenPostgres(dsn)
+	require.NoError(t, err)
+	repos := config.NewGormRepositories(db)
+	require.NoError(t, repos.Migrate())
+	repos.Reset()
+	return repos
+}
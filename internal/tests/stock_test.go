@@ -0,0 +1,178 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/WarisLi/Golang-mini-project/internal/adapters/consumer"
+	"github.com/WarisLi/Golang-mini-project/internal/adapters/producer"
+	"github.com/WarisLi/Golang-mini-project/internal/config"
+	"github.com/WarisLi/Golang-mini-project/internal/core/models"
+	"github.com/WarisLi/Golang-mini-project/internal/core/ports"
+	"github.com/WarisLi/Golang-mini-project/internal/tests/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/Shopify/sarama.v1"
+	"gorm.io/gorm"
+)
+
+// stockUnitOfWork returns the unit of work of the stock service on the mocks, the
+// product events are saved in the mocked outbox and published.
+func stockUnitOfWork(stockRepo *mocks.MockStockRepository, outboxRepo *mocks.MockOutboxRepository) ports.UnitOfWork {
+	outboxRepo.On("SaveEvent", mock.MatchedBy(func(event models.OutboxEvent) bool {
+		return event.Topic != "OrderPlacedEvent"
+	})).Return(uint(1), nil).Maybe()
+	outboxRepo.On("MarkEventPublished", mock.Anything).Return(nil).Maybe()
+	return &mocks.MockUnitOfWork{Repositories: ports.TransactionRepositories{Stock: stockRepo, Outbox: outboxRepo}}
+}
+
+func TestHandleOrderPlaced(t *testing.T) {
+	mockStockRepo := new(mocks.MockStockRepository)
+	mockOutboxRepo := new(mocks.MockOutboxRepository)
+	bus := producer.NewChannelBus(10)
+	lowQuantityEvents := bus.Subscribe("LowProductQuantityNotificationEvent")
+	stockService := ports.NewStockService(stockUnitOfWork(mockStockRepo, mockOutboxRepo), bus, mockOutboxRepo)
+
+	movements := []models.StockMovement{{ProductID: 1, Delta: -5}, {ProductID: 2, Delta: -20}}
+	mockStockRepo.On("ApplyStockMovements", "event-1", movements).Return([]models.Product{
+		{ID: 1, Name: "Book A", Quantity: 995},
+		{ID: 2, Name: "Book B", Quantity: 80},
+	}, nil)
+	mockStockRepo.On("ApplyStockMovements", "event-2", mock.Anything).Return(nil, ports.ErrEventAlreadyProcessed)
+
+	order := models.OrderPlacedEvent{
+		EventID: "event-1",
+		OrderID: 10,
+		Items:   []models.OrderItem{{ProductID: 1, Quantity: 5}, {ProductID: 2, Quantity: 20}},
+	}
+	assert.NoError(t, stockService.HandleOrderPlaced(order))
+	assert.Len(t, lowQuantityEvents, 1)
+
+	order.EventID = "event-2"
+	assert.NoError(t, stockService.HandleOrderPlaced(order))
+
+	order.EventID = "event-3"
+	order.Items = []models.OrderItem{{ProductID: 1, Quantity: 0}}
+	assert.ErrorIs(t, stockService.HandleOrderPlaced(order), ports.ErrInvalidEvent)
+
+	mockStockRepo.AssertExpectations(t)
+}
+
+func TestHandleOrderCancelled(t *testing.T) {
+	mockStockRepo := new(mocks.MockStockRepository)
+	mockOutboxRepo := new(mocks.MockOutboxRepository)
+	stockService := ports.NewStockService(stockUnitOfWork(mockStockRepo, mockOutboxRepo), producer.NewChannelBus(10), mockOutboxRepo)
+
+	movements := []models.StockMovement{{ProductID: 1, Delta: 5}}
+	mockStockRepo.On("ApplyStockMovements", "event-1", movements).Return([]models.Product{{ID: 1, Name: "Book A", Quantity: 1000}}, nil)
+
+	order := models.OrderCancelledEvent{EventID: "event-1", OrderID: 10, Items: []models.OrderItem{{ProductID: 1, Quantity: 5}}}
+	assert.NoError(t, stockService.HandleOrderCancelled(order))
+	mockStockRepo.AssertExpectations(t)
+}
+
+func TestOrderRolledBackWithItsEvents(t *testing.T) {
+	repos := config.NewMemoryRepositories()
+	id, err := repos.Product.Save(models.Product{Name: "Book A", Quantity: 10})
+	require.NoError(t, err)
+	stockService := ports.NewStockService(failingOutboxUnitOfWork{repos.UnitOfWork}, producer.NewChannelBus(10), repos.Outbox)
+
+	order := models.OrderPlacedEvent{EventID: "event-1", OrderID: 1, Items: []models.OrderItem{{ProductID: id, Quantity: 5}}}
+	assert.Error(t, stockService.HandleOrderPlaced(order))
+
+	product, err := repos.Product.GetOne(id)
+	require.NoError(t, err)
+	assert.Equal(t, 10, product.Quantity)
+
+	// The event was not recorded as processed, it is applied once the outbox is back
+	stockService = ports.NewStockService(repos.UnitOfWork, producer.NewChannelBus(10), repos.Outbox)
+	require.NoError(t, stockService.HandleOrderPlaced(order))
+	product, err = repos.Product.GetOne(id)
+	require.NoError(t, err)
+	assert.Equal(t, 5, product.Quantity)
+}
+
+// fakeConsumerGroupSession records the marked messages.
+type fakeConsumerGroupSession struct {
+	ctx    context.Context
+	marked []int64
+}
+
+func (s *fakeConsumerGroupSession) Claims() map[string][]int32 { return nil }
+func (s *fakeConsumerGroupSession) MemberID() string           { return "member" }
+func (s *fakeConsumerGroupSession) GenerationID() int32        { return 1 }
+func (s *fakeConsumerGroupSession) MarkOffset(topic string, partition int32, offset int64, metadata string) {
+}
+func (s *fakeConsumerGroupSession) ResetOffset(topic string, partition int32, offset int64, metadata string) {
+}
+func (s *fakeConsumerGroupSession) MarkMessage(msg *sarama.ConsumerMessage, metadata string) {
+	s.marked = append(s.marked, msg.Offset)
+}
+func (s *fakeConsumerGroupSession) Context() context.Context { return s.ctx }
+
+type fakeConsumerGroupClaim struct {
+	messages chan *sarama.ConsumerMessage
+}
+
+func (c *fakeConsumerGroupClaim) Topic() string                            { return "OrderPlacedEvent" }
+func (c *fakeConsumerGroupClaim) Partition() int32                         { return 0 }
+func (c *fakeConsumerGroupClaim) InitialOffset() int64                     { return 0 }
+func (c *fakeConsumerGroupClaim) HighWaterMarkOffset() int64               { return 0 }
+func (c *fakeConsumerGroupClaim) Messages() <-chan *sarama.ConsumerMessage { return c.messages }
+
+func TestOrderConsumer(t *testing.T) {
+	mockStockRepo := new(mocks.MockStockRepository)
+	mockOutboxRepo := new(mocks.MockOutboxRepository)
+	stockService := ports.NewStockService(stockUnitOfWork(mockStockRepo, mockOutboxRepo), producer.NewChannelBus(10), mockOutboxRepo)
+	orderConsumer := consumer.NewOrderConsumer(nil, stockService, mockOutboxRepo, consumer.OrderConsumerOptions{TopicPrefix: "dev."})
+
+	mockStockRepo.On("ApplyStockMovements", "event-1", []models.StockMovement{{ProductID: 1, Delta: -1}}).
+		Return([]models.Product{{ID: 1, Quantity: 500}}, nil)
+	// Message without event id falls back to its position
+	mockStockRepo.On("ApplyStockMovements", "dev.OrderPlacedEvent/0/2", []models.StockMovement{{ProductID: 1, Delta: -2}}).
+		Return([]models.Product{{ID: 1, Quantity: 498}}, nil)
+	mockStockRepo.On("ApplyStockMovements", "event-4", mock.Anything).Return(nil, gorm.ErrRecordNotFound)
+	mockOutboxRepo.On("SaveEvent", mock.MatchedBy(func(event models.OutboxEvent) bool {
+		return event.Topic == "OrderPlacedEvent" && event.Consumed
+	})).Return(uint(1), nil).Twice()
+
+	claim := &fakeConsumerGroupClaim{messages: make(chan *sarama.ConsumerMessage, 4)}
+	claim.messages <- &sarama.ConsumerMessage{Topic: "dev.OrderPlacedEvent", Offset: 1,
+		Value: []byte(`{"event_id":"event-1","order_id":1,"items":[{"product_id":1,"quantity":1}]}`)}
+	claim.messages <- &sarama.ConsumerMessage{Topic: "dev.OrderPlacedEvent", Offset: 2,
+		Value: []byte(`{"specversion":"1.0","type":"OrderPlacedEvent","data":{"order_id":2,"items":[{"product_id":1,"quantity":2}]}}`)}
+	claim.messages <- &sarama.ConsumerMessage{Topic: "dev.OrderPlacedEvent", Offset: 3, Value: []byte(`not json`)}
+	claim.messages <- &sarama.ConsumerMessage{Topic: "dev.OrderPlacedEvent", Offset: 4,
+		Value: []byte(`{"event_id":"event-4","order_id":4,"items":[{"product_id":99,"quantity":1}]}`)}
+	close(claim.messages)
+
+	session := &fakeConsumerGroupSession{ctx: context.Background()}
+	assert.NoError(t, orderConsumer.ConsumeClaim(session, claim))
+	assert.Equal(t, []int64{1, 2, 3, 4}, session.marked)
+
+	mockStockRepo.AssertExpectations(t)
+	mockOutboxRepo.AssertExpectations(t)
+}
+
+func TestOrderConsumerStopsOnTemporaryFailure(t *testing.T) {
+	mockStockRepo := new(mocks.MockStockRepository)
+	mockOutboxRepo := new(mocks.MockOutboxRepository)
+	stockService := ports.NewStockService(stockUnitOfWork(mockStockRepo, mockOutboxRepo), producer.NewChannelBus(10), mockOutboxRepo)
+	orderConsumer := consumer.NewOrderConsumer(nil, stockService, mockOutboxRepo, consumer.OrderConsumerOptions{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	mockStockRepo.On("ApplyStockMovements", "event-1", mock.Anything).
+		Return(nil, errors.New("connection refused")).
+		Run(func(args mock.Arguments) { cancel() })
+
+	claim := &fakeConsumerGroupClaim{messages: make(chan *sarama.ConsumerMessage, 1)}
+	claim.messages <- &sarama.ConsumerMessage{Topic: "OrderPlacedEvent", Offset: 1,
+		Value: []byte(`{"event_id":"event-1","order_id":1,"items":[{"product_id":1,"quantity":1}]}`)}
+	close(claim.messages)
+
+	session := &fakeConsumerGroupSession{ctx: ctx}
+	assert.NoError(t, orderConsumer.ConsumeClaim(session, claim))
+	assert.Empty(t, session.marked)
+}
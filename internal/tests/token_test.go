@@ -0,0 +1,294 @@
+package tests
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/WarisLi/Golang-mini-project/internal/adapters/memory"
+	"github.com/WarisLi/Golang-mini-project/internal/core/models"
+	"github.com/WarisLi/Golang-mini-project/internal/core/ports"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+var testTokenOptions = ports.TokenOptions{
+	Issuer:           "golang-mini-project",
+	Audience:         "golang-mini-project",
+	TTL:              time.Hour,
+	RotationInterval: 3 * time.Hour,
+	PublishLead:      time.Hour,
+	KeyCacheTTL:      time.Hour,
+	KeyEncryptionKey: testKeyEncryptionKey,
+}
+
+// legacySecret is the default JWT_SECRET of the HS256 tokens before the signing keys.
+var legacySecret = []byte("key")
+
+// jwkPublicKey returns the public key of a JWK, as a service verifying the tokens would.
+func jwkPublicKey(t *testing.T, jwks *models.JWKS, kid string) interface{} {
+	for _, jwk := range jwks.Keys {
+		if jwk.Kid != kid {
+			continue
+		}
+		assert.Equal(t, "sig", jwk.Use)
+		switch jwk.Kty {
+		case "RSA":
+			n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+			require.NoError(t, err)
+			e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+			require.NoError(t, err)
+			return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		case "OKP":
+			assert.Equal(t, "Ed25519", jwk.Crv)
+			x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+			require.NoError(t, err)
+			return ed25519.PublicKey(x)
+		}
+	}
+	require.FailNow(t, "key not in the JWKS", kid)
+	return nil
+}
+
+// newTestSigningKey returns an EdDSA signing key activated at activatesAt.
+func newTestSigningKey(t *testing.T, keyID string, activatesAt time.Time) models.SigningKey {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	require.NoError(t, err)
+	return models.SigningKey{
+		KeyID:       keyID,
+		Algorithm:   models.AlgorithmEdDSA,
+		PrivateKey:  string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		ActivatesAt: activatesAt,
+	}
+}
+
+func TestTokenSigning(t *testing.T) {
+	for _, algorithm := range []string{models.AlgorithmRS256, models.AlgorithmEdDSA} {
+		t.Run(algorithm, func(t *testing.T) {
+			options := testTokenOptions
+			options.Algorithm = algorithm
+			service := ports.NewTokenService(memory.NewMemorySigningKeyRepository(memory.NewMemoryRepository()), options)
+
+			signed, err := service.SignToken(&models.User{Username: "alice", Role: models.RoleUser, SessionVersion: 2})
+			require.NoError(t, err)
+			other, err := service.SignToken(&models.User{Username: "alice", Role: models.RoleUser, SessionVersion: 2})
+			require.NoError(t, err)
+
+			token, err := jwt.Parse(signed, service.Keyfunc)
+			require.NoError(t, err)
+			assert.Equal(t, algorithm, token.Method.Alg())
+			claims := token.Claims.(jwt.MapClaims)
+			assert.Equal(t, "golang-mini-project", claims["iss"])
+			assert.Equal(t, "golang-mini-project", claims["aud"])
+			assert.Equal(t, "alice", claims["sub"])
+			assert.Equal(t, models.RoleUser, claims["role"])
+			assert.Equal(t, float64(2), claims["ver"])
+			assert.NotEmpty(t, claims["jti"])
+			otherToken, _, err := jwt.NewParser().ParseUnverified(other, jwt.MapClaims{})
+			require.NoError(t, err)
+			assert.NotEqual(t, claims["jti"], otherToken.Claims.(jwt.MapClaims)["jti"])
+			expiresAt, err := claims.GetExpirationTime()
+			require.NoError(t, err)
+			assert.WithinDuration(t, time.Now().Add(time.Hour), expiresAt.Time, time.Minute)
+
+			// A service verifies the token with the JWKS alone
+			jwks, err := service.JWKS()
+			require.NoError(t, err)
+			require.Len(t, jwks.Keys, 1)
+			assert.Equal(t, algorithm, jwks.Keys[0].Alg)
+			kid := token.Header["kid"].(string)
+			publicKey := jwkPublicKey(t, jwks, kid)
+			_, err = jwt.Parse(signed, func(*jwt.Token) (interface{}, error) { return publicKey, nil },
+				jwt.WithValidMethods([]string{algorithm}), jwt.WithIssuer("golang-mini-project"), jwt.WithAudience("golang-mini-project"))
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestTokenVerification(t *testing.T) {
+	repo := memory.NewMemorySigningKeyRepository(memory.NewMemoryRepository())
+	service := ports.NewTokenService(repo, testTokenOptions)
+	signed, err := service.SignToken(&models.User{Username: "alice", Role: models.RoleAdmin})
+	require.NoError(t, err)
+	token, err := jwt.Parse(signed, service.Keyfunc)
+	require.NoError(t, err)
+	kid := token.Header["kid"].(string)
+	jwks, err := service.JWKS()
+	require.NoError(t, err)
+	publicKey := jwkPublicKey(t, jwks, kid)
+
+	// Tokens of another issuer or audience, signed with the keys of the service
+	otherIssuer := testTokenOptions
+	otherIssuer.Issuer = "other-issuer"
+	otherAudience := testTokenOptions
+	otherAudience.Audience = "other-audience"
+	sign := func(options ports.TokenOptions) string {
+		signed, err := ports.NewTokenService(repo, options).SignToken(&models.User{Username: "alice", Role: models.RoleAdmin})
+		require.NoError(t, err)
+		return signed
+	}
+	// A token signed with the public key as an HMAC secret
+	confused := jwt.NewWithClaims(jwt.SigningMethodHS256, token.Claims)
+	confused.Header["kid"] = kid
+	confusedToken, err := confused.SignedString(publicKey.(*rsa.PublicKey).N.Bytes())
+	require.NoError(t, err)
+	// A token of the former shared secret
+	legacyToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"username": "alice", "role": models.RoleAdmin, "exp": time.Now().Add(time.Hour).Unix(),
+	}).SignedString(legacySecret)
+	require.NoError(t, err)
+	// A token of an unknown key
+	unknownKey := newTestSigningKey(t, "unknown", time.Now())
+	unknown := jwt.NewWithClaims(jwt.SigningMethodEdDSA, token.Claims)
+	unknown.Header["kid"] = unknownKey.KeyID
+	block, _ := pem.Decode([]byte(unknownKey.PrivateKey))
+	unknownPrivate, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	require.NoError(t, err)
+	unknownToken, err := unknown.SignedString(unknownPrivate)
+	require.NoError(t, err)
+
+	tests := []struct {
+		description string
+		token       string
+		expectValid bool
+	}{
+		{description: "Valid", token: signed, expectValid: true},
+		{description: "Other issuer", token: sign(otherIssuer)},
+		{description: "Other audience", token: sign(otherAudience)},
+		{description: "Algorithm confusion", token: confusedToken},
+		{description: "Shared secret", token: legacyToken},
+		{description: "Unknown key", token: unknownToken},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			_, err := jwt.Parse(test.token, service.Keyfunc)
+			if test.expectValid {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, ports.ErrInvalidToken)
+			}
+		})
+	}
+}
+
+func TestTokenKeyRotation(t *testing.T) {
+	repo := memory.NewMemorySigningKeyRepository(memory.NewMemoryRepository())
+	now := time.Now()
+	// retired signed until current was activated, more than a TTL ago
+	require.NoError(t, repo.CreateSigningKey(newTestSigningKey(t, "retired", now.Add(-5*time.Hour))))
+	require.NoError(t, repo.CreateSigningKey(newTestSigningKey(t, "current", now.Add(-2*time.Hour))))
+	service := ports.NewTokenService(repo, testTokenOptions)
+
+	require.NoError(t, service.RotateKeys())
+	keys, err := repo.GetSigningKeys()
+	require.NoError(t, err)
+	require.Len(t, keys, 2)
+	assert.Equal(t, "current", keys[0].KeyID)
+	next := keys[1]
+	assert.WithinDuration(t, now.Add(time.Hour), next.ActivatesAt, time.Minute)
+
+	// The next key is published before it signs
+	jwks, err := service.JWKS()
+	require.NoError(t, err)
+	assert.Len(t, jwks.Keys, 2)
+	signed, err := service.SignToken(&models.User{Username: "alice", Role: models.RoleUser})
+	require.NoError(t, err)
+	token, err := jwt.Parse(signed, service.Keyfunc)
+	require.NoError(t, err)
+	assert.Equal(t, "current", token.Header["kid"])
+
+	// The rotation is not repeated before the next interval
+	require.NoError(t, service.RotateKeys())
+	keys, err = repo.GetSigningKeys()
+	require.NoError(t, err)
+	assert.Len(t, keys, 2)
+
+	// The other instances read the new keys of the tokens they do not know
+	other := ports.NewTokenService(repo, testTokenOptions)
+	_, err = other.JWKS()
+	require.NoError(t, err)
+	require.NoError(t, repo.CreateSigningKey(newTestSigningKey(t, "newer", now.Add(-time.Minute))))
+	require.NoError(t, service.RotateKeys())
+	signed, err = service.SignToken(&models.User{Username: "alice", Role: models.RoleUser})
+	require.NoError(t, err)
+	time.Sleep(time.Second)
+	token, err = jwt.Parse(signed, other.Keyfunc)
+	require.NoError(t, err)
+	assert.Equal(t, "newer", token.Header["kid"])
+}
+
+func TestSigningKeysEncrypted(t *testing.T) {
+	repo := memory.NewMemorySigningKeyRepository(memory.NewMemoryRepository())
+	service := ports.NewTokenService(repo, testTokenOptions)
+	signed, err := service.SignToken(&models.User{Username: "alice", Role: models.RoleUser})
+	require.NoError(t, err)
+
+	keys, err := repo.GetSigningKeys()
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	block, _ := pem.Decode([]byte(keys[0].PrivateKey))
+	require.NotNil(t, block)
+	assert.Equal(t, "AES-256-GCM PRIVATE KEY", block.Type)
+	_, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	assert.Error(t, err)
+
+	// The keys are not read with another key encryption key, nor under another key ID
+	otherOptions := testTokenOptions
+	otherOptions.KeyEncryptionKey = []byte("fedcba9876543210fedcba9876543210")
+	_, err = jwt.Parse(signed, ports.NewTokenService(repo, otherOptions).Keyfunc)
+	assert.ErrorIs(t, err, ports.ErrInvalidToken)
+	swapped := keys[0]
+	swapped.ID = 0
+	swapped.KeyID = "swapped"
+	swappedRepo := memory.NewMemorySigningKeyRepository(memory.NewMemoryRepository())
+	require.NoError(t, swappedRepo.CreateSigningKey(swapped))
+	jwks, err := ports.NewTokenService(swappedRepo, testTokenOptions).JWKS()
+	require.NoError(t, err)
+	assert.Empty(t, jwks.Keys)
+
+	// No key is created without a valid key encryption key
+	noKeyOptions := testTokenOptions
+	noKeyOptions.KeyEncryptionKey = nil
+	_, err = ports.NewTokenService(memory.NewMemorySigningKeyRepository(memory.NewMemoryRepository()), noKeyOptions).
+		SignToken(&models.User{Username: "alice", Role: models.RoleUser})
+	assert.Error(t, err)
+}
+
+func TestJWKSRoute(t *testing.T) {
+	app, mocks := setupAppTestWithMocks()
+	mocks.productRepo.On("GetPage", mock.Anything).Return([]models.Product{}, int64(0), nil)
+	token, _, err := jwt.NewParser().ParseUnverified(generateMockJWT(), jwt.MapClaims{})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest("GET", "/.well-known/jwks.json", nil)
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+	assert.Equal(t, "public, max-age=300", resp.Header.Get(fiber.HeaderCacheControl))
+	var jwks models.JWKS
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&jwks))
+	jwkPublicKey(t, &jwks, token.Header["kid"].(string))
+
+	legacyToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"username": "mock_user", "role": models.RoleAdmin, "exp": time.Now().Add(time.Hour).Unix(),
+	}).SignedString(legacySecret)
+	require.NoError(t, err)
+	for token, expectStatus := range map[string]int{generateMockJWT(): fiber.StatusOK, legacyToken: fiber.StatusUnauthorized} {
+		status, _ := sendJSON(t, app, "GET", "/product", token, nil)
+		assert.Equal(t, expectStatus, status)
+	}
+}
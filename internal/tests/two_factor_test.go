@@ -0,0 +1,299 @@
+package tests
+
+import (
+	"crypto/sha256"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/WarisLi/Golang-mini-project/internal/adapters/memory"
+	"github.com/WarisLi/Golang-mini-project/internal/adapters/notifier"
+	"github.com/WarisLi/Golang-mini-project/internal/core/models"
+	"github.com/WarisLi/Golang-mini-project/internal/core/ports"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/joho/godotenv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestTOTP(t *testing.T) {
+	// Test vectors of RFC 6238 for SHA-1, the last 6 digits of the 8 digit codes
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ" // "12345678901234567890"
+	vectors := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1111111111: "050471",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+	for unix, expectCode := range vectors {
+		code, err := ports.TOTPCode(secret, ports.TOTPStep(time.Unix(unix, 0)))
+		require.NoError(t, err)
+		assert.Equal(t, expectCode, code, "time %d", unix)
+	}
+
+	now := time.Unix(1111111111, 0)
+	step := ports.TOTPStep(now)
+	previous, _ := ports.TOTPCode(secret, step-1)
+	next, _ := ports.TOTPCode(secret, step+1)
+	late, _ := ports.TOTPCode(secret, step+2)
+
+	acceptedStep, ok := ports.ValidateTOTP(secret, "050471", now, 0)
+	assert.True(t, ok)
+	assert.Equal(t, step, acceptedStep)
+	_, ok = ports.ValidateTOTP(secret, previous, now, 0)
+	assert.True(t, ok, "clock drift of one step")
+	_, ok = ports.ValidateTOTP(secret, next, now, 0)
+	assert.True(t, ok, "clock drift of one step")
+	_, ok = ports.ValidateTOTP(secret, late, now, 0)
+	assert.False(t, ok)
+	_, ok = ports.ValidateTOTP(secret, "050471", now, step)
+	assert.False(t, ok, "a code is accepted once")
+	_, ok = ports.ValidateTOTP(secret, "123", now, 0)
+	assert.False(t, ok)
+
+	uri, err := url.Parse(ports.TOTPURI("Mini Project", "alice", secret))
+	require.NoError(t, err)
+	assert.Equal(t, "otpauth", uri.Scheme)
+	assert.Equal(t, "totp", uri.Host)
+	assert.Equal(t, "/Mini Project:alice", uri.Path)
+	assert.Equal(t, secret, uri.Query().Get("secret"))
+	assert.Equal(t, "Mini Project", uri.Query().Get("issuer"))
+
+	newSecret, err := ports.NewTOTPSecret()
+	require.NoError(t, err)
+	assert.Len(t, newSecret, 32)
+}
+
+func totpCode(t *testing.T, secret string, step int64) string {
+	code, err := ports.TOTPCode(secret, step)
+	require.NoError(t, err)
+	return code
+}
+
+// loginChallenge logs admin in and returns the two-factor challenge.
+func loginChallenge(t *testing.T, app *fiber.App) models.TwoFactorChallenge {
+	var challenge models.TwoFactorChallenge
+	status := sendJSONTo(t, app, "POST", "/user/login", "", models.UsernamePassword{Username: "admin", Password: "Pass@12345"}, &challenge)
+	require.Equal(t, fiber.StatusOK, status)
+	require.NotEmpty(t, challenge.ChallengeToken)
+	return challenge
+}
+
+func TestTwoFactorLogin(t *testing.T) {
+	app := setupMemoryAppTest(t, memoryAppOptions{}).app
+	token := login(t, app, "admin")
+
+	// A challenge of a user without second factor does not log in without a code
+	challengeToken, err := testTokenService.SignChallenge(&models.User{Username: "admin"}, time.Minute)
+	require.NoError(t, err)
+	status, _ := sendJSON(t, app, "POST", "/user/login/2fa", "", models.TwoFactorLogin{ChallengeToken: challengeToken, Code: "000000"})
+	assert.Equal(t, fiber.StatusUnauthorized, status)
+
+	var enrollment models.TOTPEnrollment
+	status = sendJSONTo(t, app, "POST", "/user/2fa/totp", token, nil, &enrollment)
+	require.Equal(t, fiber.StatusOK, status)
+	assert.Contains(t, enrollment.URI, "secret="+enrollment.Secret)
+
+	// The authenticator is enabled once confirmed
+	status, _ = sendJSON(t, app, "POST", "/user/login", "", models.UsernamePassword{Username: "admin", Password: "Pass@12345"})
+	assert.Equal(t, fiber.StatusOK, status)
+	status, _ = sendJSON(t, app, "POST", "/user/2fa/totp/confirm", token, models.TOTPCode{Code: "000000"})
+	assert.Equal(t, fiber.StatusUnauthorized, status)
+
+	step := ports.TOTPStep(time.Now())
+	var recoveryCodes models.RecoveryCodes
+	status = sendJSONTo(t, app, "POST", "/user/2fa/totp/confirm", token, models.TOTPCode{Code: totpCode(t, enrollment.Secret, step)}, &recoveryCodes)
+	require.Equal(t, fiber.StatusOK, status)
+	require.Len(t, recoveryCodes.RecoveryCodes, 10)
+	status, _ = sendJSON(t, app, "POST", "/user/2fa/totp", token, nil)
+	assert.Equal(t, fiber.StatusConflict, status)
+
+	challenge := loginChallenge(t, app)
+	assert.False(t, challenge.Enroll)
+
+	// A challenge token is not an access token
+	status, _ = sendJSON(t, app, "GET", sessionURL, challenge.ChallengeToken, nil)
+	assert.Equal(t, fiber.StatusUnauthorized, status)
+
+	tests := []struct {
+		description  string
+		login        models.TwoFactorLogin
+		expectStatus int
+	}{
+		{description: "Invalid challenge", login: models.TwoFactorLogin{ChallengeToken: token, Code: totpCode(t, enrollment.Secret, step+1)}, expectStatus: fiber.StatusUnauthorized},
+		{description: "Wrong code", login: models.TwoFactorLogin{ChallengeToken: challenge.ChallengeToken, Code: "000000"}, expectStatus: fiber.StatusUnauthorized},
+		{description: "Code already used", login: models.TwoFactorLogin{ChallengeToken: challenge.ChallengeToken, Code: totpCode(t, enrollment.Secret, step)}, expectStatus: fiber.StatusUnauthorized},
+		{description: "Next code", login: models.TwoFactorLogin{ChallengeToken: challenge.ChallengeToken, Code: totpCode(t, enrollment.Secret, step+1)}, expectStatus: fiber.StatusOK},
+		{description: "Recovery code", login: models.TwoFactorLogin{ChallengeToken: challenge.ChallengeToken, Code: recoveryCodes.RecoveryCodes[0]}, expectStatus: fiber.StatusOK},
+		{description: "Recovery code already used", login: models.TwoFactorLogin{ChallengeToken: challenge.ChallengeToken, Code: recoveryCodes.RecoveryCodes[0]}, expectStatus: fiber.StatusUnauthorized},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			var success models.LoginSuccess
+			status := sendJSONTo(t, app, "POST", "/user/login/2fa", "", test.login, &success)
+			assert.Equal(t, test.expectStatus, status)
+			if test.expectStatus == fiber.StatusOK {
+				assert.Empty(t, success.RecoveryCodes)
+				status, _ := sendJSON(t, app, "GET", sessionURL, success.Token, nil)
+				assert.Equal(t, fiber.StatusOK, status)
+			}
+		})
+	}
+
+	// New recovery codes replace the previous ones
+	var newCodes models.RecoveryCodes
+	status = sendJSONTo(t, app, "POST", "/user/2fa/recovery-codes", token, models.TOTPCode{Code: recoveryCodes.RecoveryCodes[1]}, &newCodes)
+	require.Equal(t, fiber.StatusOK, status)
+	status, _ = sendJSON(t, app, "DELETE", "/user/2fa/totp", token, models.TOTPCode{Code: recoveryCodes.RecoveryCodes[2]})
+	assert.Equal(t, fiber.StatusUnauthorized, status)
+
+	// Recovery codes are accepted in upper case and without the dash
+	code := newCodes.RecoveryCodes[0]
+	status, _ = sendJSON(t, app, "DELETE", "/user/2fa/totp", token, models.TOTPCode{Code: code[:5] + code[6:]})
+	require.Equal(t, fiber.StatusOK, status)
+	status, response := sendJSON(t, app, "POST", "/user/login", "", models.UsernamePassword{Username: "admin", Password: "Pass@12345"})
+	assert.Equal(t, fiber.StatusOK, status)
+	assert.NotEmpty(t, response["token"])
+}
+
+func TestTwoFactorForgedChallenge(t *testing.T) {
+	app := setupMemoryAppTest(t, memoryAppOptions{user: ports.UserServiceOptions{TwoFactorRoles: []string{models.RoleAdmin}}}).app
+
+	// Challenge tokens of the former HMAC key, derived from an empty or a default JWT_SECRET
+	claims := jwt.MapClaims{"username": "admin", "ver": 0, "exp": time.Now().Add(time.Minute).Unix()}
+	var forged []string
+	for _, secret := range []string{"", "key"} {
+		key := sha256.Sum256([]byte("two-factor challenge:" + secret))
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(key[:])
+		require.NoError(t, err)
+		forged = append(forged, token)
+	}
+	// An access token of the user
+	accessToken, err := testTokenService.SignToken(&models.User{Username: "admin", Role: models.RoleAdmin})
+	require.NoError(t, err)
+	forged = append(forged, accessToken)
+
+	for _, token := range forged {
+		status, _ := sendJSON(t, app, "POST", "/user/login/2fa/enroll", "", models.TwoFactorEnrollChallenge{ChallengeToken: token})
+		assert.Equal(t, fiber.StatusUnauthorized, status)
+		status, _ = sendJSON(t, app, "POST", "/user/login/2fa", "", models.TwoFactorLogin{ChallengeToken: token, Code: "000000"})
+		assert.Equal(t, fiber.StatusUnauthorized, status)
+	}
+
+	// A challenge token is refused by the verifiers of the access tokens
+	challenge := loginChallenge(t, app)
+	_, err = jwt.Parse(challenge.ChallengeToken, testTokenService.Keyfunc)
+	assert.ErrorIs(t, err, ports.ErrInvalidToken)
+}
+
+func TestTwoFactorRequiredRole(t *testing.T) {
+	env := setupMemoryAppTest(t, memoryAppOptions{user: ports.UserServiceOptions{TwoFactorRoles: []string{models.RoleAdmin}}})
+	app, userAdminService := env.app, env.userAdminService
+
+	challenge := loginChallenge(t, app)
+	assert.True(t, challenge.Enroll)
+
+	status, _ := sendJSON(t, app, "POST", "/user/login/2fa", "", models.TwoFactorLogin{ChallengeToken: challenge.ChallengeToken, Code: "000000"})
+	assert.Equal(t, fiber.StatusConflict, status, "enroll first")
+
+	var enrollment models.TOTPEnrollment
+	status = sendJSONTo(t, app, "POST", "/user/login/2fa/enroll", "", models.TwoFactorEnrollChallenge{ChallengeToken: challenge.ChallengeToken}, &enrollment)
+	require.Equal(t, fiber.StatusOK, status)
+
+	var success models.LoginSuccess
+	code := totpCode(t, enrollment.Secret, ports.TOTPStep(time.Now()))
+	status = sendJSONTo(t, app, "POST", "/user/login/2fa", "", models.TwoFactorLogin{ChallengeToken: challenge.ChallengeToken, Code: code}, &success)
+	require.Equal(t, fiber.StatusOK, status)
+	assert.Len(t, success.RecoveryCodes, 10)
+
+	status, _ = sendJSON(t, app, "POST", "/user/login/2fa/enroll", "", models.TwoFactorEnrollChallenge{ChallengeToken: challenge.ChallengeToken})
+	assert.Equal(t, fiber.StatusConflict, status)
+	status, _ = sendJSON(t, app, "DELETE", "/user/2fa/totp", success.Token, models.TOTPCode{Code: success.RecoveryCodes[0]})
+	assert.Equal(t, fiber.StatusForbidden, status)
+
+	// After a reset by an administrator the user enrolls again
+	require.NoError(t, userAdminService.ResetTwoFactor("root", "admin"))
+	challenge = loginChallenge(t, app)
+	assert.True(t, challenge.Enroll)
+}
+
+func TestTwoFactorLockout(t *testing.T) {
+	app := setupMemoryAppTest(t, memoryAppOptions{user: ports.UserServiceOptions{MaxFailedLogins: 2, LockoutDuration: time.Hour}}).app
+	token := login(t, app, "admin")
+
+	var enrollment models.TOTPEnrollment
+	require.Equal(t, fiber.StatusOK, sendJSONTo(t, app, "POST", "/user/2fa/totp", token, nil, &enrollment))
+	code := totpCode(t, enrollment.Secret, ports.TOTPStep(time.Now()))
+	require.Equal(t, fiber.StatusOK, sendJSONTo(t, app, "POST", "/user/2fa/totp/confirm", token, models.TOTPCode{Code: code}, nil))
+
+	challenge := loginChallenge(t, app)
+	for _, expectStatus := range []int{fiber.StatusUnauthorized, fiber.StatusUnauthorized, fiber.StatusTooManyRequests} {
+		status, _ := sendJSON(t, app, "POST", "/user/login/2fa", "", models.TwoFactorLogin{ChallengeToken: challenge.ChallengeToken, Code: "000000"})
+		assert.Equal(t, expectStatus, status)
+	}
+
+	// The password does not reset the failed codes
+	status, _ := sendJSON(t, app, "POST", "/user/login", "", models.UsernamePassword{Username: "admin", Password: "Pass@12345"})
+	assert.Equal(t, fiber.StatusTooManyRequests, status)
+}
+
+func TestTwoFactorCodeConcurrentReuse(t *testing.T) {
+	require.NoError(t, godotenv.Load("../../.env"))
+
+	repo := memory.NewMemoryRepository()
+	userService := ports.NewUserService(memory.NewMemoryUserRepository(repo), memory.NewMemoryPasswordResetRepository(repo), notifier.NewLogNotifier(), testTokenService, ports.UserServiceOptions{
+		MaxFailedLogins: 100,
+		PasswordHash:    ports.PasswordHashOptions{BcryptCost: bcrypt.MinCost},
+	})
+	require.NoError(t, userService.RegisterUser(models.UsernamePassword{Username: "user_1", Password: "Pass@12345"}))
+	enrollment, err := userService.EnrollTOTP("user_1")
+	require.NoError(t, err)
+	step := ports.TOTPStep(time.Now())
+	recoveryCodes, err := userService.ConfirmTOTP("user_1", totpCode(t, enrollment.Secret, step))
+	require.NoError(t, err)
+
+	_, err = userService.LoginUser(models.UsernamePassword{Username: "user_1", Password: "Pass@12345"})
+	var challenge *ports.TwoFactorRequiredError
+	require.ErrorAs(t, err, &challenge)
+
+	tests := []struct {
+		description string
+		code        string
+	}{
+		{description: "Code of the authenticator", code: totpCode(t, enrollment.Secret, step+1)},
+		{description: "Recovery code", code: recoveryCodes[0]},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			// Parallel logins with the same code all check it before any use is recorded
+			const logins = 20
+			var wg sync.WaitGroup
+			var succeeded atomic.Int32
+			start := make(chan struct{})
+			for i := 0; i < logins; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					<-start
+					_, _, err := userService.LoginTwoFactor(models.TwoFactorLogin{ChallengeToken: challenge.ChallengeToken, Code: test.code})
+					if err == nil {
+						succeeded.Add(1)
+					} else {
+						assert.ErrorIs(t, err, ports.ErrInvalidTwoFactorCode)
+					}
+				}()
+			}
+			close(start)
+			wg.Wait()
+
+			assert.Equal(t, int32(1), succeeded.Load(), "the code is accepted once")
+		})
+	}
+}
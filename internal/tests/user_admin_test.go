@@ -0,0 +1,272 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/WarisLi/Golang-mini-project/internal/adapters/producer"
+	"github.com/WarisLi/Golang-mini-project/internal/config"
+	"github.com/WarisLi/Golang-mini-project/internal/core/models"
+	"github.com/WarisLi/Golang-mini-project/internal/core/ports"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetUsers(t *testing.T) {
+	app := setupMemoryAppTest(t, memoryAppOptions{}).app
+	adminToken := login(t, app, "admin")
+
+	tests := []struct {
+		description     string
+		url             string
+		expectStatus    int
+		expectUsernames []string
+	}{
+		{description: "All users", url: "/users", expectStatus: fiber.StatusOK, expectUsernames: []string{"admin", "alice"}},
+		{description: "Search", url: "/users?q=EXAMPLE.com", expectStatus: fiber.StatusOK, expectUsernames: []string{"alice"}},
+		{description: "Role", url: "/users?role=admin", expectStatus: fiber.StatusOK, expectUsernames: []string{"admin"}},
+		{description: "Enabled", url: "/users?disabled=false&page_size=1", expectStatus: fiber.StatusOK, expectUsernames: []string{"admin"}},
+		{description: "Disabled", url: "/users?disabled=true", expectStatus: fiber.StatusOK, expectUsernames: []string{}},
+		{description: "Unknown role", url: "/users?role=owner", expectStatus: fiber.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			req := httptest.NewRequest("GET", test.url, nil)
+			req.Header.Set("Authorization", "Bearer "+adminToken)
+			resp, err := app.Test(req)
+			require.NoError(t, err)
+
+			assert.Equal(t, test.expectStatus, resp.StatusCode)
+			if test.expectUsernames != nil {
+				var page models.Page[models.UserResponse]
+				require.NoError(t, json.NewDecoder(resp.Body).Decode(&page))
+				usernames := []string{}
+				for _, user := range page.Items {
+					usernames = append(usernames, user.Username)
+				}
+				assert.Equal(t, test.expectUsernames, usernames)
+			}
+		})
+	}
+}
+
+func TestGetUser(t *testing.T) {
+	app := setupMemoryAppTest(t, memoryAppOptions{}).app
+	adminToken := login(t, app, "admin")
+
+	req := httptest.NewRequest("GET", "/users/alice", nil)
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	var body map[string]interface{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	assert.Equal(t, "alice", body["username"])
+	assert.Equal(t, "alice@example.com", body["email"])
+	assert.Equal(t, models.RoleUser, body["role"])
+	assert.Equal(t, false, body["disabled"])
+	assert.NotContains(t, body, "password")
+
+	status, _ := sendJSON(t, app, "GET", "/users/missing", adminToken, nil)
+	assert.Equal(t, fiber.StatusNotFound, status)
+
+	// The user management is for administrators only
+	status, _ = sendJSON(t, app, "GET", "/users/alice", login(t, app, "alice"), nil)
+	assert.Equal(t, fiber.StatusUnauthorized, status)
+}
+
+func TestSetUserRole(t *testing.T) {
+	env := setupMemoryAppTest(t, memoryAppOptions{})
+	app, auditEvents := env.app, env.auditEvents
+	adminToken := login(t, app, "admin")
+	aliceToken := login(t, app, "alice")
+
+	tests := []struct {
+		description  string
+		username     string
+		role         string
+		expectStatus int
+	}{
+		{description: "Promote", username: "alice", role: models.RoleAdmin, expectStatus: fiber.StatusOK},
+		{description: "Unknown role", username: "alice", role: "owner", expectStatus: fiber.StatusBadRequest},
+		{description: "Unknown user", username: "missing", role: models.RoleUser, expectStatus: fiber.StatusNotFound},
+		{description: "Demote self", username: "admin", role: models.RoleUser, expectStatus: fiber.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			status, _ := sendJSON(t, app, "PUT", "/users/"+test.username+"/role", adminToken, models.UserRole{Role: test.role})
+			assert.Equal(t, test.expectStatus, status)
+		})
+	}
+
+	event := receiveAuditEvent(t, auditEvents)
+	assert.Equal(t, models.UserRoleChanged, event.Action)
+	assert.Equal(t, "alice", event.Username)
+	assert.Equal(t, "admin", event.Actor)
+	assert.Equal(t, models.RoleAdmin, event.Role)
+	assert.WithinDuration(t, time.Now(), event.Time, time.Minute)
+	assert.Empty(t, auditEvents, "refused changes are not audited")
+
+	// The tokens of the former role are signed out
+	status, _ := sendJSON(t, app, "GET", sessionURL, aliceToken, nil)
+	assert.Equal(t, fiber.StatusUnauthorized, status)
+	aliceToken = login(t, app, "alice")
+	status, _ = sendJSON(t, app, "GET", "/users", aliceToken, nil)
+	assert.Equal(t, fiber.StatusOK, status)
+
+	// A demoted administrator loses the admin routes at once
+	status, _ = sendJSON(t, app, "PUT", "/users/alice/role", adminToken, models.UserRole{Role: models.RoleUser})
+	require.Equal(t, fiber.StatusOK, status)
+	receiveAuditEvent(t, auditEvents)
+	status, _ = sendJSON(t, app, "GET", "/users", aliceToken, nil)
+	assert.Equal(t, fiber.StatusUnauthorized, status)
+}
+
+func TestDisableUser(t *testing.T) {
+	env := setupMemoryAppTest(t, memoryAppOptions{})
+	app, userService, auditEvents := env.app, env.userService, env.auditEvents
+	adminToken := login(t, app, "admin")
+	aliceToken := login(t, app, "alice")
+
+	status, _ := sendJSON(t, app, "POST", "/users/alice/disable", adminToken, nil)
+	require.Equal(t, fiber.StatusOK, status)
+	event := receiveAuditEvent(t, auditEvents)
+	assert.Equal(t, models.UserDisabled, event.Action)
+	assert.Equal(t, "alice", event.Username)
+
+	// Disabling twice changes nothing
+	status, _ = sendJSON(t, app, "POST", "/users/alice/disable", adminToken, nil)
+	assert.Equal(t, fiber.StatusOK, status)
+	assert.Empty(t, auditEvents)
+
+	status, _ = sendJSON(t, app, "GET", sessionURL, aliceToken, nil)
+	assert.Equal(t, fiber.StatusUnauthorized, status)
+	_, err := userService.LoginUser(models.UsernamePassword{Username: "alice", Password: "Pass@12345"})
+	assert.Error(t, err)
+
+	status, _ = sendJSON(t, app, "POST", "/users/admin/disable", adminToken, nil)
+	assert.Equal(t, fiber.StatusForbidden, status)
+
+	status, _ = sendJSON(t, app, "POST", "/users/alice/enable", adminToken, nil)
+	require.Equal(t, fiber.StatusOK, status)
+	event = receiveAuditEvent(t, auditEvents)
+	assert.Equal(t, models.UserEnabled, event.Action)
+
+	// The tokens issued before the user was disabled stay invalid
+	status, _ = sendJSON(t, app, "GET", sessionURL, aliceToken, nil)
+	assert.Equal(t, fiber.StatusUnauthorized, status)
+	status, _ = sendJSON(t, app, "GET", sessionURL, login(t, app, "alice"), nil)
+	assert.Equal(t, fiber.StatusOK, status)
+}
+
+func TestDeleteUser(t *testing.T) {
+	env := setupMemoryAppTest(t, memoryAppOptions{})
+	app, userService, auditEvents := env.app, env.userService, env.auditEvents
+	adminToken := login(t, app, "admin")
+	aliceToken := login(t, app, "alice")
+
+	status, _ := sendJSON(t, app, "DELETE", "/users/admin", adminToken, nil)
+	assert.Equal(t, fiber.StatusForbidden, status)
+
+	status, _ = sendJSON(t, app, "DELETE", "/users/alice", adminToken, nil)
+	require.Equal(t, fiber.StatusOK, status)
+	event := receiveAuditEvent(t, auditEvents)
+	assert.Equal(t, models.UserDeleted, event.Action)
+	assert.Equal(t, "alice", event.Username)
+	assert.Equal(t, "admin", event.Actor)
+
+	status, _ = sendJSON(t, app, "DELETE", "/users/alice", adminToken, nil)
+	assert.Equal(t, fiber.StatusNotFound, status)
+	status, _ = sendJSON(t, app, "GET", sessionURL, aliceToken, nil)
+	assert.Equal(t, fiber.StatusUnauthorized, status)
+
+	// The username can be registered again
+	assert.NoError(t, userService.RegisterUser(models.UsernamePassword{Username: "alice", Password: "Pass@12345"}))
+}
+
+func TestDeletedUserRegisteredAgain(t *testing.T) {
+	env := setupMemoryAppTest(t, memoryAppOptions{})
+	app := env.app
+	require.NoError(t, env.userService.CreateUser(models.UsernamePassword{Username: "bob", Password: "Pass@12345"}, models.RoleAdmin))
+	bobToken := login(t, app, "bob")
+	status, _ := sendJSON(t, app, "GET", "/users", bobToken, nil)
+	require.Equal(t, fiber.StatusOK, status)
+
+	status, _ = sendJSON(t, app, "DELETE", "/users/bob", login(t, app, "admin"), nil)
+	require.Equal(t, fiber.StatusOK, status)
+	status, _ = sendJSON(t, app, "POST", "/user", "", models.UsernamePassword{Username: "bob", Password: "Pass@12345"})
+	require.Equal(t, fiber.StatusCreated, status)
+
+	// The tokens of the deleted admin are not tokens of the new user
+	status, _ = sendJSON(t, app, "GET", "/users", bobToken, nil)
+	assert.Equal(t, fiber.StatusUnauthorized, status)
+	status, _ = sendJSON(t, app, "GET", sessionURL, bobToken, nil)
+	assert.Equal(t, fiber.StatusUnauthorized, status)
+	status, _ = sendJSON(t, app, "PUT", "/user/password", bobToken, models.ChangePassword{CurrentPassword: "Pass@12345", NewPassword: "Pass@67890"})
+	assert.Equal(t, fiber.StatusUnauthorized, status)
+
+	newToken := login(t, app, "bob")
+	status, _ = sendJSON(t, app, "GET", sessionURL, newToken, nil)
+	assert.Equal(t, fiber.StatusOK, status)
+	status, _ = sendJSON(t, app, "GET", "/users", newToken, nil)
+	assert.Equal(t, fiber.StatusUnauthorized, status)
+}
+
+func TestDeleteUserRolledBackWithItsEvent(t *testing.T) {
+	repos := config.NewMemoryRepositories()
+	require.NoError(t, repos.User.Create(models.User{Username: "bob", Password: "hash", Role: models.RoleUser}))
+	_, err := repos.APIKey.CreateAPIKey(models.APIKey{Username: "bob", Name: "ci", KeyID: "key-1", SecretHash: "hash"})
+	require.NoError(t, err)
+	userAdminService := ports.NewUserAdminService(repos.User, failingOutboxUnitOfWork{repos.UnitOfWork}, producer.NewChannelBus(10), repos.Outbox)
+
+	assert.Error(t, userAdminService.DeleteUser("admin", "bob"))
+
+	_, err = repos.User.GetUser("bob")
+	assert.NoError(t, err)
+	keys, err := repos.APIKey.GetUserAPIKeys("bob")
+	require.NoError(t, err)
+	assert.Len(t, keys, 1)
+}
+
+func TestRegisteredUserIsNotAdmin(t *testing.T) {
+	env := setupMemoryAppTest(t, memoryAppOptions{})
+	app, userService := env.app, env.userService
+	require.NoError(t, userService.RegisterUser(models.UsernamePassword{Username: "carol", Password: "Pass@12345"}))
+
+	status, _ := sendJSON(t, app, "GET", "/users", login(t, app, "carol"), nil)
+	assert.Equal(t, fiber.StatusUnauthorized, status)
+}
+
+func TestUserAdminRoutes(t *testing.T) {
+	app, mocks := setupAppTestWithMocks()
+	mocks.userRepo.On("GetUser", "plain_user").Return(&models.User{Username: "plain_user", Role: models.RoleUser}, nil)
+	mocks.userRepo.On("GetUsers", mock.Anything).Return([]models.User{{Username: "mock_user", Role: models.RoleAdmin}}, int64(1), nil)
+
+	signedUserToken := signTestToken(models.User{Username: "plain_user", Role: models.RoleUser})
+
+	tests := []struct {
+		description  string
+		token        string
+		expectStatus int
+	}{
+		{description: "Admin", token: generateMockJWT(), expectStatus: fiber.StatusOK},
+		{description: "User", token: signedUserToken, expectStatus: fiber.StatusUnauthorized},
+		{description: "No token", expectStatus: fiber.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			status, _ := sendJSON(t, app, "GET", "/users?page=1", test.token, nil)
+			assert.Equal(t, test.expectStatus, status)
+		})
+	}
+
+	mocks.userRepo.AssertCalled(t, "GetUsers", models.UserQuery{PageRequest: models.PageRequest{Page: 1, PageSize: models.DefaultPageSize}})
+}
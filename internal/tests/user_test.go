@@ -7,11 +7,17 @@ import (
 	"net/http/httptest"
 	"testing"
 
+	"github.com/WarisLi/Golang-mini-project/internal/adapters/memory"
+	"github.com/WarisLi/Golang-mini-project/internal/adapters/notifier"
+	"github.com/WarisLi/Golang-mini-project/internal/config"
 	"github.com/WarisLi/Golang-mini-project/internal/core/models"
+	"github.com/WarisLi/Golang-mini-project/internal/core/ports"
 	"github.com/gofiber/fiber/v2"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
 )
 
 func TestCreateUser(t *testing.T) {
@@ -101,3 +107,53 @@ func TestLoginUser(t *testing.T) {
 	}
 	mockUserRepo.AssertExpectations(t)
 }
+
+func TestCreateUserRole(t *testing.T) {
+	repo := memory.NewMemoryRepository()
+	userRepo := memory.NewMemoryUserRepository(repo)
+	userService := ports.NewUserService(userRepo, memory.NewMemoryPasswordResetRepository(repo), notifier.NewLogNotifier(), testTokenService,
+		ports.UserServiceOptions{PasswordHash: ports.PasswordHashOptions{BcryptCost: bcrypt.MinCost}})
+
+	// An unknown role leaves no user behind
+	err := userService.CreateUser(models.UsernamePassword{Username: "alice", Password: "Pass@12345"}, "bogus")
+	assert.ErrorIs(t, err, ports.ErrUnknownRole)
+	_, err = userRepo.GetUser("alice")
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+	require.NoError(t, userService.CreateUser(models.UsernamePassword{Username: "alice", Password: "Pass@12345"}, models.RoleAdmin))
+	require.NoError(t, userService.RegisterUser(models.UsernamePassword{Username: "bob", Password: "Pass@12345"}))
+	for username, expectRole := range map[string]string{"alice": models.RoleAdmin, "bob": models.RoleUser} {
+		user, err := userRepo.GetUser(username)
+		require.NoError(t, err)
+		assert.Equal(t, expectRole, user.Role)
+	}
+}
+
+func TestLoadSeedUser(t *testing.T) {
+	tests := []struct {
+		description    string
+		appEnv         string
+		password       string
+		expectPassword string
+	}{
+		{description: "Development", appEnv: "development", expectPassword: "Pass@12345"},
+		{description: "Production", appEnv: "production"},
+		{description: "APP_ENV unset", appEnv: ""},
+		{description: "Seed password", appEnv: "production", password: "Seed@12345", expectPassword: "Seed@12345"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			t.Setenv("APP_ENV", test.appEnv)
+			t.Setenv("SEED_PASSWORD", test.password)
+
+			user := config.LoadSeedUser()
+			if test.expectPassword == "" {
+				assert.Nil(t, user)
+				return
+			}
+			require.NotNil(t, user)
+			assert.Equal(t, test.expectPassword, user.Password)
+		})
+	}
+}
@@ -1,59 +1,298 @@
 package tests
 
 import (
-	"os"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"testing"
 	"time"
 
+	"github.com/WarisLi/Golang-mini-project/internal/adapters/cache"
 	"github.com/WarisLi/Golang-mini-project/internal/adapters/http"
+	"github.com/WarisLi/Golang-mini-project/internal/adapters/http/middleware"
+	"github.com/WarisLi/Golang-mini-project/internal/adapters/memory"
+	"github.com/WarisLi/Golang-mini-project/internal/adapters/notifier"
 	"github.com/WarisLi/Golang-mini-project/internal/adapters/producer"
+	"github.com/WarisLi/Golang-mini-project/internal/config"
+	"github.com/WarisLi/Golang-mini-project/internal/core/models"
 	"github.com/WarisLi/Golang-mini-project/internal/core/ports"
 	"github.com/WarisLi/Golang-mini-project/internal/tests/mocks"
 	"github.com/gofiber/fiber/v2"
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/joho/godotenv"
-	"gopkg.in/Shopify/sarama.v1"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
 )
 
+// testMocks holds the mocked secondary ports of the application under test.
+type testMocks struct {
+	productRepo     *mocks.MockProductRepository
+	productSearcher *mocks.MockProductSearcher
+	userRepo        *mocks.MockUserRepository
+	outboxRepo      *mocks.MockOutboxRepository
+	webhookRepo     *mocks.MockWebhookRepository
+	idempotencyRepo *mocks.MockIdempotencyRepository
+	passwordReset   *mocks.MockPasswordResetRepository
+	apiKeyRepo      *mocks.MockAPIKeyRepository
+	notifier        *mocks.MockNotifier
+	// productStream receives the product changes of the product service.
+	productStream ports.ProductStreamService
+}
+
 func setupAppTest() (*fiber.App, *mocks.MockProductRepository, *mocks.MockUserRepository) {
+	app, testMocks := setupAppTestWithMocks()
+	return app, testMocks.productRepo, testMocks.userRepo
+}
+
+func setupAppTestWithMocks() (*fiber.App, *testMocks) {
 	err := godotenv.Load("../../.env")
 	if err != nil {
 		panic(err)
 	}
 
 	app := fiber.New()
-	mockProductRepo := new(mocks.MockProductRepository)
-	mockUserRepo := new(mocks.MockUserRepository)
-
-	servers := []string{os.Getenv("KAFKA_SERVERS")}
-	saramaProducer, err := sarama.NewSyncProducer(servers, nil)
-	if err != nil {
-		panic(err)
+	testMocks := &testMocks{
+		productRepo:     new(mocks.MockProductRepository),
+		productSearcher: new(mocks.MockProductSearcher),
+		userRepo:        new(mocks.MockUserRepository),
+		outboxRepo:      new(mocks.MockOutboxRepository),
+		webhookRepo:     new(mocks.MockWebhookRepository),
+		idempotencyRepo: new(mocks.MockIdempotencyRepository),
+		passwordReset:   new(mocks.MockPasswordResetRepository),
+		apiKeyRepo:      new(mocks.MockAPIKeyRepository),
+		notifier:        new(mocks.MockNotifier),
+		productStream:   ports.NewProductStreamService(ports.ProductStreamOptions{HistorySize: 10, BufferSize: 10}),
 	}
-	defer saramaProducer.Close()
+	testMocks.outboxRepo.On("SaveEvent", mock.Anything).Return(uint(1), nil).Maybe()
+	testMocks.outboxRepo.On("MarkEventPublished", mock.Anything).Return(nil).Maybe()
+	// The session of the tokens of generateMockJWT
+	testMocks.userRepo.On("GetUser", "mock_user").Return(&models.User{Username: "mock_user", Role: models.RoleAdmin}, nil).Maybe()
 
-	eventProducer := producer.NewEventProducer(saramaProducer)
+	eventProducer := producer.NewChannelBus(100)
 
-	productService := ports.NewProductService(mockProductRepo, eventProducer)
+	unitOfWork := &mocks.MockUnitOfWork{Repositories: ports.TransactionRepositories{
+		Product:       testMocks.productRepo,
+		Outbox:        testMocks.outboxRepo,
+		User:          testMocks.userRepo,
+		PasswordReset: testMocks.passwordReset,
+		APIKey:        testMocks.apiKeyRepo,
+		Webhook:       testMocks.webhookRepo,
+	}}
+	productService := ports.NewProductService(testMocks.productRepo, unitOfWork,
+		producer.NewMultiProducer(eventProducer, testMocks.productStream), testMocks.outboxRepo,
+		ports.ProductServiceOptions{MaxBatchSize: 3})
 	productHandler := http.NewHttpProductHandler(productService)
 
-	userService := ports.NewUserService(mockUserRepo)
-	userHandler := http.NewHttpUserHandler(userService)
+	productSearchService := ports.NewProductSearchService(testMocks.productSearcher)
+	productSearchHandler := http.NewHttpProductSearchHandler(productSearchService)
+
+	userService := ports.NewUserService(testMocks.userRepo, testMocks.passwordReset, testMocks.notifier, testTokenService, ports.UserServiceOptions{})
+	userHandler := http.NewHttpUserHandler(userService, testCookieOptions)
+	tokenHandler := http.NewHttpTokenHandler(testTokenService)
+	oidcService := ports.NewOIDCService(testMocks.userRepo, memory.NewMemoryOIDCLoginRepository(memory.NewMemoryRepository()),
+		testTokenService, eventProducer, testMocks.outboxRepo, nil, ports.OIDCOptions{})
+	oidcHandler := http.NewHttpOIDCHandler(oidcService, testCookieOptions, "")
 
-	http.SetupRoutes(app, productHandler, userHandler)
+	userAdminService := ports.NewUserAdminService(testMocks.userRepo, unitOfWork, eventProducer, testMocks.outboxRepo)
+	userAdminHandler := http.NewHttpUserAdminHandler(userAdminService)
 
-	return app, mockProductRepo, mockUserRepo
+	apiKeyService := ports.NewAPIKeyService(testMocks.apiKeyRepo, testMocks.userRepo, eventProducer, testMocks.outboxRepo, ports.APIKeyOptions{})
+	apiKeyHandler := http.NewHttpAPIKeyHandler(apiKeyService)
+
+	outboxService := ports.NewOutboxService(testMocks.outboxRepo, eventProducer)
+	deadLetterHandler := http.NewHttpDeadLetterHandler(outboxService)
+
+	webhookService := ports.NewWebhookService(testMocks.webhookRepo, nil, ports.WebhookOptions{})
+	webhookHandler := http.NewHttpWebhookHandler(webhookService)
+
+	productStreamHandler := http.NewHttpProductStreamHandler(testMocks.productStream, userService, apiKeyService, 0)
+
+	idempotencyService := ports.NewIdempotencyService(testMocks.idempotencyRepo, ports.IdempotencyOptions{TTL: time.Hour, LockTimeout: time.Minute})
+
+	loginRateLimit, apiRateLimit := testRateLimits()
+	http.SetupRoutes(app, productHandler, productSearchHandler, userHandler, userAdminHandler, tokenHandler, oidcHandler, apiKeyHandler, deadLetterHandler, webhookHandler,
+		productStreamHandler, middleware.Idempotency(idempotencyService), loginRateLimit, apiRateLimit, middleware.APIKeyAuth(apiKeyService))
+
+	return app, testMocks
 }
 
-func generateMockJWT() string {
-	claims := jwt.MapClaims{
-		"username": "mock_user",
-		"role":     "admin",
-		"exp":      time.Now().Add(time.Hour * 72).Unix(),
+// testRateLimits returns the login and API rate limits of the apps under test,
+// high enough for the tests not to reach them.
+func testRateLimits() (fiber.Handler, fiber.Handler) {
+	rateLimiter := cache.NewMemoryRateLimiter()
+	loginRateLimit := middleware.RateLimit(rateLimiter,
+		middleware.RateLimitRule{Name: "login-ip", Limit: 1000, Window: time.Minute, Key: middleware.ClientIP})
+	apiRateLimit := middleware.RateLimit(rateLimiter,
+		middleware.RateLimitRule{Name: "api", Limit: 1000, Window: time.Minute, Key: middleware.AccessToken})
+	return loginRateLimit, apiRateLimit
+}
+
+// failingOutboxUnitOfWork runs the units of work of UnitOfWork with an outbox failing
+// to save the events, the writes of the units of work are then rolled back.
+type failingOutboxUnitOfWork struct {
+	ports.UnitOfWork
+}
+
+func (u failingOutboxUnitOfWork) Do(fn func(repos ports.TransactionRepositories) error) error {
+	return u.UnitOfWork.Do(func(repos ports.TransactionRepositories) error {
+		outboxRepo := new(mocks.MockOutboxRepository)
+		outboxRepo.On("SaveEvent", mock.Anything).Return(uint(0), errors.New("outbox down"))
+		repos.Outbox = outboxRepo
+		return fn(repos)
+	})
+}
+
+// sessionURL is a route of every signed-in user, the sessions of the tokens are checked on it.
+const sessionURL = "/user/api-keys"
+
+// memoryAppTest is the app of http.SetupRoutes on in-memory repositories, wired as
+// by the serve command, with the administrator "admin" and the user "alice", both
+// with the password Pass@12345.
+type memoryAppTest struct {
+	app              *fiber.App
+	repos            *config.Repositories
+	userService      ports.UserService
+	userAdminService ports.UserAdminService
+	// auditEvents receives the user audit events of the app.
+	auditEvents <-chan producer.Message
+}
+
+// memoryAppOptions are the options of the services of a memoryAppTest.
+type memoryAppOptions struct {
+	user   ports.UserServiceOptions
+	apiKey ports.APIKeyOptions
+	// notifier sends the notifications of the users, they are logged when nil.
+	notifier      ports.Notifier
+	oidcProviders map[string]ports.OIDCProvider
+}
+
+func setupMemoryAppTest(t *testing.T, options memoryAppOptions) *memoryAppTest {
+	require.NoError(t, godotenv.Load("../../.env"))
+
+	repos := config.NewMemoryRepositories()
+	if options.notifier == nil {
+		options.notifier = notifier.NewLogNotifier()
 	}
-	// Create token
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	options.user.PasswordHash = ports.PasswordHashOptions{BcryptCost: bcrypt.MinCost}
+	userService := ports.NewUserService(repos.User, repos.PasswordReset, options.notifier, testTokenService, options.user)
+	require.NoError(t, userService.CreateUser(models.UsernamePassword{Username: "admin", Password: "Pass@12345"}, models.RoleAdmin))
+	require.NoError(t, userService.RegisterUser(models.UsernamePassword{Username: "alice", Password: "Pass@12345", Email: "alice@example.com"}))
+
+	eventBus := producer.NewChannelBus(10)
+	auditEvents := eventBus.Subscribe(producer.TopicOf(models.UserAuditEvent{}))
+
+	webhookService := ports.NewWebhookService(repos.Webhook, nil, ports.WebhookOptions{})
+	productStreamService := ports.NewProductStreamService(ports.ProductStreamOptions{HistorySize: 10, BufferSize: 10})
+	productService := ports.NewProductService(repos.Product, repos.UnitOfWork,
+		producer.NewMultiProducer(eventBus, productStreamService), repos.Outbox, ports.ProductServiceOptions{})
+	productSearchService := ports.NewProductSearchService(repos.ProductSearcher)
+	oidcService := ports.NewOIDCService(repos.User, repos.OIDCLogin, testTokenService, eventBus, repos.Outbox,
+		options.oidcProviders, ports.OIDCOptions{})
+	userAdminService := ports.NewUserAdminService(repos.User, repos.UnitOfWork, eventBus, repos.Outbox)
+	apiKeyService := ports.NewAPIKeyService(repos.APIKey, repos.User, eventBus, repos.Outbox, options.apiKey)
+	outboxService := ports.NewOutboxService(repos.Outbox, eventBus)
+	idempotencyService := ports.NewIdempotencyService(repos.Idempotency, ports.IdempotencyOptions{TTL: time.Hour, LockTimeout: time.Minute})
 
-	// Generate encoded token and send it as response.
-	t, _ := token.SignedString([]byte(os.Getenv("JWT_SECRET")))
-	return t
+	app := fiber.New()
+	loginRateLimit, apiRateLimit := testRateLimits()
+	http.SetupRoutes(app,
+		http.NewHttpProductHandler(productService),
+		http.NewHttpProductSearchHandler(productSearchService),
+		http.NewHttpUserHandler(userService, testCookieOptions),
+		http.NewHttpUserAdminHandler(userAdminService),
+		http.NewHttpTokenHandler(testTokenService),
+		http.NewHttpOIDCHandler(oidcService, testCookieOptions, ""),
+		http.NewHttpAPIKeyHandler(apiKeyService),
+		http.NewHttpDeadLetterHandler(outboxService),
+		http.NewHttpWebhookHandler(webhookService),
+		// The sessions of the streams are checked often for the tests closing them
+		http.NewHttpProductStreamHandler(productStreamService, userService, apiKeyService, 50*time.Millisecond),
+		middleware.Idempotency(idempotencyService), loginRateLimit, apiRateLimit, middleware.APIKeyAuth(apiKeyService))
+
+	return &memoryAppTest{
+		app:              app,
+		repos:            repos,
+		userService:      userService,
+		userAdminService: userAdminService,
+		auditEvents:      auditEvents,
+	}
+}
+
+// sendJSON sends body to the app and returns the status code and the decoded response.
+func sendJSON(t *testing.T, app *fiber.App, method string, url string, token string, body interface{}) (int, map[string]string) {
+	response := map[string]string{}
+	status := sendJSONTo(t, app, method, url, token, body, &response)
+	return status, response
+}
+
+// sendJSONTo sends body to the app and decodes the response into response.
+func sendJSONTo(t *testing.T, app *fiber.App, method string, url string, token string, body interface{}, response interface{}) int {
+	var reqBody []byte
+	if body != nil {
+		reqBody, _ = json.Marshal(body)
+	}
+	req := httptest.NewRequest(method, url, bytes.NewReader(reqBody))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+
+	if response != nil {
+		json.NewDecoder(resp.Body).Decode(response)
+	}
+	return resp.StatusCode
+}
+
+// login logs username in with the password Pass@12345 and returns its token.
+func login(t *testing.T, app *fiber.App, username string) string {
+	status, response := sendJSON(t, app, "POST", "/user/login", "", models.UsernamePassword{Username: username, Password: "Pass@12345"})
+	require.Equal(t, fiber.StatusOK, status)
+	return response["token"]
+}
+
+// receiveAuditEvent returns the next audit event, the test fails without one.
+func receiveAuditEvent(t *testing.T, auditEvents <-chan producer.Message) models.UserAuditEvent {
+	select {
+	case msg := <-auditEvents:
+		var event models.UserAuditEvent
+		require.NoError(t, json.Unmarshal(msg.Value, &event))
+		return event
+	case <-time.After(time.Second):
+		require.FailNow(t, "no audit event")
+	}
+	return models.UserAuditEvent{}
+}
+
+// testTokenService signs and verifies the tokens of every app under test.
+var testTokenService = ports.NewTokenService(memory.NewMemorySigningKeyRepository(memory.NewMemoryRepository()), ports.TokenOptions{
+	Algorithm:        models.AlgorithmEdDSA,
+	Issuer:           "golang-mini-project",
+	Audience:         "golang-mini-project",
+	KeyEncryptionKey: testKeyEncryptionKey,
+})
+
+// testKeyEncryptionKey encrypts the signing keys of the token services under test.
+var testKeyEncryptionKey = []byte("0123456789abcdef0123456789abcdef")
+
+// testCookieOptions are the attributes of the token cookies of every app under test.
+var testCookieOptions = middleware.CookieOptions{
+	Secure:   true,
+	SameSite: fiber.CookieSameSiteLaxMode,
+	TTL:      time.Hour,
+}
+
+func generateMockJWT() string {
+	return signTestToken(models.User{Username: "mock_user", Role: models.RoleAdmin})
+}
+
+// signTestToken returns a token of the current session of user.
+func signTestToken(user models.User) string {
+	token, err := testTokenService.SignToken(&user)
+	if err != nil {
+		panic(err)
+	}
+	return token
 }
@@ -0,0 +1,205 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/WarisLi/Golang-mini-project/internal/adapters/webhook"
+	"github.com/WarisLi/Golang-mini-project/internal/config"
+	"github.com/WarisLi/Golang-mini-project/internal/core/models"
+	"github.com/WarisLi/Golang-mini-project/internal/core/ports"
+	"github.com/WarisLi/Golang-mini-project/internal/tests/mocks"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+const webhookSecret = "0123456789abcdef"
+
+func TestWebhookDelivery(t *testing.T) {
+	var signature, timestamp, eventType string
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		signature = r.Header.Get(ports.WebhookSignatureHeader)
+		timestamp = r.Header.Get(ports.WebhookTimestampHeader)
+		eventType = r.Header.Get(ports.WebhookEventHeader)
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	mockWebhookRepo := new(mocks.MockWebhookRepository)
+	subscribed := models.Webhook{Model: gorm.Model{ID: 1}, URL: server.URL, EventTypes: "ProductUpdatedEvent", Secret: webhookSecret, Active: true}
+	other := models.Webhook{Model: gorm.Model{ID: 2}, URL: server.URL, EventTypes: "ProductDeletedEvent", Secret: webhookSecret, Active: true}
+	mockWebhookRepo.On("GetActiveWebhooks").Return([]models.Webhook{subscribed, other}, nil)
+	mockWebhookRepo.On("SaveWebhookDelivery", mock.MatchedBy(func(delivery models.WebhookDelivery) bool {
+		return delivery.WebhookID == 1 && delivery.Success && delivery.StatusCode == http.StatusOK
+	})).Return(nil).Once()
+	mockWebhookRepo.On("GetWebhook", uint(1)).Return(&subscribed, nil)
+
+	webhookService := ports.NewWebhookService(mockWebhookRepo, webhook.NewHttpWebhookSender(time.Second), ports.WebhookOptions{MaxAttempts: 3})
+	event := models.ProductUpdatedEvent{ID: 1, Name: "Book A", Quantity: 10, Category: "Books"}
+	assert.NoError(t, webhookService.Produce(event))
+	webhookService.Wait()
+
+	assert.Equal(t, "ProductUpdatedEvent", eventType)
+	assert.Equal(t, ports.SignWebhook(webhookSecret, timestamp, body), signature)
+
+	var payload ports.WebhookPayload
+	assert.NoError(t, json.Unmarshal(body, &payload))
+	assert.Equal(t, "ProductUpdatedEvent", payload.Type)
+	assert.NotEmpty(t, payload.ID)
+	assert.JSONEq(t, `{"id":1,"name":"Book A","quantity":10,"category":"Books"}`, string(payload.Data))
+	mockWebhookRepo.AssertExpectations(t)
+}
+
+func TestWebhookDisabledAfterFailures(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	webhookRepo := config.NewMemoryRepositories().Webhook
+	id, err := webhookRepo.CreateWebhook(models.Webhook{URL: server.URL, EventTypes: models.WebhookAllEvents, Secret: webhookSecret, Active: true, FailureCount: 1})
+	require.NoError(t, err)
+
+	options := ports.WebhookOptions{MaxAttempts: 2, DisableAfter: 2}
+	webhookService := ports.NewWebhookService(webhookRepo, webhook.NewHttpWebhookSender(time.Second), options)
+	assert.NoError(t, webhookService.Produce(models.ProductDeletedEvent{ID: 1}))
+	webhookService.Wait()
+
+	// The retry of the failed attempt is kept in the delivery log
+	deliveries, err := webhookRepo.GetWebhookDeliveries(id)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	assert.NotNil(t, deliveries[0].RetryAt)
+	failing, err := webhookRepo.GetWebhook(id)
+	require.NoError(t, err)
+	assert.True(t, failing.Active)
+
+	// A restarted service retries it
+	restarted := ports.NewWebhookService(webhookRepo, webhook.NewHttpWebhookSender(time.Second), options)
+	assert.NoError(t, restarted.RetryDeliveries())
+	restarted.Wait()
+	assert.NoError(t, restarted.RetryDeliveries())
+	restarted.Wait()
+
+	assert.Equal(t, 2, attempts)
+	deliveries, err = webhookRepo.GetWebhookDeliveries(id)
+	require.NoError(t, err)
+	if assert.Len(t, deliveries, 2) {
+		assert.Equal(t, 2, deliveries[0].Attempt)
+		assert.Equal(t, http.StatusInternalServerError, deliveries[0].StatusCode)
+		assert.Nil(t, deliveries[0].RetryAt, "no retry after the last attempt")
+		assert.Nil(t, deliveries[1].RetryAt, "retry claimed")
+	}
+	failing, err = webhookRepo.GetWebhook(id)
+	require.NoError(t, err)
+	assert.False(t, failing.Active)
+	assert.NotNil(t, failing.DisabledAt)
+	assert.Equal(t, 2, failing.FailureCount)
+}
+
+func TestUpdateWebhookFailureCount(t *testing.T) {
+	webhookRepo := config.NewMemoryRepositories().Webhook
+	webhookService := ports.NewWebhookService(webhookRepo, webhook.NewHttpWebhookSender(time.Second), ports.WebhookOptions{})
+	id, err := webhookRepo.CreateWebhook(models.Webhook{URL: "https://partner.example.com/hooks", EventTypes: "*", Secret: webhookSecret, Active: true, FailureCount: 3})
+	require.NoError(t, err)
+
+	active, inactive := true, false
+	input := models.WebhookInput{URL: "https://partner.example.com/v2/hooks", EventTypes: []string{"*"}, Secret: webhookSecret}
+
+	// Editing an active webhook keeps its failure count
+	updated, err := webhookService.UpdateWebhook(id, input)
+	require.NoError(t, err)
+	assert.Equal(t, 3, updated.FailureCount)
+	input.Active = &active
+	updated, err = webhookService.UpdateWebhook(id, input)
+	require.NoError(t, err)
+	assert.Equal(t, 3, updated.FailureCount)
+
+	input.Active = &inactive
+	updated, err = webhookService.UpdateWebhook(id, input)
+	require.NoError(t, err)
+	assert.False(t, updated.Active)
+	assert.Equal(t, 3, updated.FailureCount)
+
+	// Enabling it again resets the count
+	input.Active = &active
+	updated, err = webhookService.UpdateWebhook(id, input)
+	require.NoError(t, err)
+	assert.True(t, updated.Active)
+	assert.Equal(t, 0, updated.FailureCount)
+	assert.Nil(t, updated.DisabledAt)
+}
+
+func TestCreateWebhook(t *testing.T) {
+	app, testMocks := setupAppTestWithMocks()
+	token := generateMockJWT()
+
+	created := models.Webhook{
+		Model:      gorm.Model{ID: 1},
+		URL:        "https://partner.example.com/hooks",
+		EventTypes: "ProductUpdatedEvent",
+		Secret:     webhookSecret,
+		Active:     true,
+	}
+	testMocks.webhookRepo.On("CreateWebhook", models.Webhook{
+		URL:        created.URL,
+		EventTypes: created.EventTypes,
+		Secret:     created.Secret,
+		Active:     true,
+	}).Return(uint(1), nil)
+	testMocks.webhookRepo.On("GetWebhook", uint(1)).Return(&created, nil)
+
+	tests := []struct {
+		description  string
+		requestBody  models.WebhookInput
+		expectStatus int
+	}{
+		{
+			description:  "Valid input",
+			requestBody:  models.WebhookInput{URL: created.URL, EventTypes: []string{"ProductUpdatedEvent"}, Secret: webhookSecret},
+			expectStatus: fiber.StatusCreated,
+		},
+		{
+			description:  "Invalid URL",
+			requestBody:  models.WebhookInput{URL: "partner", EventTypes: []string{"ProductUpdatedEvent"}, Secret: webhookSecret},
+			expectStatus: fiber.StatusBadRequest,
+		},
+		{
+			description:  "Missing event types",
+			requestBody:  models.WebhookInput{URL: created.URL, Secret: webhookSecret},
+			expectStatus: fiber.StatusBadRequest,
+		},
+		{
+			description:  "Short secret",
+			requestBody:  models.WebhookInput{URL: created.URL, EventTypes: []string{"ProductUpdatedEvent"}, Secret: "secret"},
+			expectStatus: fiber.StatusBadRequest,
+		},
+	}
+
+	// Run tests
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			reqBody, _ := json.Marshal(test.requestBody)
+			req := httptest.NewRequest("POST", "/webhook", bytes.NewReader(reqBody))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+			resp, _ := app.Test(req)
+
+			assert.Equal(t, test.expectStatus, resp.StatusCode)
+		})
+	}
+	testMocks.webhookRepo.AssertExpectations(t)
+}